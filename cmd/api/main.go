@@ -10,17 +10,28 @@ import (
 	"net/url"
 	"os"
 	"os/signal"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/JuanSaenz04/archiver/internal/api"
+	"github.com/JuanSaenz04/archiver/internal/auth"
+	"github.com/JuanSaenz04/archiver/internal/ingest"
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/queue"
+	"github.com/JuanSaenz04/archiver/internal/quota"
+	"github.com/JuanSaenz04/archiver/internal/retention"
+	"github.com/JuanSaenz04/archiver/internal/storage"
 	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/JuanSaenz04/archiver/internal/trash"
+	"github.com/JuanSaenz04/archiver/internal/watcher"
 	"github.com/labstack/echo/v5"
 	"github.com/redis/go-redis/v9"
 )
 
+const minSigningKeyLength = 32
+
 func main() {
 	level := slog.LevelInfo
 	switch strings.ToLower(strings.TrimSpace(os.Getenv("LOG_LEVEL"))) {
@@ -56,39 +67,124 @@ func run() error {
 		}
 	}()
 
-	if err := rdb.XGroupCreateMkStream(ctx, "crawl_stream", "worker_group", "$").Err(); err != nil && !redis.HasErrorPrefix(err, "BUSYGROUP") {
-		return fmt.Errorf("ensure redis stream/group: %w", err)
-	}
-
-	archivesDir := os.Getenv("ARCHIVES_DIR")
-	if archivesDir == "" {
-		return errors.New("environment variable ARCHIVES_DIR not set")
+	for _, priority := range models.Priorities {
+		if err := rdb.XGroupCreateMkStream(ctx, queue.StreamName(priority), "worker_group", "$").Err(); err != nil && !redis.HasErrorPrefix(err, "BUSYGROUP") {
+			return fmt.Errorf("ensure redis stream/group: %w", err)
+		}
 	}
 
-	sqliteDir := os.Getenv("SQLITE_DIR")
-	if sqliteDir == "" {
-		sqliteDir = archivesDir
+	archiveStorage, err := storage.FromEnv()
+	if err != nil {
+		return err
 	}
 
-	archiveStore, err := store.Open(filepath.Join(sqliteDir, "archive.db"))
+	archiveStore, err := store.FromEnv()
 	if err != nil {
-		return fmt.Errorf("open sqlite database: %w", err)
+		return fmt.Errorf("open database: %w", err)
 	}
 	defer func() {
 		if err := archiveStore.Close(); err != nil {
-			slog.Warn("failed to close sqlite database", "error", err)
+			slog.Warn("failed to close database", "error", err)
 		}
 	}()
 
 	if err := archiveStore.RunMigrations(); err != nil {
-		return fmt.Errorf("run sqlite migrations: %w", err)
+		return fmt.Errorf("run database migrations: %w", err)
 	}
 
-	if err := archiveStore.SyncFromDisk(ctx, archivesDir); err != nil {
-		return fmt.Errorf("sync sqlite database from disk: %w", err)
+	ingester := ingest.NewIngester(archiveStore, archiveStorage)
+
+	pendingCompletions := func(ctx context.Context) (map[string]bool, error) {
+		return queue.PendingCompletionFiles(ctx, rdb)
 	}
 
-	handler := api.NewHandler(rdb, archivesDir, archiveStore)
+	syncReport, err := archiveStore.SyncFromDisk(ctx, archiveStorage, store.SyncOptions{
+		ModifiedBefore: time.Now().Add(-store.SyncSettleTime),
+		Pending:        pendingCompletions,
+		Describe:       ingester.Describe,
+	})
+	if err != nil {
+		return fmt.Errorf("sync database from storage: %w", err)
+	}
+	slog.Info("database synced from storage",
+		"added", len(syncReport.Added),
+		"renamed", len(syncReport.Renamed),
+		"resized", len(syncReport.Resized),
+		"recovered", len(syncReport.Recovered),
+		"missing", len(syncReport.Missing),
+		"deferred", len(syncReport.Deferred),
+	)
+
+	retentionEnv := os.Getenv("TRASH_RETENTION_DAYS")
+	retentionDays, err := strconv.Atoi(retentionEnv)
+	if err != nil || retentionDays < 0 {
+		retentionDays = 30
+		slog.Debug("invalid TRASH_RETENTION_DAYS, using default", "value", retentionEnv, "default", retentionDays)
+	}
+	if retentionDays > 0 {
+		purger := trash.NewPurger(archiveStore, archiveStorage, time.Duration(retentionDays)*24*time.Hour)
+		go purger.Start(ctx)
+	} else {
+		slog.Info("trash purge disabled, trashed archives are kept until restored")
+	}
+
+	go retention.NewEnforcer(archiveStore, archiveStorage).Start(ctx)
+
+	if localStorage, ok := archiveStorage.(*storage.Local); ok {
+		w := watcher.NewWatcher(archiveStore, localStorage, ingester.Describe)
+		w.SetPending(pendingCompletions)
+		go w.Start(ctx)
+	}
+
+	// Workers sharing the database publish finished archives instead of
+	// writing them, keeping this process its only writer.
+	go func() {
+		if err := queue.StartCompletionConsumer(ctx, rdb, completionConsumerName(), ingester.RecordCompletion); err != nil {
+			slog.Error("archive completion consumer stopped", "error", err)
+		}
+	}()
+
+	storageQuota, err := quota.FromEnv()
+	if err != nil {
+		return err
+	}
+
+	crawlLimits, err := queue.LimitsFromEnv()
+	if err != nil {
+		return err
+	}
+
+	authMode, err := setUpAuth(ctx, archiveStore)
+	if err != nil {
+		return err
+	}
+
+	handler := api.NewHandler(rdb, archiveStorage, archiveStore)
+	handler.SetStorageQuota(storageQuota)
+	handler.SetCrawlLimits(crawlLimits)
+	handler.SetWorkerToken(os.Getenv("WORKER_TOKEN"))
+	switch authMode {
+	case "local":
+		handler.SetAuthEnabled(true)
+	case "proxy":
+		proxyAuth, err := api.ProxyAuthFromEnv()
+		if err != nil {
+			return err
+		}
+		if len(proxyAuth.AdminGroups) == 0 {
+			slog.Warn("proxy authentication is enabled but AUTH_ADMIN_GROUPS is not set, so no user is an administrator and the user, audit log and retention settings are unreachable")
+		}
+		handler.SetProxyAuth(proxyAuth)
+	}
+	signingKey, err := signingKeyFromEnv()
+	if err != nil {
+		return err
+	}
+	if signingKey != nil {
+		handler.SetSigningKey(signingKey)
+	} else {
+		slog.Warn("SIGNING_KEY is not set, replay and share links stop working when the api restarts and are only valid on the host that issued them")
+	}
 	appPublicURL, err := publicOriginFromEnv("APP_PUBLIC_URL")
 	if err != nil {
 		return err
@@ -125,7 +221,7 @@ func run() error {
 
 	errCh := make(chan error, 2)
 	go func() {
-		slog.Info("starting api server", "addr", ":1080", "public_url", appPublicURL, "archives_dir", archivesDir, "sqlite_dir", sqliteDir)
+		slog.Info("starting api server", "addr", ":1080", "public_url", appPublicURL)
 		if err := mainConfig.Start(ctx, mainServer); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			errCh <- fmt.Errorf("start api server: %w", err)
 		}
@@ -147,6 +243,61 @@ func run() error {
 	return nil
 }
 
+// setUpAuth reads AUTH_MODE and, for built-in authentication, creates the
+// administrator named by AUTH_ADMIN_USERNAME and AUTH_ADMIN_PASSWORD.
+func setUpAuth(ctx context.Context, archiveStore store.Store) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv("AUTH_MODE"))); mode {
+	case "", "none":
+		return "none", nil
+	case "proxy":
+		return mode, nil
+	case "local":
+	default:
+		return "", fmt.Errorf("invalid AUTH_MODE %q", mode)
+	}
+
+	username, password := os.Getenv("AUTH_ADMIN_USERNAME"), os.Getenv("AUTH_ADMIN_PASSWORD")
+	if (username == "") != (password == "") {
+		return "", errors.New("AUTH_ADMIN_USERNAME and AUTH_ADMIN_PASSWORD must be set together")
+	}
+	if username != "" {
+		if err := auth.EnsureAdmin(ctx, archiveStore, username, password); err != nil {
+			return "", fmt.Errorf("create administrator: %w", err)
+		}
+		return "local", nil
+	}
+
+	users, err := archiveStore.ListUsers(ctx)
+	if err != nil {
+		return "", fmt.Errorf("list users: %w", err)
+	}
+	if len(users) == 0 {
+		slog.Warn("built-in authentication is enabled but no users exist, set AUTH_ADMIN_USERNAME and AUTH_ADMIN_PASSWORD to create one")
+	}
+	return "local", nil
+}
+
+// signingKeyFromEnv reads SIGNING_KEY, which signs the links handed out to
+// the replay origin. Nil means none is configured.
+func signingKeyFromEnv() ([]byte, error) {
+	key := os.Getenv("SIGNING_KEY")
+	if key == "" {
+		return nil, nil
+	}
+	if len(key) < minSigningKeyLength {
+		return nil, fmt.Errorf("SIGNING_KEY must be at least %d characters long", minSigningKeyLength)
+	}
+	return []byte(key), nil
+}
+
+func completionConsumerName() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return "api"
+	}
+	return "api-" + hostname
+}
+
 func publicOriginFromEnv(name string) (string, error) {
 	value := strings.TrimSpace(os.Getenv(name))
 	if value == "" {
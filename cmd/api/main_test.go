@@ -2,8 +2,10 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/JuanSaenz04/archiver/internal/store"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -27,3 +29,53 @@ func TestPublicOriginFromEnv(t *testing.T) {
 		})
 	}
 }
+
+func TestSetUpAuth(t *testing.T) {
+	archiveStore, err := store.Open(filepath.Join(t.TempDir(), "archive.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = archiveStore.Close() })
+	require.NoError(t, archiveStore.RunMigrations())
+
+	t.Setenv("AUTH_MODE", "")
+	mode, err := setUpAuth(t.Context(), archiveStore)
+	require.NoError(t, err)
+	assert.Equal(t, "none", mode)
+
+	t.Setenv("AUTH_MODE", "Proxy")
+	mode, err = setUpAuth(t.Context(), archiveStore)
+	require.NoError(t, err)
+	assert.Equal(t, "proxy", mode)
+
+	t.Setenv("AUTH_MODE", "ldap")
+	_, err = setUpAuth(t.Context(), archiveStore)
+	assert.Error(t, err)
+
+	t.Setenv("AUTH_MODE", "local")
+	t.Setenv("AUTH_ADMIN_USERNAME", "admin")
+	_, err = setUpAuth(t.Context(), archiveStore)
+	assert.Error(t, err, "a username without a password should be rejected")
+
+	t.Setenv("AUTH_ADMIN_PASSWORD", "admin password")
+	mode, err = setUpAuth(t.Context(), archiveStore)
+	require.NoError(t, err)
+	assert.Equal(t, "local", mode)
+	admin, err := archiveStore.GetUserByUsername(t.Context(), "admin")
+	require.NoError(t, err)
+	assert.True(t, admin.IsAdmin)
+}
+
+func TestSigningKeyFromEnv(t *testing.T) {
+	t.Setenv("SIGNING_KEY", "")
+	key, err := signingKeyFromEnv()
+	require.NoError(t, err)
+	assert.Nil(t, key)
+
+	t.Setenv("SIGNING_KEY", "too-short")
+	_, err = signingKeyFromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("SIGNING_KEY", "0123456789abcdef0123456789abcdef")
+	key, err = signingKeyFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("0123456789abcdef0123456789abcdef"), key)
+}
@@ -7,13 +7,16 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/JuanSaenz04/archiver/internal/crawler"
+	"github.com/JuanSaenz04/archiver/internal/ingest"
 	"github.com/JuanSaenz04/archiver/internal/queue"
+	"github.com/JuanSaenz04/archiver/internal/quota"
+	"github.com/JuanSaenz04/archiver/internal/storage"
 	"github.com/JuanSaenz04/archiver/internal/store"
 	"github.com/JuanSaenz04/archiver/internal/worker"
 	"github.com/redis/go-redis/v9"
@@ -64,40 +67,77 @@ func run() error {
 		slog.Debug("invalid CRAWLER_TIMEOUT, using default", "value", timeoutEnv, "default", timeoutSeconds)
 	}
 
-	archivesDir := os.Getenv("ARCHIVES_DIR")
-	if archivesDir == "" {
-		return errors.New("environment variable ARCHIVES_DIR not set")
+	var sink crawler.Sink
+	if apiURL := os.Getenv("API_INTERNAL_URL"); apiURL != "" {
+		token := os.Getenv("WORKER_TOKEN")
+		if token == "" {
+			return errors.New("environment variable WORKER_TOKEN not set")
+		}
+		sink = ingest.NewClient(apiURL, token)
+		slog.Info("starting worker", "timeout_seconds", timeoutSeconds, "api_url", apiURL)
+	} else {
+		ingester, closeStore, err := newLocalIngester(ctx, rdb)
+		if err != nil {
+			return err
+		}
+		defer closeStore()
+		sink = ingester
+		slog.Info("starting worker", "timeout_seconds", timeoutSeconds)
 	}
 
-	sqliteDir := os.Getenv("SQLITE_DIR")
-	if sqliteDir == "" {
-		sqliteDir = archivesDir
-	}
+	crawler := crawler.NewCrawler(timeoutSeconds, sink)
+
+	consumerName := worker.GetWorkerName()
 
-	archiveStore, err := store.Open(filepath.Join(sqliteDir, "archive.db"))
+	workerOptions, err := queue.WorkerOptionsFromEnv()
 	if err != nil {
-		return fmt.Errorf("open sqlite database: %w", err)
+		return err
 	}
-	defer func() {
-		if err := archiveStore.Close(); err != nil {
-			slog.Warn("failed to close sqlite database", "error", err)
-		}
-	}()
 
-	if err := archiveStore.RunMigrations(); err != nil {
-		return fmt.Errorf("run sqlite migrations: %w", err)
+	slog.Info("consuming crawl jobs", "consumer", consumerName, "concurrency", max(workerOptions.Concurrency, 1), "max_per_host", workerOptions.MaxPerHost)
+
+	if err := queue.StartWorker(ctx, rdb, consumerName, workerOptions, crawler.Run); err != nil {
+		return fmt.Errorf("start worker: %w", err)
 	}
 
-	crawler := crawler.NewCrawler(timeoutSeconds, archiveStore)
+	slog.Info("worker stopped gracefully")
+	return nil
+}
 
-	slog.Info("starting worker", "timeout_seconds", timeoutSeconds, "archives_dir", archivesDir, "sqlite_dir", sqliteDir)
+// newLocalIngester stores archives from this process, which requires the
+// same archive storage and database as the API. The database is only read
+// here: migrations and new archives are left to the API, so SQLite never sees
+// two writers.
+func newLocalIngester(ctx context.Context, rdb *redis.Client) (*ingest.Ingester, func(), error) {
+	archiveStorage, err := storage.FromEnv()
+	if err != nil {
+		return nil, nil, err
+	}
 
-	consumerName := worker.GetWorkerName()
+	archiveStore, err := store.FromEnv()
+	if err != nil {
+		return nil, nil, fmt.Errorf("open database: %w", err)
+	}
+	closeStore := func() {
+		if err := archiveStore.Close(); err != nil {
+			slog.Warn("failed to close database", "error", err)
+		}
+	}
 
-	if err := queue.StartWorker(ctx, rdb, consumerName, crawler.Run); err != nil {
-		return fmt.Errorf("start worker: %w", err)
+	if err := archiveStore.WaitForMigrations(ctx, time.Second); err != nil {
+		closeStore()
+		return nil, nil, fmt.Errorf("wait for database migrations: %w", err)
 	}
 
-	slog.Info("worker stopped gracefully")
-	return nil
+	storageQuota, err := quota.FromEnv()
+	if err != nil {
+		closeStore()
+		return nil, nil, err
+	}
+
+	ingester := ingest.NewIngester(archiveStore, archiveStorage)
+	ingester.SetStorageQuota(storageQuota)
+	ingester.SetRecorder(queue.NewCompletionPublisher(rdb))
+
+	return ingester, closeStore, nil
 }
@@ -4,6 +4,7 @@ import {
 	Archive,
 	CalendarRange,
 	List,
+	LogOut,
 	Menu,
 	Moon,
 	Plus,
@@ -22,6 +23,12 @@ import {
 	DropdownMenuTrigger,
 } from "@/components/ui/dropdown-menu";
 import { useTheme } from "@/components/use-theme";
+import { useRuntimeConfig } from "@/lib/runtime-config";
+
+const signOut = async () => {
+	await fetch("/api/auth/logout", { method: "POST" });
+	window.location.reload();
+};
 
 const sectionFor = (path: string) =>
 	path === "/timeline"
@@ -34,6 +41,7 @@ export function AppShell() {
 	const section = sectionFor(path);
 	const [mobileJobsOpen, setMobileJobsOpen] = useState(false);
 	const { setTheme } = useTheme();
+	const canSignOut = useRuntimeConfig().auth_mode === "local";
 	return (
 		<div className="flex h-dvh min-h-dvh flex-col bg-background">
 			<header
@@ -71,6 +79,16 @@ export function AppShell() {
 							</Button>
 						</Link>
 						<ModeToggle />
+						{canSignOut && (
+							<Button
+								variant="ghost"
+								size="icon"
+								aria-label="Sign out"
+								onClick={() => void signOut()}
+							>
+								<LogOut className="size-4" />
+							</Button>
+						)}
 					</div>
 					<Link to="/create-archive">
 						<Button size="sm" className="gap-1.5">
@@ -129,6 +147,12 @@ export function AppShell() {
 										</DropdownMenuItem>
 									</DropdownMenuSubContent>
 								</DropdownMenuSub>
+								{canSignOut && (
+									<DropdownMenuItem onSelect={() => void signOut()}>
+										<LogOut className="size-4" />
+										Sign out
+									</DropdownMenuItem>
+								)}
 							</DropdownMenuContent>
 						</DropdownMenu>
 					</div>
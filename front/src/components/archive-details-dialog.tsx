@@ -1,4 +1,4 @@
-import type { Archive } from "@/models/archive";
+import type { Archive, Visibility } from "@/models/archive";
 import {
 	Dialog,
 	DialogContent,
@@ -21,11 +21,15 @@ import {
 	Check,
 	X,
 	AlertCircle,
+	Eye,
+	Bot,
 } from "lucide-react";
 import { useState } from "react";
 import { useMutation, useQueryClient } from "@tanstack/react-query";
 import { apiClient } from "@/lib/api";
 import { queryKeys } from "@/lib/queries";
+import { useRuntimeConfig } from "@/lib/runtime-config";
+import { ArchiveShareLinks } from "@/components/archive-share-links";
 import { toast } from "sonner";
 import { displayArchiveName, formatBytes, formatDateTime } from "@/lib/format";
 import {
@@ -39,6 +43,12 @@ import {
 	AlertDialogTitle,
 } from "@/components/ui/alert-dialog";
 
+const visibilityLabels: Record<Visibility, string> = {
+	private: "Private: only you",
+	shared: "Shared: every signed in user",
+	public: "Public: anyone with the link",
+};
+
 interface Props {
 	archive: Archive | null;
 	open: boolean;
@@ -55,10 +65,12 @@ export function ArchiveDetailsDialog({
 	onUpdated,
 }: Props) {
 	const queryClient = useQueryClient();
+	const { auth_enabled: authEnabled } = useRuntimeConfig();
 	const [isEditing, setIsEditing] = useState(false);
 	const [editName, setEditName] = useState("");
 	const [editDescription, setEditDescription] = useState("");
 	const [editTags, setEditTags] = useState("");
+	const [editVisibility, setEditVisibility] = useState<Visibility>("shared");
 	const [isDeleting, setIsDeleting] = useState(false);
 	const [error, setError] = useState<string | null>(null);
 	const [success, setSuccess] = useState<string | null>(null);
@@ -68,7 +80,12 @@ export function ArchiveDetailsDialog({
 			payload,
 		}: {
 			id: string;
-			payload: { name: string; description: string; tags: string[] };
+			payload: {
+				name: string;
+				description: string;
+				tags: string[];
+				visibility: Visibility;
+			};
 		}) => apiClient.put(`/archives/${id}`, payload),
 	});
 	const deleteArchive = useMutation({
@@ -82,6 +99,7 @@ export function ArchiveDetailsDialog({
 		setEditName(displayArchiveName(archive.name));
 		setEditDescription(archive.description || "");
 		setEditTags(archive.tags?.join(", ") || "");
+		setEditVisibility(archive.visibility || "shared");
 	};
 
 	const handleOpenChange = (nextOpen: boolean) => {
@@ -127,6 +145,7 @@ export function ArchiveDetailsDialog({
 				name: editName,
 				description: editDescription,
 				tags: parsedTags,
+				visibility: editVisibility,
 			};
 
 			await updateArchive.mutateAsync({ id: archive.id, payload });
@@ -136,6 +155,7 @@ export function ArchiveDetailsDialog({
 				name: editName,
 				description: editDescription,
 				tags: parsedTags,
+				visibility: editVisibility,
 			};
 
 			// Notify parent about the update
@@ -155,7 +175,9 @@ export function ArchiveDetailsDialog({
 		try {
 			await deleteArchive.mutateAsync(archive.id);
 			void queryClient.invalidateQueries({ queryKey: queryKeys.archives });
-			toast.success(`Archive "${displayArchiveName(archive.name)}" deleted`);
+			toast.success(
+				`Archive "${displayArchiveName(archive.name)}" moved to trash`,
+			);
 			onDeleted(archive.id);
 			onOpenChange(false);
 			setIsDeleting(false);
@@ -263,8 +285,22 @@ export function ArchiveDetailsDialog({
 									</Label>
 									<div className="text-sm">
 										{formatBytes(archive.size_bytes || 0)}
+										{archive.dedup_saved_bytes > 0 && (
+											<span className="text-muted-foreground">
+												{" "}
+												({formatBytes(archive.dedup_saved_bytes)} deduplicated)
+											</span>
+										)}
 									</div>
 								</div>
+								{archive.software && (
+									<div className="space-y-1">
+										<Label className="text-muted-foreground flex items-center gap-1">
+											<Bot className="size-3" /> Crawler
+										</Label>
+										<div className="text-sm">{archive.software}</div>
+									</div>
+								)}
 							</div>
 						)}
 
@@ -296,6 +332,39 @@ export function ArchiveDetailsDialog({
 							)}
 						</div>
 
+						{authEnabled && (
+							<div className="space-y-2">
+								<Label
+									htmlFor="archive-visibility"
+									className="text-muted-foreground flex items-center gap-1"
+								>
+									<Eye className="size-3" /> Visibility
+								</Label>
+								{isEditing ? (
+									<select
+										id="archive-visibility"
+										value={editVisibility}
+										onChange={(e) =>
+											setEditVisibility(e.target.value as Visibility)
+										}
+										className="border-input h-9 w-full rounded-md border bg-transparent px-3 text-sm shadow-xs outline-none focus-visible:border-ring focus-visible:ring-[3px] focus-visible:ring-ring/50 dark:bg-input/30"
+									>
+										{Object.entries(visibilityLabels).map(([value, label]) => (
+											<option key={value} value={value}>
+												{label}
+											</option>
+										))}
+									</select>
+								) : (
+									<p className="text-sm">
+										{visibilityLabels[archive.visibility || "shared"]}
+									</p>
+								)}
+							</div>
+						)}
+
+						{!isEditing && <ArchiveShareLinks archiveId={archive.id} />}
+
 						{error && (
 							<div className="flex items-center gap-2 text-sm text-destructive bg-destructive/10 p-2 rounded-md">
 								<AlertCircle className="size-4" />
@@ -362,15 +431,14 @@ export function ArchiveDetailsDialog({
 			<AlertDialog open={isDeleting} onOpenChange={setIsDeleting}>
 				<AlertDialogContent>
 					<AlertDialogHeader>
-						<AlertDialogTitle>Are you absolutely sure?</AlertDialogTitle>
+						<AlertDialogTitle>Move to trash?</AlertDialogTitle>
 						<AlertDialogDescription>
-							This action cannot be undone. This will permanently delete the
-							archive
+							This will move the archive
 							<span className="font-semibold text-foreground">
 								{" "}
 								{archive.name}{" "}
 							</span>
-							and remove all associated metadata.
+							to the trash. It can be restored until the trash is purged.
 						</AlertDialogDescription>
 					</AlertDialogHeader>
 					<AlertDialogFooter>
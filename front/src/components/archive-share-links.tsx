@@ -0,0 +1,131 @@
+import { useState } from "react";
+import { useMutation, useQuery, useQueryClient } from "@tanstack/react-query";
+import { Copy, Link2, Loader2, X } from "lucide-react";
+import { toast } from "sonner";
+import { apiClient } from "@/lib/api";
+import { formatDate } from "@/lib/format";
+import { shareLinksQueryOptions } from "@/lib/queries";
+import type { ShareLink } from "@/models/share";
+import { Button } from "@/components/ui/button";
+import { Input } from "@/components/ui/input";
+import { Label } from "@/components/ui/label";
+
+interface Props {
+	archiveId: string;
+}
+
+const copyLink = async (link: ShareLink) => {
+	try {
+		await navigator.clipboard.writeText(link.url);
+		toast.success("Share link copied");
+	} catch {
+		toast.error("Could not copy the share link");
+	}
+};
+
+// ArchiveShareLinks lists the links opening an archive without signing in,
+// and creates and revokes them.
+export function ArchiveShareLinks({ archiveId }: Props) {
+	const queryClient = useQueryClient();
+	const [name, setName] = useState("");
+	const [days, setDays] = useState("7");
+	const queryOptions = shareLinksQueryOptions(archiveId);
+	const { data: links = [], isLoading } = useQuery(queryOptions);
+	const refresh = () =>
+		queryClient.invalidateQueries({ queryKey: queryOptions.queryKey });
+	const createLink = useMutation({
+		mutationFn: () =>
+			apiClient.post<ShareLink>(`/archives/${archiveId}/share`, {
+				name,
+				expires_in_days: Number(days),
+			}),
+		onSuccess: (link) => {
+			setName("");
+			void refresh();
+			void copyLink(link);
+		},
+		onError: (err) =>
+			toast.error(err instanceof Error ? err.message : "Failed to share"),
+	});
+	const revokeLink = useMutation({
+		mutationFn: (id: string) =>
+			apiClient.delete(`/archives/${archiveId}/share/${id}`),
+		onSuccess: () => {
+			void refresh();
+			toast.success("Share link revoked");
+		},
+	});
+
+	return (
+		<div className="space-y-2">
+			<Label className="text-muted-foreground flex items-center gap-1">
+				<Link2 className="size-3" /> Share links
+			</Label>
+			<div className="flex gap-2">
+				<Input
+					value={name}
+					onChange={(e) => setName(e.target.value)}
+					placeholder="Recipient (optional)"
+				/>
+				<Input
+					type="number"
+					min={1}
+					max={365}
+					value={days}
+					onChange={(e) => setDays(e.target.value)}
+					className="w-20"
+					aria-label="Days until the link expires"
+				/>
+				<Button
+					variant="outline"
+					onClick={() => createLink.mutate()}
+					disabled={createLink.isPending}
+				>
+					{createLink.isPending ? (
+						<Loader2 className="size-4 animate-spin" />
+					) : (
+						"Share"
+					)}
+				</Button>
+			</div>
+			{isLoading ? (
+				<Loader2 className="size-4 animate-spin text-muted-foreground" />
+			) : links.length === 0 ? (
+				<p className="text-sm text-muted-foreground italic">
+					Not shared with anyone
+				</p>
+			) : (
+				<ul className="space-y-1">
+					{links.map((link) => (
+						<li key={link.id} className="flex items-center gap-2 text-sm">
+							<span className="min-w-0 flex-1 truncate">
+								{link.name || "Unnamed link"}
+								<span className="text-muted-foreground">
+									{" "}
+									· until {formatDate(link.expires_at)}
+								</span>
+							</span>
+							<Button
+								variant="ghost"
+								size="icon"
+								onClick={() => void copyLink(link)}
+								aria-label="Copy share link"
+							>
+								<Copy className="size-4" />
+							</Button>
+							<Button
+								variant="ghost"
+								size="icon"
+								onClick={() => revokeLink.mutate(link.id)}
+								disabled={revokeLink.isPending}
+								aria-label="Revoke share link"
+							>
+								<X className="size-4" />
+							</Button>
+						</li>
+					))}
+				</ul>
+			)}
+		</div>
+	);
+}
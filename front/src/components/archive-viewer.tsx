@@ -1,7 +1,9 @@
 import { useRef, useState } from "react";
+import { useQuery } from "@tanstack/react-query";
 import { ExternalLink, FileArchive, Loader2 } from "lucide-react";
 import type { Archive } from "@/models/archive";
 import { useRuntimeConfig } from "@/lib/runtime-config";
+import { archiveReplayQueryOptions } from "@/lib/queries";
 import { displayArchiveName, formatDateTime, hostname } from "@/lib/format";
 import { Button } from "@/components/ui/button";
 import { gsap, useGSAP } from "@/lib/motion";
@@ -12,6 +14,10 @@ export function ArchiveViewer({ archive }: Props) {
 	const { replay_origin: origin } = useRuntimeConfig();
 	const [loadedId, setLoadedId] = useState("");
 	const panel = useRef<HTMLElement>(null);
+	const { data: source, isError } = useQuery({
+		...archiveReplayQueryOptions(archive?.id ?? ""),
+		enabled: !!archive,
+	});
 	useGSAP(
 		() => {
 			const media = gsap.matchMedia();
@@ -43,9 +49,11 @@ export function ArchiveViewer({ archive }: Props) {
 				</div>
 			</section>
 		);
+	// The API tells where to load the archive from, as deduplicated captures
+	// replay through a collection and private ones need an access grant.
 	const viewerUrl = new URL("/viewer.html", origin);
-	viewerUrl.searchParams.set("source", `/archives/${archive.id}`);
-	const loading = loadedId !== archive.id;
+	if (source) viewerUrl.searchParams.set("source", source);
+	const loading = !isError && (!source || loadedId !== archive.id);
 	return (
 		<section
 			ref={panel}
@@ -86,14 +94,21 @@ export function ArchiveViewer({ archive }: Props) {
 						</span>
 					</div>
 				)}
-				<iframe
-					key={viewerUrl.toString()}
-					src={viewerUrl.toString()}
-					onLoad={() => setLoadedId(archive.id)}
-					className="h-full w-full border-0"
-          title={`Archive replay: ${displayArchiveName(archive.name)}`}
-          allow="fullscreen"
-				/>
+				{isError && (
+					<div className="absolute inset-0 z-10 grid place-items-center text-sm text-muted-foreground">
+						This capture could not be opened.
+					</div>
+				)}
+				{source && (
+					<iframe
+						key={viewerUrl.toString()}
+						src={viewerUrl.toString()}
+						onLoad={() => setLoadedId(archive.id)}
+						className="h-full w-full border-0"
+						title={`Archive replay: ${displayArchiveName(archive.name)}`}
+						allow="fullscreen"
+					/>
+				)}
 			</div>
 		</section>
 	);
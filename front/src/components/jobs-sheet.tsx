@@ -114,7 +114,10 @@ export function JobsSheet({
 										<StatusPill status={j.status} />
 									</div>
 									<div className="mt-3 flex justify-between font-mono text-[.68rem] text-muted-foreground">
-										<span>{compactId(j.id)}</span>
+										<span>
+											{compactId(j.id)}
+											{j.priority !== "normal" && ` · ${j.priority} priority`}
+										</span>
 										<time>{formatDateTime(j.created_at)}</time>
 									</div>
 								</article>
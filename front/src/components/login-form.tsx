@@ -0,0 +1,83 @@
+import { useState, type FormEvent } from "react";
+import { Archive } from "lucide-react";
+import { Button } from "@/components/ui/button";
+import { Input } from "@/components/ui/input";
+import { Label } from "@/components/ui/label";
+
+export function LoginForm() {
+	const [username, setUsername] = useState("");
+	const [password, setPassword] = useState("");
+	const [error, setError] = useState<string | null>(null);
+	const [pending, setPending] = useState(false);
+
+	const onSubmit = async (event: FormEvent<HTMLFormElement>) => {
+		event.preventDefault();
+		setPending(true);
+		setError(null);
+		try {
+			const response = await fetch("/api/auth/login", {
+				method: "POST",
+				headers: { "Content-Type": "application/json" },
+				body: JSON.stringify({ username, password }),
+			});
+			if (!response.ok) {
+				setError(
+					response.status === 401
+						? "Invalid username or password."
+						: "Unable to sign in. Try again later.",
+				);
+				return;
+			}
+			window.location.reload();
+		} catch {
+			setError("Unable to reach the server.");
+		} finally {
+			setPending(false);
+		}
+	};
+
+	return (
+		<main className="grid min-h-dvh place-items-center bg-background p-6">
+			<form
+				onSubmit={(event) => void onSubmit(event)}
+				className="flex w-full max-w-sm flex-col gap-4 rounded-lg border p-6"
+			>
+				<div className="flex items-center gap-2 font-semibold tracking-tight">
+					<span className="grid size-8 place-items-center rounded-md bg-primary text-primary-foreground">
+						<Archive className="size-4" />
+					</span>
+					Sign in to Archiver
+				</div>
+				<div className="flex flex-col gap-2">
+					<Label htmlFor="username">Username</Label>
+					<Input
+						id="username"
+						autoComplete="username"
+						value={username}
+						onChange={(event) => setUsername(event.target.value)}
+						required
+					/>
+				</div>
+				<div className="flex flex-col gap-2">
+					<Label htmlFor="password">Password</Label>
+					<Input
+						id="password"
+						type="password"
+						autoComplete="current-password"
+						value={password}
+						onChange={(event) => setPassword(event.target.value)}
+						required
+					/>
+				</div>
+				{error && (
+					<p role="alert" className="text-sm text-destructive">
+						{error}
+					</p>
+				)}
+				<Button type="submit" disabled={pending}>
+					Sign in
+				</Button>
+			</form>
+		</main>
+	);
+}
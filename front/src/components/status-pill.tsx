@@ -8,6 +8,7 @@ const variants = cva(
 				pending: "bg-warning/20 text-foreground",
 				running: "bg-info/20 text-foreground",
 				completed: "bg-success/20 text-foreground",
+				unchanged: "bg-muted text-muted-foreground",
 				failed: "bg-destructive/20 text-destructive",
 			},
 		},
@@ -22,7 +23,7 @@ export function StatusPill({
 	className?: string;
 }) {
 	const normalized = (
-		["pending", "running", "completed", "failed"] as const
+		["pending", "running", "completed", "unchanged", "failed"] as const
 	).includes(status as "pending")
 		? (status as VariantProps<typeof variants>["status"])
 		: "running";
@@ -1,10 +1,12 @@
 import { infiniteQueryOptions, queryOptions } from "@tanstack/react-query";
 import { apiClient } from "@/lib/api";
 import type {
+	GetArchiveReplayResponse,
 	GetArchivesResponse,
 	GetArchiveTagsResponse,
 } from "@/models/archive";
 import type { Job } from "@/models/job";
+import type { GetShareLinksResponse } from "@/models/share";
 
 type JobsResponse = Job[] | { jobs?: Job[] };
 
@@ -43,6 +45,31 @@ export const archiveTagsQueryOptions = queryOptions({
 	staleTime: 30_000,
 });
 
+// Replay sources carry an access grant valid for 12 hours, so they are
+// refreshed well before it expires.
+export const archiveReplayQueryOptions = (archiveId: string) =>
+	queryOptions({
+		queryKey: [...queryKeys.archives, archiveId, "replay"] as const,
+		queryFn: async () =>
+			(
+				await apiClient.get<GetArchiveReplayResponse>(
+					`/archives/${archiveId}/replay`,
+				)
+			).source,
+		staleTime: 60 * 60_000,
+	});
+
+export const shareLinksQueryOptions = (archiveId: string) =>
+	queryOptions({
+		queryKey: [...queryKeys.archives, archiveId, "share"] as const,
+		queryFn: async () =>
+			(
+				await apiClient.get<GetShareLinksResponse>(
+					`/archives/${archiveId}/share`,
+				)
+			).links,
+	});
+
 export const timelineArchivesQueryOptions = (from: Date, to: Date) => {
 	const params = new URLSearchParams({
 		from: from.toISOString(),
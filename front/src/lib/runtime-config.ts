@@ -2,6 +2,8 @@ import { createContext, useContext } from "react";
 
 export interface RuntimeConfig {
   replay_origin: string;
+  auth_enabled: boolean;
+  auth_mode: "none" | "local" | "proxy";
 }
 
 export const RuntimeConfigContext = createContext<RuntimeConfig | null>(null);
@@ -18,7 +20,23 @@ export async function loadRuntimeConfig(): Promise<RuntimeConfig> {
     throw new Error("Runtime configuration contains an invalid replay origin");
   }
 
-  return { replay_origin: replayOrigin.origin };
+  return {
+    replay_origin: replayOrigin.origin,
+    auth_enabled: config.auth_enabled === true,
+    auth_mode: config.auth_mode ?? "none",
+  };
+}
+
+// isSignedIn reports whether the browser holds a valid session.
+export async function isSignedIn(): Promise<boolean> {
+  const response = await fetch("/api/auth/me");
+  if (response.status === 401) {
+    return false;
+  }
+  if (!response.ok) {
+    throw new Error(`Failed to load the current user: ${response.status}`);
+  }
+  return true;
 }
 
 export function useRuntimeConfig(): RuntimeConfig {
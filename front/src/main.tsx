@@ -6,8 +6,9 @@ import { QueryClientProvider } from "@tanstack/react-query";
 
 // Import the generated route tree
 import { routeTree } from "./routeTree.gen";
-import { loadRuntimeConfig } from "./lib/runtime-config";
+import { isSignedIn, loadRuntimeConfig } from "./lib/runtime-config";
 import { RuntimeConfigProvider } from "./components/runtime-config-provider";
+import { LoginForm } from "./components/login-form";
 import { queryClient } from "./lib/query-client";
 
 // Create a new router instance
@@ -27,6 +28,14 @@ async function renderApp() {
   const root = ReactDOM.createRoot(rootElement);
   try {
     const config = await loadRuntimeConfig();
+    if (config.auth_mode === "local" && !(await isSignedIn())) {
+      root.render(
+        <StrictMode>
+          <LoginForm />
+        </StrictMode>,
+      );
+      return;
+    }
     root.render(
       <StrictMode>
         <QueryClientProvider client={queryClient}>
@@ -1,12 +1,23 @@
+export type Visibility = "private" | "shared" | "public";
+
 export interface Archive {
     id: string;
     name: string;
     filename: string;
     description: string;
     source_url: string;
+    subject: string;
     tags: string[];
     created_at: string;
     size_bytes: number;
+    dedup_saved_bytes: number;
+    content_hash: string;
+    software: string;
+    deleted_at?: string;
+    missing_at?: string;
+    owner_id?: string;
+    owner?: string;
+    visibility: Visibility;
 }
 
 export interface GetArchivesResponse {
@@ -14,6 +25,10 @@ export interface GetArchivesResponse {
 	next_cursor: string;
 }
 
+export interface GetArchiveReplayResponse {
+	source: string;
+}
+
 export interface GetArchiveTagsResponse {
 	tags: string[];
 }
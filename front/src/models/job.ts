@@ -1,8 +1,12 @@
+export type JobPriority = "high" | "normal" | "low";
+
 export interface Job {
     id: string;
     url: string;
     status: string;
     created_at: string;
+    owner?: string;
+    priority: JobPriority;
 }
 
 export type GetJobsResponse = Job[];
\ No newline at end of file
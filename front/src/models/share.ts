@@ -0,0 +1,13 @@
+export interface ShareLink {
+	id: string;
+	archive_id: string;
+	name: string;
+	created_by?: string;
+	created_at: string;
+	expires_at: string;
+	url: string;
+}
+
+export interface GetShareLinksResponse {
+	links: ShareLink[];
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v5"
+)
+
+const errArchiveChangeForbidden = "Only the owner of this archive can change it"
+
+func ownsArchive(user models.User, archive models.Archive) bool {
+	return archive.OwnerID != nil && *archive.OwnerID == user.ID
+}
+
+// canViewArchive applies the visibility of archive to the current user.
+// Everyone sees everything while authentication is disabled, and the
+// archive of a share link whatever its visibility.
+func (handler *Handler) canViewArchive(c *echo.Context, archive models.Archive) bool {
+	if shared, ok := currentSharedArchive(c); ok && shared.archiveId == archive.ID {
+		return true
+	}
+	if !handler.authEnabled || archive.Visibility == models.VisibilityPublic {
+		return true
+	}
+	user, ok := currentUser(c)
+	return ok && userCanView(user, archive)
+}
+
+func userCanView(user models.User, archive models.Archive) bool {
+	return user.IsAdmin || archive.Visibility != models.VisibilityPrivate || ownsArchive(user, archive)
+}
+
+// sharerCanView reports whether the creator of a share link may see
+// archive, which the link then opens along with the shared archive.
+func (handler *Handler) sharerCanView(c *echo.Context, link models.ShareLink, archive models.Archive) bool {
+	if !handler.authEnabled || archive.Visibility == models.VisibilityPublic {
+		return true
+	}
+	if link.CreatedBy == nil {
+		return false
+	}
+	creator, err := handler.archiveStore.GetUser(c.Request().Context(), *link.CreatedBy)
+	return err == nil && userCanView(creator, archive)
+}
+
+// archiveChangeDenied returns the error to respond with unless the current
+// user may change archive, which only its owner and administrators can.
+// Archives the user cannot see are reported as not found.
+func (handler *Handler) archiveChangeDenied(c *echo.Context, archive models.Archive) (int, string) {
+	if !handler.canViewArchive(c, archive) {
+		return http.StatusNotFound, errArchiveNotFound
+	}
+	if !handler.authEnabled {
+		return 0, ""
+	}
+	if user, ok := currentUser(c); ok && (user.IsAdmin || ownsArchive(user, archive)) {
+		return 0, ""
+	}
+	return http.StatusForbidden, errArchiveChangeForbidden
+}
+
+// archiveViewer is the ListArchivesOptions.Viewer of the current user, nil
+// when they may see every archive.
+func (handler *Handler) archiveViewer(c *echo.Context) *uuid.UUID {
+	if !handler.authEnabled {
+		return nil
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return &uuid.Nil
+	}
+	if user.IsAdmin {
+		return nil
+	}
+	return &user.ID
+}
+
+// getVisibleArchive loads a live archive, reporting archives the current
+// user may not see as not found.
+func (handler *Handler) getVisibleArchive(c *echo.Context, archiveId uuid.UUID) (models.Archive, error) {
+	archive, err := handler.archiveStore.Get(c.Request().Context(), archiveId)
+	if err == nil && !handler.canViewArchive(c, archive) {
+		return models.Archive{}, store.ErrArchiveNotFound
+	}
+	return archive, err
+}
+
+// getRestorableArchive loads a trashed archive, reporting archives the
+// current user may not restore as not found so the trash of other users
+// cannot be probed.
+func (handler *Handler) getRestorableArchive(c *echo.Context, archiveId uuid.UUID) (models.Archive, error) {
+	archive, err := handler.archiveStore.GetTrashed(c.Request().Context(), archiveId)
+	if err == nil {
+		if code, _ := handler.archiveChangeDenied(c, archive); code != 0 {
+			return models.Archive{}, store.ErrArchiveNotFound
+		}
+	}
+	return archive, err
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/auth"
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/storage"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveVisibility(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	archiveStore, _ := openArchiveStore(t)
+	archivesDir := t.TempDir()
+
+	require.NoError(t, auth.EnsureAdmin(t.Context(), archiveStore, "admin", "admin password"))
+	users := map[string]models.User{}
+	for _, username := range []string{"alice", "bob"} {
+		user, err := auth.NewUser(username, username+" password", false)
+		require.NoError(t, err)
+		require.NoError(t, archiveStore.InsertUser(t.Context(), user))
+		users[username] = user
+	}
+	alice := users["alice"]
+
+	fixture := func(name string, visibility models.Visibility) models.Archive {
+		archive := models.Archive{ID: uuid.New(), Name: name, Filename: name + ".wacz", OwnerID: &alice.ID, Visibility: visibility, CreatedAt: time.Now().UTC()}
+		require.NoError(t, os.WriteFile(filepath.Join(archivesDir, archive.Filename), []byte(name), 0644))
+		insertArchiveFixture(t, archiveStore, archive)
+		return archive
+	}
+	private := fixture("private", models.VisibilityPrivate)
+	shared := fixture("shared", models.VisibilityShared)
+	public := fixture("public", models.VisibilityPublic)
+
+	handler := NewHandler(rdb, storage.NewLocal(archivesDir), archiveStore)
+	handler.SetAuthEnabled(true)
+	e := echo.New()
+	handler.setMainRoutes(e, testRouteConfig, testFrontendFS)
+	replay := echo.New()
+	handler.setReplayRoutes(replay, testRouteConfig, testFrontendFS)
+
+	aliceCookie := login(t, e, "alice", "alice password")
+	bobCookie := login(t, e, "bob", "bob password")
+	adminCookie := login(t, e, "admin", "admin password")
+
+	listNames := func(cookie *http.Cookie) []string {
+		t.Helper()
+		rec := serveAuthRequest(e, http.MethodGet, "/api/archives", "", cookie)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var response archiveListResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		names := make([]string, 0, len(response.Archives))
+		for _, archive := range response.Archives {
+			names = append(names, archive.Name)
+		}
+		return names
+	}
+	replaySource := func(archiveId uuid.UUID, cookie *http.Cookie) string {
+		t.Helper()
+		rec := serveAuthRequest(e, http.MethodGet, "/api/archives/"+archiveId.String()+"/replay", "", cookie)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var response map[string]string
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		return response["source"]
+	}
+
+	t.Run("lists only visible archives", func(t *testing.T) {
+		assert.ElementsMatch(t, []string{"private", "shared", "public"}, listNames(aliceCookie))
+		assert.ElementsMatch(t, []string{"shared", "public"}, listNames(bobCookie))
+		assert.ElementsMatch(t, []string{"private", "shared", "public"}, listNames(adminCookie))
+
+		rec := serveAuthRequest(e, http.MethodGet, "/api/archives/"+private.ID.String()+"/replay", "", bobCookie)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("replay origin requires an access grant unless public", func(t *testing.T) {
+		for _, archive := range []models.Archive{private, shared} {
+			rec := serveAuthRequest(replay, http.MethodGet, "/archives/"+archive.ID.String(), "", nil)
+			assert.Equal(t, http.StatusNotFound, rec.Code, archive.Name)
+		}
+		rec := serveAuthRequest(replay, http.MethodGet, "/archives/"+public.ID.String(), "", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "public", rec.Body.String())
+	})
+
+	t.Run("access grants open the archive they were issued for", func(t *testing.T) {
+		source := replaySource(private.ID, aliceCookie)
+		require.True(t, strings.HasPrefix(source, "/archives/"+private.ID.String()+"?access="), source)
+		rec := serveAuthRequest(replay, http.MethodGet, source, "", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "private", rec.Body.String())
+
+		parsed, err := url.Parse(source)
+		require.NoError(t, err)
+		rec = serveAuthRequest(replay, http.MethodGet, "/archives/"+shared.ID.String()+"?"+parsed.RawQuery, "", nil)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		rec = serveAuthRequest(replay, http.MethodGet, source+"x", "", nil)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		expired := handler.replayAccess(private.ID, alice.ID, time.Now().Add(-time.Minute))
+		rec = serveAuthRequest(replay, http.MethodGet, "/archives/"+private.ID.String()+"?access="+url.QueryEscape(expired), "", nil)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("only administrators manage retention", func(t *testing.T) {
+		rule := `{"name":"purge","tag":"","max_age_days":1,"dry_run":false}`
+		rec := serveAuthRequest(e, http.MethodPost, "/api/retention/rules", rule, bobCookie)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		for _, target := range []string{"/api/retention/rules", "/api/retention/preview"} {
+			rec = serveAuthRequest(e, http.MethodGet, target, "", bobCookie)
+			assert.Equal(t, http.StatusForbidden, rec.Code, target)
+		}
+		rec = serveAuthRequest(e, http.MethodGet, "/api/retention/rules", "", adminCookie)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("only administrators read storage statistics", func(t *testing.T) {
+		for _, target := range []string{"/api/stats/storage", "/api/stats/dedup"} {
+			rec := serveAuthRequest(e, http.MethodGet, target, "", bobCookie)
+			assert.Equal(t, http.StatusForbidden, rec.Code, target)
+			rec = serveAuthRequest(e, http.MethodGet, target, "", adminCookie)
+			assert.Equal(t, http.StatusOK, rec.Code, target)
+		}
+	})
+
+	t.Run("only owners and administrators change archives", func(t *testing.T) {
+		rec := serveAuthRequest(e, http.MethodPut, "/api/archives/"+shared.ID.String(), `{"name":"renamed"}`, bobCookie)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		rec = serveAuthRequest(e, http.MethodDelete, "/api/archives/"+shared.ID.String(), "", bobCookie)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		rec = serveAuthRequest(e, http.MethodDelete, "/api/archives/"+private.ID.String(), "", bobCookie)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		rec = serveAuthRequest(e, http.MethodPut, "/api/archives/"+shared.ID.String(), `{"name":"shared","visibility":"secret"}`, aliceCookie)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		rec = serveAuthRequest(e, http.MethodPut, "/api/archives/"+shared.ID.String(), `{"name":"shared","visibility":"private"}`, aliceCookie)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.ElementsMatch(t, []string{"public"}, listNames(bobCookie))
+
+		rec = serveAuthRequest(e, http.MethodPut, "/api/archives/"+shared.ID.String(), `{"name":"shared","visibility":"shared"}`, adminCookie)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.ElementsMatch(t, []string{"shared", "public"}, listNames(bobCookie))
+
+		rec = serveAuthRequest(e, http.MethodDelete, "/api/archives/"+public.ID.String(), "", aliceCookie)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("trash lists only archives the user may restore", func(t *testing.T) {
+		rec := serveAuthRequest(e, http.MethodDelete, "/api/archives/"+shared.ID.String(), "", aliceCookie)
+		require.Equal(t, http.StatusNoContent, rec.Code)
+
+		trashNames := func(cookie *http.Cookie) []string {
+			t.Helper()
+			rec := serveAuthRequest(e, http.MethodGet, "/api/trash", "", cookie)
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			var response archiveListResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			names := make([]string, 0, len(response.Archives))
+			for _, archive := range response.Archives {
+				names = append(names, archive.Name)
+			}
+			return names
+		}
+		assert.Empty(t, trashNames(bobCookie))
+		assert.ElementsMatch(t, []string{"shared", "public"}, trashNames(aliceCookie))
+		assert.ElementsMatch(t, []string{"shared", "public"}, trashNames(adminCookie))
+
+		rec = serveAuthRequest(e, http.MethodPost, "/api/archives/"+shared.ID.String()+"/restore", "", bobCookie)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		rec = serveAuthRequest(e, http.MethodPost, "/api/archives/"+shared.ID.String()+"/restore", "", aliceCookie)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/queue"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/labstack/echo/v5"
+)
+
+const errSyncInProgress = "A storage sync is already running"
+
+type syncRequest struct {
+	DryRun        bool `json:"dry_run"`
+	RemoveMissing bool `json:"remove_missing"`
+}
+
+func (handler *Handler) HandleSyncStorage(c *echo.Context) error {
+	var request syncRequest
+	if err := c.Bind(&request); err != nil {
+		return respondWithError(http.StatusBadRequest, "Malformed request", c)
+	}
+
+	options := store.SyncOptions{
+		DryRun:         request.DryRun,
+		RemoveMissing:  request.RemoveMissing,
+		ModifiedBefore: time.Now().Add(-store.SyncSettleTime),
+		NoWait:         true,
+	}
+	if handler.ingester != nil {
+		options.Describe = handler.ingester.Describe
+	}
+	if handler.rdb != nil {
+		options.Pending = func(ctx context.Context) (map[string]bool, error) {
+			return queue.PendingCompletionFiles(ctx, handler.rdb)
+		}
+	}
+	report, err := handler.archiveStore.SyncFromDisk(c.Request().Context(), handler.storage, options)
+	if errors.Is(err, store.ErrSyncInProgress) {
+		return respondWithError(http.StatusConflict, errSyncInProgress, c)
+	}
+	if err != nil {
+		slog.Error("failed to sync database from storage", "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+
+	slog.Info("database synced from storage",
+		"dry_run", report.DryRun,
+		"added", len(report.Added),
+		"renamed", len(report.Renamed),
+		"resized", len(report.Resized),
+		"recovered", len(report.Recovered),
+		"missing", len(report.Missing),
+		"removed", len(report.Removed),
+		"deferred", len(report.Deferred),
+	)
+	if !report.DryRun {
+		handler.audit(c, auditStorageSync, "", nil, report)
+	}
+	return c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/storage"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func serveSyncRequest(t *testing.T, handler *Handler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/sync", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, handler.HandleSyncStorage(echo.New().NewContext(req, rec)))
+	return rec
+}
+
+func TestHandleSyncStorage(t *testing.T) {
+	archiveStore, _ := openArchiveStore(t)
+	archivesDir := t.TempDir()
+	handler := &Handler{archiveStore: archiveStore, storage: storage.NewLocal(archivesDir)}
+
+	archivePath := filepath.Join(archivesDir, "found.wacz")
+	assert.NoError(t, os.WriteFile(archivePath, []byte("archive"), 0644))
+	settled := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(archivePath, settled, settled))
+	assert.NoError(t, os.WriteFile(filepath.Join(archivesDir, "writing.wacz"), []byte("partial"), 0644))
+
+	rec := serveSyncRequest(t, handler, `{"dry_run":true}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var report store.SyncReport
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.True(t, report.DryRun)
+	if assert.Len(t, report.Added, 1, "recently modified files should wait for a later sync") {
+		assert.Equal(t, "found.wacz", report.Added[0].Filename)
+	}
+
+	archives, err := archiveStore.List(t.Context())
+	assert.NoError(t, err)
+	assert.Empty(t, archives, "a dry run should not register archives")
+
+	rec = serveSyncRequest(t, handler, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	archives, err = archiveStore.List(t.Context())
+	assert.NoError(t, err)
+	assert.Len(t, archives, 1)
+}
+
+func TestHandleSyncStorageRejectsConcurrentSyncs(t *testing.T) {
+	archiveStore, _ := openArchiveStore(t)
+	archivesDir := t.TempDir()
+	handler := &Handler{archiveStore: archiveStore, storage: storage.NewLocal(archivesDir)}
+	assert.NoError(t, os.WriteFile(filepath.Join(archivesDir, "copied.wacz"), []byte("wacz"), 0644))
+
+	// A sync started elsewhere, such as by the watcher, is still running.
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = archiveStore.SyncFromDisk(t.Context(), handler.storage, store.SyncOptions{
+			Describe: func(context.Context, string) (store.FileDetails, error) {
+				close(started)
+				<-unblock
+				return store.FileDetails{}, nil
+			},
+		})
+	}()
+	<-started
+	defer func() {
+		close(unblock)
+		<-done
+	}()
+
+	rec := serveSyncRequest(t, handler, "")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
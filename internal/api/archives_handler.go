@@ -6,25 +6,28 @@ import (
 	"errors"
 	"log/slog"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/storage"
 	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/JuanSaenz04/archiver/internal/trash"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v5"
 )
 
 const (
-	errArchiveNotFound     = "Archive not found"
-	errInternalServerError = "Internal server error"
-	errInvalidId           = "Invalid archive ID"
-	errInvalidArchiveQuery = "Invalid archive query"
-	defaultArchivePageSize = 30
-	maxArchivePageSize     = 100
+	errArchiveNotFound      = "Archive not found"
+	errInternalServerError  = "Internal server error"
+	errInvalidId            = "Invalid archive ID"
+	errInvalidArchiveQuery  = "Invalid archive query"
+	errArchiveFilenameTaken = "Another archive already uses this filename"
+	errInvalidVisibility    = "Visibility must be private, shared or public"
+	errReferencesTrashed    = "Restore the archives this archive replays payloads from first"
+	defaultArchivePageSize  = 30
+	maxArchivePageSize      = 100
 )
 
 func (handler *Handler) HandleGetArchives(c *echo.Context) error {
@@ -32,6 +35,7 @@ func (handler *Handler) HandleGetArchives(c *echo.Context) error {
 	if err != nil {
 		return respondWithError(http.StatusBadRequest, errInvalidArchiveQuery, c)
 	}
+	options.Viewer = handler.archiveViewer(c)
 
 	page, err := handler.archiveStore.ListArchives(c.Request().Context(), options)
 	if err != nil {
@@ -55,7 +59,7 @@ func (handler *Handler) HandleGetArchives(c *echo.Context) error {
 }
 
 func (handler *Handler) HandleGetArchiveTags(c *echo.Context) error {
-	tags, err := handler.archiveStore.ListTags(c.Request().Context())
+	tags, err := handler.archiveStore.ListTags(c.Request().Context(), handler.archiveViewer(c))
 	if err != nil {
 		slog.Error("failed to list archive tags", "error", err)
 		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
@@ -66,8 +70,9 @@ func (handler *Handler) HandleGetArchiveTags(c *echo.Context) error {
 func archiveListOptions(request *http.Request) (store.ListArchivesOptions, error) {
 	query := request.URL.Query()
 	options := store.ListArchivesOptions{
-		Tags:   uniqueNonEmpty(query["tag"]),
-		Search: strings.TrimSpace(query.Get("q")),
+		Tags:        uniqueNonEmpty(query["tag"]),
+		Search:      strings.TrimSpace(query.Get("q")),
+		ContentHash: strings.ToLower(strings.TrimSpace(query.Get("content_hash"))),
 	}
 
 	fromValue, toValue := query.Get("from"), query.Get("to")
@@ -157,77 +162,191 @@ func (handler *Handler) HandleGetArchive(c *echo.Context) error {
 		return respondWithError(http.StatusBadRequest, errInvalidId, c)
 	}
 
-	filename, err := handler.archiveStore.GetFilename(c.Request().Context(), archiveId)
+	archive, err := handler.getVisibleArchive(c, archiveId)
 	if err != nil {
-		if errors.Is(err, store.ErrArchiveNotFound) {
+		return handler.respondWithArchiveLookupError(c, archiveId, err)
+	}
+	filename := archive.Filename
+
+	ctx := c.Request().Context()
+	info, err := handler.storage.Stat(ctx, filename)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotExist) {
 			return respondWithError(http.StatusNotFound, errArchiveNotFound, c)
-		} else {
-			return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
 		}
+		slog.Error("failed to stat archive file", "archive_id", archiveId, "filename", filename, "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
 	}
 
-	err = c.FileFS(filename, echo.NewDefaultFS(handler.archivesDir))
-	if err != nil {
-		return respondWithError(http.StatusNotFound, errArchiveNotFound, c)
+	// The hash is only trusted while the file still has the recorded size;
+	// the next storage sync recomputes it otherwise.
+	if archive.ContentHash != "" && info.Size == archive.SizeBytes {
+		c.Response().Header().Set("ETag", `"`+archive.ContentHash+`"`)
 	}
 
+	content := storage.NewReadSeeker(ctx, handler.storage, filename, info.Size)
+	defer content.Close()
+
+	http.ServeContent(c.Response(), c.Request(), filename, info.ModTime, content)
 	return nil
 }
 
+// HandleGetArchiveCollection describes a deduplicated archive as a
+// multi-WACZ collection, so replay can resolve revisit records against the
+// archives that store their payloads.
+func (handler *Handler) HandleGetArchiveCollection(c *echo.Context) error {
+	archiveId, err := uuid.Parse(c.Param("archiveId"))
+	if err != nil {
+		return respondWithError(http.StatusBadRequest, errInvalidId, c)
+	}
+
+	archive, err := handler.getVisibleArchive(c, archiveId)
+	if err != nil {
+		return handler.respondWithArchiveLookupError(c, archiveId, err)
+	}
+
+	referencedIds, err := handler.archiveStore.ListReferencedArchiveIDs(c.Request().Context(), archiveId)
+	if err != nil {
+		slog.Error("failed to list referenced archives", "archive_id", archiveId, "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+
+	archives := []models.Archive{archive}
+	if len(referencedIds) > 0 {
+		page, err := handler.archiveStore.ListArchives(c.Request().Context(), store.ListArchivesOptions{IDs: referencedIds})
+		if err != nil {
+			slog.Error("failed to load referenced archives", "archive_id", archiveId, "error", err)
+			return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+		}
+		archives = append(archives, page.Archives...)
+	}
+
+	// Payloads held by archives the viewer cannot see are left unresolved
+	// rather than exposed through this one. A share link covers those its
+	// creator could see.
+	shared, isShared := currentSharedArchive(c)
+	resources := make([]map[string]any, 0, len(archives))
+	for _, resource := range archives {
+		path := handler.replayPath(c, resource.ID, "")
+		if isShared {
+			if resource.ID != shared.archiveId && !handler.sharerCanView(c, shared.link, resource) {
+				continue
+			}
+			path = handler.sharePath(shared.link, resource.ID, "")
+		} else if !handler.canViewArchive(c, resource) {
+			continue
+		}
+		resources = append(resources, map[string]any{
+			"name":  resource.Filename,
+			"path":  path,
+			"bytes": resource.SizeBytes,
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"profile":   "multi-wacz-package",
+		"resources": resources,
+	})
+}
+
+// HandleDeleteArchive moves an archive to the trash. Its file is kept under
+// the storage backend's .trash prefix until it is restored or purged.
 func (handler *Handler) HandleDeleteArchive(c *echo.Context) error {
 	archiveId, err := uuid.Parse(c.Param("archiveId"))
 	if err != nil {
 		return respondWithError(http.StatusBadRequest, errInvalidId, c)
 	}
 
-	filename, err := handler.archiveStore.GetFilename(c.Request().Context(), archiveId)
+	archive, err := handler.archiveStore.Get(c.Request().Context(), archiveId)
 	if err != nil {
-		if errors.Is(err, store.ErrArchiveNotFound) {
+		return handler.respondWithArchiveLookupError(c, archiveId, err)
+	}
+	if code, message := handler.archiveChangeDenied(c, archive); code != 0 {
+		return respondWithError(code, message, c)
+	}
+	filename := archive.Filename
+
+	err = trash.Move(c.Request().Context(), handler.archiveStore, handler.storage, archiveId, filename, time.Now().UTC())
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotExist), errors.Is(err, store.ErrArchiveNotFound):
 			return respondWithError(http.StatusNotFound, errArchiveNotFound, c)
+		case errors.Is(err, store.ErrArchiveReferenced):
+			return respondWithError(http.StatusConflict, "Archive stores payloads replayed by other archives", c)
 		}
+
+		slog.Error("failed to move archive to trash", "archive_id", archiveId, "filename", filename, "error", err)
 		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
 	}
 
-	path := filepath.Join(handler.archivesDir, filename)
+	slog.Info("archive moved to trash", "archive_id", archiveId, "filename", filename)
+	handler.audit(c, auditArchiveDelete, archiveId.String(), archive, nil)
 
-	tmpDir, err := os.MkdirTemp(handler.archivesDir, "archiver")
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (handler *Handler) HandleGetTrash(c *echo.Context) error {
+	// Only the archives the user could restore: their own, or all of them
+	// for administrators.
+	options := store.ListArchivesOptions{Trashed: true, Owner: handler.archiveViewer(c)}
+	page, err := handler.archiveStore.ListArchives(c.Request().Context(), options)
 	if err != nil {
-		slog.Error("failed to create temporary directory for delete", "filename", filename, "error", err)
+		slog.Error("failed to list trashed archives", "error", err)
 		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
 	}
+	return c.JSON(http.StatusOK, map[string]any{"archives": page.Archives})
+}
+
+func (handler *Handler) HandleRestoreArchive(c *echo.Context) error {
+	archiveId, err := uuid.Parse(c.Param("archiveId"))
+	if err != nil {
+		return respondWithError(http.StatusBadRequest, errInvalidId, c)
+	}
 
-	tempArchiveName := filepath.Join(tmpDir, filename)
+	archive, err := handler.getRestorableArchive(c, archiveId)
+	if err != nil {
+		return handler.respondWithArchiveLookupError(c, archiveId, err)
+	}
 
-	if err := os.Rename(path, tempArchiveName); err != nil {
-		if errors.Is(err, os.ErrNotExist) {
+	ctx := c.Request().Context()
+	trashKey := trash.Key(archiveId)
+
+	if err := handler.storage.Rename(ctx, trashKey, archive.Filename); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrExist):
+			return respondWithError(http.StatusConflict, errArchiveFilenameTaken, c)
+		case errors.Is(err, storage.ErrNotExist):
 			return respondWithError(http.StatusNotFound, errArchiveNotFound, c)
 		}
 
-		slog.Error("failed to move archive to temporary location", "filename", filename, "path", path, "temp_path", tempArchiveName, "error", err)
+		slog.Error("failed to move archive out of trash", "filename", archive.Filename, "trash_key", trashKey, "error", err)
 		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
 	}
 
-	err = handler.archiveStore.Delete(c.Request().Context(), archiveId)
-	if err != nil {
-		if rollbackErr := os.Rename(tempArchiveName, path); rollbackErr != nil {
-			slog.Error("failed to rollback archive file after delete error", "filename", filename, "temp_path", tempArchiveName, "path", path, "error", rollbackErr)
+	if err := handler.archiveStore.Restore(ctx, archiveId); err != nil {
+		if rollbackErr := handler.storage.Rename(ctx, archive.Filename, trashKey); rollbackErr != nil {
+			slog.Error("failed to rollback archive file after restore error", "filename", archive.Filename, "trash_key", trashKey, "error", rollbackErr)
 		}
 
-		if errors.Is(err, store.ErrArchiveNotFound) {
+		switch {
+		case errors.Is(err, store.ErrArchiveNotFound):
 			return respondWithError(http.StatusNotFound, errArchiveNotFound, c)
+		case errors.Is(err, store.ErrArchiveFilenameConflict):
+			return respondWithError(http.StatusConflict, errArchiveFilenameTaken, c)
+		case errors.Is(err, store.ErrReferencedArchiveTrashed):
+			return respondWithError(http.StatusConflict, errReferencesTrashed, c)
 		}
 
-		slog.Error("failed to delete archive metadata", "filename", filename, "error", err)
+		slog.Error("failed to restore archive metadata", "filename", archive.Filename, "error", err)
 		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
 	}
 
-	if err := os.RemoveAll(tmpDir); err != nil {
-		slog.Warn("failed to remove temporary directory after delete", "filename", filename, "tmp_dir", tmpDir, "error", err)
-	}
-
-	slog.Info("archive deleted", "filename", filename)
+	slog.Info("archive restored from trash", "archive_id", archiveId, "filename", archive.Filename)
 
-	return c.NoContent(http.StatusNoContent)
+	restored := archive
+	restored.DeletedAt = nil
+	handler.audit(c, auditArchiveRestore, archiveId.String(), archive, restored)
+	return c.JSON(http.StatusOK, restored)
 }
 
 func (handler *Handler) HandleModifyArchiveMetadata(c *echo.Context) error {
@@ -241,6 +360,17 @@ func (handler *Handler) HandleModifyArchiveMetadata(c *echo.Context) error {
 	if err != nil {
 		return respondWithError(http.StatusBadRequest, errInvalidId, c)
 	}
+	if newArchive.Visibility != "" && !newArchive.Visibility.Valid() {
+		return respondWithError(http.StatusBadRequest, errInvalidVisibility, c)
+	}
+
+	archive, err := handler.archiveStore.Get(c.Request().Context(), archiveId)
+	if err != nil {
+		return handler.respondWithArchiveLookupError(c, archiveId, err)
+	}
+	if code, message := handler.archiveChangeDenied(c, archive); code != 0 {
+		return respondWithError(code, message, c)
+	}
 
 	err = handler.archiveStore.UpdateMetadata(c.Request().Context(), archiveId, newArchive.Name, newArchive.Description, newArchive.Tags)
 	if err != nil {
@@ -252,7 +382,26 @@ func (handler *Handler) HandleModifyArchiveMetadata(c *echo.Context) error {
 		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
 	}
 
+	if newArchive.Visibility != "" && newArchive.Visibility != archive.Visibility {
+		if err := handler.archiveStore.UpdateVisibility(c.Request().Context(), archiveId, newArchive.Visibility); err != nil {
+			if errors.Is(err, store.ErrArchiveNotFound) {
+				return respondWithError(http.StatusNotFound, errArchiveNotFound, c)
+			}
+
+			slog.Error("failed to change archive visibility", "archive_id", archiveId, "visibility", newArchive.Visibility, "error", err)
+			return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+		}
+		slog.Info("archive visibility changed", "archive_id", archiveId, "visibility", newArchive.Visibility)
+	}
+
 	slog.Info("archive renamed", "archive_id", archiveId, "new_name", newArchive.Name)
 
+	updated, err := handler.archiveStore.Get(c.Request().Context(), archiveId)
+	if err != nil {
+		slog.Warn("failed to reload updated archive", "archive_id", archiveId, "error", err)
+		updated = archive
+	}
+	handler.audit(c, auditArchiveUpdate, archiveId.String(), archive, updated)
+
 	return c.NoContent(http.StatusNoContent)
 }
@@ -2,7 +2,9 @@ package api
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,7 +18,9 @@ import (
 	"time"
 
 	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/storage"
 	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/JuanSaenz04/archiver/internal/trash"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v5"
 	"github.com/stretchr/testify/assert"
@@ -317,7 +321,7 @@ func TestHandleGetArchive(t *testing.T) {
 			CreatedAt:   time.Now().UTC(),
 		})
 
-		handler := &Handler{archivesDir: tempDir, archiveStore: archiveStore}
+		handler := &Handler{storage: storage.NewLocal(tempDir), archiveStore: archiveStore}
 		e := echo.New()
 		req := httptest.NewRequest(http.MethodGet, "/api/archives/"+archiveID.String(), nil)
 		rec := httptest.NewRecorder()
@@ -342,6 +346,56 @@ func TestHandleGetArchive(t *testing.T) {
 		}
 	})
 
+	t.Run("ContentHashETag", func(t *testing.T) {
+		tempDir := t.TempDir()
+		archiveStore, _ := openArchiveStore(t)
+		archiveID := uuid.New()
+		content := []byte("hashed wacz content")
+		sum := sha256.Sum256(content)
+		contentHash := hex.EncodeToString(sum[:])
+
+		if err := os.WriteFile(filepath.Join(tempDir, "hashed.wacz"), content, 0644); err != nil {
+			t.Fatalf("write archive file: %v", err)
+		}
+		insertArchiveFixture(t, archiveStore, models.Archive{
+			ID:          archiveID,
+			Name:        "Hashed",
+			Filename:    "hashed.wacz",
+			CreatedAt:   time.Now().UTC(),
+			SizeBytes:   int64(len(content)),
+			ContentHash: contentHash,
+		})
+
+		handler := &Handler{storage: storage.NewLocal(tempDir), archiveStore: archiveStore}
+		e := echo.New()
+		serve := func(ifNoneMatch string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, "/archives/"+archiveID.String(), nil)
+			if ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", ifNoneMatch)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetPathValues([]echo.PathValue{{Name: "archiveId", Value: archiveID.String()}})
+			assert.NoError(t, handler.HandleGetArchive(c))
+			return rec
+		}
+
+		rec := serve("")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `"`+contentHash+`"`, rec.Header().Get("ETag"))
+
+		rec = serve(`"` + contentHash + `"`)
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+
+		// A file changed since it was hashed gets no ETag until resynced.
+		if err := os.WriteFile(filepath.Join(tempDir, "hashed.wacz"), []byte("replaced"), 0644); err != nil {
+			t.Fatalf("replace archive file: %v", err)
+		}
+		rec = serve(`"` + contentHash + `"`)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("ETag"))
+	})
+
 	t.Run("InvalidID", func(t *testing.T) {
 		handler := &Handler{}
 		e := echo.New()
@@ -359,7 +413,7 @@ func TestHandleGetArchive(t *testing.T) {
 		tempDir := t.TempDir()
 		archiveStore, _ := openArchiveStore(t)
 		archiveID := uuid.New()
-		handler := &Handler{archivesDir: tempDir, archiveStore: archiveStore}
+		handler := &Handler{storage: storage.NewLocal(tempDir), archiveStore: archiveStore}
 		e := echo.New()
 		req := httptest.NewRequest(http.MethodGet, "/api/archives/"+archiveID.String(), nil)
 		rec := httptest.NewRecorder()
@@ -384,7 +438,7 @@ func TestHandleGetArchive(t *testing.T) {
 			CreatedAt:   time.Now().UTC(),
 		})
 
-		handler := &Handler{archivesDir: tempDir, archiveStore: archiveStore}
+		handler := &Handler{storage: storage.NewLocal(tempDir), archiveStore: archiveStore}
 		e := echo.New()
 		req := httptest.NewRequest(http.MethodGet, "/api/archives/"+archiveID.String(), nil)
 		rec := httptest.NewRecorder()
@@ -417,7 +471,7 @@ func TestHandleDeleteArchive(t *testing.T) {
 			CreatedAt:   time.Now().UTC(),
 		})
 
-		handler := &Handler{archivesDir: tempDir, archiveStore: archiveStore}
+		handler := &Handler{storage: storage.NewLocal(tempDir), archiveStore: archiveStore}
 		e := echo.New()
 		req := httptest.NewRequest(http.MethodDelete, "/api/archives/"+archiveID.String(), nil)
 		rec := httptest.NewRecorder()
@@ -428,8 +482,41 @@ func TestHandleDeleteArchive(t *testing.T) {
 			assert.Equal(t, http.StatusNoContent, rec.Code)
 
 			_, statErr := os.Stat(filePath)
-			assert.True(t, errors.Is(statErr, os.ErrNotExist), "file should be deleted")
+			assert.True(t, errors.Is(statErr, os.ErrNotExist), "file should be moved out of the archives directory")
+			assert.FileExists(t, filepath.Join(tempDir, filepath.FromSlash(trash.Key(archiveID))))
 			assert.Equal(t, 0, countArchiveByName(t, archiveStore, "Delete Me"))
+
+			trashed, err := archiveStore.GetTrashed(context.Background(), archiveID)
+			if assert.NoError(t, err) {
+				assert.NotNil(t, trashed.DeletedAt)
+			}
+		}
+	})
+
+	t.Run("ReferencedByDeduplicatedArchive", func(t *testing.T) {
+		tempDir := t.TempDir()
+		archiveStore, _ := openArchiveStore(t)
+		original := models.Archive{ID: uuid.New(), Name: "Original", Filename: "original.wacz", CreatedAt: time.Now().UTC()}
+		revisit := models.Archive{ID: uuid.New(), Name: "Revisit", Filename: "revisit.wacz", CreatedAt: time.Now().UTC()}
+		insertArchiveFixture(t, archiveStore, original)
+		insertArchiveFixture(t, archiveStore, revisit)
+		assert.NoError(t, archiveStore.RegisterPayloads(context.Background(), revisit.ID, nil, []uuid.UUID{original.ID}))
+		filePath := filepath.Join(tempDir, original.Filename)
+		if err := os.WriteFile(filePath, []byte("content"), 0644); err != nil {
+			t.Fatalf("write archive file: %v", err)
+		}
+
+		handler := &Handler{storage: storage.NewLocal(tempDir), archiveStore: archiveStore}
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodDelete, "/api/archives/"+original.ID.String(), nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPathValues([]echo.PathValue{{Name: "archiveId", Value: original.ID.String()}})
+
+		if assert.NoError(t, handler.HandleDeleteArchive(c)) {
+			assert.Equal(t, http.StatusConflict, rec.Code)
+			assert.FileExists(t, filePath)
+			assert.Equal(t, 1, countArchiveByName(t, archiveStore, "Original"))
 		}
 	})
 
@@ -450,7 +537,7 @@ func TestHandleDeleteArchive(t *testing.T) {
 		tempDir := t.TempDir()
 		archiveStore, _ := openArchiveStore(t)
 		archiveID := uuid.New()
-		handler := &Handler{archivesDir: tempDir, archiveStore: archiveStore}
+		handler := &Handler{storage: storage.NewLocal(tempDir), archiveStore: archiveStore}
 		e := echo.New()
 		req := httptest.NewRequest(http.MethodDelete, "/api/archives/"+archiveID.String(), nil)
 		rec := httptest.NewRecorder()
@@ -475,7 +562,7 @@ func TestHandleDeleteArchive(t *testing.T) {
 			CreatedAt:   time.Now().UTC(),
 		})
 
-		handler := &Handler{archivesDir: tempDir, archiveStore: archiveStore}
+		handler := &Handler{storage: storage.NewLocal(tempDir), archiveStore: archiveStore}
 		e := echo.New()
 		req := httptest.NewRequest(http.MethodDelete, "/api/archives/"+archiveID.String(), nil)
 		rec := httptest.NewRecorder()
@@ -501,11 +588,11 @@ func TestHandleDeleteArchive(t *testing.T) {
 			t.Fatalf("write archive file: %v", err)
 		}
 		seedArchiveWithFilename(t, db, archiveID, "Rollback Delete", filename)
-		if _, err := db.ExecContext(context.Background(), `CREATE TRIGGER fail_archive_delete BEFORE DELETE ON archives BEGIN SELECT RAISE(ABORT, 'forced delete failure'); END;`); err != nil {
-			t.Fatalf("create failing delete trigger: %v", err)
+		if _, err := db.ExecContext(context.Background(), `CREATE TRIGGER fail_archive_trash BEFORE UPDATE OF deleted_at ON archives BEGIN SELECT RAISE(ABORT, 'forced trash failure'); END;`); err != nil {
+			t.Fatalf("create failing trash trigger: %v", err)
 		}
 
-		handler := &Handler{archivesDir: tempDir, archiveStore: archiveStore}
+		handler := &Handler{storage: storage.NewLocal(tempDir), archiveStore: archiveStore}
 		e := echo.New()
 		req := httptest.NewRequest(http.MethodDelete, "/api/archives/"+archiveID.String(), nil)
 		rec := httptest.NewRecorder()
@@ -516,9 +603,10 @@ func TestHandleDeleteArchive(t *testing.T) {
 			assert.Equal(t, http.StatusInternalServerError, rec.Code)
 			_, statErr := os.Stat(filePath)
 			assert.NoError(t, statErr, "file should be restored on DB delete failure")
+			assert.NoFileExists(t, filepath.Join(tempDir, filepath.FromSlash(trash.Key(archiveID))))
 
 			var count int
-			if assert.NoError(t, db.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM archives WHERE id = ?;", archiveID).Scan(&count)) {
+			if assert.NoError(t, db.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM archives WHERE id = ? AND deleted_at IS NULL;", archiveID).Scan(&count)) {
 				assert.Equal(t, 1, count)
 			}
 		}
@@ -543,7 +631,7 @@ func TestHandleModifyArchiveMetadata(t *testing.T) {
 			t.Fatalf("seed tag: %v", err)
 		}
 
-		handler := &Handler{archivesDir: tempDir, archiveStore: archiveStore}
+		handler := &Handler{storage: storage.NewLocal(tempDir), archiveStore: archiveStore}
 		e := echo.New()
 		body, _ := json.Marshal(map[string]any{
 			"name":        "Renamed Title",
@@ -685,7 +773,7 @@ func TestHandleModifyArchiveMetadata(t *testing.T) {
 			CreatedAt:   time.Now().UTC(),
 		})
 
-		handler := &Handler{archivesDir: tempDir, archiveStore: archiveStore}
+		handler := &Handler{storage: storage.NewLocal(tempDir), archiveStore: archiveStore}
 		e := echo.New()
 		body, _ := json.Marshal(map[string]any{"name": "Existing Title", "description": "updated", "tags": []string{"x"}})
 		req := httptest.NewRequest(http.MethodPut, "/api/archives/"+archiveID.String(), strings.NewReader(string(body)))
@@ -771,3 +859,139 @@ func apiArchiveColumnExists(t *testing.T, db *sql.DB, column string) bool {
 
 	return false
 }
+
+func TestHandleGetArchiveCollection(t *testing.T) {
+	archiveStore, _ := openArchiveStore(t)
+	original := models.Archive{ID: uuid.New(), Name: "Original", Filename: "original.wacz", SizeBytes: 4096, CreatedAt: time.Now().UTC()}
+	revisit := models.Archive{ID: uuid.New(), Name: "Revisit", Filename: "revisit.wacz", SizeBytes: 512, DedupSavedBytes: 3584, CreatedAt: time.Now().UTC()}
+	insertArchiveFixture(t, archiveStore, original)
+	insertArchiveFixture(t, archiveStore, revisit)
+	assert.NoError(t, archiveStore.RegisterPayloads(context.Background(), revisit.ID, nil, []uuid.UUID{original.ID}))
+
+	handler := &Handler{archiveStore: archiveStore}
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/archives/"+revisit.ID.String()+"/collection.json", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPathValues([]echo.PathValue{{Name: "archiveId", Value: revisit.ID.String()}})
+
+	if assert.NoError(t, handler.HandleGetArchiveCollection(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var collection struct {
+			Profile   string `json:"profile"`
+			Resources []struct {
+				Name  string `json:"name"`
+				Path  string `json:"path"`
+				Bytes int64  `json:"bytes"`
+			} `json:"resources"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &collection))
+		assert.Equal(t, "multi-wacz-package", collection.Profile)
+		if assert.Len(t, collection.Resources, 2) {
+			assert.Equal(t, "/archives/"+revisit.ID.String(), collection.Resources[0].Path)
+			assert.Equal(t, "/archives/"+original.ID.String(), collection.Resources[1].Path)
+			assert.Equal(t, int64(4096), collection.Resources[1].Bytes)
+		}
+	}
+}
+
+func TestHandleRestoreArchive(t *testing.T) {
+	tempDir := t.TempDir()
+	archiveStore, _ := openArchiveStore(t)
+	archive := models.Archive{ID: uuid.New(), Name: "Restore Me", Filename: "restore-me.wacz", Tags: []string{"keep"}, CreatedAt: time.Now().UTC()}
+	insertArchiveFixture(t, archiveStore, archive)
+	filePath := filepath.Join(tempDir, archive.Filename)
+	if err := os.WriteFile(filePath, []byte("content"), 0644); err != nil {
+		t.Fatalf("write archive file: %v", err)
+	}
+
+	handler := &Handler{storage: storage.NewLocal(tempDir), archiveStore: archiveStore}
+	e := echo.New()
+	serve := func(handle echo.HandlerFunc, method, target, id string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(method, target, nil), rec)
+		if id != "" {
+			c.SetPathValues([]echo.PathValue{{Name: "archiveId", Value: id}})
+		}
+		assert.NoError(t, handle(c))
+		return rec
+	}
+
+	rec := serve(handler.HandleDeleteArchive, http.MethodDelete, "/api/archives/"+archive.ID.String(), archive.ID.String())
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = serve(handler.HandleGetTrash, http.MethodGet, "/api/trash", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var trashResponse struct {
+		Archives []models.Archive `json:"archives"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &trashResponse))
+	if assert.Len(t, trashResponse.Archives, 1) {
+		assert.Equal(t, archive.ID, trashResponse.Archives[0].ID)
+		assert.NotNil(t, trashResponse.Archives[0].DeletedAt)
+	}
+
+	t.Run("FilenameTaken", func(t *testing.T) {
+		if err := os.WriteFile(filePath, []byte("newer capture"), 0644); err != nil {
+			t.Fatalf("write conflicting file: %v", err)
+		}
+		defer os.Remove(filePath)
+
+		rec := serve(handler.HandleRestoreArchive, http.MethodPost, "/api/archives/"+archive.ID.String()+"/restore", archive.ID.String())
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.FileExists(t, filepath.Join(tempDir, filepath.FromSlash(trash.Key(archive.ID))))
+	})
+
+	rec = serve(handler.HandleRestoreArchive, http.MethodPost, "/api/archives/"+archive.ID.String()+"/restore", archive.ID.String())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	content, err := os.ReadFile(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+	assert.NoFileExists(t, filepath.Join(tempDir, filepath.FromSlash(trash.Key(archive.ID))))
+
+	restored, err := archiveStore.Get(context.Background(), archive.ID)
+	if assert.NoError(t, err) {
+		assert.Nil(t, restored.DeletedAt)
+		assert.Equal(t, []string{"keep"}, restored.Tags)
+	}
+
+	rec = serve(handler.HandleRestoreArchive, http.MethodPost, "/api/archives/"+archive.ID.String()+"/restore", archive.ID.String())
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandleRestoreArchiveRequiresLiveReferences(t *testing.T) {
+	tempDir := t.TempDir()
+	archiveStore, _ := openArchiveStore(t)
+	original := models.Archive{ID: uuid.New(), Name: "Original", Filename: "original.wacz", CreatedAt: time.Now().UTC()}
+	revisit := models.Archive{ID: uuid.New(), Name: "Revisit", Filename: "revisit.wacz", CreatedAt: time.Now().UTC()}
+	for _, archive := range []models.Archive{original, revisit} {
+		insertArchiveFixture(t, archiveStore, archive)
+		if err := os.WriteFile(filepath.Join(tempDir, archive.Filename), []byte(archive.Name), 0644); err != nil {
+			t.Fatalf("write archive file: %v", err)
+		}
+	}
+	assert.NoError(t, archiveStore.RegisterPayloads(context.Background(), revisit.ID, nil, []uuid.UUID{original.ID}))
+
+	handler := &Handler{storage: storage.NewLocal(tempDir), archiveStore: archiveStore}
+	e := echo.New()
+	serve := func(handle echo.HandlerFunc, method string, id uuid.UUID) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(method, "/api/archives/"+id.String(), nil), rec)
+		c.SetPathValues([]echo.PathValue{{Name: "archiveId", Value: id.String()}})
+		assert.NoError(t, handle(c))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusNoContent, serve(handler.HandleDeleteArchive, http.MethodDelete, revisit.ID).Code)
+	assert.Equal(t, http.StatusNoContent, serve(handler.HandleDeleteArchive, http.MethodDelete, original.ID).Code)
+
+	rec := serve(handler.HandleRestoreArchive, http.MethodPost, revisit.ID)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.FileExists(t, filepath.Join(tempDir, filepath.FromSlash(trash.Key(revisit.ID))))
+	assert.NoFileExists(t, filepath.Join(tempDir, revisit.Filename))
+
+	assert.Equal(t, http.StatusOK, serve(handler.HandleRestoreArchive, http.MethodPost, original.ID).Code)
+	assert.Equal(t, http.StatusOK, serve(handler.HandleRestoreArchive, http.MethodPost, revisit.ID).Code)
+	assert.FileExists(t, filepath.Join(tempDir, revisit.Filename))
+}
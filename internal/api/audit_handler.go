@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/auth"
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/labstack/echo/v5"
+)
+
+// Audited actions, named after what they change. Every handler changing
+// state records one.
+const (
+	auditJobCreate           = "job.create"
+	auditSubjectCapture      = "subject.capture"
+	auditArchiveUpdate       = "archive.update"
+	auditArchiveDelete       = "archive.delete"
+	auditArchiveRestore      = "archive.restore"
+	auditArchiveShare        = "archive.share"
+	auditArchiveUnshare      = "archive.unshare"
+	auditRetentionRuleCreate = "retention_rule.create"
+	auditRetentionRuleUpdate = "retention_rule.update"
+	auditRetentionRuleDelete = "retention_rule.delete"
+	auditStorageSync         = "storage.sync"
+	auditUserCreate          = "user.create"
+	auditUserDelete          = "user.delete"
+	auditAPITokenCreate      = "api_token.create"
+	auditAPITokenDelete      = "api_token.delete"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+	errInvalidAuditQuery = "Invalid audit query"
+)
+
+// audit records a change made by the current request. before and after are
+// the changed object, nil when it did not exist. The change has already
+// happened, so failing to record it is only logged.
+func (handler *Handler) audit(c *echo.Context, action, targetId string, before, after any) {
+	entry := models.AuditEntry{
+		CreatedAt: time.Now().UTC(),
+		ClientIP:  c.RealIP(),
+		Action:    action,
+		TargetID:  targetId,
+	}
+	if user, ok := currentUser(c); ok {
+		entry.ActorID = &user.ID
+		entry.Actor = user.Username
+	}
+	if token, ok := currentAPIToken(c); ok {
+		entry.TokenID = &token.ID
+	}
+
+	var err error
+	if entry.Before, err = auditState(before); err == nil {
+		entry.After, err = auditState(after)
+	}
+	if err == nil {
+		err = handler.archiveStore.InsertAuditEntry(c.Request().Context(), entry)
+	}
+	if err != nil {
+		slog.Error("failed to record audit entry", "action", action, "target_id", targetId, "actor", entry.Actor, "error", err)
+	}
+}
+
+func auditState(value any) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+	return json.Marshal(value)
+}
+
+func (handler *Handler) HandleGetAuditLog(c *echo.Context) error {
+	query, err := auditQuery(c.Request())
+	if err != nil {
+		return respondWithError(http.StatusBadRequest, errInvalidAuditQuery, c)
+	}
+
+	entries, err := handler.archiveStore.ListAuditEntries(c.Request().Context(), query)
+	if err != nil {
+		slog.Error("failed to list audit entries", "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+
+	nextCursor := ""
+	if len(entries) == query.Limit {
+		nextCursor = strconv.FormatInt(entries[len(entries)-1].ID, 10)
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"entries":     entries,
+		"next_cursor": nextCursor,
+	})
+}
+
+func auditQuery(request *http.Request) (store.AuditQuery, error) {
+	values := request.URL.Query()
+	query := store.AuditQuery{
+		Actor:    auth.NormalizeUsername(values.Get("actor")),
+		Action:   strings.TrimSpace(values.Get("action")),
+		TargetID: strings.TrimSpace(values.Get("target_id")),
+		Limit:    defaultAuditPageSize,
+	}
+
+	if value := values.Get("since"); value != "" {
+		since, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return query, err
+		}
+		query.Since = &since
+	}
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxAuditPageSize {
+			return query, errors.New("invalid limit")
+		}
+		query.Limit = limit
+	}
+	if value := values.Get("cursor"); value != "" {
+		cursor, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || cursor < 1 {
+			return query, errors.New("invalid cursor")
+		}
+		query.BeforeID = cursor
+	}
+	return query, nil
+}
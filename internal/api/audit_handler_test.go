@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/auth"
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/storage"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type auditLogResponse struct {
+	Entries    []models.AuditEntry `json:"entries"`
+	NextCursor string              `json:"next_cursor"`
+}
+
+func TestAuditLog(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	archiveStore, _ := openArchiveStore(t)
+	archivesDir := t.TempDir()
+
+	require.NoError(t, auth.EnsureAdmin(t.Context(), archiveStore, "admin", "admin password"))
+	alice, err := auth.NewUser("alice", "alice password", false)
+	require.NoError(t, err)
+	require.NoError(t, archiveStore.InsertUser(t.Context(), alice))
+
+	archive := models.Archive{ID: uuid.New(), Name: "before", Filename: "audited.wacz", OwnerID: &alice.ID, CreatedAt: time.Now().UTC()}
+	require.NoError(t, os.WriteFile(filepath.Join(archivesDir, archive.Filename), []byte("wacz"), 0644))
+	insertArchiveFixture(t, archiveStore, archive)
+
+	handler := NewHandler(rdb, storage.NewLocal(archivesDir), archiveStore)
+	handler.SetAuthEnabled(true)
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+	handler.setMainRoutes(e, testRouteConfig, testFrontendFS)
+
+	aliceCookie := login(t, e, "alice", "alice password")
+	adminCookie := login(t, e, "admin", "admin password")
+
+	rec := serveAuthRequest(e, http.MethodPost, "/api/jobs", `{"url":"https://example.com","name":"capture"}`, aliceCookie)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	rec = serveAuthRequest(e, http.MethodPut, "/api/archives/"+archive.ID.String(), `{"name":"after","tags":["case"]}`, aliceCookie)
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	rec = serveAuthRequest(e, http.MethodDelete, "/api/archives/"+archive.ID.String(), "", aliceCookie)
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+
+	getAuditLog := func(target string) auditLogResponse {
+		t.Helper()
+		rec := serveAuthRequest(e, http.MethodGet, target, "", adminCookie)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		var response auditLogResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		return response
+	}
+
+	t.Run("only administrators read the audit log", func(t *testing.T) {
+		rec := serveAuthRequest(e, http.MethodGet, "/api/audit", "", aliceCookie)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		rec = serveAuthRequest(e, http.MethodGet, "/api/audit?limit=0", "", adminCookie)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("records who changed what", func(t *testing.T) {
+		response := getAuditLog("/api/audit?actor=Alice")
+		require.Len(t, response.Entries, 3)
+		actions := []string{response.Entries[0].Action, response.Entries[1].Action, response.Entries[2].Action}
+		assert.Equal(t, []string{auditArchiveDelete, auditArchiveUpdate, auditJobCreate}, actions)
+
+		for _, entry := range response.Entries {
+			assert.Equal(t, "alice", entry.Actor)
+			require.NotNil(t, entry.ActorID)
+			assert.Equal(t, alice.ID, *entry.ActorID)
+			assert.Equal(t, "192.0.2.1", entry.ClientIP)
+		}
+
+		update := response.Entries[1]
+		assert.Equal(t, archive.ID.String(), update.TargetID)
+		var before, after models.Archive
+		require.NoError(t, json.Unmarshal(update.Before, &before))
+		require.NoError(t, json.Unmarshal(update.After, &after))
+		assert.Equal(t, "before", before.Name)
+		assert.Equal(t, "after", after.Name)
+		assert.Equal(t, []string{"case"}, after.Tags)
+
+		assert.Nil(t, response.Entries[0].After)
+		assert.Contains(t, string(response.Entries[2].After), "https://example.com")
+	})
+
+	t.Run("pages through entries", func(t *testing.T) {
+		first := getAuditLog("/api/audit?limit=2")
+		require.Len(t, first.Entries, 2)
+		require.NotEmpty(t, first.NextCursor)
+		second := getAuditLog("/api/audit?limit=2&cursor=" + first.NextCursor)
+		require.Len(t, second.Entries, 1)
+		assert.Equal(t, auditJobCreate, second.Entries[0].Action)
+		assert.Empty(t, second.NextCursor)
+
+		filtered := getAuditLog("/api/audit?action=" + auditArchiveDelete + "&target_id=" + archive.ID.String())
+		assert.Len(t, filtered.Entries, 1)
+	})
+}
@@ -0,0 +1,222 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/auth"
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	sessionCookieName = "archiver_session"
+	sessionLifetime   = 30 * 24 * time.Hour
+	userContextKey    = "user"
+)
+
+const (
+	errAuthenticationRequired = "Authentication required"
+	errAdminRequired          = "Administrator access required"
+	errInvalidCredentials     = "Invalid username or password"
+	errInvalidUserId          = "Invalid user ID"
+	errUserNotFound           = "User not found"
+	errUsernameTaken          = "Username already taken"
+	errCannotDeleteSelf       = "You cannot delete your own account"
+)
+
+// publicAPIRoutes are reachable without signing in.
+var publicAPIRoutes = map[string]bool{
+	"/api/config":     true,
+	"/api/auth/login": true,
+}
+
+type credentialsRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type createUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	IsAdmin  bool   `json:"is_admin"`
+}
+
+// currentUser returns the signed in user, if any.
+func currentUser(c *echo.Context) (models.User, bool) {
+	user, ok := c.Get(userContextKey).(models.User)
+	return user, ok
+}
+
+// requireUser rejects API requests without a valid session cookie or API
+// token when built-in authentication is enabled.
+func (handler *Handler) requireUser() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			if !handler.authEnabled {
+				return next(c)
+			}
+			if _, ok := currentUser(c); ok {
+				return next(c)
+			}
+
+			if cookie, err := c.Cookie(sessionCookieName); err == nil && cookie.Value != "" {
+				user, err := handler.archiveStore.GetSessionUser(c.Request().Context(), auth.HashToken(cookie.Value), time.Now())
+				if err == nil {
+					c.Set(userContextKey, user)
+					return next(c)
+				}
+				if !errors.Is(err, store.ErrSessionNotFound) {
+					slog.Error("failed to look up session", "error", err)
+					return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+				}
+			}
+
+			if publicAPIRoutes[c.Path()] {
+				return next(c)
+			}
+			return respondWithError(http.StatusUnauthorized, errAuthenticationRequired, c)
+		}
+	}
+}
+
+func requireAdmin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c *echo.Context) error {
+		if user, ok := currentUser(c); ok && !user.IsAdmin {
+			return respondWithError(http.StatusForbidden, errAdminRequired, c)
+		}
+		if token, ok := currentAPIToken(c); ok && !token.Scope.Allows(models.ScopeAdmin) {
+			return respondWithError(http.StatusForbidden, errInsufficientScope, c)
+		}
+		return next(c)
+	}
+}
+
+func (handler *Handler) HandleLogin(c *echo.Context) error {
+	var request credentialsRequest
+	if err := c.Bind(&request); err != nil {
+		return respondWithError(http.StatusBadRequest, "Malformed request", c)
+	}
+
+	ctx := c.Request().Context()
+	user, err := auth.Authenticate(ctx, handler.archiveStore, request.Username, request.Password)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			slog.Warn("failed login", "username", auth.NormalizeUsername(request.Username), "remote_ip", c.RealIP())
+			return respondWithError(http.StatusUnauthorized, errInvalidCredentials, c)
+		}
+		slog.Error("failed to authenticate user", "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+
+	token, err := auth.NewToken()
+	if err != nil {
+		slog.Error("failed to create session token", "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+	now := time.Now()
+	expiresAt := now.Add(sessionLifetime)
+	if err := handler.archiveStore.InsertSession(ctx, auth.HashToken(token), user.ID, expiresAt); err != nil {
+		slog.Error("failed to store session", "user_id", user.ID, "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+	if err := handler.archiveStore.DeleteExpiredSessions(ctx, now); err != nil {
+		slog.Warn("failed to remove expired sessions", "error", err)
+	}
+
+	c.SetCookie(handler.sessionCookie(token, expiresAt))
+	return c.JSON(http.StatusOK, user)
+}
+
+func (handler *Handler) HandleLogout(c *echo.Context) error {
+	if cookie, err := c.Cookie(sessionCookieName); err == nil && cookie.Value != "" {
+		if err := handler.archiveStore.DeleteSession(c.Request().Context(), auth.HashToken(cookie.Value)); err != nil {
+			slog.Error("failed to delete session", "error", err)
+			return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+		}
+	}
+
+	c.SetCookie(handler.sessionCookie("", time.Unix(0, 0)))
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (handler *Handler) HandleGetCurrentUser(c *echo.Context) error {
+	user, ok := currentUser(c)
+	if !ok {
+		return respondWithError(http.StatusNotFound, "Authentication is disabled", c)
+	}
+	return c.JSON(http.StatusOK, user)
+}
+
+// sessionCookie is scoped to the app origin: it sets no Domain, so it is
+// never sent to the replay origin.
+func (handler *Handler) sessionCookie(token string, expiresAt time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   handler.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (handler *Handler) HandleGetUsers(c *echo.Context) error {
+	users, err := handler.archiveStore.ListUsers(c.Request().Context())
+	if err != nil {
+		slog.Error("failed to list users", "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+	return c.JSON(http.StatusOK, map[string]any{"users": users})
+}
+
+func (handler *Handler) HandleCreateUser(c *echo.Context) error {
+	var request createUserRequest
+	if err := c.Bind(&request); err != nil {
+		return respondWithError(http.StatusBadRequest, "Malformed request", c)
+	}
+
+	user, err := auth.NewUser(request.Username, request.Password, request.IsAdmin)
+	if err != nil {
+		return respondWithError(http.StatusBadRequest, err.Error(), c)
+	}
+	if err := handler.archiveStore.InsertUser(c.Request().Context(), user); err != nil {
+		if errors.Is(err, store.ErrUsernameTaken) {
+			return respondWithError(http.StatusConflict, errUsernameTaken, c)
+		}
+		slog.Error("failed to create user", "username", user.Username, "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+	handler.audit(c, auditUserCreate, user.ID.String(), nil, user)
+	return c.JSON(http.StatusCreated, user)
+}
+
+func (handler *Handler) HandleDeleteUser(c *echo.Context) error {
+	userId, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		return respondWithError(http.StatusBadRequest, errInvalidUserId, c)
+	}
+	if user, ok := currentUser(c); ok && user.ID == userId {
+		return respondWithError(http.StatusBadRequest, errCannotDeleteSelf, c)
+	}
+
+	ctx := c.Request().Context()
+	user, err := handler.archiveStore.GetUser(ctx, userId)
+	if err == nil {
+		err = handler.archiveStore.DeleteUser(ctx, userId)
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrUserNotFound) {
+			return respondWithError(http.StatusNotFound, errUserNotFound, c)
+		}
+		slog.Error("failed to delete user", "user_id", userId, "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+	handler.audit(c, auditUserDelete, userId.String(), user, nil)
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/JuanSaenz04/archiver/internal/auth"
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveAuthRequest(e *echo.Echo, method, target, body string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderOrigin, testRouteConfig.AppPublicURL)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func login(t *testing.T, e *echo.Echo, username, password string) *http.Cookie {
+	t.Helper()
+	rec := serveAuthRequest(e, http.MethodPost, "/api/auth/login", `{"username":"`+username+`","password":"`+password+`"}`, nil)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == sessionCookieName {
+			return cookie
+		}
+	}
+	t.Fatal("login did not set a session cookie")
+	return nil
+}
+
+func TestBuiltInAuthentication(t *testing.T) {
+	archiveStore, _ := openArchiveStore(t)
+	require.NoError(t, auth.EnsureAdmin(t.Context(), archiveStore, "admin", "admin password"))
+	member, err := auth.NewUser("member", "member password", false)
+	require.NoError(t, err)
+	require.NoError(t, archiveStore.InsertUser(t.Context(), member))
+
+	handler := &Handler{archiveStore: archiveStore}
+	handler.SetAuthEnabled(true)
+	e := echo.New()
+	handler.setMainRoutes(e, testRouteConfig, testFrontendFS)
+
+	t.Run("config stays public", func(t *testing.T) {
+		rec := serveAuthRequest(e, http.MethodGet, "/api/config", "", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var response map[string]any
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, true, response["auth_enabled"])
+	})
+
+	t.Run("rejects requests without a session", func(t *testing.T) {
+		rec := serveAuthRequest(e, http.MethodGet, "/api/archives", "", nil)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		rec = serveAuthRequest(e, http.MethodGet, "/api/archives", "", &http.Cookie{Name: sessionCookieName, Value: "forged"})
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("rejects wrong passwords", func(t *testing.T) {
+		rec := serveAuthRequest(e, http.MethodPost, "/api/auth/login", `{"username":"admin","password":"wrong password"}`, nil)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Empty(t, rec.Result().Cookies())
+	})
+
+	t.Run("session cookie grants access until logout", func(t *testing.T) {
+		cookie := login(t, e, "admin", "admin password")
+		assert.True(t, cookie.HttpOnly)
+		assert.True(t, cookie.Secure)
+		assert.Empty(t, cookie.Domain, "the cookie must not be sent to the replay origin")
+
+		rec := serveAuthRequest(e, http.MethodGet, "/api/archives", "", cookie)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		rec = serveAuthRequest(e, http.MethodGet, "/api/auth/me", "", cookie)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var user models.User
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &user))
+		assert.Equal(t, "admin", user.Username)
+		assert.NotContains(t, rec.Body.String(), "password")
+
+		rec = serveAuthRequest(e, http.MethodPost, "/api/auth/logout", "", cookie)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		rec = serveAuthRequest(e, http.MethodGet, "/api/archives", "", cookie)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("only administrators manage users", func(t *testing.T) {
+		memberCookie := login(t, e, "member", "member password")
+		rec := serveAuthRequest(e, http.MethodGet, "/api/users", "", memberCookie)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		rec = serveAuthRequest(e, http.MethodPost, "/api/admin/sync", "", memberCookie)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+
+		adminCookie := login(t, e, "admin", "admin password")
+		rec = serveAuthRequest(e, http.MethodPost, "/api/users", `{"username":"viewer","password":"short"}`, adminCookie)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		rec = serveAuthRequest(e, http.MethodPost, "/api/users", `{"username":"Member","password":"long enough"}`, adminCookie)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		rec = serveAuthRequest(e, http.MethodPost, "/api/users", `{"username":"viewer","password":"long enough"}`, adminCookie)
+		require.Equal(t, http.StatusCreated, rec.Code)
+		var created models.User
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+
+		rec = serveAuthRequest(e, http.MethodDelete, "/api/users/"+created.ID.String(), "", adminCookie)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+
+		admin, err := archiveStore.GetUserByUsername(t.Context(), "admin")
+		require.NoError(t, err)
+		rec = serveAuthRequest(e, http.MethodDelete, "/api/users/"+admin.ID.String(), "", adminCookie)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
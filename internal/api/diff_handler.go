@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/storage"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/JuanSaenz04/archiver/internal/wacz"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v5"
+)
+
+const errUnreadableArchive = "Archive is not a readable WACZ"
+
+type archiveContents struct {
+	records []wacz.IndexRecord
+	pages   []wacz.Page
+}
+
+func (handler *Handler) HandleDiffArchives(c *echo.Context) error {
+	fromId, err := uuid.Parse(c.QueryParam("from"))
+	if err != nil {
+		return respondWithError(http.StatusBadRequest, errInvalidId, c)
+	}
+	toId, err := uuid.Parse(c.QueryParam("to"))
+	if err != nil {
+		return respondWithError(http.StatusBadRequest, errInvalidId, c)
+	}
+
+	from, err := handler.getVisibleArchive(c, fromId)
+	if err != nil {
+		return handler.respondWithArchiveLookupError(c, fromId, err)
+	}
+	to, err := handler.getVisibleArchive(c, toId)
+	if err != nil {
+		return handler.respondWithArchiveLookupError(c, toId, err)
+	}
+
+	return handler.diffArchives(c, from, to)
+}
+
+func (handler *Handler) HandleDiffSubject(c *echo.Context) error {
+	subject, err := decodeSubjectID(c.Param("subjectId"))
+	if err != nil {
+		return respondWithError(http.StatusBadRequest, errInvalidSubjectId, c)
+	}
+
+	page, err := handler.archiveStore.ListArchives(c.Request().Context(), store.ListArchivesOptions{Subject: subject, Limit: 2, Viewer: handler.archiveViewer(c)})
+	if err != nil {
+		slog.Error("failed to list subject snapshots", "subject", subject, "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+	if len(page.Archives) == 0 {
+		return respondWithError(http.StatusNotFound, errSubjectNotFound, c)
+	}
+	if len(page.Archives) < 2 {
+		return respondWithError(http.StatusConflict, "Subject has a single snapshot", c)
+	}
+
+	return handler.diffArchives(c, page.Archives[1], page.Archives[0])
+}
+
+func (handler *Handler) respondWithArchiveLookupError(c *echo.Context, archiveId uuid.UUID, err error) error {
+	if errors.Is(err, store.ErrArchiveNotFound) {
+		return respondWithError(http.StatusNotFound, errArchiveNotFound, c)
+	}
+	slog.Error("failed to load archive", "archive_id", archiveId, "error", err)
+	return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+}
+
+func (handler *Handler) diffArchives(c *echo.Context, from, to models.Archive) error {
+	fromContents, err := handler.readArchiveContents(c.Request().Context(), from)
+	if err != nil {
+		return handler.respondWithContentsError(c, from, err)
+	}
+	toContents, err := handler.readArchiveContents(c.Request().Context(), to)
+	if err != nil {
+		return handler.respondWithContentsError(c, to, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"from": from,
+		"to":   to,
+		"urls": wacz.DiffIndexes(fromContents.records, toContents.records),
+		"text": wacz.DiffPages(fromContents.pages, toContents.pages),
+	})
+}
+
+func (handler *Handler) readArchiveContents(ctx context.Context, archive models.Archive) (archiveContents, error) {
+	reader, err := wacz.OpenObject(ctx, handler.storage, archive.Filename)
+	if err != nil {
+		return archiveContents{}, err
+	}
+	defer reader.Close()
+
+	records, err := reader.IndexRecords()
+	if err != nil {
+		return archiveContents{}, err
+	}
+	pages, err := reader.Pages()
+	if err != nil {
+		return archiveContents{}, err
+	}
+
+	return archiveContents{records: records, pages: pages}, nil
+}
+
+func (handler *Handler) respondWithContentsError(c *echo.Context, archive models.Archive, err error) error {
+	if errors.Is(err, storage.ErrNotExist) {
+		return respondWithError(http.StatusNotFound, errArchiveNotFound, c)
+	}
+	slog.Warn("failed to read archive contents", "archive_id", archive.ID, "filename", archive.Filename, "error", err)
+	return respondWithError(http.StatusUnprocessableEntity, errUnreadableArchive, c)
+}
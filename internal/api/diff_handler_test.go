@@ -0,0 +1,131 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/storage"
+	"github.com/JuanSaenz04/archiver/internal/wacz"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type archiveDiffResponse struct {
+	From models.Archive    `json:"from"`
+	To   models.Archive    `json:"to"`
+	URLs wacz.URLChanges   `json:"urls"`
+	Text []wacz.TextChange `json:"text"`
+}
+
+func writeWACZFixture(t *testing.T, path, cdxj, pages string) {
+	t.Helper()
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create wacz fixture: %v", err)
+	}
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+	for name, data := range map[string]string{"indexes/index.cdxj": cdxj, "pages/pages.jsonl": pages} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		if _, err := w.Write([]byte(data)); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close wacz fixture: %v", err)
+	}
+}
+
+func TestHandleDiffArchives(t *testing.T) {
+	archivesDir := t.TempDir()
+	archiveStore, _ := openArchiveStore(t)
+	handler := &Handler{storage: storage.NewLocal(archivesDir), archiveStore: archiveStore}
+	e := echo.New()
+	start := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	writeWACZFixture(t, filepath.Join(archivesDir, "week1.wacz"),
+		`com,example)/ 20260401000000 {"url":"https://example.com/","digest":"sha256:home-1"}`+"\n"+
+			`com,example)/old 20260401000000 {"url":"https://example.com/old","digest":"sha256:old"}`+"\n",
+		`{"url":"https://example.com/","text":"Terms v1"}`+"\n")
+	writeWACZFixture(t, filepath.Join(archivesDir, "week2.wacz"),
+		`com,example)/ 20260408000000 {"url":"https://example.com/","digest":"sha256:home-2"}`+"\n"+
+			`com,example)/new 20260408000000 {"url":"https://example.com/new","digest":"sha256:new"}`+"\n",
+		`{"url":"https://example.com/","text":"Terms v2"}`+"\n")
+	if err := os.WriteFile(filepath.Join(archivesDir, "broken.wacz"), []byte("not a zip"), 0644); err != nil {
+		t.Fatalf("write broken archive: %v", err)
+	}
+
+	week1 := models.Archive{ID: uuid.New(), Name: "week 1", Filename: "week1.wacz", Subject: "https://example.com", CreatedAt: start}
+	week2 := models.Archive{ID: uuid.New(), Name: "week 2", Filename: "week2.wacz", Subject: "https://example.com", CreatedAt: start.Add(7 * 24 * time.Hour)}
+	broken := models.Archive{ID: uuid.New(), Name: "broken", Filename: "broken.wacz", Subject: "https://broken.example", CreatedAt: start}
+	for _, archive := range []models.Archive{week1, week2, broken} {
+		insertArchiveFixture(t, archiveStore, archive)
+	}
+
+	assertDiff := func(t *testing.T, rec *httptest.ResponseRecorder) {
+		t.Helper()
+		if !assert.Equal(t, http.StatusOK, rec.Code) {
+			return
+		}
+		var response archiveDiffResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, week1.ID, response.From.ID)
+		assert.Equal(t, week2.ID, response.To.ID)
+		assert.Equal(t, []string{"https://example.com/new"}, response.URLs.Added)
+		assert.Equal(t, []string{"https://example.com/old"}, response.URLs.Removed)
+		assert.Equal(t, []string{"https://example.com/"}, response.URLs.Changed)
+		if assert.Len(t, response.Text, 1) {
+			assert.Equal(t, "@@ -1,1 +1,1 @@\n-Terms v1\n+Terms v2\n", response.Text[0].Diff)
+		}
+	}
+
+	t.Run("ByArchiveIDs", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/archives/diff?from="+week1.ID.String()+"&to="+week2.ID.String(), nil)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handler.HandleDiffArchives(e.NewContext(req, rec)))
+		assertDiff(t, rec)
+	})
+
+	t.Run("BySubject", func(t *testing.T) {
+		assertDiff(t, serveSubjectRequest(t, e, handler.HandleDiffSubject, http.MethodGet, subjectID("https://example.com")))
+	})
+
+	t.Run("SubjectWithSingleSnapshot", func(t *testing.T) {
+		rec := serveSubjectRequest(t, e, handler.HandleDiffSubject, http.MethodGet, subjectID("https://broken.example"))
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("InvalidID", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/archives/diff?from=nope&to="+week2.ID.String(), nil)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handler.HandleDiffArchives(e.NewContext(req, rec)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("MissingArchive", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/archives/diff?from="+uuid.NewString()+"&to="+week2.ID.String(), nil)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handler.HandleDiffArchives(e.NewContext(req, rec)))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("UnreadableArchive", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/archives/diff?from="+broken.ID.String()+"&to="+week2.ID.String(), nil)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handler.HandleDiffArchives(e.NewContext(req, rec)))
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+}
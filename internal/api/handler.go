@@ -1,23 +1,86 @@
 package api
 
 import (
+	"github.com/JuanSaenz04/archiver/internal/auth"
+	"github.com/JuanSaenz04/archiver/internal/ingest"
 	"github.com/JuanSaenz04/archiver/internal/queue"
+	"github.com/JuanSaenz04/archiver/internal/quota"
+	"github.com/JuanSaenz04/archiver/internal/storage"
 	"github.com/JuanSaenz04/archiver/internal/store"
 	"github.com/redis/go-redis/v9"
 )
 
 type Handler struct {
-	rdb          *redis.Client
-	jobRepo      *queue.JobRepository
-	archivesDir  string
-	archiveStore *store.ArchiveStore
+	rdb           *redis.Client
+	jobRepo       *queue.JobRepository
+	storage       storage.Backend
+	archiveStore  store.Store
+	ingester      *ingest.Ingester
+	quota         quota.Quota
+	crawlLimits   queue.Limits
+	workerToken   string
+	authEnabled   bool
+	proxyAuth     *ProxyAuth
+	secureCookies bool
+	replayOrigin  string
+	signer        *auth.Signer
 }
 
-func NewHandler(rdb *redis.Client, archivesDir string, archiveStore *store.ArchiveStore) *Handler {
+func NewHandler(rdb *redis.Client, backend storage.Backend, archiveStore store.Store) *Handler {
 	return &Handler{
 		rdb:          rdb,
 		jobRepo:      queue.NewJobRepository(rdb),
-		archivesDir:  archivesDir,
+		storage:      backend,
 		archiveStore: archiveStore,
+		ingester:     ingest.NewIngester(archiveStore, backend),
+		signer:       auth.NewRandomSigner(),
+	}
+}
+
+func (handler *Handler) SetStorageQuota(q quota.Quota) {
+	handler.quota = q
+	if handler.ingester != nil {
+		handler.ingester.SetStorageQuota(q)
+	}
+}
+
+// SetCrawlLimits restricts how fast crawl jobs are submitted.
+func (handler *Handler) SetCrawlLimits(limits queue.Limits) {
+	handler.crawlLimits = limits
+}
+
+// SetWorkerToken enables the internal upload endpoint for workers presenting
+// token as a bearer token.
+func (handler *Handler) SetWorkerToken(token string) {
+	handler.workerToken = token
+}
+
+// SetAuthEnabled requires a signed in user for every API request except
+// the login itself.
+func (handler *Handler) SetAuthEnabled(enabled bool) {
+	handler.authEnabled = enabled
+}
+
+// SetSigningKey replaces the random key links to the replay origin are
+// signed with, so that they stay valid across restarts and API hosts.
+func (handler *Handler) SetSigningKey(key []byte) {
+	handler.signer = auth.NewSigner(key)
+}
+
+// SetProxyAuth requires every API request to carry the identity headers of
+// an authentication proxy, or an API token.
+func (handler *Handler) SetProxyAuth(proxyAuth ProxyAuth) {
+	handler.proxyAuth = &proxyAuth
+	handler.authEnabled = true
+}
+
+func (handler *Handler) authMode() string {
+	switch {
+	case handler.proxyAuth != nil:
+		return "proxy"
+	case handler.authEnabled:
+		return "local"
+	default:
+		return "none"
 	}
 }
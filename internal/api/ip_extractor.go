@@ -22,8 +22,19 @@ func GetIPExtractorFromEnv() echo.IPExtractor {
 		echo.TrustLinkLocal(false),
 		echo.TrustPrivateNet(false),
 	)
+	for _, ipnet := range parseTrustedProxies(trustedProxiesEnv) {
+		trustOptions = append(trustOptions, echo.TrustIPRange(ipnet))
+	}
+
+	slog.Info("configured secure IP extractor", "trusted_proxies", trustedProxiesEnv)
+	return echo.ExtractIPFromXFFHeader(trustOptions...)
+}
 
-	for proxy := range strings.SplitSeq(trustedProxiesEnv, ",") {
+// parseTrustedProxies parses a TRUSTED_PROXIES list of IPs and CIDR ranges,
+// skipping malformed entries.
+func parseTrustedProxies(value string) []*net.IPNet {
+	var ranges []*net.IPNet
+	for proxy := range strings.SplitSeq(value, ",") {
 		proxy = strings.TrimSpace(proxy)
 		if proxy == "" {
 			continue
@@ -32,7 +43,7 @@ func GetIPExtractorFromEnv() echo.IPExtractor {
 		// Try to parse as CIDR
 		_, ipnet, err := net.ParseCIDR(proxy)
 		if err == nil {
-			trustOptions = append(trustOptions, echo.TrustIPRange(ipnet))
+			ranges = append(ranges, ipnet)
 			continue
 		}
 
@@ -45,13 +56,11 @@ func GetIPExtractorFromEnv() echo.IPExtractor {
 			} else {
 				mask = net.CIDRMask(128, 128)
 			}
-			trustOptions = append(trustOptions, echo.TrustIPRange(&net.IPNet{IP: ip, Mask: mask}))
+			ranges = append(ranges, &net.IPNet{IP: ip, Mask: mask})
 			continue
 		}
 
 		slog.Warn("invalid trusted proxy", "proxy", proxy)
 	}
-
-	slog.Info("configured secure IP extractor", "trusted_proxies", trustedProxiesEnv)
-	return echo.ExtractIPFromXFFHeader(trustOptions...)
+	return ranges
 }
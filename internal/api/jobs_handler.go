@@ -1,20 +1,44 @@
 package api
 
 import (
+	"errors"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/JuanSaenz04/archiver/internal/models"
 	"github.com/JuanSaenz04/archiver/internal/queue"
+	"github.com/JuanSaenz04/archiver/internal/quota"
 	"github.com/labstack/echo/v5"
 )
 
+const errInvalidPriority = "priority must be high, normal or low"
+
 func (handler *Handler) HandleNewJob(c *echo.Context) error {
 	job := &models.CrawlRequest{}
 
 	if err := c.Bind(job); err != nil {
 		return respondWithError(http.StatusBadRequest, "Bad request", c)
 	}
+	if job.Visibility != "" && !job.Visibility.Valid() {
+		return respondWithError(http.StatusBadRequest, errInvalidVisibility, c)
+	}
+	if job.Priority != "" && !job.Priority.Valid() {
+		return respondWithError(http.StatusBadRequest, errInvalidPriority, c)
+	}
+
+	if ok, err := handler.admitStorage(c, job.URL, job.Tags); !ok {
+		return err
+	}
+
+	if user, ok := currentUser(c); ok {
+		job.Owner = &user
+	}
+	if ok, err := handler.admitCrawl(c, job.URL); !ok {
+		return err
+	}
 
 	jobId, err := queue.EnqueueCrawl(c.Request().Context(), handler.rdb, *job)
 	if err != nil {
@@ -22,14 +46,63 @@ func (handler *Handler) HandleNewJob(c *echo.Context) error {
 		return respondWithError(http.StatusInternalServerError, "Failed to queue job", c)
 	}
 
-	slog.Info("crawl job enqueued", "job_id", jobId.String(), "url", job.URL)
+	if job.Priority == "" {
+		job.Priority = models.PriorityNormal
+	}
+	slog.Info("crawl job enqueued", "job_id", jobId.String(), "url", job.URL, "priority", job.Priority)
+	handler.audit(c, auditJobCreate, jobId.String(), nil, job)
 
 	return c.JSON(http.StatusCreated, map[string]interface{}{
-		"job_id": jobId,
-		"status": "pending",
+		"job_id":   jobId,
+		"status":   "pending",
+		"priority": job.Priority,
 	})
 }
 
+// admitStorage rejects crawls while the storage quota covering their tags
+// is used up. Like admitCrawl, when ok is false the request was already
+// answered and err is the result to return.
+func (handler *Handler) admitStorage(c *echo.Context, url string, tags []string) (ok bool, err error) {
+	err = handler.quota.Check(c.Request().Context(), handler.archiveStore, tags, 0)
+	if errors.Is(err, quota.ErrExceeded) {
+		slog.Warn("crawl job rejected", "url", url, "reason", err)
+		return false, respondWithError(http.StatusInsufficientStorage, "Storage quota exceeded"+strings.TrimPrefix(err.Error(), quota.ErrExceeded.Error()), c)
+	}
+	if err != nil {
+		slog.Error("failed to check storage quota", "url", url, "error", err)
+		return false, respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+	return true, nil
+}
+
+// admitCrawl applies the crawl submission limits to the current request.
+// When ok is false, the request was already answered and err is the result
+// to return.
+func (handler *Handler) admitCrawl(c *echo.Context, url string) (ok bool, err error) {
+	if !handler.crawlLimits.Enabled() {
+		return true, nil
+	}
+
+	owner := ""
+	if user, ok := currentUser(c); ok {
+		owner = user.Username
+	}
+	err = handler.crawlLimits.Admit(c.Request().Context(), handler.rdb, owner, c.RealIP())
+
+	var limitErr *queue.LimitError
+	if errors.As(err, &limitErr) {
+		slog.Warn("crawl job rejected", "url", url, "owner", owner, "client_ip", c.RealIP(), "reason", limitErr.Reason)
+		seconds := int(math.Ceil(limitErr.RetryAfter.Seconds()))
+		c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+		return false, respondWithError(http.StatusTooManyRequests, "Too many crawl jobs: "+limitErr.Reason, c)
+	}
+	if err != nil {
+		slog.Error("failed to check crawl limits", "url", url, "error", err)
+		return false, respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+	return true, nil
+}
+
 func (handler *Handler) HandleGetJobs(c *echo.Context) error {
 	jobs, err := handler.jobRepo.GetAllJobs(c.Request().Context())
 
@@ -38,5 +111,16 @@ func (handler *Handler) HandleGetJobs(c *echo.Context) error {
 		return respondWithError(http.StatusInternalServerError, "Internal server error", c)
 	}
 
+	// Only administrators see the crawls of other users.
+	if user, ok := currentUser(c); handler.authEnabled && ok && !user.IsAdmin {
+		owned := make([]models.Job, 0, len(jobs))
+		for _, job := range jobs {
+			if job.Owner == user.Username {
+				owned = append(owned, job)
+			}
+		}
+		jobs = owned
+	}
+
 	return c.JSON(http.StatusOK, jobs)
 }
@@ -6,11 +6,14 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/JuanSaenz04/archiver/internal/models"
 	"github.com/JuanSaenz04/archiver/internal/queue"
-	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/JuanSaenz04/archiver/internal/quota"
+	"github.com/JuanSaenz04/archiver/internal/storage"
 	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v5"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
@@ -30,8 +33,8 @@ func TestHandleNewJob(t *testing.T) {
 	})
 
 	// 3. Initialize Handler
-	var archiveStore *store.ArchiveStore
-	handler := NewHandler(rdb, t.TempDir(), archiveStore)
+	archiveStore, _ := openArchiveStore(t)
+	handler := NewHandler(rdb, storage.NewLocal(t.TempDir()), archiveStore)
 	e := echo.New()
 
 	t.Run("Success", func(t *testing.T) {
@@ -91,6 +94,27 @@ func TestHandleNewJob(t *testing.T) {
 			assert.Equal(t, http.StatusBadRequest, rec.Code)
 		}
 	})
+
+	t.Run("Priority", func(t *testing.T) {
+		submit := func(body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/api/jobs", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			assert.NoError(t, handler.HandleNewJob(e.NewContext(req, rec)))
+			return rec
+		}
+
+		rec := submit(`{"url":"https://example.com","priority":"urgent"}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec = submit(`{"url":"https://example.com","priority":"high"}`)
+		if assert.Equal(t, http.StatusCreated, rec.Code) {
+			assert.Contains(t, rec.Body.String(), `"priority":"high"`)
+			length, err := rdb.XLen(t.Context(), queue.StreamName(models.PriorityHigh)).Result()
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), length)
+		}
+	})
 }
 
 func TestHandleGetJobs(t *testing.T) {
@@ -104,8 +128,8 @@ func TestHandleGetJobs(t *testing.T) {
 		Addr: mr.Addr(),
 	})
 
-	var archiveStore *store.ArchiveStore
-	handler := NewHandler(rdb, t.TempDir(), archiveStore)
+	archiveStore, _ := openArchiveStore(t)
+	handler := NewHandler(rdb, storage.NewLocal(t.TempDir()), archiveStore)
 	e := echo.New()
 
 	t.Run("Empty", func(t *testing.T) {
@@ -167,3 +191,77 @@ func TestHandleGetJobs(t *testing.T) {
 		}
 	})
 }
+
+func TestHandleNewJobEnforcesStorageQuota(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Failed to start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	archiveStore, _ := openArchiveStore(t)
+	insertArchiveFixture(t, archiveStore, models.Archive{ID: uuid.New(), Name: "scratch", Filename: "scratch.wacz", Tags: []string{"temp"}, SizeBytes: 2048})
+	handler := NewHandler(rdb, storage.NewLocal(t.TempDir()), archiveStore)
+	handler.SetStorageQuota(quota.Quota{GlobalBytes: 1 << 20, TagBytes: map[string]int64{"temp": 2048}})
+	e := echo.New()
+
+	submit := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/jobs", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handler.HandleNewJob(e.NewContext(req, rec)))
+		return rec
+	}
+
+	rec := submit(`{"url":"https://example.com","tags":["temp"]}`)
+	assert.Equal(t, http.StatusInsufficientStorage, rec.Code)
+	assert.Contains(t, rec.Body.String(), `Storage quota exceeded: tag \"temp\" uses 2.0 KB of 2.0 KB`)
+
+	rec = submit(`{"url":"https://example.com","tags":["news"]}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	entries, err := rdb.XLen(t.Context(), "crawl_stream").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), entries)
+}
+
+func TestHandleNewJobEnforcesCrawlLimits(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Failed to start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	archiveStore, _ := openArchiveStore(t)
+	handler := NewHandler(rdb, storage.NewLocal(t.TempDir()), archiveStore)
+	e := echo.New()
+	e.IPExtractor = echo.ExtractIPDirect()
+
+	submit := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/jobs", strings.NewReader(`{"url":"https://example.com"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handler.HandleNewJob(e.NewContext(req, rec)))
+		return rec
+	}
+
+	handler.SetCrawlLimits(queue.Limits{Rate: 1, RateWindow: time.Minute})
+	assert.Equal(t, http.StatusCreated, submit("192.0.2.1:1234").Code)
+	rec := submit("192.0.2.1:1234")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusCreated, submit("192.0.2.2:1234").Code)
+
+	handler.SetCrawlLimits(queue.Limits{MaxQueueLength: 2})
+	rec = submit("192.0.2.3:1234")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Contains(t, rec.Body.String(), "the crawl queue is full")
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+	entries, err := rdb.XLen(t.Context(), "crawl_stream").Result()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), entries)
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/JuanSaenz04/archiver/internal/auth"
+	"github.com/labstack/echo/v5"
+)
+
+const errGroupNotAllowed = "Your groups do not grant access to Archiver"
+
+// ProxyAuth reads the user signed in by an authentication proxy from the
+// request headers it sets. Headers are only trusted on connections coming
+// from TrustedProxies, as anyone else could set them.
+type ProxyAuth struct {
+	UserHeader   string
+	GroupsHeader string
+	// AdminGroups, when set, decide who is an administrator. When
+	// UserGroups is set, only members of UserGroups or AdminGroups may use
+	// Archiver.
+	AdminGroups    []string
+	UserGroups     []string
+	TrustedProxies []*net.IPNet
+}
+
+// ProxyAuthFromEnv reads AUTH_USER_HEADER, AUTH_GROUPS_HEADER,
+// AUTH_ADMIN_GROUPS, AUTH_USER_GROUPS and TRUSTED_PROXIES.
+func ProxyAuthFromEnv() (ProxyAuth, error) {
+	proxyAuth := ProxyAuth{
+		UserHeader:     envOrDefault("AUTH_USER_HEADER", "Remote-User"),
+		GroupsHeader:   envOrDefault("AUTH_GROUPS_HEADER", "Remote-Groups"),
+		AdminGroups:    splitGroups(os.Getenv("AUTH_ADMIN_GROUPS")),
+		UserGroups:     splitGroups(os.Getenv("AUTH_USER_GROUPS")),
+		TrustedProxies: parseTrustedProxies(os.Getenv("TRUSTED_PROXIES")),
+	}
+	if len(proxyAuth.TrustedProxies) == 0 {
+		return ProxyAuth{}, errors.New("AUTH_MODE=proxy requires TRUSTED_PROXIES")
+	}
+	return proxyAuth, nil
+}
+
+func envOrDefault(name, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func splitGroups(value string) []string {
+	groups := make([]string, 0)
+	for group := range strings.SplitSeq(value, ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// trusts reports whether the request comes straight from a trusted proxy.
+func (proxyAuth ProxyAuth) trusts(req *http.Request) bool {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipnet := range proxyAuth.TrustedProxies {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (proxyAuth ProxyAuth) isAdmin(groups []string) bool {
+	return slices.ContainsFunc(groups, func(group string) bool {
+		return slices.Contains(proxyAuth.AdminGroups, group)
+	})
+}
+
+func (proxyAuth ProxyAuth) allows(groups []string) bool {
+	if len(proxyAuth.UserGroups) == 0 || proxyAuth.isAdmin(groups) {
+		return true
+	}
+	return slices.ContainsFunc(groups, func(group string) bool {
+		return slices.Contains(proxyAuth.UserGroups, group)
+	})
+}
+
+// authenticateProxyUser signs in the user named by the proxy headers,
+// creating them on their first request.
+func (handler *Handler) authenticateProxyUser() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			proxyAuth := handler.proxyAuth
+			if proxyAuth == nil {
+				return next(c)
+			}
+			if _, ok := currentUser(c); ok {
+				return next(c)
+			}
+
+			req := c.Request()
+			username := auth.NormalizeUsername(req.Header.Get(proxyAuth.UserHeader))
+			if username == "" {
+				return next(c)
+			}
+			if !proxyAuth.trusts(req) {
+				slog.Warn("ignoring identity headers from untrusted source", "remote_addr", req.RemoteAddr)
+				return next(c)
+			}
+
+			groups := splitGroups(req.Header.Get(proxyAuth.GroupsHeader))
+			if !proxyAuth.allows(groups) {
+				return respondWithError(http.StatusForbidden, errGroupNotAllowed, c)
+			}
+
+			user, err := auth.EnsureUser(req.Context(), handler.archiveStore, username)
+			if err != nil {
+				slog.Error("failed to load proxy user", "username", username, "error", err)
+				return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+			}
+			// Group membership is stored so that it also applies where the
+			// headers are missing, as on replay access grants.
+			if isAdmin := proxyAuth.isAdmin(groups); len(proxyAuth.AdminGroups) > 0 && isAdmin != user.IsAdmin {
+				if err := handler.archiveStore.SetUserAdmin(req.Context(), user.ID, isAdmin); err != nil {
+					slog.Error("failed to update proxy user", "username", username, "error", err)
+					return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+				}
+				user.IsAdmin = isAdmin
+			}
+
+			c.Set(userContextKey, user)
+			return next(c)
+		}
+	}
+}
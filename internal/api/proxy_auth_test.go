@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/queue"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/labstack/echo/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveProxyRequest(e *echo.Echo, method, target, body, remoteAddr, user, groups string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderOrigin, testRouteConfig.AppPublicURL)
+	if user != "" {
+		req.Header.Set("Remote-User", user)
+	}
+	if groups != "" {
+		req.Header.Set("Remote-Groups", groups)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestProxyAuthFromEnv(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "")
+	_, err := ProxyAuthFromEnv()
+	assert.Error(t, err, "identity headers must not be trusted from anyone")
+
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, not-an-ip")
+	t.Setenv("AUTH_GROUPS_HEADER", "X-Groups")
+	t.Setenv("AUTH_ADMIN_GROUPS", "admins, ops")
+	proxyAuth, err := ProxyAuthFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, "Remote-User", proxyAuth.UserHeader)
+	assert.Equal(t, "X-Groups", proxyAuth.GroupsHeader)
+	assert.Equal(t, []string{"admins", "ops"}, proxyAuth.AdminGroups)
+	assert.Empty(t, proxyAuth.UserGroups)
+	assert.Len(t, proxyAuth.TrustedProxies, 1)
+}
+
+func TestProxyAuthentication(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	archiveStore, _ := openArchiveStore(t)
+
+	handler := NewHandler(rdb, nil, archiveStore)
+	_, trusted, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+	handler.SetProxyAuth(ProxyAuth{
+		UserHeader:     "Remote-User",
+		GroupsHeader:   "Remote-Groups",
+		AdminGroups:    []string{"admins"},
+		UserGroups:     []string{"archivists"},
+		TrustedProxies: []*net.IPNet{trusted},
+	})
+	e := echo.New()
+	handler.setMainRoutes(e, testRouteConfig, testFrontendFS)
+
+	const proxy, outsider = "10.0.0.2:4000", "203.0.113.7:4000"
+
+	t.Run("config reports proxy mode", func(t *testing.T) {
+		rec := serveProxyRequest(e, http.MethodGet, "/api/config", "", outsider, "", "")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"auth_mode":"proxy"`)
+	})
+
+	t.Run("ignores headers from untrusted sources", func(t *testing.T) {
+		rec := serveProxyRequest(e, http.MethodGet, "/api/auth/me", "", outsider, "alice", "admins")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		rec = serveProxyRequest(e, http.MethodGet, "/api/auth/me", "", proxy, "", "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("requires an allowed group", func(t *testing.T) {
+		rec := serveProxyRequest(e, http.MethodGet, "/api/archives", "", proxy, "mallory", "guests")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("creates users and grants admin by group", func(t *testing.T) {
+		rec := serveProxyRequest(e, http.MethodGet, "/api/auth/me", "", proxy, "Alice", "archivists")
+		require.Equal(t, http.StatusOK, rec.Code)
+		var user models.User
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &user))
+		assert.Equal(t, "alice", user.Username)
+		assert.False(t, user.IsAdmin)
+
+		rec = serveProxyRequest(e, http.MethodGet, "/api/users", "", proxy, "alice", "archivists")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		rec = serveProxyRequest(e, http.MethodGet, "/api/users", "", proxy, "bob", "admins")
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		rec = serveProxyRequest(e, http.MethodGet, "/api/auth/me", "", proxy, "alice", "archivists")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), user.ID.String(), "the same user should be reused")
+	})
+
+	t.Run("password login is unavailable", func(t *testing.T) {
+		rec := serveProxyRequest(e, http.MethodPost, "/api/auth/login", `{"username":"alice","password":"whatever"}`, proxy, "alice", "archivists")
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	})
+
+	t.Run("attributes jobs to the user", func(t *testing.T) {
+		rec := serveProxyRequest(e, http.MethodPost, "/api/jobs", `{"url":"https://example.com","name":"Example"}`, proxy, "alice", "archivists")
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+
+		alice, err := archiveStore.GetUserByUsername(t.Context(), "alice")
+		require.NoError(t, err)
+
+		entries, err := rdb.XRange(t.Context(), "crawl_stream", "-", "+").Result()
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		var msg queue.CrawlMessage
+		require.NoError(t, json.Unmarshal([]byte(entries[0].Values["payload"].(string)), &msg))
+		if assert.NotNil(t, msg.Archive.OwnerID) {
+			assert.Equal(t, alice.ID, *msg.Archive.OwnerID)
+		}
+
+		rec = serveProxyRequest(e, http.MethodGet, "/api/jobs", "", proxy, "alice", "archivists")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"owner":"alice"`)
+	})
+}
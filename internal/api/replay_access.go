@@ -0,0 +1,131 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	replayAccessParam = "access"
+	// replayAccessLifetime is how long a viewer can keep loading an archive
+	// it opened.
+	replayAccessLifetime = 12 * time.Hour
+)
+
+const errInvalidReplayAccess = "Replay link is invalid or expired"
+
+// The session cookie never reaches the replay origin, so the app hands the
+// viewer a signed access grant for the archive it opens. A grant names the
+// user it was issued to and is checked against the archive's visibility on
+// every request, so it stops working when the archive is made private.
+
+func replayAccessMessage(archiveId, userId uuid.UUID, expiresAt int64) string {
+	return fmt.Sprintf("replay|%s|%s|%d", archiveId, userId, expiresAt)
+}
+
+func (handler *Handler) replayAccess(archiveId, userId uuid.UUID, expiresAt time.Time) string {
+	expires := expiresAt.Unix()
+	signature := handler.signer.Sign(replayAccessMessage(archiveId, userId, expires))
+	return fmt.Sprintf("%s.%d.%s", userId, expires, signature)
+}
+
+// replayAccessUser returns the user an access grant for archiveId was issued
+// to, if it is valid at now.
+func (handler *Handler) replayAccessUser(archiveId uuid.UUID, access string, now time.Time) (uuid.UUID, bool) {
+	parts := strings.Split(access, ".")
+	if len(parts) != 3 {
+		return uuid.Nil, false
+	}
+	userId, err := uuid.Parse(parts[0])
+	if err != nil {
+		return uuid.Nil, false
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || now.Unix() >= expires {
+		return uuid.Nil, false
+	}
+	if !handler.signer.Verify(replayAccessMessage(archiveId, userId, expires), parts[2]) {
+		return uuid.Nil, false
+	}
+	return userId, true
+}
+
+// replayPath is the path the viewer loads archiveId from, carrying an
+// access grant for the current user when authentication is enabled.
+func (handler *Handler) replayPath(c *echo.Context, archiveId uuid.UUID, suffix string) string {
+	path := "/archives/" + archiveId.String() + suffix
+	user, ok := currentUser(c)
+	if !handler.authEnabled || !ok {
+		return path
+	}
+	access := handler.replayAccess(archiveId, user.ID, time.Now().Add(replayAccessLifetime))
+	return path + "?" + url.Values{replayAccessParam: {access}}.Encode()
+}
+
+// authenticateReplayAccess signs in the user named by a valid access grant
+// on the replay origin.
+func (handler *Handler) authenticateReplayAccess() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			access := c.QueryParam(replayAccessParam)
+			if !handler.authEnabled || access == "" {
+				return next(c)
+			}
+			if _, ok := currentUser(c); ok {
+				return next(c)
+			}
+
+			archiveId, err := uuid.Parse(c.Param("archiveId"))
+			if err != nil {
+				return respondWithError(http.StatusBadRequest, errInvalidId, c)
+			}
+			userId, ok := handler.replayAccessUser(archiveId, access, time.Now())
+			if !ok {
+				return respondWithError(http.StatusForbidden, errInvalidReplayAccess, c)
+			}
+
+			user, err := handler.archiveStore.GetUser(c.Request().Context(), userId)
+			if errors.Is(err, store.ErrUserNotFound) {
+				return respondWithError(http.StatusForbidden, errInvalidReplayAccess, c)
+			}
+			if err != nil {
+				slog.Error("failed to load replay user", "user_id", userId, "error", err)
+				return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+			}
+			c.Set(userContextKey, user)
+			return next(c)
+		}
+	}
+}
+
+// HandleGetArchiveReplay returns where the viewer should load an archive
+// from on the replay origin.
+func (handler *Handler) HandleGetArchiveReplay(c *echo.Context) error {
+	archiveId, err := uuid.Parse(c.Param("archiveId"))
+	if err != nil {
+		return respondWithError(http.StatusBadRequest, errInvalidId, c)
+	}
+
+	archive, err := handler.getVisibleArchive(c, archiveId)
+	if err != nil {
+		return handler.respondWithArchiveLookupError(c, archiveId, err)
+	}
+
+	// Deduplicated captures replay through a collection that also loads the
+	// archives holding their revisited payloads.
+	suffix := ""
+	if archive.DedupSavedBytes > 0 {
+		suffix = "/collection.json"
+	}
+	return c.JSON(http.StatusOK, map[string]string{"source": handler.replayPath(c, archiveId, suffix)})
+}
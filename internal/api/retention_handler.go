@@ -0,0 +1,156 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/retention"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	errInvalidRuleId         = "Invalid retention rule ID"
+	errRetentionRuleNotFound = "Retention rule not found"
+)
+
+type retentionRuleRequest struct {
+	Name       string `json:"name"`
+	Tag        string `json:"tag"`
+	MaxAgeDays int    `json:"max_age_days"`
+	KeepLast   int    `json:"keep_last"`
+	Hold       bool   `json:"hold"`
+	DryRun     *bool  `json:"dry_run"`
+}
+
+// bindRetentionRule reads a rule from the request body. Rules start in
+// dry-run mode unless the request explicitly turns it off.
+func bindRetentionRule(c *echo.Context) (models.RetentionRule, error) {
+	var request retentionRuleRequest
+	if err := c.Bind(&request); err != nil {
+		return models.RetentionRule{}, err
+	}
+
+	rule := models.RetentionRule{
+		Name:       strings.TrimSpace(request.Name),
+		Tag:        strings.TrimSpace(request.Tag),
+		MaxAgeDays: request.MaxAgeDays,
+		KeepLast:   request.KeepLast,
+		Hold:       request.Hold,
+		DryRun:     request.DryRun == nil || *request.DryRun,
+	}
+	if rule.Name == "" {
+		return rule, errors.New("name is required")
+	}
+	return rule, retention.ValidateRule(rule)
+}
+
+func (handler *Handler) HandleGetRetentionRules(c *echo.Context) error {
+	rules, err := handler.archiveStore.ListRetentionRules(c.Request().Context())
+	if err != nil {
+		slog.Error("failed to list retention rules", "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+	return c.JSON(http.StatusOK, map[string]any{"rules": rules})
+}
+
+func (handler *Handler) HandleCreateRetentionRule(c *echo.Context) error {
+	rule, err := bindRetentionRule(c)
+	if err != nil {
+		return respondWithError(http.StatusBadRequest, err.Error(), c)
+	}
+	rule.ID = uuid.New()
+	rule.CreatedAt = time.Now().UTC()
+
+	if err := handler.archiveStore.InsertRetentionRule(c.Request().Context(), rule); err != nil {
+		slog.Error("failed to create retention rule", "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+
+	slog.Info("retention rule created", "rule_id", rule.ID, "name", rule.Name, "dry_run", rule.DryRun)
+	handler.audit(c, auditRetentionRuleCreate, rule.ID.String(), nil, rule)
+	return c.JSON(http.StatusCreated, rule)
+}
+
+func (handler *Handler) HandleUpdateRetentionRule(c *echo.Context) error {
+	ruleId, err := uuid.Parse(c.Param("ruleId"))
+	if err != nil {
+		return respondWithError(http.StatusBadRequest, errInvalidRuleId, c)
+	}
+	rule, err := bindRetentionRule(c)
+	if err != nil {
+		return respondWithError(http.StatusBadRequest, err.Error(), c)
+	}
+	rule.ID = ruleId
+
+	previous, err := handler.findRetentionRule(c, ruleId)
+	if err == nil {
+		rule.CreatedAt = previous.CreatedAt
+		err = handler.archiveStore.UpdateRetentionRule(c.Request().Context(), rule)
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrRetentionRuleNotFound) {
+			return respondWithError(http.StatusNotFound, errRetentionRuleNotFound, c)
+		}
+		slog.Error("failed to update retention rule", "rule_id", ruleId, "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+
+	slog.Info("retention rule updated", "rule_id", rule.ID, "name", rule.Name, "dry_run", rule.DryRun)
+	handler.audit(c, auditRetentionRuleUpdate, rule.ID.String(), previous, rule)
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (handler *Handler) HandleDeleteRetentionRule(c *echo.Context) error {
+	ruleId, err := uuid.Parse(c.Param("ruleId"))
+	if err != nil {
+		return respondWithError(http.StatusBadRequest, errInvalidRuleId, c)
+	}
+
+	previous, err := handler.findRetentionRule(c, ruleId)
+	if err == nil {
+		err = handler.archiveStore.DeleteRetentionRule(c.Request().Context(), ruleId)
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrRetentionRuleNotFound) {
+			return respondWithError(http.StatusNotFound, errRetentionRuleNotFound, c)
+		}
+		slog.Error("failed to delete retention rule", "rule_id", ruleId, "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+
+	slog.Info("retention rule deleted", "rule_id", ruleId)
+	handler.audit(c, auditRetentionRuleDelete, ruleId.String(), previous, nil)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// findRetentionRule returns the rule ruleId, or ErrRetentionRuleNotFound.
+func (handler *Handler) findRetentionRule(c *echo.Context, ruleId uuid.UUID) (models.RetentionRule, error) {
+	rules, err := handler.archiveStore.ListRetentionRules(c.Request().Context())
+	if err != nil {
+		return models.RetentionRule{}, err
+	}
+	for _, rule := range rules {
+		if rule.ID == ruleId {
+			return rule, nil
+		}
+	}
+	return models.RetentionRule{}, store.ErrRetentionRuleNotFound
+}
+
+// HandlePreviewRetention reports every archive the current rules would
+// expire, including those matched by rules still in dry-run mode.
+func (handler *Handler) HandlePreviewRetention(c *echo.Context) error {
+	enforcer := retention.NewEnforcer(handler.archiveStore, handler.storage)
+	expirations, err := enforcer.Preview(c.Request().Context(), time.Now().UTC())
+	if err != nil {
+		slog.Error("failed to preview retention rules", "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+	return c.JSON(http.StatusOK, map[string]any{"expirations": expirations})
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/retention"
+	"github.com/JuanSaenz04/archiver/internal/storage"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func serveRetentionRequest(t *testing.T, e *echo.Echo, handle echo.HandlerFunc, method, body, ruleId string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, "/api/retention/rules", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	if ruleId != "" {
+		c.SetPathValues([]echo.PathValue{{Name: "ruleId", Value: ruleId}})
+	}
+	assert.NoError(t, handle(c))
+	return rec
+}
+
+func TestRetentionRuleHandlers(t *testing.T) {
+	archiveStore, _ := openArchiveStore(t)
+	handler := &Handler{archiveStore: archiveStore, storage: storage.NewLocal(t.TempDir())}
+	e := echo.New()
+
+	rec := serveRetentionRequest(t, e, handler.HandleCreateRetentionRule, http.MethodPost, `{"name":"temp","tag":"temp","max_age_days":30}`, "")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var created models.RetentionRule
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.True(t, created.DryRun, "new rules should start in dry-run mode")
+
+	rec = serveRetentionRequest(t, e, handler.HandleCreateRetentionRule, http.MethodPost, `{"name":"broken","hold":true,"keep_last":2}`, "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serveRetentionRequest(t, e, handler.HandleUpdateRetentionRule, http.MethodPut, `{"name":"temp","tag":"temp","max_age_days":14,"dry_run":false}`, created.ID.String())
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = serveRetentionRequest(t, e, handler.HandleGetRetentionRules, http.MethodGet, "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var list struct {
+		Rules []models.RetentionRule `json:"rules"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	if assert.Len(t, list.Rules, 1) {
+		assert.Equal(t, 14, list.Rules[0].MaxAgeDays)
+		assert.False(t, list.Rules[0].DryRun)
+	}
+
+	rec = serveRetentionRequest(t, e, handler.HandleUpdateRetentionRule, http.MethodPut, `{"name":"missing","keep_last":1}`, uuid.NewString())
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = serveRetentionRequest(t, e, handler.HandleDeleteRetentionRule, http.MethodDelete, "", created.ID.String())
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = serveRetentionRequest(t, e, handler.HandleDeleteRetentionRule, http.MethodDelete, "", created.ID.String())
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandlePreviewRetention(t *testing.T) {
+	archiveStore, _ := openArchiveStore(t)
+	handler := &Handler{archiveStore: archiveStore, storage: storage.NewLocal(t.TempDir())}
+	e := echo.New()
+	insertArchiveFixture(t, archiveStore, models.Archive{ID: uuid.New(), Name: "scratch", Filename: "scratch.wacz", Tags: []string{"temp"}, CreatedAt: time.Now().UTC().Add(-60 * 24 * time.Hour)})
+	insertArchiveFixture(t, archiveStore, models.Archive{ID: uuid.New(), Name: "fresh", Filename: "fresh.wacz", Tags: []string{"temp"}, CreatedAt: time.Now().UTC()})
+
+	rec := serveRetentionRequest(t, e, handler.HandleCreateRetentionRule, http.MethodPost, `{"name":"temp","tag":"temp","max_age_days":30}`, "")
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = serveRetentionRequest(t, e, handler.HandlePreviewRetention, http.MethodGet, "", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var preview struct {
+		Expirations []retention.Expiration `json:"expirations"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &preview))
+	if assert.Len(t, preview.Expirations, 1) {
+		assert.Equal(t, "scratch", preview.Expirations[0].Archive.Name)
+		assert.True(t, preview.Expirations[0].DryRun)
+	}
+
+	archives, err := archiveStore.List(t.Context())
+	assert.NoError(t, err)
+	assert.Len(t, archives, 2, "preview must not delete anything")
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"crypto/subtle"
 	"embed"
 	"errors"
 	"io/fs"
@@ -28,28 +29,75 @@ func (handler *Handler) SetMainRoutes(e *echo.Echo, config RouteConfig) {
 func (handler *Handler) setMainRoutes(e *echo.Echo, config RouteConfig, dist fs.FS) {
 	e.Use(middleware.Gzip())
 
+	handler.secureCookies = strings.HasPrefix(config.AppPublicURL, "https://")
+	handler.replayOrigin = config.ReplayPublicURL
+
 	apiGroup := e.Group("/api")
 	apiGroup.Use(requestLogger())
+	apiGroup.Use(handler.authenticateAPIToken())
 	apiGroup.Use(requireTrustedOrigin(config.AppPublicURL))
+	apiGroup.Use(handler.authenticateProxyUser())
+	apiGroup.Use(handler.requireUser())
 
 	apiGroup.GET("/config", func(c *echo.Context) error {
 		c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
-		return c.JSON(http.StatusOK, map[string]string{
+		return c.JSON(http.StatusOK, map[string]any{
 			"replay_origin": config.ReplayPublicURL,
+			"auth_enabled":  handler.authEnabled,
+			"auth_mode":     handler.authMode(),
 		})
 	})
+	if handler.authEnabled {
+		apiGroup.GET("/auth/me", handler.HandleGetCurrentUser)
+		apiGroup.GET("/users", handler.HandleGetUsers, requireAdmin)
+		apiGroup.DELETE("/users/:userId", handler.HandleDeleteUser, requireAdmin)
+	}
+	if handler.authMode() == "local" {
+		apiGroup.POST("/auth/login", handler.HandleLogin)
+		apiGroup.POST("/auth/logout", handler.HandleLogout)
+		apiGroup.POST("/users", handler.HandleCreateUser, requireAdmin)
+	}
 	apiGroup.POST("/jobs", handler.HandleNewJob)
 	apiGroup.GET("/jobs", handler.HandleGetJobs)
 	apiGroup.GET("/archives", handler.HandleGetArchives)
 	apiGroup.GET("/archives/tags", handler.HandleGetArchiveTags)
+	apiGroup.GET("/archives/diff", handler.HandleDiffArchives)
+	apiGroup.GET("/stats/dedup", handler.HandleGetDedupStats, requireAdmin)
+	apiGroup.GET("/stats/storage", handler.HandleGetStorageStats, requireAdmin)
 	apiGroup.DELETE("/archives/:archiveId", handler.HandleDeleteArchive)
 	apiGroup.PUT("/archives/:archiveId", handler.HandleModifyArchiveMetadata)
+	apiGroup.GET("/archives/:archiveId/replay", handler.HandleGetArchiveReplay)
+	apiGroup.GET("/archives/:archiveId/share", handler.HandleGetShareLinks)
+	apiGroup.POST("/archives/:archiveId/share", handler.HandleCreateShareLink)
+	apiGroup.DELETE("/archives/:archiveId/share/:shareId", handler.HandleDeleteShareLink)
+	apiGroup.POST("/archives/:archiveId/restore", handler.HandleRestoreArchive)
+	apiGroup.GET("/trash", handler.HandleGetTrash)
+	apiGroup.GET("/retention/rules", handler.HandleGetRetentionRules, requireAdmin)
+	apiGroup.POST("/retention/rules", handler.HandleCreateRetentionRule, requireAdmin)
+	apiGroup.PUT("/retention/rules/:ruleId", handler.HandleUpdateRetentionRule, requireAdmin)
+	apiGroup.DELETE("/retention/rules/:ruleId", handler.HandleDeleteRetentionRule, requireAdmin)
+	apiGroup.GET("/retention/preview", handler.HandlePreviewRetention, requireAdmin)
+	apiGroup.GET("/subjects/:subjectId/snapshots", handler.HandleGetSubjectSnapshots)
+	apiGroup.POST("/subjects/:subjectId/captures", handler.HandleCaptureSubject)
+	apiGroup.GET("/subjects/:subjectId/diff", handler.HandleDiffSubject)
+	apiGroup.POST("/admin/sync", handler.HandleSyncStorage, requireAdmin)
+	apiGroup.GET("/audit", handler.HandleGetAuditLog, requireAdmin)
+	apiGroup.GET("/tokens", handler.HandleGetAPITokens)
+	apiGroup.POST("/tokens", handler.HandleCreateAPIToken)
+	apiGroup.DELETE("/tokens/:tokenId", handler.HandleDeleteAPIToken)
+
+	if handler.workerToken != "" {
+		internalGroup := e.Group("/internal")
+		internalGroup.Use(requestLogger())
+		internalGroup.Use(requireWorkerToken(handler.workerToken))
+		internalGroup.POST("/archives", handler.HandleUploadArchive)
+	}
 
 	e.GET("/*", func(c *echo.Context) error {
 		path := c.Request().URL.Path
 
 		// API requests and replay assets must never fall back to the frontend.
-		if strings.HasPrefix(path, "/api") || path == "/viewer.html" || path == "/replay" || strings.HasPrefix(path, "/replay/") {
+		if strings.HasPrefix(path, "/api") || strings.HasPrefix(path, "/internal") || path == "/viewer.html" || path == "/replay" || strings.HasPrefix(path, "/replay/") {
 			return echo.ErrNotFound
 		}
 
@@ -91,8 +139,17 @@ func (handler *Handler) setReplayRoutes(e *echo.Echo, config RouteConfig, dist f
 		cleanPath := strings.TrimPrefix(c.Request().URL.Path, "/")
 		return c.FileFS(cleanPath, dist)
 	})
-	e.GET("/archives/:archiveId", handler.HandleGetArchive)
-	e.HEAD("/archives/:archiveId", handler.HandleGetArchive)
+	// Viewers are identified by an access grant, an API token or the
+	// headers of an authentication proxy guarding this origin too, and
+	// anyone may open the archives of a share link.
+	archivesGroup := e.Group("/archives")
+	archivesGroup.Use(handler.authenticateShareLink())
+	archivesGroup.Use(handler.authenticateAPIToken())
+	archivesGroup.Use(handler.authenticateProxyUser())
+	archivesGroup.Use(handler.authenticateReplayAccess())
+	archivesGroup.GET("/:archiveId", handler.HandleGetArchive)
+	archivesGroup.HEAD("/:archiveId", handler.HandleGetArchive)
+	archivesGroup.GET("/:archiveId/collection.json", handler.HandleGetArchiveCollection)
 }
 
 func requestLogger() echo.MiddlewareFunc {
@@ -128,6 +185,9 @@ func requireTrustedOrigin(appPublicURL string) echo.MiddlewareFunc {
 			case http.MethodGet, http.MethodHead, http.MethodOptions:
 				return next(c)
 			}
+			if _, ok := currentAPIToken(c); ok {
+				return next(c)
+			}
 
 			if c.Request().Header.Get(echo.HeaderOrigin) != appPublicURL {
 				return echo.NewHTTPError(http.StatusForbidden, "request origin not allowed")
@@ -137,3 +197,17 @@ func requireTrustedOrigin(appPublicURL string) echo.MiddlewareFunc {
 		}
 	}
 }
+
+func requireWorkerToken(token string) echo.MiddlewareFunc {
+	expected := []byte("Bearer " + token)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			authorization := []byte(c.Request().Header.Get(echo.HeaderAuthorization))
+			if subtle.ConstantTimeCompare(authorization, expected) != 1 {
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid worker token")
+			}
+
+			return next(c)
+		}
+	}
+}
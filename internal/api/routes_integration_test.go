@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/storage"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v5"
 	"github.com/stretchr/testify/assert"
@@ -37,7 +38,7 @@ func TestMainAndReplayServersOverHTTP(t *testing.T) {
 		SizeBytes: int64(len(archiveContent)),
 	})
 
-	handler := &Handler{archivesDir: archivesDir, archiveStore: archiveStore}
+	handler := &Handler{storage: storage.NewLocal(archivesDir), archiveStore: archiveStore}
 	mainEcho := echo.New()
 	replayEcho := echo.New()
 	mainServer := httptest.NewUnstartedServer(mainEcho)
@@ -67,7 +68,7 @@ func TestMainAndReplayServersOverHTTP(t *testing.T) {
 		assert.Equal(t, "no-store", response.Header.Get("Cache-Control"))
 		assert.Empty(t, response.Header.Get("Access-Control-Allow-Origin"))
 
-		var runtimeConfig map[string]string
+		var runtimeConfig map[string]any
 		require.NoError(t, json.Unmarshal(body, &runtimeConfig))
 		assert.Equal(t, replayServer.URL, runtimeConfig["replay_origin"])
 	})
@@ -34,9 +34,10 @@ func TestMainRoutesExposeRuntimeConfigAndNotReplayContent(t *testing.T) {
 		rec := serveRequest(e, http.MethodGet, "/api/config", "")
 		require.Equal(t, http.StatusOK, rec.Code)
 
-		var response map[string]string
+		var response map[string]any
 		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
 		assert.Equal(t, testRouteConfig.ReplayPublicURL, response["replay_origin"])
+		assert.Equal(t, false, response["auth_enabled"])
 		assert.Equal(t, "no-store", rec.Header().Get(echo.HeaderCacheControl))
 	})
 
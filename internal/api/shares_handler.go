@@ -0,0 +1,225 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	shareLinkParam      = "share"
+	shareLinkContextKey = "share_link"
+	defaultShareDays    = 7
+	maxShareDays        = 365
+)
+
+const (
+	errInvalidShareLink = "Share link is invalid, expired or revoked"
+	errInvalidShareId   = "Invalid share link ID"
+	errShareNotFound    = "Share link not found"
+	errInvalidShareDays = "expires_in_days must be between 1 and 365"
+)
+
+type createShareLinkRequest struct {
+	Name          string `json:"name"`
+	ExpiresInDays int    `json:"expires_in_days"`
+}
+
+type shareLinkResponse struct {
+	models.ShareLink
+	URL string `json:"url"`
+}
+
+// sharedArchive is the archive a request on the replay origin was let in
+// by a share link for.
+type sharedArchive struct {
+	link      models.ShareLink
+	archiveId uuid.UUID
+}
+
+// A share link is signed for each archive it opens: the shared one, and the
+// archives its collection loads revisited payloads from.
+
+func shareLinkMessage(link models.ShareLink, archiveId uuid.UUID) string {
+	return fmt.Sprintf("share|%s|%s|%d", archiveId, link.ID, link.ExpiresAt.Unix())
+}
+
+func (handler *Handler) sharePath(link models.ShareLink, archiveId uuid.UUID, suffix string) string {
+	token := link.ID.String() + "." + handler.signer.Sign(shareLinkMessage(link, archiveId))
+	return "/archives/" + archiveId.String() + suffix + "?" + url.Values{shareLinkParam: {token}}.Encode()
+}
+
+func (handler *Handler) shareLinkResponse(link models.ShareLink, archive models.Archive) shareLinkResponse {
+	suffix := ""
+	if archive.DedupSavedBytes > 0 {
+		suffix = "/collection.json"
+	}
+	source := handler.sharePath(link, archive.ID, suffix)
+	return shareLinkResponse{
+		ShareLink: link,
+		URL:       handler.replayOrigin + "/viewer.html?" + url.Values{"source": {source}}.Encode(),
+	}
+}
+
+func currentSharedArchive(c *echo.Context) (sharedArchive, bool) {
+	shared, ok := c.Get(shareLinkContextKey).(sharedArchive)
+	return shared, ok
+}
+
+// authenticateShareLink lets a request on the replay origin carrying a
+// valid share link see the archive it was signed for.
+func (handler *Handler) authenticateShareLink() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			token := c.QueryParam(shareLinkParam)
+			if token == "" {
+				return next(c)
+			}
+
+			archiveId, err := uuid.Parse(c.Param("archiveId"))
+			if err != nil {
+				return respondWithError(http.StatusBadRequest, errInvalidId, c)
+			}
+			id, signature, _ := strings.Cut(token, ".")
+			linkId, err := uuid.Parse(id)
+			if err != nil {
+				return respondWithError(http.StatusForbidden, errInvalidShareLink, c)
+			}
+
+			link, err := handler.archiveStore.GetShareLink(c.Request().Context(), linkId, time.Now())
+			if errors.Is(err, store.ErrShareLinkNotFound) {
+				return respondWithError(http.StatusForbidden, errInvalidShareLink, c)
+			}
+			if err != nil {
+				slog.Error("failed to load share link", "share_id", linkId, "error", err)
+				return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+			}
+			if !handler.signer.Verify(shareLinkMessage(link, archiveId), signature) {
+				return respondWithError(http.StatusForbidden, errInvalidShareLink, c)
+			}
+
+			c.Set(shareLinkContextKey, sharedArchive{link: link, archiveId: archiveId})
+			return next(c)
+		}
+	}
+}
+
+// shareableArchive loads an archive whose share links the current user may
+// manage, which takes the same rights as changing it. When ok is false, the
+// request was already answered and err is the result to return.
+func (handler *Handler) shareableArchive(c *echo.Context) (archive models.Archive, ok bool, err error) {
+	archiveId, err := uuid.Parse(c.Param("archiveId"))
+	if err != nil {
+		return archive, false, respondWithError(http.StatusBadRequest, errInvalidId, c)
+	}
+	archive, err = handler.archiveStore.Get(c.Request().Context(), archiveId)
+	if err != nil {
+		return archive, false, handler.respondWithArchiveLookupError(c, archiveId, err)
+	}
+	if code, message := handler.archiveChangeDenied(c, archive); code != 0 {
+		return archive, false, respondWithError(code, message, c)
+	}
+	return archive, true, nil
+}
+
+func (handler *Handler) HandleGetShareLinks(c *echo.Context) error {
+	archive, ok, err := handler.shareableArchive(c)
+	if !ok {
+		return err
+	}
+
+	links, err := handler.archiveStore.ListShareLinks(c.Request().Context(), archive.ID, time.Now())
+	if err != nil {
+		slog.Error("failed to list share links", "archive_id", archive.ID, "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+
+	responses := make([]shareLinkResponse, 0, len(links))
+	for _, link := range links {
+		responses = append(responses, handler.shareLinkResponse(link, archive))
+	}
+	return c.JSON(http.StatusOK, map[string]any{"links": responses})
+}
+
+func (handler *Handler) HandleCreateShareLink(c *echo.Context) error {
+	var request createShareLinkRequest
+	if err := c.Bind(&request); err != nil {
+		return respondWithError(http.StatusBadRequest, "Malformed request", c)
+	}
+	if request.ExpiresInDays == 0 {
+		request.ExpiresInDays = defaultShareDays
+	}
+	if request.ExpiresInDays < 1 || request.ExpiresInDays > maxShareDays {
+		return respondWithError(http.StatusBadRequest, errInvalidShareDays, c)
+	}
+
+	archive, ok, err := handler.shareableArchive(c)
+	if !ok {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	now := time.Now().UTC().Truncate(time.Second)
+	if err := handler.archiveStore.DeleteExpiredShareLinks(ctx, now); err != nil {
+		slog.Warn("failed to delete expired share links", "error", err)
+	}
+
+	link := models.ShareLink{
+		ID:        uuid.New(),
+		ArchiveID: archive.ID,
+		Name:      strings.TrimSpace(request.Name),
+		CreatedAt: now,
+		ExpiresAt: now.AddDate(0, 0, request.ExpiresInDays),
+	}
+	if user, ok := currentUser(c); ok {
+		link.CreatedBy = &user.ID
+	}
+
+	if err := handler.archiveStore.InsertShareLink(ctx, link); err != nil {
+		slog.Error("failed to store share link", "archive_id", archive.ID, "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+	slog.Info("created share link", "share_id", link.ID, "archive_id", archive.ID, "expires_at", link.ExpiresAt)
+	handler.audit(c, auditArchiveShare, archive.ID.String(), nil, link)
+	return c.JSON(http.StatusCreated, handler.shareLinkResponse(link, archive))
+}
+
+func (handler *Handler) HandleDeleteShareLink(c *echo.Context) error {
+	linkId, err := uuid.Parse(c.Param("shareId"))
+	if err != nil {
+		return respondWithError(http.StatusBadRequest, errInvalidShareId, c)
+	}
+
+	archive, ok, err := handler.shareableArchive(c)
+	if !ok {
+		return err
+	}
+
+	ctx := c.Request().Context()
+	link, err := handler.archiveStore.GetShareLink(ctx, linkId, time.Time{})
+	if err == nil && link.ArchiveID != archive.ID {
+		err = store.ErrShareLinkNotFound
+	}
+	if err == nil {
+		err = handler.archiveStore.DeleteShareLink(ctx, archive.ID, linkId)
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrShareLinkNotFound) {
+			return respondWithError(http.StatusNotFound, errShareNotFound, c)
+		}
+		slog.Error("failed to delete share link", "share_id", linkId, "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+	slog.Info("revoked share link", "share_id", linkId, "archive_id", archive.ID)
+	handler.audit(c, auditArchiveUnshare, archive.ID.String(), link, nil)
+	return c.NoContent(http.StatusNoContent)
+}
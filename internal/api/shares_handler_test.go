@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/auth"
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/storage"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShareLinks(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	archiveStore, _ := openArchiveStore(t)
+	archivesDir := t.TempDir()
+
+	for _, username := range []string{"alice", "bob"} {
+		user, err := auth.NewUser(username, username+" password", false)
+		require.NoError(t, err)
+		require.NoError(t, archiveStore.InsertUser(t.Context(), user))
+	}
+	alice, err := archiveStore.GetUserByUsername(t.Context(), "alice")
+	require.NoError(t, err)
+	bob, err := archiveStore.GetUserByUsername(t.Context(), "bob")
+	require.NoError(t, err)
+
+	archive := models.Archive{ID: uuid.New(), Name: "evidence", Filename: "evidence.wacz", OwnerID: &alice.ID, Visibility: models.VisibilityPrivate, CreatedAt: time.Now().UTC()}
+	other := models.Archive{ID: uuid.New(), Name: "other", Filename: "other.wacz", OwnerID: &alice.ID, Visibility: models.VisibilityPrivate, CreatedAt: time.Now().UTC()}
+	// The shared capture was deduplicated against a private archive of bob.
+	bobs := models.Archive{ID: uuid.New(), Name: "bobs", Filename: "bobs.wacz", OwnerID: &bob.ID, Visibility: models.VisibilityPrivate, CreatedAt: time.Now().UTC()}
+	for _, a := range []models.Archive{archive, other, bobs} {
+		require.NoError(t, os.WriteFile(filepath.Join(archivesDir, a.Filename), []byte(a.Name), 0644))
+		insertArchiveFixture(t, archiveStore, a)
+	}
+	require.NoError(t, archiveStore.RegisterPayloads(t.Context(), archive.ID, nil, []uuid.UUID{other.ID, bobs.ID}))
+
+	handler := NewHandler(rdb, storage.NewLocal(archivesDir), archiveStore)
+	handler.SetAuthEnabled(true)
+	e := echo.New()
+	handler.setMainRoutes(e, testRouteConfig, testFrontendFS)
+	replay := echo.New()
+	handler.setReplayRoutes(replay, testRouteConfig, testFrontendFS)
+
+	aliceCookie := login(t, e, "alice", "alice password")
+	bobCookie := login(t, e, "bob", "bob password")
+	sharePath := "/api/archives/" + archive.ID.String() + "/share"
+
+	var created shareLinkResponse
+	t.Run("only those who may change the archive share it", func(t *testing.T) {
+		rec := serveAuthRequest(e, http.MethodPost, sharePath, `{}`, bobCookie)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		rec = serveAuthRequest(e, http.MethodPost, sharePath, `{"expires_in_days":400}`, aliceCookie)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+		rec = serveAuthRequest(e, http.MethodPost, sharePath, `{"name":" counsel "}`, aliceCookie)
+		require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+		assert.Equal(t, "counsel", created.Name)
+		assert.Equal(t, archive.ID, created.ArchiveID)
+		assert.WithinDuration(t, time.Now().AddDate(0, 0, defaultShareDays), created.ExpiresAt, time.Minute)
+		assert.True(t, strings.HasPrefix(created.URL, testRouteConfig.ReplayPublicURL+"/viewer.html?source="), created.URL)
+	})
+
+	viewerURL, err := url.Parse(created.URL)
+	require.NoError(t, err)
+	source := viewerURL.Query().Get("source")
+
+	t.Run("the link opens the archive without signing in", func(t *testing.T) {
+		rec := serveAuthRequest(replay, http.MethodGet, source, "", nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Equal(t, "evidence", rec.Body.String())
+
+		rec = serveAuthRequest(replay, http.MethodGet, strings.Replace(source, "/archives/"+archive.ID.String(), "/archives/"+archive.ID.String()+"/collection.json", 1), "", nil)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		assert.Contains(t, rec.Body.String(), "share=")
+		assert.Contains(t, rec.Body.String(), other.Filename)
+		assert.NotContains(t, rec.Body.String(), bobs.Filename, "archives the sharer cannot see must not be signed")
+	})
+
+	t.Run("the link opens nothing else", func(t *testing.T) {
+		rec := serveAuthRequest(replay, http.MethodGet, strings.Replace(source, archive.ID.String(), other.ID.String(), 1), "", nil)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		rec = serveAuthRequest(replay, http.MethodGet, "/archives/"+other.ID.String(), "", nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("revoked links stop working", func(t *testing.T) {
+		rec := serveAuthRequest(e, http.MethodGet, sharePath, "", aliceCookie)
+		require.Equal(t, http.StatusOK, rec.Code)
+		var listed struct {
+			Links []shareLinkResponse `json:"links"`
+		}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &listed))
+		require.Len(t, listed.Links, 1)
+		assert.Equal(t, created.URL, listed.Links[0].URL)
+
+		rec = serveAuthRequest(e, http.MethodDelete, sharePath+"/"+created.ID.String(), "", bobCookie)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		rec = serveAuthRequest(e, http.MethodDelete, sharePath+"/"+created.ID.String(), "", aliceCookie)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+
+		rec = serveAuthRequest(replay, http.MethodGet, source, "", nil)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
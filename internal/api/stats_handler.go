@@ -0,0 +1,34 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/labstack/echo/v5"
+)
+
+func (handler *Handler) HandleGetDedupStats(c *echo.Context) error {
+	stats, err := handler.archiveStore.DedupStats(c.Request().Context())
+	if err != nil {
+		slog.Error("failed to load dedup stats", "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+	return c.JSON(http.StatusOK, stats)
+}
+
+func (handler *Handler) HandleGetStorageStats(c *echo.Context) error {
+	stats, err := handler.archiveStore.StorageStats(c.Request().Context())
+	if err != nil {
+		slog.Error("failed to load storage stats", "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"total_bytes":   stats.TotalBytes,
+		"trashed_bytes": stats.TrashedBytes,
+		"archives":      stats.Archives,
+		"by_tag":        stats.ByTag,
+		"by_host":       stats.ByHost,
+		"by_month":      stats.ByMonth,
+		"quota":         handler.quota,
+	})
+}
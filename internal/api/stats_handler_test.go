@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/quota"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleGetDedupStats(t *testing.T) {
+	archiveStore, _ := openArchiveStore(t)
+	insertArchiveFixture(t, archiveStore, models.Archive{ID: uuid.New(), Name: "plain", Filename: "plain.wacz"})
+	insertArchiveFixture(t, archiveStore, models.Archive{ID: uuid.New(), Name: "first", Filename: "first.wacz", DedupSavedBytes: 1000})
+	insertArchiveFixture(t, archiveStore, models.Archive{ID: uuid.New(), Name: "second", Filename: "second.wacz", DedupSavedBytes: 24})
+
+	handler := &Handler{archiveStore: archiveStore}
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/stats/dedup", nil), rec)
+
+	if assert.NoError(t, handler.HandleGetDedupStats(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var stats map[string]int64
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+		assert.Equal(t, map[string]int64{"saved_bytes": 1024, "deduplicated_archives": 2}, stats)
+	}
+}
+
+func TestHandleGetStorageStats(t *testing.T) {
+	archiveStore, _ := openArchiveStore(t)
+	insertArchiveFixture(t, archiveStore, models.Archive{ID: uuid.New(), Name: "a", Filename: "a.wacz", SourceURL: "https://example.com/", Tags: []string{"news"}, SizeBytes: 300})
+	trashed := models.Archive{ID: uuid.New(), Name: "trashed", Filename: "trashed.wacz", SizeBytes: 200}
+	insertArchiveFixture(t, archiveStore, trashed)
+	assert.NoError(t, archiveStore.Trash(context.Background(), trashed.ID, time.Now().UTC()))
+
+	handler := &Handler{archiveStore: archiveStore}
+	handler.SetStorageQuota(quota.Quota{GlobalBytes: 1000, TagBytes: map[string]int64{"news": 500}})
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/stats/storage", nil), rec)
+
+	if assert.NoError(t, handler.HandleGetStorageStats(c)) {
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response struct {
+			TotalBytes   int64                `json:"total_bytes"`
+			TrashedBytes int64                `json:"trashed_bytes"`
+			ByTag        []store.StorageUsage `json:"by_tag"`
+			ByHost       []store.StorageUsage `json:"by_host"`
+			ByMonth      []store.StorageUsage `json:"by_month"`
+			Quota        quota.Quota          `json:"quota"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, int64(300), response.TotalBytes)
+		assert.Equal(t, int64(200), response.TrashedBytes)
+		assert.Equal(t, []store.StorageUsage{{Key: "news", Archives: 1, Bytes: 300}}, response.ByTag)
+		assert.Equal(t, []store.StorageUsage{{Key: "example.com", Archives: 1, Bytes: 300}}, response.ByHost)
+		assert.Len(t, response.ByMonth, 1)
+		assert.Equal(t, int64(500), response.Quota.TagBytes["news"])
+	}
+}
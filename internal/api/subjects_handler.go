@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/queue"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	errInvalidSubjectId = "Invalid subject ID"
+	errSubjectNotFound  = "Subject not found"
+)
+
+func (handler *Handler) HandleGetSubjectSnapshots(c *echo.Context) error {
+	subject, err := decodeSubjectID(c.Param("subjectId"))
+	if err != nil {
+		return respondWithError(http.StatusBadRequest, errInvalidSubjectId, c)
+	}
+
+	page, err := handler.archiveStore.ListArchives(c.Request().Context(), store.ListArchivesOptions{Subject: subject, Viewer: handler.archiveViewer(c)})
+	if err != nil {
+		slog.Error("failed to list subject snapshots", "subject", subject, "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+	if len(page.Archives) == 0 {
+		return respondWithError(http.StatusNotFound, errSubjectNotFound, c)
+	}
+
+	return c.JSON(http.StatusOK, map[string]any{
+		"subject":   subject,
+		"snapshots": page.Archives,
+	})
+}
+
+func (handler *Handler) HandleCaptureSubject(c *echo.Context) error {
+	subject, err := decodeSubjectID(c.Param("subjectId"))
+	if err != nil {
+		return respondWithError(http.StatusBadRequest, errInvalidSubjectId, c)
+	}
+
+	page, err := handler.archiveStore.ListArchives(c.Request().Context(), store.ListArchivesOptions{Subject: subject, Limit: 1, Viewer: handler.archiveViewer(c)})
+	if err != nil {
+		slog.Error("failed to load latest subject snapshot", "subject", subject, "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+	if len(page.Archives) == 0 {
+		return respondWithError(http.StatusNotFound, errSubjectNotFound, c)
+	}
+
+	latest := page.Archives[0]
+	request := models.CrawlRequest{
+		URL:         latest.SourceURL,
+		Name:        latest.Name,
+		Description: latest.Description,
+		Subject:     subject,
+		Tags:        latest.Tags,
+		Visibility:  latest.Visibility,
+	}
+	if latest.CrawlOptions != nil {
+		request.Options = *latest.CrawlOptions
+	}
+	if user, ok := currentUser(c); ok {
+		request.Owner = &user
+	}
+	if ok, err := handler.admitStorage(c, request.URL, request.Tags); !ok {
+		return err
+	}
+	if ok, err := handler.admitCrawl(c, request.URL); !ok {
+		return err
+	}
+
+	jobId, err := queue.EnqueueCrawl(c.Request().Context(), handler.rdb, request)
+	if err != nil {
+		slog.Error("failed to enqueue subject capture", "subject", subject, "url", request.URL, "error", err)
+		return respondWithError(http.StatusInternalServerError, "Failed to queue job", c)
+	}
+
+	slog.Info("subject capture enqueued", "job_id", jobId.String(), "subject", subject, "url", request.URL)
+	handler.audit(c, auditSubjectCapture, jobId.String(), nil, request)
+
+	return c.JSON(http.StatusCreated, map[string]any{
+		"job_id": jobId,
+		"status": "pending",
+	})
+}
+
+// Subject IDs are the base64url encoding of the subject key, which keeps
+// URLs and free-form group names safe to use as a single path segment.
+func decodeSubjectID(value string) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+	subject := strings.TrimSpace(string(data))
+	if subject == "" {
+		return "", errors.New("empty subject")
+	}
+	return subject, nil
+}
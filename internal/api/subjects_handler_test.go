@@ -0,0 +1,143 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/queue"
+	"github.com/JuanSaenz04/archiver/internal/quota"
+	"github.com/JuanSaenz04/archiver/internal/storage"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleGetSubjectSnapshots(t *testing.T) {
+	archiveStore, _ := openArchiveStore(t)
+	handler := &Handler{archiveStore: archiveStore}
+	e := echo.New()
+	start := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	for _, archive := range []models.Archive{
+		{ID: uuid.New(), Name: "monday", Filename: "monday.wacz", Subject: "https://example.com", CreatedAt: start},
+		{ID: uuid.New(), Name: "tuesday", Filename: "tuesday.wacz", Subject: "https://example.com", CreatedAt: start.Add(24 * time.Hour)},
+		{ID: uuid.New(), Name: "unrelated", Filename: "unrelated.wacz", Subject: "https://other.example", CreatedAt: start},
+	} {
+		insertArchiveFixture(t, archiveStore, archive)
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		rec := serveSubjectRequest(t, e, handler.HandleGetSubjectSnapshots, http.MethodGet, subjectID("https://example.com"))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response struct {
+			Subject   string           `json:"subject"`
+			Snapshots []models.Archive `json:"snapshots"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, "https://example.com", response.Subject)
+		if assert.Len(t, response.Snapshots, 2) {
+			assert.Equal(t, "tuesday", response.Snapshots[0].Name)
+			assert.Equal(t, "monday", response.Snapshots[1].Name)
+		}
+	})
+
+	t.Run("InvalidID", func(t *testing.T) {
+		rec := serveSubjectRequest(t, e, handler.HandleGetSubjectSnapshots, http.MethodGet, "not-base64!")
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		rec := serveSubjectRequest(t, e, handler.HandleGetSubjectSnapshots, http.MethodGet, subjectID("https://missing.example"))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestHandleCaptureSubject(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Failed to start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	archiveStore, _ := openArchiveStore(t)
+	handler := NewHandler(rdb, storage.NewLocal(t.TempDir()), archiveStore)
+	e := echo.New()
+	start := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	options := &models.CrawlOptions{ScopeType: models.Host, PageLimit: 10, Depth: 1}
+	insertArchiveFixture(t, archiveStore, models.Archive{
+		ID: uuid.New(), Name: "old", Filename: "old.wacz", SourceURL: "https://example.com/",
+		Subject: "example-group", CreatedAt: start,
+	})
+	insertArchiveFixture(t, archiveStore, models.Archive{
+		ID: uuid.New(), Name: "latest", Filename: "latest.wacz", SourceURL: "https://example.com/",
+		Description: "weekly", Subject: "example-group", Tags: []string{"weekly"}, CreatedAt: start.Add(time.Hour),
+		CrawlOptions: options,
+	})
+
+	rec := serveSubjectRequest(t, e, handler.HandleCaptureSubject, http.MethodPost, subjectID("example-group"))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	entries, err := rdb.XRange(t.Context(), "crawl_stream", "-", "+").Result()
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		var msg queue.CrawlMessage
+		assert.NoError(t, json.Unmarshal([]byte(entries[0].Values["payload"].(string)), &msg))
+		assert.Equal(t, "https://example.com/", msg.Archive.SourceURL)
+		assert.Equal(t, "latest", msg.Archive.Name)
+		assert.Equal(t, "weekly", msg.Archive.Description)
+		assert.Equal(t, "example-group", msg.Archive.Subject)
+		assert.Equal(t, []string{"weekly"}, msg.Archive.Tags)
+		assert.Equal(t, *options, msg.Options)
+	}
+
+	rec = serveSubjectRequest(t, e, handler.HandleCaptureSubject, http.MethodPost, subjectID("https://missing.example"))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandleCaptureSubjectEnforcesStorageQuota(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("Failed to start miniredis: %v", err)
+	}
+	defer mr.Close()
+
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	archiveStore, _ := openArchiveStore(t)
+	insertArchiveFixture(t, archiveStore, models.Archive{
+		ID: uuid.New(), Name: "latest", Filename: "latest.wacz", SourceURL: "https://example.com/",
+		Subject: "example-group", Tags: []string{"temp"}, SizeBytes: 2048,
+	})
+	handler := NewHandler(rdb, storage.NewLocal(t.TempDir()), archiveStore)
+	handler.SetStorageQuota(quota.Quota{GlobalBytes: 1 << 20, TagBytes: map[string]int64{"temp": 2048}})
+	e := echo.New()
+
+	rec := serveSubjectRequest(t, e, handler.HandleCaptureSubject, http.MethodPost, subjectID("example-group"))
+	assert.Equal(t, http.StatusInsufficientStorage, rec.Code)
+	assert.Contains(t, rec.Body.String(), `Storage quota exceeded: tag \"temp\" uses 2.0 KB of 2.0 KB`)
+
+	entries, err := rdb.XLen(t.Context(), "crawl_stream").Result()
+	assert.NoError(t, err)
+	assert.Zero(t, entries)
+}
+
+func subjectID(subject string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(subject))
+}
+
+func serveSubjectRequest(t *testing.T, e *echo.Echo, handle echo.HandlerFunc, method, id string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, "/api/subjects/"+id, nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPathValues([]echo.PathValue{{Name: "subjectId", Value: id}})
+	assert.NoError(t, handle(c))
+	return rec
+}
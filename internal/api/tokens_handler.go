@@ -0,0 +1,219 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/auth"
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v5"
+)
+
+const (
+	apiTokenContextKey = "api_token"
+	apiTokenPrefix     = "arch_"
+	// apiTokenTouchInterval bounds how often last_used_at is written for a
+	// busy token.
+	apiTokenTouchInterval = time.Minute
+)
+
+const (
+	errInvalidAPIToken    = "Invalid API token"
+	errInsufficientScope  = "API token scope does not allow this request"
+	errInvalidTokenId     = "Invalid token ID"
+	errAPITokenNotFound   = "API token not found"
+	errTokenNameRequired  = "Token name is required"
+	errInvalidTokenScope  = "Scope must be one of read, crawl or admin"
+	errInvalidTokenExpiry = "expires_in_days must not be negative"
+)
+
+// crawlRoutes are the state-changing routes allowed to crawl tokens. Other
+// reads need the read scope, and every other change the admin scope.
+var crawlRoutes = map[string]bool{
+	http.MethodPost + " /api/jobs":                         true,
+	http.MethodPost + " /api/subjects/:subjectId/captures": true,
+}
+
+type createAPITokenRequest struct {
+	Name          string            `json:"name"`
+	Scope         models.TokenScope `json:"scope"`
+	ExpiresInDays int               `json:"expires_in_days"`
+}
+
+// createdAPITokenResponse is the only response carrying the token itself.
+type createdAPITokenResponse struct {
+	models.APIToken
+	Token string `json:"token"`
+}
+
+func currentAPIToken(c *echo.Context) (models.APIToken, bool) {
+	token, ok := c.Get(apiTokenContextKey).(models.APIToken)
+	return token, ok
+}
+
+func requiredScope(c *echo.Context) models.TokenScope {
+	method := c.Request().Method
+	switch {
+	case method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions:
+		return models.ScopeRead
+	case crawlRoutes[method+" "+c.Path()]:
+		return models.ScopeCrawl
+	default:
+		return models.ScopeAdmin
+	}
+}
+
+// authenticateAPIToken accepts requests carrying an `Authorization: Bearer`
+// API token, as the user who created it. Token requests skip the origin
+// check: scripts send no Origin header, and a cross-site page cannot make a
+// browser send the token.
+func (handler *Handler) authenticateAPIToken() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c *echo.Context) error {
+			secret, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !ok {
+				return next(c)
+			}
+
+			ctx := c.Request().Context()
+			now := time.Now()
+			token, err := handler.archiveStore.GetAPITokenByHash(ctx, auth.HashToken(secret), now)
+			if errors.Is(err, store.ErrAPITokenNotFound) {
+				return respondWithError(http.StatusUnauthorized, errInvalidAPIToken, c)
+			}
+			if err != nil {
+				slog.Error("failed to look up api token", "error", err)
+				return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+			}
+
+			if token.UserID != nil {
+				user, err := handler.archiveStore.GetUser(ctx, *token.UserID)
+				if errors.Is(err, store.ErrUserNotFound) {
+					return respondWithError(http.StatusUnauthorized, errInvalidAPIToken, c)
+				}
+				if err != nil {
+					slog.Error("failed to look up api token user", "token_id", token.ID, "error", err)
+					return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+				}
+				c.Set(userContextKey, user)
+			} else if handler.authEnabled {
+				// Tokens created before users existed act as nobody.
+				return respondWithError(http.StatusUnauthorized, errInvalidAPIToken, c)
+			}
+
+			if !token.Scope.Allows(requiredScope(c)) {
+				return respondWithError(http.StatusForbidden, errInsufficientScope, c)
+			}
+
+			if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= apiTokenTouchInterval {
+				if err := handler.archiveStore.TouchAPIToken(ctx, token.ID, now); err != nil {
+					slog.Warn("failed to record api token use", "token_id", token.ID, "error", err)
+				}
+			}
+
+			c.Set(apiTokenContextKey, token)
+			return next(c)
+		}
+	}
+}
+
+// canManageAPIToken reports whether the current user may see or revoke
+// token. Everyone can when built-in authentication is disabled.
+func canManageAPIToken(c *echo.Context, token models.APIToken) bool {
+	user, ok := currentUser(c)
+	return !ok || user.IsAdmin || (token.UserID != nil && *token.UserID == user.ID)
+}
+
+func (handler *Handler) HandleGetAPITokens(c *echo.Context) error {
+	tokens, err := handler.archiveStore.ListAPITokens(c.Request().Context())
+	if err != nil {
+		slog.Error("failed to list api tokens", "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+
+	visible := make([]models.APIToken, 0, len(tokens))
+	for _, token := range tokens {
+		if canManageAPIToken(c, token) {
+			visible = append(visible, token)
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]any{"tokens": visible})
+}
+
+func (handler *Handler) HandleCreateAPIToken(c *echo.Context) error {
+	var request createAPITokenRequest
+	if err := c.Bind(&request); err != nil {
+		return respondWithError(http.StatusBadRequest, "Malformed request", c)
+	}
+
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		return respondWithError(http.StatusBadRequest, errTokenNameRequired, c)
+	}
+	if !request.Scope.Valid() {
+		return respondWithError(http.StatusBadRequest, errInvalidTokenScope, c)
+	}
+	if request.ExpiresInDays < 0 {
+		return respondWithError(http.StatusBadRequest, errInvalidTokenExpiry, c)
+	}
+
+	secret, err := auth.NewToken()
+	if err != nil {
+		slog.Error("failed to create api token", "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+	secret = apiTokenPrefix + secret
+
+	now := time.Now().UTC()
+	token := models.APIToken{
+		ID:        uuid.New(),
+		Name:      name,
+		Scope:     request.Scope,
+		CreatedAt: now,
+	}
+	if user, ok := currentUser(c); ok {
+		token.UserID = &user.ID
+	}
+	if request.ExpiresInDays > 0 {
+		expiresAt := now.AddDate(0, 0, request.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := handler.archiveStore.InsertAPIToken(c.Request().Context(), token, auth.HashToken(secret)); err != nil {
+		slog.Error("failed to store api token", "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+	slog.Info("created api token", "token_id", token.ID, "name", token.Name, "scope", token.Scope)
+	handler.audit(c, auditAPITokenCreate, token.ID.String(), nil, token)
+	return c.JSON(http.StatusCreated, createdAPITokenResponse{APIToken: token, Token: secret})
+}
+
+func (handler *Handler) HandleDeleteAPIToken(c *echo.Context) error {
+	tokenId, err := uuid.Parse(c.Param("tokenId"))
+	if err != nil {
+		return respondWithError(http.StatusBadRequest, errInvalidTokenId, c)
+	}
+
+	ctx := c.Request().Context()
+	token, err := handler.archiveStore.GetAPIToken(ctx, tokenId)
+	if err == nil && !canManageAPIToken(c, token) {
+		err = store.ErrAPITokenNotFound
+	}
+	if err == nil {
+		err = handler.archiveStore.DeleteAPIToken(ctx, tokenId)
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrAPITokenNotFound) {
+			return respondWithError(http.StatusNotFound, errAPITokenNotFound, c)
+		}
+		slog.Error("failed to delete api token", "token_id", tokenId, "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+	handler.audit(c, auditAPITokenDelete, tokenId.String(), token, nil)
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/JuanSaenz04/archiver/internal/auth"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveTokenRequest(e *echo.Echo, method, target, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func createAPIToken(t *testing.T, e *echo.Echo, scope string, cookie *http.Cookie) createdAPITokenResponse {
+	t.Helper()
+	rec := serveAuthRequest(e, http.MethodPost, "/api/tokens", `{"name":"script","scope":"`+scope+`"}`, cookie)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	var created createdAPITokenResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	return created
+}
+
+func TestAPITokensWithoutBuiltInAuthentication(t *testing.T) {
+	archiveStore, _ := openArchiveStore(t)
+	handler := &Handler{archiveStore: archiveStore}
+	e := echo.New()
+	handler.setMainRoutes(e, testRouteConfig, testFrontendFS)
+
+	rec := serveAuthRequest(e, http.MethodPost, "/api/tokens", `{"name":"script","scope":"owner"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	read := createAPIToken(t, e, "read", nil)
+	assert.True(t, strings.HasPrefix(read.Token, apiTokenPrefix))
+	admin := createAPIToken(t, e, "admin", nil)
+
+	t.Run("tokens skip the origin check", func(t *testing.T) {
+		rec := serveTokenRequest(e, http.MethodPost, "/api/retention/rules", `{"name":"short","max_age_days":1}`, "")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		rec = serveTokenRequest(e, http.MethodPost, "/api/retention/rules", `{"name":"short","max_age_days":1}`, admin.Token)
+		assert.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	})
+
+	t.Run("scopes limit what tokens can do", func(t *testing.T) {
+		rec := serveTokenRequest(e, http.MethodGet, "/api/archives", "", read.Token)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		rec = serveTokenRequest(e, http.MethodPost, "/api/retention/rules", `{"name":"short","max_age_days":1}`, read.Token)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		rec = serveTokenRequest(e, http.MethodPost, "/api/tokens", `{"name":"escalate","scope":"admin"}`, read.Token)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("unknown and revoked tokens are rejected", func(t *testing.T) {
+		rec := serveTokenRequest(e, http.MethodGet, "/api/archives", "", "arch_forged")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		rec = serveAuthRequest(e, http.MethodDelete, "/api/tokens/"+read.ID.String(), "", nil)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		rec = serveTokenRequest(e, http.MethodGet, "/api/archives", "", read.Token)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("lists tokens without their secret", func(t *testing.T) {
+		rec := serveAuthRequest(e, http.MethodGet, "/api/tokens", "", nil)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.NotContains(t, rec.Body.String(), admin.Token)
+		assert.Contains(t, rec.Body.String(), `"last_used_at"`)
+	})
+}
+
+func TestAPITokensActAsTheirUser(t *testing.T) {
+	archiveStore, _ := openArchiveStore(t)
+	require.NoError(t, auth.EnsureAdmin(t.Context(), archiveStore, "admin", "admin password"))
+	member, err := auth.NewUser("member", "member password", false)
+	require.NoError(t, err)
+	require.NoError(t, archiveStore.InsertUser(t.Context(), member))
+
+	handler := &Handler{archiveStore: archiveStore}
+	handler.SetAuthEnabled(true)
+	e := echo.New()
+	handler.setMainRoutes(e, testRouteConfig, testFrontendFS)
+
+	memberToken := createAPIToken(t, e, "admin", login(t, e, "member", "member password"))
+	adminCookie := login(t, e, "admin", "admin password")
+	adminReadToken := createAPIToken(t, e, "read", adminCookie)
+
+	rec := serveTokenRequest(e, http.MethodGet, "/api/auth/me", "", memberToken.Token)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"username":"member"`)
+
+	rec = serveTokenRequest(e, http.MethodGet, "/api/users", "", memberToken.Token)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "an admin token of a regular user grants no administration")
+	rec = serveTokenRequest(e, http.MethodGet, "/api/users", "", adminReadToken.Token)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "administration needs the admin scope")
+
+	rec = serveTokenRequest(e, http.MethodGet, "/api/tokens", "", memberToken.Token)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), adminReadToken.ID.String())
+	rec = serveTokenRequest(e, http.MethodDelete, "/api/tokens/"+adminReadToken.ID.String(), "", memberToken.Token)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = serveAuthRequest(e, http.MethodDelete, "/api/users/"+member.ID.String(), "", adminCookie)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	rec = serveTokenRequest(e, http.MethodGet, "/api/archives", "", memberToken.Token)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	_, err = archiveStore.GetAPIToken(t.Context(), memberToken.ID)
+	assert.ErrorIs(t, err, store.ErrAPITokenNotFound)
+}
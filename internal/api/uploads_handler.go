@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/JuanSaenz04/archiver/internal/ingest"
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/quota"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v5"
+)
+
+const errMalformedUpload = "Malformed archive upload"
+
+// HandleUploadArchive stores a WACZ streamed by a worker, applying the same
+// options as a crawl persisted by the API host itself.
+func (handler *Handler) HandleUploadArchive(c *echo.Context) error {
+	reader, err := c.Request().MultipartReader()
+	if err != nil {
+		return respondWithError(http.StatusBadRequest, errMalformedUpload, c)
+	}
+
+	var metadata ingest.Metadata
+	uploadPath := ""
+	defer func() {
+		if uploadPath != "" {
+			_ = os.Remove(uploadPath)
+		}
+	}()
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return respondWithError(http.StatusBadRequest, errMalformedUpload, c)
+		}
+
+		switch part.FormName() {
+		case "metadata":
+			err = json.NewDecoder(part).Decode(&metadata)
+		case "file":
+			if uploadPath == "" {
+				uploadPath, err = saveUpload(part)
+			}
+		}
+		_ = part.Close()
+		if err != nil {
+			slog.Warn("failed to read archive upload", "part", part.FormName(), "error", err)
+			return respondWithError(http.StatusBadRequest, errMalformedUpload, c)
+		}
+	}
+
+	if uploadPath == "" || metadata.JobID == "" || metadata.Archive.ID == uuid.Nil {
+		return respondWithError(http.StatusBadRequest, errMalformedUpload, c)
+	}
+
+	archive, err := handler.ingester.Ingest(c.Request().Context(), metadata.JobID, metadata.Archive, metadata.Options, uploadPath)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrUnchanged):
+			return respondWithError(http.StatusConflict, err.Error(), c)
+		case errors.Is(err, quota.ErrExceeded):
+			return respondWithError(http.StatusInsufficientStorage, "Storage quota exceeded"+strings.TrimPrefix(err.Error(), quota.ErrExceeded.Error()), c)
+		}
+
+		slog.Error("failed to store uploaded archive", "job_id", metadata.JobID, "archive_id", metadata.Archive.ID, "error", err)
+		return respondWithError(http.StatusInternalServerError, errInternalServerError, c)
+	}
+
+	slog.Info("uploaded archive stored", "job_id", metadata.JobID, "archive_id", archive.ID, "filename", archive.Filename, "size_bytes", archive.SizeBytes)
+
+	return c.JSON(http.StatusCreated, archive)
+}
+
+func saveUpload(src io.Reader) (string, error) {
+	file, err := os.CreateTemp("", "archiver-upload-*.wacz")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, src); err != nil {
+		_ = os.Remove(file.Name())
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/JuanSaenz04/archiver/internal/ingest"
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/storage"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testIndex = `com,example)/ 20260401000000 {"url":"https://example.com/","status":"200","digest":"sha256:home"}` + "\n"
+
+func TestHandleUploadArchive(t *testing.T) {
+	archiveStore, _ := openArchiveStore(t)
+	archivesDir := t.TempDir()
+	handler := NewHandler(nil, storage.NewLocal(archivesDir), archiveStore)
+	handler.SetWorkerToken("worker-secret")
+
+	e := echo.New()
+	handler.setMainRoutes(e, testRouteConfig, testFrontendFS)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	ctx := context.Background()
+	srcPath := filepath.Join(t.TempDir(), "crawl.wacz")
+	writeWACZFixture(t, srcPath, testIndex, "")
+	options := models.CrawlOptions{SkipUnchanged: true}
+
+	upload := func(client *ingest.Client) (models.Archive, error) {
+		jobID := uuid.New()
+		archive := models.Archive{ID: jobID, Name: "Weekly", SourceURL: "https://example.com/", Subject: "https://example.com", Tags: []string{"news"}}
+		return client.Ingest(ctx, jobID.String(), archive, options, srcPath)
+	}
+
+	t.Run("rejects an invalid token", func(t *testing.T) {
+		_, err := upload(ingest.NewClient(server.URL, "wrong"))
+		assert.ErrorContains(t, err, "401")
+
+		archives, err := archiveStore.List(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, archives)
+	})
+
+	client := ingest.NewClient(server.URL+"/", "worker-secret")
+
+	t.Run("stores the archive", func(t *testing.T) {
+		stored, err := upload(client)
+		require.NoError(t, err)
+		assert.Equal(t, "Weekly.wacz", stored.Filename)
+		assert.Equal(t, []string{"news"}, stored.Tags)
+
+		want, err := os.ReadFile(srcPath)
+		require.NoError(t, err)
+		got, err := os.ReadFile(filepath.Join(archivesDir, "Weekly.wacz"))
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+
+		archive, err := archiveStore.Get(ctx, stored.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(want)), archive.SizeBytes)
+	})
+
+	t.Run("reports unchanged crawls", func(t *testing.T) {
+		_, err := upload(client)
+		assert.ErrorIs(t, err, models.ErrUnchanged)
+		assert.NoFileExists(t, filepath.Join(archivesDir, "Weekly-1.wacz"))
+	})
+}
+
+func TestUploadRouteRequiresWorkerToken(t *testing.T) {
+	handler := &Handler{}
+	handler.SetWorkerToken("worker-secret")
+	e := echo.New()
+	handler.setMainRoutes(e, testRouteConfig, testFrontendFS)
+
+	for name, authorization := range map[string]string{
+		"missing token": "",
+		"wrong token":   "Bearer wrong",
+		"bare token":    "worker-secret",
+	} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, ingest.UploadPath, nil)
+			if authorization != "" {
+				req.Header.Set(echo.HeaderAuthorization, authorization)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		})
+	}
+}
+
+func TestUploadRouteIsNotRegisteredWithoutWorkerToken(t *testing.T) {
+	handler := &Handler{}
+	e := echo.New()
+	handler.setMainRoutes(e, testRouteConfig, testFrontendFS)
+
+	rec := serveRequest(e, http.MethodPost, ingest.UploadPath, "")
+	assert.NotEqual(t, http.StatusUnauthorized, rec.Code)
+	assert.GreaterOrEqual(t, rec.Code, http.StatusBadRequest)
+
+	rec = serveRequest(e, http.MethodGet, ingest.UploadPath, "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
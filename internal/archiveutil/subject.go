@@ -0,0 +1,34 @@
+package archiveutil
+
+import (
+	"net/url"
+	"strings"
+)
+
+// NormalizeSubject returns the key used to group captures of the same site.
+// Scheme and host are lowercased, default ports, fragments and trailing
+// slashes are dropped so equivalent URLs share a subject.
+func NormalizeSubject(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return ""
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return strings.TrimRight(rawURL, "/")
+	}
+
+	scheme := strings.ToLower(parsed.Scheme)
+	host := strings.ToLower(parsed.Hostname())
+	if port := parsed.Port(); port != "" && !(scheme == "http" && port == "80") && !(scheme == "https" && port == "443") {
+		host += ":" + port
+	}
+
+	subject := scheme + "://" + host + strings.TrimRight(parsed.EscapedPath(), "/")
+	if parsed.RawQuery != "" {
+		subject += "?" + parsed.RawQuery
+	}
+
+	return subject
+}
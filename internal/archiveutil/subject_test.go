@@ -0,0 +1,28 @@
+package archiveutil
+
+import "testing"
+
+func TestNormalizeSubject(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "lowercases scheme and host", input: "HTTPS://Example.COM/Blog", want: "https://example.com/Blog"},
+		{name: "drops trailing slash", input: "https://example.com/", want: "https://example.com"},
+		{name: "drops default port", input: "https://example.com:443/docs/", want: "https://example.com/docs"},
+		{name: "keeps custom port", input: "http://example.com:8080", want: "http://example.com:8080"},
+		{name: "drops fragment and keeps query", input: "https://example.com/page?id=1#top", want: "https://example.com/page?id=1"},
+		{name: "trims whitespace", input: "  https://example.com  ", want: "https://example.com"},
+		{name: "keeps unparseable values", input: "not a url/", want: "not a url"},
+		{name: "empty", input: "   ", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeSubject(tt.input); got != tt.want {
+				t.Fatalf("NormalizeSubject(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the shortest password accepted for new users.
+const MinPasswordLength = 8
+
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// dummyHash is compared against when a username does not exist, so that
+// failed logins take as long whether or not the user exists.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("archiver-dummy-password"), bcrypt.DefaultCost)
+
+// NormalizeUsername makes usernames case-insensitive.
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// NewUser validates the credentials of a user about to be created and hashes
+// their password.
+func NewUser(username, password string, isAdmin bool) (models.User, error) {
+	username = NormalizeUsername(username)
+	if username == "" {
+		return models.User{}, errors.New("username is required")
+	}
+	if len(password) < MinPasswordLength {
+		return models.User{}, fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	if len(password) > 72 {
+		// bcrypt ignores everything past 72 bytes.
+		return models.User{}, errors.New("password must be at most 72 bytes")
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return models.User{}, err
+	}
+	return models.User{
+		ID:           uuid.New(),
+		Username:     username,
+		PasswordHash: hash,
+		IsAdmin:      isAdmin,
+		CreatedAt:    time.Now().UTC(),
+	}, nil
+}
+
+// Authenticate returns the user matching username and password.
+func Authenticate(ctx context.Context, archiveStore store.Store, username, password string) (models.User, error) {
+	user, err := archiveStore.GetUserByUsername(ctx, NormalizeUsername(username))
+	if errors.Is(err, store.ErrUserNotFound) {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return models.User{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return models.User{}, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// NewToken returns a random token suitable for a session cookie.
+func NewToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken returns what is stored in place of a token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// EnsureAdmin creates the bootstrap administrator unless a user with that
+// name already exists. An existing user keeps their password, so the
+// variables can stay set after the first start.
+func EnsureAdmin(ctx context.Context, archiveStore store.Store, username, password string) error {
+	user, err := NewUser(username, password, true)
+	if err != nil {
+		return err
+	}
+
+	err = archiveStore.InsertUser(ctx, user)
+	if errors.Is(err, store.ErrUsernameTaken) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("created administrator", "username", user.Username)
+	return nil
+}
+
+// EnsureUser returns the user named username, creating them without a
+// password if needed. It is used for users authenticated elsewhere, who can
+// never sign in with a password.
+func EnsureUser(ctx context.Context, archiveStore store.Store, username string) (models.User, error) {
+	username = NormalizeUsername(username)
+	user, err := archiveStore.GetUserByUsername(ctx, username)
+	if !errors.Is(err, store.ErrUserNotFound) {
+		return user, err
+	}
+
+	user = models.User{
+		ID:        uuid.New(),
+		Username:  username,
+		CreatedAt: time.Now().UTC(),
+	}
+	err = archiveStore.InsertUser(ctx, user)
+	if errors.Is(err, store.ErrUsernameTaken) {
+		// Created by a concurrent request.
+		return archiveStore.GetUserByUsername(ctx, username)
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+	slog.Info("created user", "username", username)
+	return user, nil
+}
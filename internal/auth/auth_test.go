@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openStore(t *testing.T) store.Store {
+	t.Helper()
+	s, err := store.Open(filepath.Join(t.TempDir(), "archive.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	require.NoError(t, s.RunMigrations())
+	return s
+}
+
+func TestNewUserValidatesCredentials(t *testing.T) {
+	_, err := NewUser("  ", "long enough", false)
+	assert.Error(t, err)
+	_, err = NewUser("alice", "short", false)
+	assert.Error(t, err)
+	_, err = NewUser("alice", strings.Repeat("a", 73), false)
+	assert.Error(t, err)
+
+	user, err := NewUser(" Alice ", "long enough", true)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user.Username)
+	assert.True(t, user.IsAdmin)
+	assert.NotEqual(t, "long enough", user.PasswordHash)
+}
+
+func TestAuthenticate(t *testing.T) {
+	s := openStore(t)
+	require.NoError(t, EnsureAdmin(t.Context(), s, "Admin", "correct horse"))
+	// A second start with other credentials keeps the existing password.
+	require.NoError(t, EnsureAdmin(t.Context(), s, "admin", "something else"))
+
+	user, err := Authenticate(t.Context(), s, "ADMIN", "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, "admin", user.Username)
+	assert.True(t, user.IsAdmin)
+
+	_, err = Authenticate(t.Context(), s, "admin", "something else")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = Authenticate(t.Context(), s, "nobody", "correct horse")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestNewToken(t *testing.T) {
+	first, err := NewToken()
+	require.NoError(t, err)
+	second, err := NewToken()
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	assert.Len(t, HashToken(first), 64)
+	assert.Equal(t, HashToken(first), HashToken(first))
+}
@@ -0,0 +1,18 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigner(t *testing.T) {
+	signer := NewSigner([]byte("0123456789abcdef0123456789abcdef"))
+	signature := signer.Sign("replay|archive")
+
+	assert.True(t, signer.Verify("replay|archive", signature))
+	assert.False(t, signer.Verify("replay|other", signature))
+	assert.False(t, signer.Verify("replay|archive", signature+"x"))
+	assert.False(t, signer.Verify("replay|archive", ""))
+	assert.False(t, NewRandomSigner().Verify("replay|archive", signature))
+}
@@ -2,35 +2,66 @@ package crawler
 
 import (
 	"context"
-	"errors"
-	"fmt"
-	"io"
 	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
-	"strings"
+	"sync"
 
-	"github.com/JuanSaenz04/archiver/internal/archiveutil"
 	"github.com/JuanSaenz04/archiver/internal/models"
-	"github.com/JuanSaenz04/archiver/internal/store"
 )
 
+// Sink persists the WACZ produced by a crawl. ingest.Ingester stores it
+// directly, ingest.Client uploads it to the API.
+type Sink interface {
+	Ingest(ctx context.Context, jobID string, archive models.Archive, options models.CrawlOptions, srcPath string) (models.Archive, error)
+}
+
+// firstDisplay is the X display of the first crawl, xvfb-run's default.
+const firstDisplay = 99
+
 type Crawler struct {
 	timeoutInSeconds int
-	archiveStore     *store.ArchiveStore
+	sink             Sink
 	collectionsDir   string
 	runCmd           func(cmd *exec.Cmd) error
+	displays         *displayPool
 }
 
-func NewCrawler(timeoutInSeconds int, archiveStore *store.ArchiveStore) *Crawler {
+func NewCrawler(timeoutInSeconds int, sink Sink) *Crawler {
 	return &Crawler{
 		timeoutInSeconds: timeoutInSeconds,
-		archiveStore:     archiveStore,
+		sink:             sink,
 		collectionsDir:   "collections",
 		runCmd:           func(cmd *exec.Cmd) error { return cmd.Run() },
+		displays:         &displayPool{used: make(map[int]bool)},
+	}
+}
+
+// displayPool hands out an X display to each running crawl. xvfb-run's
+// --auto-servernum picks a free display by probing for lock files, which
+// races when several crawls of a worker start at once.
+type displayPool struct {
+	mu   sync.Mutex
+	used map[int]bool
+}
+
+func (pool *displayPool) acquire() int {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	display := firstDisplay
+	for pool.used[display] {
+		display++
 	}
+	pool.used[display] = true
+	return display
+}
+
+func (pool *displayPool) release(display int) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	delete(pool.used, display)
 }
 
 // Run executes the crawler for a specific job.
@@ -43,9 +74,12 @@ func (crawler *Crawler) Run(ctx context.Context, jobID string, archive models.Ar
 		"archive_name", archive.Name,
 	)
 
+	display := crawler.displays.acquire()
+	defer crawler.displays.release(display)
+
 	cmd := exec.CommandContext(
 		ctx,
-		"xvfb-run", "--auto-servernum", "--server-args=-screen 0 1280x1024x24",
+		"xvfb-run", "--server-num="+strconv.Itoa(display), "--server-args=-screen 0 1280x1024x24",
 		"node", "/app/dist/main.js", "crawl",
 		"--url", archive.SourceURL,
 		"--generateWACZ",
@@ -71,86 +105,28 @@ func (crawler *Crawler) Run(ctx context.Context, jobID string, archive models.Ar
 		return err
 	}
 
-	archivesDir := os.Getenv("ARCHIVES_DIR")
-	if archivesDir == "" {
-		slog.Warn("ARCHIVES_DIR not set, archive will not be persisted", "job_id", jobID, "url", archive.SourceURL)
+	if crawler.sink == nil {
+		slog.Warn("no archive sink configured, archive will not be persisted", "job_id", jobID, "url", archive.SourceURL)
 		return nil
 	}
 
-	if err := os.MkdirAll(archivesDir, 0755); err != nil {
-		slog.Error("failed to create archives directory", "job_id", jobID, "archives_dir", archivesDir, "error", err)
-		return err
-	}
-
 	srcPath := filepath.Join(crawler.collectionsDir, jobID, jobID+".wacz")
-	filename, ok := archiveutil.NormalizeArchiveName(archive.Name)
-	if !ok {
-		filename = jobID + ".wacz"
-	}
-	src, err := os.Open(srcPath)
-	if err != nil {
-		return fmt.Errorf("failed to open source wacz: %w", err)
-	}
-	defer src.Close()
-
-	dst, filename, err := createArchiveFile(archivesDir, filename)
-	if err != nil {
-		return fmt.Errorf("failed to create destination wacz: %w", err)
-	}
-	dstPath := dst.Name()
-	keepFile := false
-	defer func() {
-		_ = dst.Close()
-		if !keepFile {
-			_ = os.Remove(dstPath)
-		}
-	}()
-
-	size, err := io.Copy(dst, src)
-	if err != nil {
-		return fmt.Errorf("failed to copy wacz: %w", err)
-	}
-	if err := dst.Close(); err != nil {
-		return fmt.Errorf("failed to close destination wacz: %w", err)
-	}
-
-	archive.Filename = filename
-	archive.SizeBytes = size
-
-	err = crawler.archiveStore.Insert(ctx, archive)
+	stored, err := crawler.sink.Ingest(ctx, jobID, archive, options, srcPath)
 	if err != nil {
 		return err
 	}
-	keepFile = true
 
 	slog.Info("archive persisted",
 		"job_id", jobID,
-		"archive_name", archive.Name,
-		"path", dstPath,
-		"size_bytes", archive.SizeBytes,
+		"archive_name", stored.Name,
+		"filename", stored.Filename,
+		"size_bytes", stored.SizeBytes,
+		"dedup_saved_bytes", stored.DedupSavedBytes,
 	)
 
 	return nil
 }
 
-func createArchiveFile(dir, filename string) (*os.File, string, error) {
-	ext := filepath.Ext(filename)
-	name := strings.TrimSuffix(filename, ext)
-
-	for suffix := 0; ; suffix++ {
-		candidate := filename
-		if suffix > 0 {
-			candidate = fmt.Sprintf("%s-%d%s", name, suffix, ext)
-		}
-
-		file, err := os.OpenFile(filepath.Join(dir, candidate), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
-		if errors.Is(err, os.ErrExist) {
-			continue
-		}
-		return file, candidate, err
-	}
-}
-
 func setDefaultValuesIfEmpty(options *models.CrawlOptions) {
 	if options.ScopeType == "" {
 		options.ScopeType = models.Prefix
@@ -6,9 +6,13 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/JuanSaenz04/archiver/internal/ingest"
 	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/storage"
 	"github.com/JuanSaenz04/archiver/internal/store"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -39,14 +43,13 @@ func newTestStore(t *testing.T) *store.ArchiveStore {
 
 func TestCrawlerRun_Success(t *testing.T) {
 	archiveStore := newTestStore(t)
-	crawler := NewCrawler(30, archiveStore)
 
 	// Setup temporary directories for collections (source) and archives (destination)
 	tempDir := t.TempDir()
 	collectionsDir := filepath.Join(tempDir, "collections")
 	archivesDir := filepath.Join(tempDir, "archives")
 
-	t.Setenv("ARCHIVES_DIR", archivesDir)
+	crawler := NewCrawler(30, ingest.NewIngester(archiveStore, storage.NewLocal(archivesDir)))
 	crawler.collectionsDir = collectionsDir
 
 	jobID := uuid.New().String()
@@ -124,14 +127,15 @@ func TestCrawlerRun_Success(t *testing.T) {
 	assert.Equal(t, archive.SourceURL, rec.SourceURL)
 	assert.Equal(t, int64(len("fake wacz zip content bytes")), rec.SizeBytes)
 	assert.ElementsMatch(t, archive.Tags, rec.Tags)
+	if assert.NotNil(t, rec.CrawlOptions) {
+		assert.Equal(t, options, *rec.CrawlOptions)
+	}
 }
 
 func TestCrawlerRun_CrawlCommandFailure(t *testing.T) {
 	archiveStore := newTestStore(t)
-	crawler := NewCrawler(30, archiveStore)
-
 	tempDir := t.TempDir()
-	t.Setenv("ARCHIVES_DIR", filepath.Join(tempDir, "archives"))
+	crawler := NewCrawler(30, ingest.NewIngester(archiveStore, storage.NewLocal(filepath.Join(tempDir, "archives"))))
 
 	crawler.runCmd = func(cmd *exec.Cmd) error {
 		return errors.New("xvfb-run crashed")
@@ -155,68 +159,36 @@ func TestCrawlerRun_CrawlCommandFailure(t *testing.T) {
 	assert.Empty(t, records)
 }
 
-func TestCrawlerRun_DuplicateNamePreservesExistingArchive(t *testing.T) {
-	archiveStore := newTestStore(t)
-	crawler := NewCrawler(30, archiveStore)
-
-	tempDir := t.TempDir()
-	collectionsDir := filepath.Join(tempDir, "collections")
-	archivesDir := filepath.Join(tempDir, "archives")
-
-	t.Setenv("ARCHIVES_DIR", archivesDir)
-	crawler.collectionsDir = collectionsDir
-	if err := os.MkdirAll(archivesDir, 0755); err != nil {
-		t.Fatalf("create archives directory: %v", err)
-	}
-
-	existingArchive := models.Archive{
-		ID:          uuid.New(),
-		Name:        "Duplicate Name",
-		Filename:    "Duplicate-Name.wacz",
-		Description: "some description",
-		SourceURL:   "https://example.com/original",
-	}
-
-	ctx := context.Background()
-	err := archiveStore.Insert(ctx, existingArchive)
-	assert.NoError(t, err)
-	existingPath := filepath.Join(archivesDir, existingArchive.Filename)
-	assert.NoError(t, os.WriteFile(existingPath, []byte("original archive"), 0644))
-
-	jobID := uuid.New().String()
-	archive := models.Archive{
-		ID:        uuid.MustParse(jobID),
-		Name:      "Duplicate Name",
-		SourceURL: "https://example.com/duplicate",
-	}
+func TestCrawlerRun_UsesOneDisplayPerRunningCrawl(t *testing.T) {
+	crawler := NewCrawler(30, nil)
 
+	displays := make(chan string, 2)
+	finish := make(chan struct{})
 	crawler.runCmd = func(cmd *exec.Cmd) error {
-		srcPath := filepath.Join(collectionsDir, jobID, jobID+".wacz")
-		if err := os.MkdirAll(filepath.Dir(srcPath), 0755); err != nil {
-			return err
+		for _, arg := range cmd.Args {
+			if strings.HasPrefix(arg, "--server-num=") {
+				displays <- arg
+			}
 		}
-		return os.WriteFile(srcPath, []byte("some wacz content"), 0644)
+		<-finish
+		return nil
 	}
 
-	assert.NoError(t, crawler.Run(ctx, jobID, archive, models.CrawlOptions{}))
-
-	existingBytes, err := os.ReadFile(existingPath)
-	assert.NoError(t, err)
-	assert.Equal(t, "original archive", string(existingBytes))
-
-	newPath := filepath.Join(archivesDir, "Duplicate-Name-1.wacz")
-	newBytes, err := os.ReadFile(newPath)
-	assert.NoError(t, err)
-	assert.Equal(t, "some wacz content", string(newBytes))
-
-	records, err := archiveStore.List(ctx)
-	assert.NoError(t, err)
-	assert.Len(t, records, 2)
-
-	filenames := make(map[uuid.UUID]string, len(records))
-	for _, record := range records {
-		filenames[record.ID] = record.Filename
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			jobID := uuid.New().String()
+			assert.NoError(t, crawler.Run(context.Background(), jobID, models.Archive{ID: uuid.MustParse(jobID), SourceURL: "https://example.com/"}, models.CrawlOptions{}))
+		}()
 	}
-	assert.Equal(t, "Duplicate-Name.wacz", filenames[existingArchive.ID])
-	assert.Equal(t, "Duplicate-Name-1.wacz", filenames[archive.ID])
+	first, second := <-displays, <-displays
+	close(finish)
+	wg.Wait()
+	assert.NotEqual(t, first, second, "concurrent crawls must not share an X display")
+	assert.ElementsMatch(t, []string{"--server-num=99", "--server-num=100"}, []string{first, second})
+
+	// Displays are handed out again once their crawl is done.
+	assert.Equal(t, firstDisplay, crawler.displays.acquire())
 }
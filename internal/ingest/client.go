@@ -0,0 +1,130 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/quota"
+)
+
+// UploadPath is the API endpoint that receives archives uploaded by workers.
+const UploadPath = "/internal/archives"
+
+// Metadata describes an uploaded crawl. It is sent as the "metadata" part of
+// the multipart upload, ahead of the "file" part holding the WACZ.
+type Metadata struct {
+	JobID   string              `json:"job_id"`
+	Archive models.Archive      `json:"archive"`
+	Options models.CrawlOptions `json:"options"`
+}
+
+// Client uploads finished crawls to the API, for workers that share neither
+// the archive storage nor the database with it.
+type Client struct {
+	url        string
+	token      string
+	httpClient *http.Client
+}
+
+func NewClient(apiURL, token string) *Client {
+	return &Client{
+		url:        strings.TrimSuffix(apiURL, "/") + UploadPath,
+		token:      token,
+		httpClient: &http.Client{},
+	}
+}
+
+// Ingest streams the WACZ at srcPath to the API, which stores it the same
+// way Ingester does. Unchanged and over-quota crawls return models.ErrUnchanged
+// and quota.ErrExceeded.
+func (client *Client) Ingest(ctx context.Context, jobID string, archive models.Archive, options models.CrawlOptions, srcPath string) (models.Archive, error) {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return models.Archive{}, fmt.Errorf("failed to open source wacz: %w", err)
+	}
+	defer src.Close()
+
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		writer.CloseWithError(writeUpload(form, Metadata{JobID: jobID, Archive: archive, Options: options}, src))
+	}()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, client.url, body)
+	if err != nil {
+		_ = body.Close()
+		return models.Archive{}, err
+	}
+	request.Header.Set("Content-Type", form.FormDataContentType())
+	request.Header.Set("Authorization", "Bearer "+client.token)
+
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		return models.Archive{}, fmt.Errorf("upload archive: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusCreated {
+		var stored models.Archive
+		if err := json.NewDecoder(response.Body).Decode(&stored); err != nil {
+			return models.Archive{}, fmt.Errorf("decode uploaded archive: %w", err)
+		}
+		return stored, nil
+	}
+
+	var failure struct {
+		Error string `json:"error"`
+	}
+	_ = json.NewDecoder(io.LimitReader(response.Body, 64*1024)).Decode(&failure)
+	switch response.StatusCode {
+	case http.StatusConflict:
+		return models.Archive{}, &uploadError{err: models.ErrUnchanged, message: failure.Error}
+	case http.StatusInsufficientStorage:
+		return models.Archive{}, &uploadError{err: quota.ErrExceeded, message: failure.Error}
+	}
+	return models.Archive{}, fmt.Errorf("upload archive: api responded with %s: %s", response.Status, failure.Error)
+}
+
+func writeUpload(form *multipart.Writer, metadata Metadata, src io.Reader) error {
+	part, err := form.CreateFormField("metadata")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(part).Encode(metadata); err != nil {
+		return err
+	}
+
+	part, err = form.CreateFormFile("file", metadata.JobID+".wacz")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, src); err != nil {
+		return err
+	}
+	return form.Close()
+}
+
+// uploadError carries the API's description of a rejected upload while still
+// matching the sentinel error it stands for.
+type uploadError struct {
+	err     error
+	message string
+}
+
+func (e *uploadError) Error() string {
+	if e.message == "" {
+		return e.err.Error()
+	}
+	return e.message
+}
+
+func (e *uploadError) Unwrap() error {
+	return e.err
+}
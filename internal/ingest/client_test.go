@@ -0,0 +1,53 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/quota"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIngestMapsRejections(t *testing.T) {
+	srcPath := filepath.Join(t.TempDir(), "crawl.wacz")
+	if err := os.WriteFile(srcPath, []byte("wacz"), 0644); err != nil {
+		t.Fatalf("write wacz: %v", err)
+	}
+
+	for _, tt := range []struct {
+		status  int
+		message string
+		want    error
+	}{
+		{status: http.StatusConflict, message: "content unchanged since previous snapshot: matches archive x", want: models.ErrUnchanged},
+		{status: http.StatusInsufficientStorage, message: `Storage quota exceeded: tag "temp" uses 1.0 KB of 1.0 KB`, want: quota.ErrExceeded},
+	} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var metadata Metadata
+			reader, err := r.MultipartReader()
+			if err == nil {
+				if part, err := reader.NextPart(); err == nil && part.FormName() == "metadata" {
+					_ = json.NewDecoder(part).Decode(&metadata)
+				}
+			}
+			assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+			assert.Equal(t, "job", metadata.JobID)
+
+			w.WriteHeader(tt.status)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": tt.message})
+		}))
+
+		_, err := NewClient(server.URL, "token").Ingest(context.Background(), "job", models.Archive{ID: uuid.New()}, models.CrawlOptions{}, srcPath)
+		server.Close()
+
+		assert.ErrorIs(t, err, tt.want)
+		assert.EqualError(t, err, tt.message)
+	}
+}
@@ -0,0 +1,373 @@
+package ingest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/JuanSaenz04/archiver/internal/archiveutil"
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/queue"
+	"github.com/JuanSaenz04/archiver/internal/quota"
+	"github.com/JuanSaenz04/archiver/internal/storage"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/JuanSaenz04/archiver/internal/wacz"
+	"github.com/google/uuid"
+)
+
+// Ingester turns the WACZ of a finished crawl into a stored archive: it
+// applies the skip-unchanged, deduplication and quota options, writes the
+// file to the storage backend and records it in the database.
+type Ingester struct {
+	archiveStore store.Store
+	storage      storage.Backend
+	quota        quota.Quota
+	recorder     Recorder
+}
+
+// Recorder saves a stored archive's metadata. By default the Ingester writes
+// it to the database itself; workers sharing the database with the API hand
+// it to the API instead, so that SQLite only ever has one writer.
+type Recorder interface {
+	Record(ctx context.Context, completion queue.CompletionMessage) error
+}
+
+func NewIngester(archiveStore store.Store, backend storage.Backend) *Ingester {
+	ingester := &Ingester{
+		archiveStore: archiveStore,
+		storage:      backend,
+	}
+	ingester.recorder = ingester
+	return ingester
+}
+
+// SetRecorder replaces the step that records stored archives. The Ingester
+// still reads the database for the skip-unchanged, deduplication and quota
+// checks.
+func (ingester *Ingester) SetRecorder(recorder Recorder) {
+	ingester.recorder = recorder
+}
+
+func (ingester *Ingester) SetStorageQuota(q quota.Quota) {
+	ingester.quota = q
+}
+
+// Ingest stores the WACZ at srcPath and returns the archive as recorded.
+// The file at srcPath is left in place.
+func (ingester *Ingester) Ingest(ctx context.Context, jobID string, archive models.Archive, options models.CrawlOptions, srcPath string) (models.Archive, error) {
+	if options.SkipUnchanged {
+		previous, unchanged, err := ingester.matchesPreviousSnapshot(ctx, archive, srcPath)
+		if err != nil {
+			slog.Warn("failed to compare crawl with previous snapshot, keeping archive", "job_id", jobID, "url", archive.SourceURL, "error", err)
+		} else if unchanged {
+			slog.Info("crawl matches previous snapshot, discarding archive", "job_id", jobID, "url", archive.SourceURL, "previous_archive_id", previous.ID)
+			return models.Archive{}, fmt.Errorf("%w: matches archive %s", models.ErrUnchanged, previous.ID)
+		}
+	}
+
+	filename, ok := archiveutil.NormalizeArchiveName(archive.Name)
+	if !ok {
+		filename = jobID + ".wacz"
+	}
+
+	// The final WACZ is staged next to the crawl output so its size and
+	// payloads are known before anything reaches the storage backend.
+	stagedPath := srcPath
+	var dedup wacz.DedupResult
+	if options.Deduplicate {
+		stagedPath = strings.TrimSuffix(srcPath, filepath.Ext(srcPath)) + ".dedup.wacz"
+		defer os.Remove(stagedPath)
+
+		var err error
+		dedup, err = ingester.deduplicate(ctx, srcPath, stagedPath)
+		if err != nil {
+			return models.Archive{}, fmt.Errorf("failed to deduplicate wacz: %w", err)
+		}
+	}
+
+	staged, err := os.Open(stagedPath)
+	if err != nil {
+		return models.Archive{}, fmt.Errorf("failed to open source wacz: %w", err)
+	}
+	defer staged.Close()
+
+	info, err := staged.Stat()
+	if err != nil {
+		return models.Archive{}, fmt.Errorf("failed to stat source wacz: %w", err)
+	}
+
+	if err := ingester.quota.Check(ctx, ingester.archiveStore, archive.Tags, info.Size()); err != nil {
+		slog.Warn("discarding archive over storage quota", "job_id", jobID, "size_bytes", info.Size(), "reason", err)
+		return models.Archive{}, err
+	}
+
+	filename, contentHash, err := ingester.putArchive(ctx, filename, staged, info.Size())
+	if err != nil {
+		return models.Archive{}, fmt.Errorf("failed to store wacz: %w", err)
+	}
+	keepFile := false
+	defer func() {
+		if !keepFile {
+			if err := ingester.storage.Delete(context.WithoutCancel(ctx), filename); err != nil {
+				slog.Warn("failed to remove stored wacz", "job_id", jobID, "filename", filename, "error", err)
+			}
+		}
+	}()
+
+	archive.Filename = filename
+	archive.SizeBytes = info.Size()
+	archive.ContentHash = contentHash
+	archive.DedupSavedBytes = dedup.SavedBytes
+	archive.CrawlOptions = &options
+
+	completion := queue.CompletionMessage{JobID: jobID, Archive: archive}
+	completion.Payloads, completion.ReferencedArchiveIDs, err = completedPayloads(stagedPath, dedup)
+	if err != nil {
+		// Without its references the archive could outlive the payloads it replays.
+		if len(dedup.ArchiveIDs) > 0 {
+			return models.Archive{}, fmt.Errorf("failed to register archive payloads: %w", err)
+		}
+		slog.Warn("failed to register archive payloads", "job_id", jobID, "archive_id", archive.ID, "error", err)
+	}
+
+	if err := ingester.recorder.Record(ctx, completion); err != nil {
+		return models.Archive{}, err
+	}
+	keepFile = true
+
+	return archive, nil
+}
+
+func (ingester *Ingester) matchesPreviousSnapshot(ctx context.Context, archive models.Archive, srcPath string) (models.Archive, bool, error) {
+	subject := archive.Subject
+	if subject == "" {
+		subject = archiveutil.NormalizeSubject(archive.SourceURL)
+	}
+	if subject == "" {
+		return models.Archive{}, false, nil
+	}
+
+	page, err := ingester.archiveStore.ListArchives(ctx, store.ListArchivesOptions{Subject: subject, Limit: 1})
+	if err != nil {
+		return models.Archive{}, false, err
+	}
+	if len(page.Archives) == 0 {
+		return models.Archive{}, false, nil
+	}
+	previous := page.Archives[0]
+
+	previousReader, err := wacz.OpenObject(ctx, ingester.storage, previous.Filename)
+	if err != nil {
+		return previous, false, fmt.Errorf("read previous archive %s: %w", previous.ID, err)
+	}
+	defer previousReader.Close()
+	previousRecords, err := previousReader.IndexRecords()
+	if err != nil {
+		return previous, false, fmt.Errorf("read previous archive %s: %w", previous.ID, err)
+	}
+	currentRecords, err := readIndexRecords(srcPath)
+	if err != nil {
+		return previous, false, fmt.Errorf("read new archive: %w", err)
+	}
+
+	// Page info and other non-response records change on every crawl, so
+	// only the URLs and payloads of responses decide whether anything did.
+	previousRecords = responseRecords(previousRecords)
+	currentRecords = responseRecords(currentRecords)
+	if len(currentRecords) == 0 {
+		return previous, false, nil
+	}
+
+	return previous, wacz.DiffIndexes(previousRecords, currentRecords).Empty(), nil
+}
+
+func responseRecords(records []wacz.IndexRecord) []wacz.IndexRecord {
+	responses := make([]wacz.IndexRecord, 0, len(records))
+	for _, record := range records {
+		if record.IsResponse() {
+			responses = append(responses, record)
+		}
+	}
+	return responses
+}
+
+func (ingester *Ingester) deduplicate(ctx context.Context, srcPath, dstPath string) (wacz.DedupResult, error) {
+	records, err := readIndexRecords(srcPath)
+	if err != nil {
+		return wacz.DedupResult{}, err
+	}
+
+	digests := make([]string, 0, len(records))
+	for _, record := range records {
+		if record.Digest != "" && record.Mime != "warc/revisit" {
+			digests = append(digests, record.Digest)
+		}
+	}
+	payloads, err := ingester.archiveStore.LookupPayloads(ctx, digests)
+	if err != nil {
+		return wacz.DedupResult{}, err
+	}
+
+	known := make(map[string]wacz.PayloadRef, len(payloads))
+	for digest, payload := range payloads {
+		known[digest] = wacz.PayloadRef{ArchiveID: payload.ArchiveID.String(), URL: payload.URL, Timestamp: payload.CapturedAt}
+	}
+
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return wacz.DedupResult{}, err
+	}
+	defer dst.Close()
+
+	result, err := wacz.Deduplicate(srcPath, dst, known)
+	if err != nil {
+		return wacz.DedupResult{}, err
+	}
+	return result, dst.Close()
+}
+
+// Record writes a stored archive and its payloads to the database. A bare
+// archive a storage sync registered for the same file while the completion
+// was pending is replaced.
+func (ingester *Ingester) Record(ctx context.Context, completion queue.CompletionMessage) error {
+	archive := completion.Archive
+	if err := ingester.archiveStore.Insert(ctx, archive); err != nil {
+		if !errors.Is(err, store.ErrArchiveFilenameConflict) {
+			return err
+		}
+		if err := ingester.archiveStore.ReplaceSynced(ctx, archive); err != nil {
+			return err
+		}
+		slog.Info("replaced archive registered by storage sync", "job_id", completion.JobID, "archive_id", archive.ID, "filename", archive.Filename)
+	}
+
+	payloads := make([]store.PayloadRecord, 0, len(completion.Payloads))
+	for _, payload := range completion.Payloads {
+		payloads = append(payloads, store.PayloadRecord{Digest: payload.Digest, URL: payload.URL, CapturedAt: payload.CapturedAt})
+	}
+
+	if err := ingester.archiveStore.RegisterPayloads(ctx, archive.ID, payloads, completion.ReferencedArchiveIDs); err != nil {
+		if len(completion.ReferencedArchiveIDs) > 0 {
+			if deleteErr := ingester.archiveStore.Delete(ctx, archive.ID); deleteErr != nil {
+				slog.Error("failed to remove archive after payload registration error", "job_id", completion.JobID, "archive_id", archive.ID, "error", deleteErr)
+			}
+			return fmt.Errorf("failed to register archive payloads: %w", err)
+		}
+		slog.Warn("failed to register archive payloads", "job_id", completion.JobID, "archive_id", archive.ID, "error", err)
+	}
+	return nil
+}
+
+// RecordCompletion records an archive a worker has already stored. It is
+// the API's handler for the completion stream. Transient database errors
+// are returned as retryable, keeping the stored file for the retry; on
+// other errors the file is removed, unless another archive was recorded
+// for it.
+func (ingester *Ingester) RecordCompletion(ctx context.Context, completion queue.CompletionMessage) error {
+	err := ingester.Record(ctx, completion)
+	if err != nil && store.IsTransient(err) {
+		return queue.Retryable(err)
+	}
+	if errors.Is(err, store.ErrArchiveFilenameConflict) || errors.Is(err, store.ErrArchiveReferenced) {
+		slog.Warn("keeping stored wacz recorded as another archive", "job_id", completion.JobID, "filename", completion.Archive.Filename)
+		return err
+	}
+	if err != nil && completion.Archive.Filename != "" {
+		if deleteErr := ingester.storage.Delete(context.WithoutCancel(ctx), completion.Archive.Filename); deleteErr != nil {
+			slog.Warn("failed to remove stored wacz", "job_id", completion.JobID, "filename", completion.Archive.Filename, "error", deleteErr)
+		}
+	}
+	return err
+}
+
+// Describe reads the title, source URL, capture date and crawler of an
+// archive file found in storage. It is the Describe hook for storage syncs.
+func (ingester *Ingester) Describe(ctx context.Context, filename string) (store.FileDetails, error) {
+	reader, err := wacz.OpenObject(ctx, ingester.storage, filename)
+	if err != nil {
+		return store.FileDetails{}, err
+	}
+	defer reader.Close()
+
+	metadata, err := reader.Metadata()
+	if err != nil {
+		return store.FileDetails{}, err
+	}
+
+	return store.FileDetails{
+		Name:      metadata.Title,
+		SourceURL: metadata.SourceURL,
+		Subject:   archiveutil.NormalizeSubject(metadata.SourceURL),
+		CreatedAt: metadata.CreatedAt,
+		Software:  metadata.Software,
+	}, nil
+}
+
+func completedPayloads(path string, dedup wacz.DedupResult) ([]queue.CompletedPayload, []uuid.UUID, error) {
+	referenced := make([]uuid.UUID, 0, len(dedup.ArchiveIDs))
+	for _, value := range dedup.ArchiveIDs {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return nil, nil, err
+		}
+		referenced = append(referenced, id)
+	}
+
+	records, err := readIndexRecords(path)
+	if err != nil {
+		return nil, referenced, err
+	}
+
+	payloads := make([]queue.CompletedPayload, 0, len(records))
+	for _, record := range records {
+		if record.Digest == "" || record.Mime == "warc/revisit" {
+			continue
+		}
+		payloads = append(payloads, queue.CompletedPayload{Digest: record.Digest, URL: record.URL, CapturedAt: record.Timestamp})
+	}
+	return payloads, referenced, nil
+}
+
+func readIndexRecords(path string) ([]wacz.IndexRecord, error) {
+	reader, err := wacz.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return reader.IndexRecords()
+}
+
+// putArchive stores the WACZ under filename, adding a numeric suffix while
+// the name is taken, and returns the key it was stored under along with the
+// SHA-256 of the stored bytes, computed as they are copied.
+func (ingester *Ingester) putArchive(ctx context.Context, filename string, src io.ReadSeeker, size int64) (string, string, error) {
+	ext := filepath.Ext(filename)
+	name := strings.TrimSuffix(filename, ext)
+
+	for suffix := 0; ; suffix++ {
+		candidate := filename
+		if suffix > 0 {
+			candidate = fmt.Sprintf("%s-%d%s", name, suffix, ext)
+		}
+
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			return "", "", err
+		}
+		hash := sha256.New()
+		err := ingester.storage.Put(ctx, candidate, io.TeeReader(src, hash), size)
+		if errors.Is(err, storage.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", "", err
+		}
+		return candidate, hex.EncodeToString(hash.Sum(nil)), nil
+	}
+}
@@ -0,0 +1,483 @@
+package ingest
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/queue"
+	"github.com/JuanSaenz04/archiver/internal/quota"
+	"github.com/JuanSaenz04/archiver/internal/storage"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStore(t *testing.T) *store.ArchiveStore {
+	t.Helper()
+
+	s, err := store.Open("file:" + uuid.NewString() + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := s.Close(); err != nil {
+			t.Fatalf("close store: %v", err)
+		}
+	})
+	if err := s.RunMigrations(); err != nil {
+		t.Fatalf("run migrations: %v", err)
+	}
+	return s
+}
+
+func TestIngest_DuplicateNamePreservesExistingArchive(t *testing.T) {
+	archiveStore := newTestStore(t)
+	tempDir := t.TempDir()
+	archivesDir := filepath.Join(tempDir, "archives")
+	ingester := NewIngester(archiveStore, storage.NewLocal(archivesDir))
+	if err := os.MkdirAll(archivesDir, 0755); err != nil {
+		t.Fatalf("create archives directory: %v", err)
+	}
+
+	existingArchive := models.Archive{
+		ID:          uuid.New(),
+		Name:        "Duplicate Name",
+		Filename:    "Duplicate-Name.wacz",
+		Description: "some description",
+		SourceURL:   "https://example.com/original",
+	}
+
+	ctx := context.Background()
+	err := archiveStore.Insert(ctx, existingArchive)
+	assert.NoError(t, err)
+	existingPath := filepath.Join(archivesDir, existingArchive.Filename)
+	assert.NoError(t, os.WriteFile(existingPath, []byte("original archive"), 0644))
+
+	jobID := uuid.New().String()
+	archive := models.Archive{
+		ID:        uuid.MustParse(jobID),
+		Name:      "Duplicate Name",
+		SourceURL: "https://example.com/duplicate",
+	}
+	srcPath := filepath.Join(tempDir, jobID+".wacz")
+	assert.NoError(t, os.WriteFile(srcPath, []byte("some wacz content"), 0644))
+
+	stored, err := ingester.Ingest(ctx, jobID, archive, models.CrawlOptions{}, srcPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "Duplicate-Name-1.wacz", stored.Filename)
+
+	existingBytes, err := os.ReadFile(existingPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "original archive", string(existingBytes))
+
+	newBytes, err := os.ReadFile(filepath.Join(archivesDir, "Duplicate-Name-1.wacz"))
+	assert.NoError(t, err)
+	assert.Equal(t, "some wacz content", string(newBytes))
+
+	records, err := archiveStore.List(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	filenames := make(map[uuid.UUID]string, len(records))
+	for _, record := range records {
+		filenames[record.ID] = record.Filename
+	}
+	assert.Equal(t, "Duplicate-Name.wacz", filenames[existingArchive.ID])
+	assert.Equal(t, "Duplicate-Name-1.wacz", filenames[archive.ID])
+}
+
+func writeWACZ(t *testing.T, path, cdxj string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("create wacz directory: %v", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create wacz: %v", err)
+	}
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+	w, err := zw.Create("indexes/index.cdxj")
+	if err != nil {
+		t.Fatalf("create index: %v", err)
+	}
+	if _, err := w.Write([]byte(cdxj)); err != nil {
+		t.Fatalf("write index: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close wacz: %v", err)
+	}
+}
+
+func TestIngest_SkipUnchanged(t *testing.T) {
+	const previousIndex = `com,example)/ 20260401000000 {"url":"https://example.com/","status":"200","digest":"sha256:home"}` + "\n" +
+		`urn:pageinfo:https://example.com/ 20260401000000 {"url":"urn:pageinfo:https://example.com/","mime":"application/json","digest":"sha256:pageinfo1"}` + "\n"
+	const sameIndex = `com,example)/ 20260408000000 {"url":"https://example.com/","status":"200","digest":"sha256:home"}` + "\n" +
+		`urn:pageinfo:https://example.com/ 20260408000000 {"url":"urn:pageinfo:https://example.com/","mime":"application/json","digest":"sha256:pageinfo2"}` + "\n"
+	const changedIndex = `com,example)/ 20260408000000 {"url":"https://example.com/","status":"200","digest":"sha256:updated"}` + "\n"
+
+	for _, tt := range []struct {
+		name       string
+		index      string
+		wantErr    bool
+		wantRecord int
+	}{
+		{name: "discards identical capture", index: sameIndex, wantErr: true, wantRecord: 1},
+		{name: "keeps changed capture", index: changedIndex, wantRecord: 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			archiveStore := newTestStore(t)
+			tempDir := t.TempDir()
+			archivesDir := filepath.Join(tempDir, "archives")
+			ingester := NewIngester(archiveStore, storage.NewLocal(archivesDir))
+
+			ctx := context.Background()
+			previous := models.Archive{
+				ID:        uuid.New(),
+				Name:      "Weekly",
+				Filename:  "Weekly.wacz",
+				SourceURL: "https://example.com/",
+				Subject:   "https://example.com",
+			}
+			writeWACZ(t, filepath.Join(archivesDir, previous.Filename), previousIndex)
+			assert.NoError(t, archiveStore.Insert(ctx, previous))
+
+			jobID := uuid.New().String()
+			archive := models.Archive{
+				ID:        uuid.MustParse(jobID),
+				Name:      "Weekly",
+				SourceURL: "https://example.com/",
+				Subject:   "https://example.com",
+			}
+			srcPath := filepath.Join(tempDir, "collections", jobID+".wacz")
+			writeWACZ(t, srcPath, tt.index)
+
+			_, err := ingester.Ingest(ctx, jobID, archive, models.CrawlOptions{SkipUnchanged: true}, srcPath)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, models.ErrUnchanged)
+				assert.NoFileExists(t, filepath.Join(archivesDir, "Weekly-1.wacz"))
+			} else {
+				assert.NoError(t, err)
+				assert.FileExists(t, filepath.Join(archivesDir, "Weekly-1.wacz"))
+			}
+
+			records, err := archiveStore.List(ctx)
+			assert.NoError(t, err)
+			assert.Len(t, records, tt.wantRecord)
+		})
+	}
+}
+
+type warcFixture struct {
+	url     string
+	digest  string
+	payload string
+}
+
+func writeWARCWACZ(t *testing.T, path string, fixtures []warcFixture) {
+	t.Helper()
+
+	var warc bytes.Buffer
+	var index strings.Builder
+	for i, fixture := range fixtures {
+		block := "HTTP/1.1 200 OK\r\nContent-Type: text/css\r\n\r\n" + fixture.payload
+		record := fmt.Sprintf("WARC/1.1\r\nWARC-Type: response\r\nWARC-Target-URI: %s\r\nWARC-Date: 2026-04-01T00:00:00Z\r\nWARC-Payload-Digest: %s\r\nContent-Length: %d\r\n\r\n%s\r\n\r\n",
+			fixture.url, fixture.digest, len(block), block)
+
+		offset := warc.Len()
+		gz := gzip.NewWriter(&warc)
+		if _, err := gz.Write([]byte(record)); err != nil {
+			t.Fatalf("write warc record: %v", err)
+		}
+		if err := gz.Close(); err != nil {
+			t.Fatalf("close warc record: %v", err)
+		}
+		fmt.Fprintf(&index, `com,example)/%d 20260401000000 {"url":%q,"mime":"text/css","status":"200","digest":%q,"length":%d,"offset":%d,"filename":"data.warc.gz"}`+"\n",
+			i, fixture.url, fixture.digest, warc.Len()-offset, offset)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("create wacz directory: %v", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create wacz: %v", err)
+	}
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+	for name, data := range map[string][]byte{
+		"archive/data.warc.gz": warc.Bytes(),
+		"indexes/index.cdxj":   []byte(index.String()),
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close wacz: %v", err)
+	}
+}
+
+func TestIngest_Deduplicate(t *testing.T) {
+	archiveStore := newTestStore(t)
+	tempDir := t.TempDir()
+	archivesDir := filepath.Join(tempDir, "archives")
+	ingester := NewIngester(archiveStore, storage.NewLocal(archivesDir))
+
+	ctx := context.Background()
+	stylesheet := warcFixture{url: "https://example.com/style.css", digest: "sha256:style", payload: strings.Repeat("body { color: red; }\n", 2048)}
+	options := models.CrawlOptions{Deduplicate: true}
+
+	crawl := func(name string, fixtures ...warcFixture) models.Archive {
+		t.Helper()
+
+		jobID := uuid.New().String()
+		srcPath := filepath.Join(tempDir, "collections", jobID, jobID+".wacz")
+		writeWARCWACZ(t, srcPath, fixtures)
+		archive := models.Archive{ID: uuid.MustParse(jobID), Name: name, SourceURL: "https://example.com/"}
+		if _, err := ingester.Ingest(ctx, jobID, archive, options, srcPath); err != nil {
+			t.Fatalf("ingest crawl %s: %v", name, err)
+		}
+		assert.NoFileExists(t, filepath.Join(filepath.Dir(srcPath), jobID+".dedup.wacz"))
+
+		stored, err := archiveStore.Get(ctx, archive.ID)
+		if err != nil {
+			t.Fatalf("get archive %s: %v", name, err)
+		}
+		return stored
+	}
+
+	first := crawl("First", stylesheet, warcFixture{url: "https://example.com/", digest: "sha256:home", payload: "first"})
+	assert.Zero(t, first.DedupSavedBytes)
+
+	second := crawl("Second", stylesheet, warcFixture{url: "https://example.com/", digest: "sha256:home-v2", payload: "second"})
+	assert.Positive(t, second.DedupSavedBytes)
+
+	info, err := os.Stat(filepath.Join(archivesDir, second.Filename))
+	assert.NoError(t, err)
+	assert.Equal(t, info.Size(), second.SizeBytes)
+
+	referenced, err := archiveStore.ListReferencedArchiveIDs(ctx, second.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{first.ID}, referenced)
+
+	payloads, err := archiveStore.LookupPayloads(ctx, []string{"sha256:style", "sha256:home-v2"})
+	assert.NoError(t, err)
+	assert.Equal(t, first.ID, payloads["sha256:style"].ArchiveID)
+	assert.Equal(t, second.ID, payloads["sha256:home-v2"].ArchiveID)
+
+	assert.ErrorIs(t, archiveStore.Delete(ctx, first.ID), store.ErrArchiveReferenced)
+}
+
+func TestIngest_DiscardsArchiveOverStorageQuota(t *testing.T) {
+	archiveStore := newTestStore(t)
+	tempDir := t.TempDir()
+	archivesDir := filepath.Join(tempDir, "archives")
+	ingester := NewIngester(archiveStore, storage.NewLocal(archivesDir))
+	ingester.SetStorageQuota(quota.Quota{TagBytes: map[string]int64{"temp": 1024}})
+
+	ctx := context.Background()
+	assert.NoError(t, archiveStore.Insert(ctx, models.Archive{ID: uuid.New(), Name: "existing", Filename: "existing.wacz", Tags: []string{"temp"}, SizeBytes: 1000}))
+
+	jobID := uuid.New().String()
+	srcPath := filepath.Join(tempDir, "collections", jobID+".wacz")
+	writeWACZ(t, srcPath, strings.Repeat("x", 512))
+	archive := models.Archive{ID: uuid.MustParse(jobID), Name: "Scratch", SourceURL: "https://example.com/", Tags: []string{"temp"}}
+
+	_, err := ingester.Ingest(ctx, jobID, archive, models.CrawlOptions{}, srcPath)
+	assert.ErrorIs(t, err, quota.ErrExceeded)
+	assert.NoFileExists(t, filepath.Join(archivesDir, "Scratch.wacz"))
+
+	archives, err := archiveStore.List(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, archives, 1)
+}
+
+type recorderFunc func(ctx context.Context, completion queue.CompletionMessage) error
+
+func (f recorderFunc) Record(ctx context.Context, completion queue.CompletionMessage) error {
+	return f(ctx, completion)
+}
+
+func TestIngest_DelegatesRecordingToRecorder(t *testing.T) {
+	archiveStore := newTestStore(t)
+	tempDir := t.TempDir()
+	archivesDir := filepath.Join(tempDir, "archives")
+	ingester := NewIngester(archiveStore, storage.NewLocal(archivesDir))
+
+	var completions []queue.CompletionMessage
+	ingester.SetRecorder(recorderFunc(func(_ context.Context, completion queue.CompletionMessage) error {
+		completions = append(completions, completion)
+		return nil
+	}))
+
+	ctx := context.Background()
+	jobID := uuid.New().String()
+	srcPath := filepath.Join(tempDir, "collections", jobID+".wacz")
+	writeWACZ(t, srcPath, `com,example)/ 20260401000000 {"url":"https://example.com/","digest":"sha256:home"}`+"\n")
+	archive := models.Archive{ID: uuid.MustParse(jobID), Name: "Weekly", SourceURL: "https://example.com/"}
+
+	stored, err := ingester.Ingest(ctx, jobID, archive, models.CrawlOptions{}, srcPath)
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(archivesDir, "Weekly.wacz"))
+
+	archives, err := archiveStore.List(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, archives, "the ingester must not write to the database itself")
+
+	if assert.Len(t, completions, 1) {
+		assert.Equal(t, jobID, completions[0].JobID)
+		assert.Equal(t, stored, completions[0].Archive)
+		assert.Equal(t, []queue.CompletedPayload{{Digest: "sha256:home", URL: "https://example.com/", CapturedAt: "20260401000000"}}, completions[0].Payloads)
+	}
+
+	// The API records the completion on the worker's behalf.
+	assert.NoError(t, NewIngester(archiveStore, storage.NewLocal(archivesDir)).RecordCompletion(ctx, completions[0]))
+	recorded, err := archiveStore.Get(ctx, stored.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Weekly.wacz", recorded.Filename)
+	payloads, err := archiveStore.LookupPayloads(ctx, []string{"sha256:home"})
+	assert.NoError(t, err)
+	assert.Equal(t, stored.ID, payloads["sha256:home"].ArchiveID)
+}
+
+func TestRecordCompletionRemovesFileItCannotRecord(t *testing.T) {
+	archiveStore := newTestStore(t)
+	archivesDir := t.TempDir()
+	ingester := NewIngester(archiveStore, storage.NewLocal(archivesDir))
+
+	ctx := context.Background()
+	existing := models.Archive{ID: uuid.New(), Name: "Weekly", Filename: "Weekly.wacz"}
+	assert.NoError(t, archiveStore.Insert(ctx, existing))
+	assert.NoError(t, os.WriteFile(filepath.Join(archivesDir, "Weekly-1.wacz"), []byte("wacz"), 0644))
+
+	// Reusing an existing ID makes the insert fail.
+	duplicate := existing
+	duplicate.Filename = "Weekly-1.wacz"
+	err := ingester.RecordCompletion(ctx, queue.CompletionMessage{JobID: existing.ID.String(), Archive: duplicate})
+	assert.Error(t, err)
+	assert.NoFileExists(t, filepath.Join(archivesDir, "Weekly-1.wacz"))
+}
+
+func TestRecordCompletionKeepsFileOnTransientErrors(t *testing.T) {
+	archiveStore := newTestStore(t)
+	archivesDir := t.TempDir()
+	ingester := NewIngester(archiveStore, storage.NewLocal(archivesDir))
+	assert.NoError(t, os.WriteFile(filepath.Join(archivesDir, "Weekly.wacz"), []byte("wacz"), 0644))
+
+	// The API is shutting down while the completion is recorded.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	archive := models.Archive{ID: uuid.New(), Name: "Weekly", Filename: "Weekly.wacz"}
+	err := ingester.RecordCompletion(ctx, queue.CompletionMessage{JobID: archive.ID.String(), Archive: archive})
+
+	var retryable *queue.RetryableError
+	assert.ErrorAs(t, err, &retryable)
+	assert.FileExists(t, filepath.Join(archivesDir, "Weekly.wacz"))
+}
+
+func TestRecordCompletionReplacesArchiveRegisteredBySync(t *testing.T) {
+	archiveStore := newTestStore(t)
+	archivesDir := t.TempDir()
+	backend := storage.NewLocal(archivesDir)
+	ingester := NewIngester(archiveStore, backend)
+
+	// A sync registers the stored file while its completion is pending.
+	ctx := context.Background()
+	assert.NoError(t, os.WriteFile(filepath.Join(archivesDir, "Weekly.wacz"), []byte("wacz"), 0644))
+	report, err := archiveStore.SyncFromDisk(ctx, backend, store.SyncOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, report.Added, 1)
+
+	sum := sha256.Sum256([]byte("wacz"))
+	archive := models.Archive{ID: uuid.New(), Name: "Weekly", Filename: "Weekly.wacz", ContentHash: hex.EncodeToString(sum[:]), SizeBytes: 4}
+	assert.NoError(t, ingester.RecordCompletion(ctx, queue.CompletionMessage{JobID: archive.ID.String(), Archive: archive}))
+	assert.FileExists(t, filepath.Join(archivesDir, "Weekly.wacz"))
+
+	archives, err := archiveStore.List(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, archives, 1) {
+		assert.Equal(t, archive.ID, archives[0].ID)
+	}
+
+	// A completion for different contents leaves the recorded file alone.
+	other := models.Archive{ID: uuid.New(), Name: "Weekly", Filename: "Weekly.wacz", ContentHash: "other"}
+	err = ingester.RecordCompletion(ctx, queue.CompletionMessage{JobID: other.ID.String(), Archive: other})
+	assert.ErrorIs(t, err, store.ErrArchiveFilenameConflict)
+	assert.FileExists(t, filepath.Join(archivesDir, "Weekly.wacz"))
+}
+
+func TestDescribeReadsArchiveDetails(t *testing.T) {
+	archivesDir := t.TempDir()
+	file, err := os.Create(filepath.Join(archivesDir, "imported.wacz"))
+	assert.NoError(t, err)
+	zw := zip.NewWriter(file)
+	for name, data := range map[string]string{
+		"datapackage.json":  `{"profile":"data-package","software":"Browsertrix-Crawler 1.5.0"}`,
+		"pages/pages.jsonl": `{"format":"json-pages-1.0","id":"pages"}` + "\n" + `{"id":"1","url":"https://Example.com/docs/","title":"Docs","ts":"2026-02-03T04:05:06Z","seed":true}` + "\n",
+	} {
+		w, err := zw.Create(name)
+		assert.NoError(t, err)
+		_, err = w.Write([]byte(data))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+	assert.NoError(t, file.Close())
+
+	ingester := NewIngester(newTestStore(t), storage.NewLocal(archivesDir))
+	details, err := ingester.Describe(context.Background(), "imported.wacz")
+	assert.NoError(t, err)
+	assert.Equal(t, store.FileDetails{
+		Name:      "Docs",
+		SourceURL: "https://Example.com/docs/",
+		Subject:   "https://example.com/docs",
+		CreatedAt: time.Date(2026, 2, 3, 4, 5, 6, 0, time.UTC),
+		Software:  "Browsertrix-Crawler 1.5.0",
+	}, details)
+
+	_, err = ingester.Describe(context.Background(), "missing.wacz")
+	assert.Error(t, err)
+}
+
+func TestIngest_RecordsContentHash(t *testing.T) {
+	archiveStore := newTestStore(t)
+	tempDir := t.TempDir()
+	ingester := NewIngester(archiveStore, storage.NewLocal(filepath.Join(tempDir, "archives")))
+
+	jobID := uuid.New().String()
+	srcPath := filepath.Join(tempDir, jobID+".wacz")
+	assert.NoError(t, os.WriteFile(srcPath, []byte("hashed wacz content"), 0644))
+
+	ctx := context.Background()
+	stored, err := ingester.Ingest(ctx, jobID, models.Archive{ID: uuid.MustParse(jobID), Name: "hashed"}, models.CrawlOptions{}, srcPath)
+	assert.NoError(t, err)
+
+	sum := sha256.Sum256([]byte("hashed wacz content"))
+	want := hex.EncodeToString(sum[:])
+	assert.Equal(t, want, stored.ContentHash)
+
+	page, err := archiveStore.ListArchives(ctx, store.ListArchivesOptions{ContentHash: want})
+	assert.NoError(t, err)
+	if assert.Len(t, page.Archives, 1) {
+		assert.Equal(t, stored.ID, page.Archives[0].ID)
+		assert.Equal(t, want, page.Archives[0].ContentHash)
+	}
+}
@@ -6,13 +6,47 @@ import (
 	"github.com/google/uuid"
 )
 
+// Visibility controls who may see an archive when authentication is
+// enabled. Private archives are seen by their owner, shared ones by every
+// signed in user and public ones by anyone. Administrators see them all.
+type Visibility string
+
+const (
+	VisibilityPrivate Visibility = "private"
+	VisibilityShared  Visibility = "shared"
+	VisibilityPublic  Visibility = "public"
+)
+
+func (visibility Visibility) Valid() bool {
+	switch visibility {
+	case VisibilityPrivate, VisibilityShared, VisibilityPublic:
+		return true
+	}
+	return false
+}
+
+// Archive is a stored WACZ. ContentHash is the hex SHA-256 of its file,
+// empty until known, and MissingAt is set when a storage sync no longer
+// finds the file. Software is the crawler that wrote the file, as read from
+// its metadata. OwnerID is the user who started the crawl, if known, and
+// Owner their username; only OwnerID is stored.
 type Archive struct {
-	ID          uuid.UUID `json:"id"`
-	Name        string    `json:"name"`
-	Filename    string    `json:"filename"`
-	Description string    `json:"description"`
-	SourceURL   string    `json:"source_url"`
-	Tags        []string  `json:"tags"`
-	CreatedAt   time.Time `json:"created_at"`
-	SizeBytes   int64     `json:"size_bytes"`
+	ID              uuid.UUID     `json:"id"`
+	Name            string        `json:"name"`
+	Filename        string        `json:"filename"`
+	Description     string        `json:"description"`
+	SourceURL       string        `json:"source_url"`
+	Subject         string        `json:"subject"`
+	Tags            []string      `json:"tags"`
+	CreatedAt       time.Time     `json:"created_at"`
+	SizeBytes       int64         `json:"size_bytes"`
+	DedupSavedBytes int64         `json:"dedup_saved_bytes"`
+	ContentHash     string        `json:"content_hash"`
+	Software        string        `json:"software"`
+	CrawlOptions    *CrawlOptions `json:"crawl_options,omitempty"`
+	DeletedAt       *time.Time    `json:"deleted_at,omitempty"`
+	MissingAt       *time.Time    `json:"missing_at,omitempty"`
+	OwnerID         *uuid.UUID    `json:"owner_id,omitempty"`
+	Owner           string        `json:"owner,omitempty"`
+	Visibility      Visibility    `json:"visibility"`
 }
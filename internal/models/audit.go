@@ -0,0 +1,25 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditEntry records one change made through the API. Actor is the
+// username of ActorID, empty when authentication is disabled, and TokenID
+// the API token the change was made with, if any. Before and After hold the
+// changed object as JSON, when it existed.
+type AuditEntry struct {
+	ID        int64           `json:"id"`
+	CreatedAt time.Time       `json:"created_at"`
+	ActorID   *uuid.UUID      `json:"actor_id,omitempty"`
+	Actor     string          `json:"actor"`
+	TokenID   *uuid.UUID      `json:"token_id,omitempty"`
+	ClientIP  string          `json:"client_ip"`
+	Action    string          `json:"action"`
+	TargetID  string          `json:"target_id"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+}
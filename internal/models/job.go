@@ -1,20 +1,56 @@
 package models
 
 import (
+	"errors"
+
 	"github.com/google/uuid"
 )
 
+// ErrUnchanged is returned for a crawl that finished without producing an
+// archive because nothing changed since the previous capture.
+var ErrUnchanged = errors.New("content unchanged since previous snapshot")
+
+// Priority orders crawl jobs. Workers run every queued high priority job
+// before any normal one, and normal ones before low ones, so one-off
+// captures are not held up by large batches submitted as low priority.
+type Priority string
+
+const (
+	PriorityHigh   Priority = "high"
+	PriorityNormal Priority = "normal"
+	PriorityLow    Priority = "low"
+)
+
+// Priorities lists the priority levels from the highest.
+var Priorities = []Priority{PriorityHigh, PriorityNormal, PriorityLow}
+
+func (priority Priority) Valid() bool {
+	switch priority {
+	case PriorityHigh, PriorityNormal, PriorityLow:
+		return true
+	}
+	return false
+}
+
 type Job struct {
 	ID        uuid.UUID `json:"id"`
 	URL       string    `json:"url"`
 	Status    string    `json:"status"`
 	CreatedAt string    `json:"created_at"`
+	Owner     string    `json:"owner,omitempty"`
+	Priority  Priority  `json:"priority"`
 }
 
 type CrawlRequest struct {
 	URL         string       `json:"url"`
 	Name        string       `json:"name"`
 	Description string       `json:"description"`
+	Subject     string       `json:"subject"`
 	Tags        []string     `json:"tags"`
 	Options     CrawlOptions `json:"crawl_options"`
+	Visibility  Visibility   `json:"visibility"`
+	// Priority defaults to PriorityNormal.
+	Priority Priority `json:"priority"`
+	// Owner is the user starting the crawl. It is never read from requests.
+	Owner *User `json:"-"`
 }
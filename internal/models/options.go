@@ -12,8 +12,10 @@ const (
 )
 
 type CrawlOptions struct {
-	ScopeType ScopeType `json:"scopeType"`
-	PageLimit int       `json:"page_limit"`
-	SizeLimit int       `json:"size_limit"`
-	Depth     int       `json:"depth"`
+	ScopeType     ScopeType `json:"scopeType"`
+	PageLimit     int       `json:"page_limit"`
+	SizeLimit     int       `json:"size_limit"`
+	Depth         int       `json:"depth"`
+	SkipUnchanged bool      `json:"skip_unchanged"`
+	Deduplicate   bool      `json:"deduplicate"`
 }
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RetentionRule expires archives carrying Tag (or every archive when Tag is
+// empty). With both MaxAgeDays and KeepLast set, an archive expires only
+// when it is older than MaxAgeDays and not among the KeepLast newest
+// snapshots of its subject. Hold rules protect matching archives from every
+// other rule.
+type RetentionRule struct {
+	ID         uuid.UUID `json:"id"`
+	Name       string    `json:"name"`
+	Tag        string    `json:"tag"`
+	MaxAgeDays int       `json:"max_age_days"`
+	KeepLast   int       `json:"keep_last"`
+	Hold       bool      `json:"hold"`
+	DryRun     bool      `json:"dry_run"`
+	CreatedAt  time.Time `json:"created_at"`
+}
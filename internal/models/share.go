@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ShareLink lets anyone holding its URL replay one archive until ExpiresAt.
+// CreatedBy is unset when authentication was disabled or the user deleted.
+type ShareLink struct {
+	ID        uuid.UUID  `json:"id"`
+	ArchiveID uuid.UUID  `json:"archive_id"`
+	Name      string     `json:"name"`
+	CreatedBy *uuid.UUID `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+}
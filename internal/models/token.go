@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TokenScope limits what an API token can do. Each scope includes the ones
+// before it: read, then crawl, then admin.
+type TokenScope string
+
+const (
+	ScopeRead  TokenScope = "read"
+	ScopeCrawl TokenScope = "crawl"
+	ScopeAdmin TokenScope = "admin"
+)
+
+var scopeLevels = map[TokenScope]int{
+	ScopeRead:  1,
+	ScopeCrawl: 2,
+	ScopeAdmin: 3,
+}
+
+func (scope TokenScope) Valid() bool {
+	return scopeLevels[scope] > 0
+}
+
+// Allows reports whether a token with this scope may do what required
+// allows.
+func (scope TokenScope) Allows(required TokenScope) bool {
+	return scope.Valid() && scopeLevels[scope] >= scopeLevels[required]
+}
+
+// APIToken is a token for scripts. UserID is the user it acts as, unset
+// for tokens created while built-in authentication was disabled.
+type APIToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scope      TokenScope `json:"scope"`
+	UserID     *uuid.UUID `json:"user_id,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
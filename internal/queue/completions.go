@@ -0,0 +1,312 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	completionStreamName = "archive_completion_stream"
+	completionGroupName  = "api_group"
+	pendingPageSize      = 100
+	// Completions left pending this long, because recording them failed
+	// or the API that read them stopped, are claimed and handled again.
+	completionClaimIdle     = time.Minute
+	completionClaimInterval = 30 * time.Second
+)
+
+// CompletionMessage carries everything the API needs to record an archive a
+// worker has already written to the shared storage.
+type CompletionMessage struct {
+	JobID                string             `json:"job_id"`
+	Archive              models.Archive     `json:"archive"`
+	Payloads             []CompletedPayload `json:"payloads,omitempty"`
+	ReferencedArchiveIDs []uuid.UUID        `json:"referenced_archive_ids,omitempty"`
+}
+
+type CompletedPayload struct {
+	Digest     string `json:"digest"`
+	URL        string `json:"url"`
+	CapturedAt string `json:"captured_at"`
+}
+
+// CompletionHandler records a completed archive. When it fails the job is
+// marked as failed, unless the error is Retryable: the completion is then
+// left pending and handled again later.
+type CompletionHandler func(ctx context.Context, msg CompletionMessage) error
+
+// RetryableError marks a completion handler error as transient, such as a
+// locked or unreachable database.
+type RetryableError struct {
+	Err error
+}
+
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable marks err as transient.
+func Retryable(err error) error {
+	return &RetryableError{Err: err}
+}
+
+// CompletionPublisher hands completed archives to the API so the database
+// only ever has a single writer.
+type CompletionPublisher struct {
+	rdb *redis.Client
+}
+
+func NewCompletionPublisher(rdb *redis.Client) *CompletionPublisher {
+	return &CompletionPublisher{rdb: rdb}
+}
+
+func (publisher *CompletionPublisher) Record(ctx context.Context, msg CompletionMessage) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	err = publisher.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: completionStreamName,
+		Values: map[string]interface{}{
+			"job_id":  msg.JobID,
+			"payload": string(payload),
+		},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("publish archive completion: %w", err)
+	}
+	return nil
+}
+
+// PendingCompletionFiles returns the filenames of stored archives whose
+// completion has been published but not yet recorded by the API.
+func PendingCompletionFiles(ctx context.Context, rdb *redis.Client) (map[string]bool, error) {
+	files := make(map[string]bool)
+	groups, err := rdb.XInfoGroups(ctx, completionStreamName).Result()
+	if err != nil {
+		// No completion was published yet.
+		if redis.HasErrorPrefix(err, "no such key") {
+			return files, nil
+		}
+		return nil, fmt.Errorf("inspect completion stream: %w", err)
+	}
+
+	start := "-"
+	for _, group := range groups {
+		if group.Name == completionGroupName {
+			start = "(" + group.LastDeliveredID
+		}
+	}
+	messages, err := rdb.XRange(ctx, completionStreamName, start, "+").Result()
+	if err != nil {
+		return nil, fmt.Errorf("read completion stream: %w", err)
+	}
+
+	// Messages delivered but not acknowledged are still being recorded, or
+	// were left by an API that stopped.
+	for from := "-"; start != "-"; {
+		pending, err := rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: completionStreamName,
+			Group:  completionGroupName,
+			Start:  from,
+			End:    "+",
+			Count:  pendingPageSize,
+		}).Result()
+		if err != nil {
+			return nil, fmt.Errorf("read pending completions: %w", err)
+		}
+		for _, entry := range pending {
+			delivered, err := rdb.XRange(ctx, completionStreamName, entry.ID, entry.ID).Result()
+			if err != nil {
+				return nil, fmt.Errorf("read completion stream: %w", err)
+			}
+			messages = append(messages, delivered...)
+		}
+		if len(pending) < pendingPageSize {
+			break
+		}
+		from = "(" + pending[len(pending)-1].ID
+	}
+
+	for _, message := range messages {
+		payload, _ := message.Values["payload"].(string)
+		var msg CompletionMessage
+		if err := json.Unmarshal([]byte(payload), &msg); err == nil && msg.Archive.Filename != "" {
+			files[msg.Archive.Filename] = true
+		}
+	}
+	return files, nil
+}
+
+func ensureCompletionGroup(ctx context.Context, rdb *redis.Client) error {
+	err := rdb.XGroupCreateMkStream(ctx, completionStreamName, completionGroupName, "0").Err()
+	if err != nil && !redis.HasErrorPrefix(err, "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// StartCompletionConsumer records archives published by workers until ctx
+// is cancelled. Messages left unacknowledged by a previous run of the same
+// consumer are handled first, and those left idle by any consumer, such as
+// an API that stopped or a completion that failed transiently, are claimed
+// on startup and periodically, so that no completion is lost.
+func StartCompletionConsumer(ctx context.Context, rdb *redis.Client, consumerName string, handle CompletionHandler) error {
+	if err := ensureCompletionGroup(ctx, rdb); err != nil {
+		return fmt.Errorf("create completion consumer group on startup: %w", err)
+	}
+
+	start := "0"
+	var lastClaim time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		if time.Since(lastClaim) >= completionClaimInterval {
+			lastClaim = time.Now()
+			claimIdleCompletions(ctx, rdb, consumerName, handle)
+		}
+
+		streams, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    completionGroupName,
+			Consumer: consumerName,
+			Streams:  []string{completionStreamName, start},
+			Count:    1,
+			Block:    1 * time.Second,
+		}).Result()
+
+		if err != nil {
+			if err == context.Canceled {
+				return nil
+			}
+			if err == redis.Nil {
+				continue
+			}
+
+			if redis.HasErrorPrefix(err, "NOGROUP") {
+				slog.Warn("redis stream or consumer group missing, attempting to recreate", "stream", completionStreamName, "group", completionGroupName, "error", err)
+				if recreateErr := ensureCompletionGroup(ctx, rdb); recreateErr == nil {
+					continue
+				} else {
+					slog.Error("failed to recreate redis stream or consumer group", "stream", completionStreamName, "group", completionGroupName, "error", recreateErr)
+				}
+			} else {
+				slog.Error("failed to read redis stream", "stream", completionStreamName, "group", completionGroupName, "consumer", consumerName, "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(retryInterval):
+			}
+			continue
+		}
+
+		if start != ">" && (len(streams) == 0 || len(streams[0].Messages) == 0) {
+			start = ">"
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, message := range stream.Messages {
+				// Messages left pending are retried once claimed, so
+				// they are not read again right away.
+				if !processCompletion(ctx, rdb, message, handle) {
+					start = ">"
+				}
+			}
+		}
+	}
+}
+
+// claimIdleCompletions takes over and handles the completions left pending
+// for completionClaimIdle. It stops at the first one to fail transiently,
+// leaving the rest for the next claim.
+func claimIdleCompletions(ctx context.Context, rdb *redis.Client, consumerName string, handle CompletionHandler) {
+	start := "0-0"
+	for {
+		messages, next, err := rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   completionStreamName,
+			Group:    completionGroupName,
+			Consumer: consumerName,
+			MinIdle:  completionClaimIdle,
+			Start:    start,
+			Count:    pendingPageSize,
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("failed to claim idle completions", "stream", completionStreamName, "group", completionGroupName, "error", err)
+			}
+			return
+		}
+
+		for _, message := range messages {
+			if !processCompletion(ctx, rdb, message, handle) {
+				return
+			}
+		}
+		if next == "0-0" {
+			return
+		}
+		start = next
+	}
+}
+
+// processCompletion handles a completion and acknowledges it unless it is
+// to be retried, reporting whether it was acknowledged.
+func processCompletion(ctx context.Context, rdb *redis.Client, message redis.XMessage, handle CompletionHandler) bool {
+	if !handleCompletion(ctx, rdb, message, handle) {
+		return false
+	}
+	if err := rdb.XAck(ctx, completionStreamName, completionGroupName, message.ID).Err(); err != nil {
+		slog.Error("failed to acknowledge redis message", "stream", completionStreamName, "message_id", message.ID, "error", err)
+	}
+	return true
+}
+
+// handleCompletion records a completion, reporting false when it failed
+// transiently and should be retried.
+func handleCompletion(ctx context.Context, rdb *redis.Client, message redis.XMessage, handle CompletionHandler) bool {
+	payload, ok := message.Values["payload"].(string)
+	if !ok {
+		slog.Warn("redis message missing valid payload", "stream", completionStreamName, "message_id", message.ID)
+		return true
+	}
+	var msg CompletionMessage
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		slog.Warn("failed to unmarshal completion message", "message_id", message.ID, "error", err)
+		return true
+	}
+
+	if err := handle(ctx, msg); err != nil {
+		var retryable *RetryableError
+		if errors.As(err, &retryable) {
+			slog.Warn("failed to record completed archive, will retry", "job_id", msg.JobID, "archive_id", msg.Archive.ID, "retry_after", completionClaimIdle, "error", err)
+			return false
+		}
+		slog.Error("failed to record completed archive", "job_id", msg.JobID, "archive_id", msg.Archive.ID, "error", err)
+		if statusErr := finishJob(ctx, rdb, msg.JobID, "failed", "error", err.Error()); statusErr != nil {
+			slog.Warn("failed to update job status", "job_id", msg.JobID, "status", "failed", "error", statusErr)
+		}
+		return true
+	}
+
+	slog.Info("completed archive recorded", "job_id", msg.JobID, "archive_id", msg.Archive.ID, "filename", msg.Archive.Filename)
+	return true
+}
@@ -0,0 +1,166 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompletionConsumerRecordsPublishedArchives(t *testing.T) {
+	_, rdb, ctx := newTestRedis(t)
+
+	jobID := uuid.New()
+	published := CompletionMessage{
+		JobID:                jobID.String(),
+		Archive:              models.Archive{ID: jobID, Name: "Weekly", Filename: "Weekly.wacz"},
+		Payloads:             []CompletedPayload{{Digest: "sha256:home", URL: "https://example.com/", CapturedAt: "20260401000000"}},
+		ReferencedArchiveIDs: []uuid.UUID{uuid.New()},
+	}
+	// Published before the API has ever started: the group must still see it.
+	require.NoError(t, NewCompletionPublisher(rdb).Record(ctx, published))
+
+	received := make(chan CompletionMessage, 1)
+	consumerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go StartCompletionConsumer(consumerCtx, rdb, testConsumerName, func(_ context.Context, msg CompletionMessage) error {
+		received <- msg
+		return nil
+	})
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, published.JobID, msg.JobID)
+		assert.Equal(t, published.Archive.Filename, msg.Archive.Filename)
+		assert.Equal(t, published.Payloads, msg.Payloads)
+		assert.Equal(t, published.ReferencedArchiveIDs, msg.ReferencedArchiveIDs)
+	case <-time.After(2 * time.Second):
+		t.Fatal("completion was not handled")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		pending, err := rdb.XPending(ctx, completionStreamName, completionGroupName).Result()
+		if err == nil && pending.Count == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("completion was not acknowledged")
+}
+
+func TestCompletionFailureIsNotOverwrittenByWorker(t *testing.T) {
+	_, rdb, ctx := newTestRedis(t)
+	createGroup(t, ctx, rdb)
+
+	jobID := uuid.New().String()
+	require.NoError(t, rdb.HSet(ctx, "job:"+jobID, "status", "pending").Err())
+	enqueueValidMessage(t, ctx, rdb, jobID, makeTestCrawlMessage(jobID))
+
+	consumerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go StartCompletionConsumer(consumerCtx, rdb, testConsumerName, func(context.Context, CompletionMessage) error {
+		return errors.New("disk I/O error")
+	})
+
+	publisher := NewCompletionPublisher(rdb)
+	processed := make(chan struct{})
+	process := func(ctx context.Context, jobID string, archive models.Archive, _ models.CrawlOptions) error {
+		if err := publisher.Record(ctx, CompletionMessage{JobID: jobID, Archive: archive}); err != nil {
+			return err
+		}
+		// Let the API reject the completion before the worker finishes.
+		waitForJobStatus(t, ctx, rdb, jobID, "failed", 2*time.Second)
+		close(processed)
+		return nil
+	}
+	_ = startWorker(t, consumerCtx, rdb, process)
+
+	if !waitForProcessorCall(processed, 3*time.Second) {
+		t.Fatal("processor did not finish")
+	}
+	waitForNoPending(t, ctx, rdb, 2*time.Second)
+	assert.Equal(t, "failed", rdb.HGet(ctx, "job:"+jobID, "status").Val())
+	assert.Equal(t, "disk I/O error", rdb.HGet(ctx, "job:"+jobID, "error").Val())
+}
+
+func TestCompletionConsumerRetriesTransientFailures(t *testing.T) {
+	mr, rdb, ctx := newTestRedis(t)
+
+	jobID := uuid.New()
+	require.NoError(t, rdb.HSet(ctx, "job:"+jobID.String(), "status", "running").Err())
+	require.NoError(t, NewCompletionPublisher(rdb).Record(ctx, CompletionMessage{JobID: jobID.String(), Archive: models.Archive{ID: jobID, Filename: "Weekly.wacz"}}))
+
+	attempted := make(chan struct{}, 1)
+	firstCtx, stopFirst := context.WithCancel(ctx)
+	go StartCompletionConsumer(firstCtx, rdb, "api-old", func(context.Context, CompletionMessage) error {
+		attempted <- struct{}{}
+		return Retryable(errors.New("database is locked"))
+	})
+	if !waitForProcessorCall(attempted, 2*time.Second) {
+		t.Fatal("completion was not handled")
+	}
+	stopFirst()
+
+	pending, err := rdb.XPending(ctx, completionStreamName, completionGroupName).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), pending.Count, "a transient failure leaves the completion pending")
+	assert.Equal(t, "running", rdb.HGet(ctx, "job:"+jobID.String(), "status").Val())
+
+	// An API started under another consumer name claims it once idle.
+	mr.SetTime(time.Now().Add(2 * completionClaimIdle))
+	recorded := make(chan CompletionMessage, 1)
+	secondCtx, stopSecond := context.WithCancel(ctx)
+	defer stopSecond()
+	go StartCompletionConsumer(secondCtx, rdb, "api-new", func(_ context.Context, msg CompletionMessage) error {
+		recorded <- msg
+		return nil
+	})
+
+	select {
+	case msg := <-recorded:
+		assert.Equal(t, jobID.String(), msg.JobID)
+	case <-time.After(2 * time.Second):
+		t.Fatal("pending completion was not claimed")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		pending, err := rdb.XPending(ctx, completionStreamName, completionGroupName).Result()
+		if err == nil && pending.Count == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("claimed completion was not acknowledged")
+}
+
+func TestPendingCompletionFiles(t *testing.T) {
+	_, rdb, ctx := newTestRedis(t)
+
+	files, err := PendingCompletionFiles(ctx, rdb)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	publisher := NewCompletionPublisher(rdb)
+	for _, filename := range []string{"recorded.wacz", "recording.wacz", "queued.wacz"} {
+		require.NoError(t, publisher.Record(ctx, CompletionMessage{JobID: uuid.NewString(), Archive: models.Archive{Filename: filename}}))
+	}
+	files, err = PendingCompletionFiles(ctx, rdb)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"recorded.wacz": true, "recording.wacz": true, "queued.wacz": true}, files)
+
+	require.NoError(t, ensureCompletionGroup(ctx, rdb))
+	streams, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{Group: completionGroupName, Consumer: testConsumerName, Streams: []string{completionStreamName, ">"}, Count: 2}).Result()
+	require.NoError(t, err)
+	require.NoError(t, rdb.XAck(ctx, completionStreamName, completionGroupName, streams[0].Messages[0].ID).Err())
+
+	files, err = PendingCompletionFiles(ctx, rdb)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"recording.wacz": true, "queued.wacz": true}, files)
+}
@@ -3,8 +3,13 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/JuanSaenz04/archiver/internal/models"
@@ -12,49 +17,203 @@ import (
 )
 
 const (
+	// streamName is the stream of normal priority jobs. Other priorities
+	// use it as a prefix.
 	streamName    = "crawl_stream"
 	groupName     = "worker_group"
 	retryInterval = 5 * time.Second
+	// idleInterval is how long a worker waits for new jobs once every
+	// crawl stream is empty.
+	idleInterval = time.Second
 )
 
+// completeJobScript marks a running job as completed. A job recorded through
+// the completion stream may already have been marked as failed by the API,
+// which must not be overwritten.
+var completeJobScript = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "status") == "running" then
+	return redis.call("HSET", KEYS[1], "status", "completed")
+end
+return 0
+`)
+
 // Processor is a function that processes a job.
 type Processor func(ctx context.Context, jobID string, archive models.Archive, options models.CrawlOptions) error
 
+// WorkerOptions tune how StartWorker runs jobs. The zero value runs one
+// job at a time, with no limit per host, and interrupts it on shutdown.
+type WorkerOptions struct {
+	// Concurrency is the number of jobs run at once.
+	Concurrency int
+	// MaxPerHost caps the crawls of one registrable domain running at once
+	// across all workers. Jobs for busy domains are set aside and queued
+	// again a few seconds later.
+	MaxPerHost int
+	// ShutdownTimeout is how long running jobs may finish once the worker
+	// is stopped. Jobs still running then are interrupted and queued again.
+	ShutdownTimeout time.Duration
+}
+
+// WorkerOptionsFromEnv reads WORKER_CONCURRENCY, CRAWL_MAX_PER_HOST and
+// WORKER_SHUTDOWN_TIMEOUT (in seconds).
+func WorkerOptionsFromEnv() (WorkerOptions, error) {
+	concurrency, err := nonNegativeEnv("WORKER_CONCURRENCY")
+	if err != nil {
+		return WorkerOptions{}, err
+	}
+	maxPerHost, err := nonNegativeEnv("CRAWL_MAX_PER_HOST")
+	if err != nil {
+		return WorkerOptions{}, err
+	}
+	shutdownSeconds, err := nonNegativeEnv("WORKER_SHUTDOWN_TIMEOUT")
+	if err != nil {
+		return WorkerOptions{}, err
+	}
+	return WorkerOptions{
+		Concurrency:     concurrency,
+		MaxPerHost:      maxPerHost,
+		ShutdownTimeout: time.Duration(shutdownSeconds) * time.Second,
+	}, nil
+}
+
+// StreamName returns the stream crawl jobs of priority are queued on.
+func StreamName(priority models.Priority) string {
+	switch priority {
+	case models.PriorityHigh, models.PriorityLow:
+		return streamName + ":" + string(priority)
+	}
+	return streamName
+}
+
+// crawlStreams returns the crawl streams from the highest priority.
+func crawlStreams() []string {
+	streams := make([]string, 0, len(models.Priorities))
+	for _, priority := range models.Priorities {
+		streams = append(streams, StreamName(priority))
+	}
+	return streams
+}
+
 func ensureStreamAndGroup(ctx context.Context, rdb *redis.Client) error {
-	err := rdb.XGroupCreateMkStream(ctx, streamName, groupName, "0").Err()
-	if err != nil && !redis.HasErrorPrefix(err, "BUSYGROUP") {
-		return err
+	for _, stream := range crawlStreams() {
+		err := rdb.XGroupCreateMkStream(ctx, stream, groupName, "0").Err()
+		if err != nil && !redis.HasErrorPrefix(err, "BUSYGROUP") {
+			return err
+		}
 	}
 	return nil
 }
 
-// StartWorker starts the worker loop to consume jobs from Redis.
-// On any error it retries after retryInterval indefinitely.
-func StartWorker(ctx context.Context, rdb *redis.Client, consumerName string, process Processor) error {
+// readNext reads one job from the first of streams holding one, without
+// waiting. It returns redis.Nil when all are empty.
+func readNext(ctx context.Context, rdb *redis.Client, consumerName string, streams []string) (string, redis.XMessage, error) {
+	for _, stream := range streams {
+		result, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    groupName,
+			Consumer: consumerName,
+			Streams:  []string{stream, ">"},
+			Count:    1,
+			Block:    -1,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return "", redis.XMessage{}, err
+		}
+		for _, read := range result {
+			if len(read.Messages) > 0 {
+				return read.Stream, read.Messages[0], nil
+			}
+		}
+	}
+	return "", redis.XMessage{}, redis.Nil
+}
+
+// StartWorker starts options.Concurrency loops consuming jobs from Redis,
+// each reading and acknowledging its own jobs. On any error they retry
+// after retryInterval indefinitely. Once ctx is done, StartWorker returns
+// when running jobs have finished or were queued again.
+func StartWorker(ctx context.Context, rdb *redis.Client, consumerName string, options WorkerOptions, process Processor) error {
+	slots := hostSlots{rdb: rdb, max: options.MaxPerHost}
+
 	if err := ensureStreamAndGroup(ctx, rdb); err != nil {
 		return fmt.Errorf("create consumer group on startup: %w", err)
 	}
+	for _, stream := range crawlStreams() {
+		if err := trimAcknowledged(ctx, rdb, stream); err != nil {
+			slog.Warn("failed to trim acknowledged crawl jobs", "stream", stream, "error", err)
+		}
+	}
+
+	// Jobs outlive ctx so that they can finish during shutdown.
+	jobCtx, cancelJobs := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelJobs()
+
+	var wg sync.WaitGroup
+	for range max(options.Concurrency, 1) {
+		wg.Go(func() {
+			consume(ctx, jobCtx, rdb, consumerName, slots, process)
+		})
+	}
 
+	<-ctx.Done()
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	if options.ShutdownTimeout > 0 {
+		slog.Info("waiting for running crawl jobs", "timeout", options.ShutdownTimeout)
+		select {
+		case <-finished:
+			return nil
+		case <-time.After(options.ShutdownTimeout):
+		}
+	}
+	cancelJobs()
+	<-finished
+	return nil
+}
+
+// consume reads and runs jobs until ctx is done, from the highest priority
+// stream holding one. Jobs run on jobCtx. After deferring a job it reads
+// from the following streams first, so that jobs for busy hosts do not hold
+// back lower priorities.
+func consume(ctx, jobCtx context.Context, rdb *redis.Client, consumerName string, slots hostSlots, process Processor) {
+	streams := crawlStreams()
+	from := 0
 	for {
 		select {
 		case <-ctx.Done():
-			return nil
+			return
 		default:
 		}
 
-		streams, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
-			Group:    groupName,
-			Consumer: consumerName,
-			Streams:  []string{streamName, ">"},
-			Count:    1,
-			Block:    1 * time.Second,
-		}).Result()
+		if err := requeueDueJobs(ctx, rdb); err != nil && ctx.Err() == nil {
+			slog.Warn("failed to queue deferred crawl jobs again", "error", err)
+		}
+
+		stream, message, err := readNext(ctx, rdb, consumerName, streams[from:])
 
 		if err != nil {
-			if err == context.Canceled {
-				return nil
+			if ctx.Err() != nil {
+				return
 			}
 			if err == redis.Nil {
+				// Wait for new jobs, or for busy hosts when the higher
+				// priorities only held jobs for them.
+				wait := idleInterval
+				if from > 0 {
+					wait = deferInterval
+				}
+				from = 0
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(wait):
+				}
 				continue
 			}
 
@@ -73,63 +232,202 @@ func StartWorker(ctx context.Context, rdb *redis.Client, consumerName string, pr
 
 			select {
 			case <-ctx.Done():
-				return nil
+				return
 			case <-time.After(retryInterval):
 			}
 			continue
 		}
 
-		for _, stream := range streams {
-			for _, message := range stream.Messages {
-				jobID, ok := message.Values["job_id"].(string)
-				if !ok {
-					slog.Warn("redis message missing valid job_id", "message_id", message.ID)
-					if err := rdb.XAck(ctx, streamName, groupName, message.ID).Err(); err != nil {
-						slog.Error("failed to acknowledge malformed redis message", "message_id", message.ID, "error", err)
-					}
-					continue
-				}
-				payloadMsg, ok := message.Values["payload"].(string)
-				if !ok {
-					slog.Warn("redis message missing valid payload", "job_id", jobID, "message_id", message.ID)
-					if err := rdb.XAck(ctx, streamName, groupName, message.ID).Err(); err != nil {
-						slog.Error("failed to acknowledge malformed redis message", "job_id", jobID, "message_id", message.ID, "error", err)
-					}
-					continue
-				}
-				var msg CrawlMessage
-				if err := json.Unmarshal([]byte(payloadMsg), &msg); err != nil {
-					slog.Warn("failed to unmarshal crawl message", "job_id", jobID, "message_id", message.ID, "error", err)
-					if err := rdb.XAck(ctx, streamName, groupName, message.ID).Err(); err != nil {
-						slog.Error("failed to acknowledge malformed redis message", "job_id", jobID, "message_id", message.ID, "error", err)
-					}
-					continue
-				}
+		// Leave jobs read during shutdown to other workers.
+		if ctx.Err() != nil {
+			requeueJob(jobCtx, rdb, stream, message)
+			return
+		}
+		if deferred := handleMessage(jobCtx, rdb, slots, stream, message, process); !deferred {
+			from = 0
+			continue
+		}
+		from = slices.Index(streams, stream) + 1
+		if from < len(streams) {
+			continue
+		}
+		from = 0
+		select {
+		case <-ctx.Done():
+		case <-time.After(deferInterval):
+		}
+	}
+}
 
-				slog.Info("processing crawl job", "job_id", jobID, "url", msg.Archive.SourceURL)
+// handleMessage runs the job of message, read from stream, and records its
+// outcome. It reports whether the job was deferred instead.
+func handleMessage(ctx context.Context, rdb *redis.Client, slots hostSlots, stream string, message redis.XMessage, process Processor) (deferred bool) {
+	jobID, ok := message.Values["job_id"].(string)
+	if !ok {
+		slog.Warn("redis message missing valid job_id", "message_id", message.ID)
+		if err := ackJob(ctx, rdb, stream, message.ID); err != nil {
+			slog.Error("failed to acknowledge malformed redis message", "message_id", message.ID, "error", err)
+		}
+		return false
+	}
+	payloadMsg, ok := message.Values["payload"].(string)
+	if !ok {
+		slog.Warn("redis message missing valid payload", "job_id", jobID, "message_id", message.ID)
+		if err := ackJob(ctx, rdb, stream, message.ID); err != nil {
+			slog.Error("failed to acknowledge malformed redis message", "job_id", jobID, "message_id", message.ID, "error", err)
+		}
+		return false
+	}
+	var msg CrawlMessage
+	if err := json.Unmarshal([]byte(payloadMsg), &msg); err != nil {
+		slog.Warn("failed to unmarshal crawl message", "job_id", jobID, "message_id", message.ID, "error", err)
+		if err := ackJob(ctx, rdb, stream, message.ID); err != nil {
+			slog.Error("failed to acknowledge malformed redis message", "job_id", jobID, "message_id", message.ID, "error", err)
+		}
+		return false
+	}
 
-				if err := rdb.HSet(ctx, "job:"+jobID, "status", "running").Err(); err != nil {
-					slog.Warn("failed to update job status", "job_id", jobID, "status", "running", "error", err)
-				}
+	domain := RegistrableDomain(msg.Archive.SourceURL)
+	release := func() {}
+	if slots.max > 0 && domain != "" {
+		held, ok, err := slots.acquire(ctx, domain, jobID)
+		if err != nil {
+			slog.Warn("failed to acquire host slot, crawling anyway", "job_id", jobID, "domain", domain, "error", err)
+		} else if !ok {
+			deferJob(ctx, rdb, stream, message)
+			slog.Debug("crawl job deferred, host busy", "job_id", jobID, "domain", domain, "retry_after", deferDelay)
+			return true
+		} else {
+			release = held
+		}
+	}
 
-				err := process(ctx, jobID, msg.Archive, msg.Options)
+	slog.Info("processing crawl job", "job_id", jobID, "url", msg.Archive.SourceURL, "stream", stream)
 
-				if err != nil {
-					slog.Error("crawl job failed", "job_id", jobID, "url", msg.Archive.SourceURL, "error", err)
-					if statusErr := rdb.HSet(ctx, "job:"+jobID, "status", "failed", "error", err.Error()).Err(); statusErr != nil {
-						slog.Warn("failed to update job status", "job_id", jobID, "status", "failed", "error", statusErr)
-					}
-				} else {
-					slog.Info("crawl job completed", "job_id", jobID, "url", msg.Archive.SourceURL)
-					if statusErr := rdb.HSet(ctx, "job:"+jobID, "status", "completed").Err(); statusErr != nil {
-						slog.Warn("failed to update job status", "job_id", jobID, "status", "completed", "error", statusErr)
-					}
-				}
+	if err := rdb.HSet(ctx, "job:"+jobID, "status", "running").Err(); err != nil {
+		slog.Warn("failed to update job status", "job_id", jobID, "status", "running", "error", err)
+	}
 
-				if err := rdb.XAck(ctx, streamName, groupName, message.ID).Err(); err != nil {
-					slog.Error("failed to acknowledge redis message", "job_id", jobID, "message_id", message.ID, "error", err)
-				}
+	err := process(ctx, jobID, msg.Archive, msg.Options)
+
+	// The outcome is recorded even when the shutdown timeout cancels ctx
+	// right after the job returned, or the job would stay pending forever.
+	recordCtx := context.WithoutCancel(ctx)
+	if err != nil && ctx.Err() != nil {
+		slog.Info("crawl job interrupted by shutdown, queueing it again", "job_id", jobID, "url", msg.Archive.SourceURL)
+		release()
+		requeueJob(recordCtx, rdb, stream, message)
+		return false
+	}
+
+	if errors.Is(err, models.ErrUnchanged) {
+		slog.Info("crawl job unchanged", "job_id", jobID, "url", msg.Archive.SourceURL, "detail", err.Error())
+		if statusErr := finishJob(recordCtx, rdb, jobID, "unchanged"); statusErr != nil {
+			slog.Warn("failed to update job status", "job_id", jobID, "status", "unchanged", "error", statusErr)
+		}
+	} else if err != nil {
+		slog.Error("crawl job failed", "job_id", jobID, "url", msg.Archive.SourceURL, "error", err)
+		if statusErr := finishJob(recordCtx, rdb, jobID, "failed", "error", err.Error()); statusErr != nil {
+			slog.Warn("failed to update job status", "job_id", jobID, "status", "failed", "error", statusErr)
+		}
+	} else {
+		slog.Info("crawl job completed", "job_id", jobID, "url", msg.Archive.SourceURL)
+		if statusErr := finishJob(recordCtx, rdb, jobID, "completed"); statusErr != nil {
+			slog.Warn("failed to update job status", "job_id", jobID, "status", "completed", "error", statusErr)
+		}
+	}
+	release()
+
+	if err := ackJob(recordCtx, rdb, stream, message.ID); err != nil {
+		slog.Error("failed to acknowledge redis message", "job_id", jobID, "message_id", message.ID, "error", err)
+	}
+	return false
+}
+
+// requeueJob moves a job it cannot run now to the back of its stream,
+// marking it pending again.
+func requeueJob(ctx context.Context, rdb *redis.Client, stream string, message redis.XMessage) {
+	jobID, _ := message.Values["job_id"].(string)
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{Stream: stream, Values: message.Values})
+		pipe.XAck(ctx, stream, groupName, message.ID)
+		pipe.XDel(ctx, stream, message.ID)
+		if jobID != "" {
+			pipe.HSet(ctx, "job:"+jobID, "status", "pending")
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("failed to queue crawl job again", "job_id", jobID, "message_id", message.ID, "error", err)
+	}
+}
+
+// finishJob records the final status of a job, along with fields such as
+// its error, and removes it from the unfinished jobs of its owner.
+func finishJob(ctx context.Context, rdb *redis.Client, jobID, status string, fields ...any) error {
+	owner, err := rdb.HGet(ctx, "job:"+jobID, "owner").Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if status == "completed" {
+			completeJobScript.Eval(ctx, pipe, []string{"job:" + jobID})
+		} else {
+			pipe.HSet(ctx, "job:"+jobID, append([]any{"status", status}, fields...)...)
+		}
+		if owner != "" {
+			pipe.SRem(ctx, unfinishedJobsKey(owner), jobID)
+		}
+		return nil
+	})
+	return err
+}
+
+// ackJob acknowledges a job of stream and deletes it, so that the crawl
+// streams only hold unfinished jobs.
+func ackJob(ctx context.Context, rdb *redis.Client, stream, messageID string) error {
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAck(ctx, stream, groupName, messageID)
+		pipe.XDel(ctx, stream, messageID)
+		return nil
+	})
+	return err
+}
+
+// trimAcknowledged deletes the entries of stream that were acknowledged
+// without being deleted, as they were before QueueLength relied on it:
+// those delivered to the group and older than any still pending.
+func trimAcknowledged(ctx context.Context, rdb *redis.Client, stream string) error {
+	groups, err := rdb.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if group.Name != groupName || group.LastDeliveredID == "0-0" {
+			continue
+		}
+		minID, err := nextStreamID(group.LastDeliveredID)
+		if err != nil {
+			return err
+		}
+		if group.Pending > 0 {
+			pending, err := rdb.XPending(ctx, stream, groupName).Result()
+			if err != nil {
+				return err
 			}
+			minID = pending.Lower
 		}
+		return rdb.XTrimMinID(ctx, stream, minID).Err()
+	}
+	return nil
+}
+
+// nextStreamID returns the smallest stream entry ID greater than id.
+func nextStreamID(id string) (string, error) {
+	ms, seq, ok := strings.Cut(id, "-")
+	sequence, err := strconv.ParseUint(seq, 10, 64)
+	if !ok || err != nil {
+		return "", fmt.Errorf("invalid stream ID %q", id)
 	}
+	return ms + "-" + strconv.FormatUint(sequence+1, 10), nil
 }
@@ -4,6 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,6 +13,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const testConsumerName = "test-consumer-1"
@@ -19,7 +22,7 @@ func startWorker(t *testing.T, ctx context.Context, rdb *redis.Client, process P
 	t.Helper()
 	done := make(chan error, 1)
 	go func() {
-		done <- StartWorker(ctx, rdb, testConsumerName, process)
+		done <- StartWorker(ctx, rdb, testConsumerName, WorkerOptions{}, process)
 	}()
 	return done
 }
@@ -210,6 +213,29 @@ func TestStartWorker_MarksJobFailedAndStoresError(t *testing.T) {
 	waitForNoPending(t, ctx, rdb, 2*time.Second)
 }
 
+func TestStartWorker_MarksUnchangedJobs(t *testing.T) {
+	_, rdb, ctx := newTestRedis(t)
+	createGroup(t, ctx, rdb)
+
+	jobID := uuid.New().String()
+	msg := makeTestCrawlMessage(jobID)
+
+	process := func(_ context.Context, _ string, _ models.Archive, _ models.CrawlOptions) error {
+		return fmt.Errorf("%w: matches archive %s", models.ErrUnchanged, uuid.NewString())
+	}
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	_ = startWorker(t, workerCtx, rdb, process)
+
+	enqueueValidMessage(t, ctx, rdb, jobID, msg)
+
+	waitForJobStatus(t, ctx, rdb, jobID, "unchanged", 2*time.Second)
+	assert.Empty(t, rdb.HGet(ctx, "job:"+jobID, "error").Val())
+
+	waitForNoPending(t, ctx, rdb, 2*time.Second)
+}
+
 // Note: "non-string" field cases are not included because Redis stores all stream
 // values as strings, so go-redis always returns string types from XReadGroup.
 // The .(string) type assertions in consumer.go will always succeed with real Redis data.
@@ -306,3 +332,222 @@ func TestStartWorker_StopsWhenContextIsCanceled(t *testing.T) {
 		t.Fatal("worker did not stop after context cancellation")
 	}
 }
+
+func TestStartWorker_RunsHigherPriorityJobsFirst(t *testing.T) {
+	_, rdb, ctx := newTestRedis(t)
+
+	var order []models.Priority
+	for _, priority := range []models.Priority{models.PriorityLow, models.PriorityNormal, models.PriorityHigh, models.PriorityNormal} {
+		_, err := EnqueueCrawl(ctx, rdb, models.CrawlRequest{URL: "https://example.com/" + string(priority), Priority: priority})
+		if err != nil {
+			t.Fatalf("EnqueueCrawl: %v", err)
+		}
+	}
+
+	done := make(chan struct{})
+	process := func(_ context.Context, _ string, archive models.Archive, _ models.CrawlOptions) error {
+		order = append(order, models.Priority(strings.TrimPrefix(archive.SourceURL, "https://example.com/")))
+		if len(order) == 4 {
+			close(done)
+		}
+		return nil
+	}
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	_ = startWorker(t, workerCtx, rdb, process)
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timed out, ran %v", order)
+	}
+	assert.Equal(t, []models.Priority{models.PriorityHigh, models.PriorityNormal, models.PriorityNormal, models.PriorityLow}, order)
+}
+
+func TestStartWorker_RunsJobsConcurrently(t *testing.T) {
+	_, rdb, ctx := newTestRedis(t)
+
+	for range 3 {
+		jobID := uuid.New().String()
+		enqueueValidMessage(t, ctx, rdb, jobID, makeTestCrawlMessage(jobID))
+	}
+
+	started := make(chan struct{}, 3)
+	proceed := make(chan struct{})
+	process := func(_ context.Context, _ string, _ models.Archive, _ models.CrawlOptions) error {
+		started <- struct{}{}
+		<-proceed
+		return nil
+	}
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		_ = StartWorker(workerCtx, rdb, testConsumerName, WorkerOptions{Concurrency: 3}, process)
+	}()
+
+	for i := range 3 {
+		if !waitForProcessorCall(started, 2*time.Second) {
+			t.Fatalf("only %d of 3 jobs started at once", i)
+		}
+	}
+	close(proceed)
+	waitForNoPending(t, ctx, rdb, 2*time.Second)
+}
+
+func TestStartWorker_WaitsForRunningJobsOnShutdown(t *testing.T) {
+	_, rdb, ctx := newTestRedis(t)
+
+	jobID := uuid.New().String()
+	enqueueValidMessage(t, ctx, rdb, jobID, makeTestCrawlMessage(jobID))
+
+	started := make(chan struct{}, 1)
+	process := func(jobCtx context.Context, _ string, _ models.Archive, _ models.CrawlOptions) error {
+		started <- struct{}{}
+		select {
+		case <-jobCtx.Done():
+			return jobCtx.Err()
+		case <-time.After(300 * time.Millisecond):
+			return nil
+		}
+	}
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- StartWorker(workerCtx, rdb, testConsumerName, WorkerOptions{ShutdownTimeout: 5 * time.Second}, process)
+	}()
+
+	if !waitForProcessorCall(started, 2*time.Second) {
+		t.Fatal("processor was not called")
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("worker did not stop after its job finished")
+	}
+	assert.Equal(t, "completed", rdb.HGet(ctx, "job:"+jobID, "status").Val())
+	waitForNoPending(t, ctx, rdb, time.Second)
+}
+
+func TestStartWorker_RequeuesInterruptedJobsOnShutdown(t *testing.T) {
+	_, rdb, ctx := newTestRedis(t)
+
+	jobID := uuid.New().String()
+	enqueueValidMessage(t, ctx, rdb, jobID, makeTestCrawlMessage(jobID))
+
+	started := make(chan struct{}, 1)
+	process := func(jobCtx context.Context, _ string, _ models.Archive, _ models.CrawlOptions) error {
+		started <- struct{}{}
+		<-jobCtx.Done()
+		return jobCtx.Err()
+	}
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- StartWorker(workerCtx, rdb, testConsumerName, WorkerOptions{ShutdownTimeout: 100 * time.Millisecond}, process)
+	}()
+
+	if !waitForProcessorCall(started, 2*time.Second) {
+		t.Fatal("processor was not called")
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("worker did not stop after interrupting its job")
+	}
+
+	assert.Equal(t, "pending", rdb.HGet(ctx, "job:"+jobID, "status").Val())
+	waitForNoPending(t, ctx, rdb, time.Second)
+	entries, err := rdb.XRange(ctx, streamName, "-", "+").Result()
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1, "the interrupted entry is replaced by its copy") {
+		assert.Equal(t, jobID, entries[0].Values["job_id"], "interrupted job should be queued again")
+	}
+}
+
+func TestStartWorker_RecordsJobsFinishingAtShutdownTimeout(t *testing.T) {
+	_, rdb, ctx := newTestRedis(t)
+
+	jobID := uuid.New().String()
+	enqueueValidMessage(t, ctx, rdb, jobID, makeTestCrawlMessage(jobID))
+
+	started := make(chan struct{}, 1)
+	process := func(jobCtx context.Context, _ string, _ models.Archive, _ models.CrawlOptions) error {
+		started <- struct{}{}
+		// The crawl finishes just as the shutdown timeout cancels it.
+		<-jobCtx.Done()
+		return nil
+	}
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- StartWorker(workerCtx, rdb, testConsumerName, WorkerOptions{ShutdownTimeout: 100 * time.Millisecond}, process)
+	}()
+
+	if !waitForProcessorCall(started, 2*time.Second) {
+		t.Fatal("processor was not called")
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("worker did not stop after its shutdown timeout")
+	}
+
+	assert.Equal(t, "completed", rdb.HGet(ctx, "job:"+jobID, "status").Val())
+	waitForNoPending(t, ctx, rdb, time.Second)
+	entries, err := rdb.XLen(ctx, streamName).Result()
+	assert.NoError(t, err)
+	assert.Zero(t, entries, "the finished job should be removed from the stream")
+}
+
+func TestWorkerOptionsFromEnv(t *testing.T) {
+	t.Setenv("WORKER_CONCURRENCY", "4")
+	t.Setenv("CRAWL_MAX_PER_HOST", "2")
+	t.Setenv("WORKER_SHUTDOWN_TIMEOUT", "30")
+
+	options, err := WorkerOptionsFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, WorkerOptions{Concurrency: 4, MaxPerHost: 2, ShutdownTimeout: 30 * time.Second}, options)
+
+	t.Setenv("WORKER_CONCURRENCY", "many")
+	_, err = WorkerOptionsFromEnv()
+	assert.Error(t, err)
+}
+
+func TestTrimAcknowledged(t *testing.T) {
+	_, rdb, ctx := newTestRedis(t)
+	createGroup(t, ctx, rdb)
+
+	// Jobs acknowledged by an older worker were left in the stream.
+	for range 3 {
+		jobID := uuid.New().String()
+		enqueueValidMessage(t, ctx, rdb, jobID, makeTestCrawlMessage(jobID))
+	}
+	streams, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{Group: groupName, Consumer: "worker", Streams: []string{streamName, ">"}, Count: 2}).Result()
+	require.NoError(t, err)
+	require.NoError(t, rdb.XAck(ctx, streamName, groupName, streams[0].Messages[0].ID).Err())
+
+	require.NoError(t, trimAcknowledged(ctx, rdb, streamName))
+	entries, err := rdb.XRange(ctx, streamName, "-", "+").Result()
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "only the acknowledged entry is trimmed")
+
+	require.NoError(t, rdb.XAck(ctx, streamName, groupName, streams[0].Messages[1].ID).Err())
+	require.NoError(t, trimAcknowledged(ctx, rdb, streamName))
+	length, err := QueueLength(ctx, rdb)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), length)
+}
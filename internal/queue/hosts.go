@@ -0,0 +1,178 @@
+package queue
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	// hostLease is how long a host slot outlives a worker that stopped
+	// renewing it, for example because it crashed mid-crawl.
+	hostLease = time.Minute
+	// deferInterval is how long a worker waits after deferring a job for
+	// a busy host, so a queue of such jobs is not cycled in a busy loop.
+	deferInterval = time.Second
+	// deferDelay is how long a job for a busy host is kept out of the
+	// queue before it is tried again.
+	deferDelay = 5 * time.Second
+
+	// deferredJobsKey holds the jobs put aside for busy hosts as
+	// "<stream>|<job_id>", scored by the Unix milliseconds they are queued
+	// again at. Their payloads are kept in deferredPayloadsKey.
+	deferredJobsKey     = "crawl_deferred"
+	deferredPayloadsKey = "crawl_deferred:payloads"
+)
+
+// acquireHostScript takes one of ARGV[1] slots of the host set KEYS[1] for
+// job ARGV[2] until ARGV[4], after dropping slots that expired before
+// ARGV[3]. Slots are scored by their expiry in Unix milliseconds.
+var acquireHostScript = redis.NewScript(`
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", ARGV[3])
+if redis.call("ZSCORE", KEYS[1], ARGV[2]) or redis.call("ZCARD", KEYS[1]) < tonumber(ARGV[1]) then
+	redis.call("ZADD", KEYS[1], ARGV[4], ARGV[2])
+	redis.call("PEXPIRE", KEYS[1], ARGV[5])
+	return 1
+end
+return 0
+`)
+
+// requeueDueScript moves up to ARGV[2] deferred jobs of KEYS[1] and KEYS[2]
+// due before ARGV[1] back to the end of their stream, one of KEYS[3...].
+var requeueDueScript = redis.NewScript(`
+local due = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+for _, member in ipairs(due) do
+	local separator = string.find(member, "|", 1, true)
+	local payload = redis.call("HGET", KEYS[2], member)
+	if separator and payload then
+		local stream = string.sub(member, 1, separator - 1)
+		for i = 3, #KEYS do
+			if KEYS[i] == stream then
+				redis.call("XADD", stream, "*", "job_id", string.sub(member, separator + 1), "payload", payload)
+			end
+		end
+	end
+	redis.call("ZREM", KEYS[1], member)
+	redis.call("HDEL", KEYS[2], member)
+end
+return #due
+`)
+
+// RegistrableDomain returns the domain a crawl of rawURL is throttled by:
+// the registrable domain of its host, such as "example.co.uk" for
+// "news.example.co.uk", or the host itself for IP addresses and names
+// without a public suffix.
+func RegistrableDomain(rawURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return ""
+	}
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	if host == "" || net.ParseIP(host) != nil {
+		return host
+	}
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return domain
+	}
+	return host
+}
+
+// hostSlots is a semaphore per registrable domain shared by every worker
+// through Redis.
+type hostSlots struct {
+	rdb *redis.Client
+	max int
+}
+
+func hostSlotsKey(domain string) string {
+	return "crawl_hosts:" + domain
+}
+
+// acquire takes a slot of domain for jobID. When ok, the slot is renewed
+// until release is called.
+func (s hostSlots) acquire(ctx context.Context, domain, jobID string) (release func(), ok bool, err error) {
+	if err := s.take(ctx, domain, jobID); err != nil {
+		if err == redis.Nil {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	renewCtx, stop := context.WithCancel(context.WithoutCancel(ctx))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(hostLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-renewCtx.Done():
+				return
+			case <-ticker.C:
+				err := s.take(renewCtx, domain, jobID)
+				if err == redis.Nil {
+					// The lease expired and the slot went to another job.
+					slog.Info("host slot lease lost, no longer renewing it", "domain", domain, "job_id", jobID)
+					return
+				}
+				if err != nil && err != context.Canceled {
+					slog.Warn("failed to renew host slot", "domain", domain, "job_id", jobID, "error", err)
+				}
+			}
+		}
+	}()
+
+	release = func() {
+		stop()
+		<-done
+		if err := s.rdb.ZRem(context.WithoutCancel(ctx), hostSlotsKey(domain), jobID).Err(); err != nil {
+			slog.Warn("failed to release host slot", "domain", domain, "job_id", jobID, "error", err)
+		}
+	}
+	return release, true, nil
+}
+
+// take takes or renews the slot of jobID, returning redis.Nil when all
+// slots of domain are held by other jobs.
+func (s hostSlots) take(ctx context.Context, domain, jobID string) error {
+	now := time.Now()
+	taken, err := acquireHostScript.Run(ctx, s.rdb, []string{hostSlotsKey(domain)},
+		s.max, jobID, now.UnixMilli(), now.Add(hostLease).UnixMilli(), hostLease.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if taken == 0 {
+		return redis.Nil
+	}
+	return nil
+}
+
+// deferJob puts a job of stream for a busy host aside for deferDelay,
+// removing it from the stream.
+func deferJob(ctx context.Context, rdb *redis.Client, stream string, message redis.XMessage) {
+	jobID, _ := message.Values["job_id"].(string)
+	payload, _ := message.Values["payload"].(string)
+	member := stream + "|" + jobID
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, deferredJobsKey, redis.Z{Score: float64(time.Now().Add(deferDelay).UnixMilli()), Member: member})
+		pipe.HSet(ctx, deferredPayloadsKey, member, payload)
+		pipe.XAck(ctx, stream, groupName, message.ID)
+		pipe.XDel(ctx, stream, message.ID)
+		return nil
+	})
+	if err != nil {
+		slog.Error("failed to defer crawl job", "job_id", jobID, "message_id", message.ID, "error", err)
+	}
+}
+
+// requeueDueJobs queues the deferred jobs that are due again.
+func requeueDueJobs(ctx context.Context, rdb *redis.Client) error {
+	keys := append([]string{deferredJobsKey, deferredPayloadsKey}, crawlStreams()...)
+	return requeueDueScript.Run(ctx, rdb, keys, time.Now().UnixMilli(), 100).Err()
+}
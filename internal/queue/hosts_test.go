@@ -0,0 +1,168 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistrableDomain(t *testing.T) {
+	tests := map[string]string{
+		"https://example.com/page":         "example.com",
+		"https://News.Example.co.uk/a?b=c": "example.co.uk",
+		"http://blog.example.com.:8080/":   "example.com",
+		"https://user.github.io/project":   "user.github.io",
+		"http://192.0.2.1:8080/status":     "192.0.2.1",
+		"http://[2001:db8::1]/":            "2001:db8::1",
+		"http://localhost:3000/":           "localhost",
+		"not a url":                        "",
+		"https://%zz":                      "",
+	}
+	for rawURL, want := range tests {
+		if got := RegistrableDomain(rawURL); got != want {
+			t.Fatalf("RegistrableDomain(%q) = %q, want %q", rawURL, got, want)
+		}
+	}
+}
+
+func TestHostSlots(t *testing.T) {
+	_, rdb, ctx := newTestRedis(t)
+	slots := hostSlots{rdb: rdb, max: 2}
+
+	releaseFirst, ok, err := slots.acquire(ctx, "example.com", "job-1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, ok, err = slots.acquire(ctx, "example.com", "job-2")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	_, ok, err = slots.acquire(ctx, "example.com", "job-3")
+	require.NoError(t, err)
+	assert.False(t, ok, "a third crawl of the domain should wait")
+	_, ok, err = slots.acquire(ctx, "example.org", "job-3")
+	require.NoError(t, err)
+	assert.True(t, ok, "other domains are not affected")
+
+	releaseFirst()
+	_, ok, err = slots.acquire(ctx, "example.com", "job-3")
+	require.NoError(t, err)
+	assert.True(t, ok, "released slots are free again")
+
+	// Slots of workers that stopped renewing them expire.
+	expired := redis.Z{Score: float64(time.Now().Add(-time.Second).UnixMilli()), Member: "crashed-1"}
+	require.NoError(t, rdb.ZAdd(ctx, hostSlotsKey("example.net"), expired, redis.Z{Score: expired.Score, Member: "crashed-2"}).Err())
+	_, ok, err = slots.acquire(ctx, "example.net", "job-4")
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestStartWorker_DefersJobsForBusyHosts(t *testing.T) {
+	_, rdb, ctx := newTestRedis(t)
+	createGroup(t, ctx, rdb)
+
+	// Another worker is crawling the domain.
+	slots := hostSlots{rdb: rdb, max: 1}
+	releaseOther, ok, err := slots.acquire(ctx, "example.com", "other-job")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	jobID := uuid.New().String()
+	enqueueValidMessage(t, ctx, rdb, jobID, makeTestCrawlMessage(jobID))
+	require.NoError(t, rdb.HSet(ctx, "job:"+jobID, "status", "pending").Err())
+
+	called := make(chan struct{}, 1)
+	process := func(_ context.Context, _ string, _ models.Archive, _ models.CrawlOptions) error {
+		called <- struct{}{}
+		return nil
+	}
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		_ = StartWorker(workerCtx, rdb, testConsumerName, WorkerOptions{MaxPerHost: 1}, process)
+	}()
+
+	assert.False(t, waitForProcessorCall(called, 1500*time.Millisecond), "job for a busy host should not run")
+	assert.Equal(t, "pending", rdb.HGet(ctx, "job:"+jobID, "status").Val())
+	entries, err := rdb.XLen(ctx, streamName).Result()
+	require.NoError(t, err)
+	assert.Zero(t, entries, "deferred jobs are kept out of the stream")
+	deferred, err := rdb.ZRange(ctx, deferredJobsKey, 0, -1).Result()
+	require.NoError(t, err)
+	assert.Equal(t, []string{streamName + "|" + jobID}, deferred)
+
+	// The job is queued again once due.
+	releaseOther()
+	require.NoError(t, rdb.ZAdd(ctx, deferredJobsKey, redis.Z{Score: 0, Member: deferred[0]}).Err())
+	if !waitForProcessorCall(called, 3*time.Second) {
+		t.Fatal("deferred job was not run once the host was free")
+	}
+	waitForJobStatus(t, ctx, rdb, jobID, "completed", 2*time.Second)
+	waitForNoPending(t, ctx, rdb, 2*time.Second)
+
+	held, err := rdb.ZCard(ctx, hostSlotsKey("example.com")).Result()
+	require.NoError(t, err)
+	assert.Zero(t, held, "finished jobs release their slot")
+	assert.Zero(t, rdb.ZCard(ctx, deferredJobsKey).Val())
+	assert.Zero(t, rdb.HLen(ctx, deferredPayloadsKey).Val())
+}
+
+func TestStartWorker_RunsLowerPriorityJobsPastBusyHosts(t *testing.T) {
+	_, rdb, ctx := newTestRedis(t)
+
+	slots := hostSlots{rdb: rdb, max: 1}
+	releaseOther, ok, err := slots.acquire(ctx, "example.com", "other-job")
+	require.NoError(t, err)
+	require.True(t, ok)
+	defer releaseOther()
+
+	// Only jobs for the busy domain are queued with a high priority.
+	for range 2 {
+		_, err := EnqueueCrawl(ctx, rdb, models.CrawlRequest{URL: "https://example.com/", Priority: models.PriorityHigh})
+		require.NoError(t, err)
+	}
+	idle, err := EnqueueCrawl(ctx, rdb, models.CrawlRequest{URL: "https://example.org/", Priority: models.PriorityLow})
+	require.NoError(t, err)
+
+	ran := make(chan string, 3)
+	process := func(_ context.Context, jobID string, _ models.Archive, _ models.CrawlOptions) error {
+		ran <- jobID
+		return nil
+	}
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		_ = StartWorker(workerCtx, rdb, testConsumerName, WorkerOptions{MaxPerHost: 1}, process)
+	}()
+
+	select {
+	case jobID := <-ran:
+		assert.Equal(t, idle.String(), jobID, "only the job for an idle domain can run")
+	case <-time.After(2 * time.Second):
+		t.Fatal("job for an idle domain was starved by jobs for a busy one")
+	}
+}
+
+func TestReadNextReadsOneJob(t *testing.T) {
+	_, rdb, ctx := newTestRedis(t)
+	require.NoError(t, ensureStreamAndGroup(ctx, rdb))
+
+	for _, priority := range []models.Priority{models.PriorityLow, models.PriorityNormal} {
+		_, err := EnqueueCrawl(ctx, rdb, models.CrawlRequest{URL: "https://example.com/", Priority: priority})
+		require.NoError(t, err)
+	}
+
+	stream, _, err := readNext(ctx, rdb, testConsumerName, crawlStreams())
+	require.NoError(t, err)
+	assert.Equal(t, streamName, stream)
+	pending, err := rdb.XPending(ctx, StreamName(models.PriorityLow), groupName).Result()
+	require.NoError(t, err)
+	assert.Zero(t, pending.Count, "lower priority jobs are left for other workers")
+}
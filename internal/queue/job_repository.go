@@ -57,11 +57,19 @@ func (repo *JobRepository) GetAllJobs(ctx context.Context) ([]models.Job, error)
 			continue
 		}
 
+		// Jobs queued before priorities existed are normal priority.
+		priority := models.Priority(result["priority"])
+		if priority == "" {
+			priority = models.PriorityNormal
+		}
+
 		jobs = append(jobs, models.Job{
 			ID:        uid,
 			URL:       result["url"],
 			Status:    result["status"],
 			CreatedAt: result["created_at"],
+			Owner:     result["owner"],
+			Priority:  priority,
 		})
 	}
 
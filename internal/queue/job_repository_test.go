@@ -32,7 +32,7 @@ func TestJobRepository_GetAllJobs_Success(t *testing.T) {
 
 	// Seed hashes for each job
 	mr.HSet("job:"+jobID1.String(), "url", "https://example.com/1", "status", "pending", "created_at", "2026-06-19T21:00:00Z")
-	mr.HSet("job:"+jobID2.String(), "url", "https://example.com/2", "status", "completed", "created_at", "2026-06-19T22:00:00Z")
+	mr.HSet("job:"+jobID2.String(), "url", "https://example.com/2", "status", "completed", "created_at", "2026-06-19T22:00:00Z", "priority", "low")
 
 	jobs, err := repo.GetAllJobs(ctx)
 	assert.NoError(t, err)
@@ -50,6 +50,7 @@ func TestJobRepository_GetAllJobs_Success(t *testing.T) {
 	assert.Equal(t, "https://example.com/1", j1.URL)
 	assert.Equal(t, "pending", j1.Status)
 	assert.Equal(t, "2026-06-19T21:00:00Z", j1.CreatedAt)
+	assert.Equal(t, models.PriorityNormal, j1.Priority, "jobs without a priority are normal priority")
 
 	// Validate job 2
 	j2, exists := jobMap[jobID2]
@@ -57,6 +58,7 @@ func TestJobRepository_GetAllJobs_Success(t *testing.T) {
 	assert.Equal(t, "https://example.com/2", j2.URL)
 	assert.Equal(t, "completed", j2.Status)
 	assert.Equal(t, "2026-06-19T22:00:00Z", j2.CreatedAt)
+	assert.Equal(t, models.PriorityLow, j2.Priority)
 }
 
 func TestJobRepository_GetAllJobs_MixedMalformedAndMissing(t *testing.T) {
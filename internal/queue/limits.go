@@ -0,0 +1,212 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+var ErrLimited = errors.New("crawl submission limited")
+
+// busyRetryAfter is suggested to clients turned away by a full queue, which
+// has no known time at which it frees up.
+const busyRetryAfter = time.Minute
+
+// LimitError is returned by Limits.Admit when a submission is turned away.
+// RetryAfter is how long the client should wait before trying again.
+type LimitError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrLimited, e.Reason)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimited
+}
+
+// Limits restrict how fast crawls are submitted. Zero values are unlimited.
+// They are checked before a job is queued rather than along with it, so
+// concurrent submissions may exceed MaxPendingPerUser and MaxQueueLength by
+// the number of submissions in flight.
+type Limits struct {
+	// Rate submissions are accepted per RateWindow from one user or client.
+	Rate       int
+	RateWindow time.Duration
+	// MaxPendingPerUser caps the unfinished jobs of a single owner.
+	MaxPendingPerUser int
+	// MaxQueueLength caps the jobs waiting for or held by a worker.
+	MaxQueueLength int
+}
+
+func (l Limits) Enabled() bool {
+	return l.Rate > 0 || l.MaxPendingPerUser > 0 || l.MaxQueueLength > 0
+}
+
+// LimitsFromEnv reads CRAWL_RATE_LIMIT (for example "20/h"),
+// CRAWL_MAX_PENDING_PER_USER and CRAWL_MAX_QUEUE_LENGTH.
+func LimitsFromEnv() (Limits, error) {
+	var l Limits
+	var err error
+
+	if value := strings.TrimSpace(os.Getenv("CRAWL_RATE_LIMIT")); value != "" {
+		if l.Rate, l.RateWindow, err = ParseRate(value); err != nil {
+			return Limits{}, fmt.Errorf("invalid CRAWL_RATE_LIMIT: %w", err)
+		}
+	}
+	if l.MaxPendingPerUser, err = nonNegativeEnv("CRAWL_MAX_PENDING_PER_USER"); err != nil {
+		return Limits{}, err
+	}
+	if l.MaxQueueLength, err = nonNegativeEnv("CRAWL_MAX_QUEUE_LENGTH"); err != nil {
+		return Limits{}, err
+	}
+	return l, nil
+}
+
+func nonNegativeEnv(name string) (int, error) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q: expected a non-negative integer", name, value)
+	}
+	return n, nil
+}
+
+var rateUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+}
+
+// ParseRate parses rates such as "20/h", "5/m" or "100/30m" into a count
+// and the window it applies to.
+func ParseRate(value string) (int, time.Duration, error) {
+	count, per, ok := strings.Cut(strings.TrimSpace(value), "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("rate %q: expected count/window", value)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || n < 0 {
+		return 0, 0, fmt.Errorf("rate %q: invalid count", value)
+	}
+
+	per = strings.TrimSpace(per)
+	window, ok := rateUnits[per]
+	if !ok {
+		window, err = time.ParseDuration(per)
+		if err != nil {
+			return 0, 0, fmt.Errorf("rate %q: invalid window", value)
+		}
+	}
+	if window < time.Second {
+		return 0, 0, fmt.Errorf("rate %q: window must be at least a second", value)
+	}
+	return n, window, nil
+}
+
+// rateLimitScript counts a submission in the fixed window of KEYS[1] and
+// returns the count and the milliseconds left in the window.
+var rateLimitScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return {count, redis.call("PTTL", KEYS[1])}
+`)
+
+// Admit checks whether a crawl submitted by owner, or by client when not
+// signed in, may be enqueued. Submissions turned away by the rate limit
+// still count against it. It returns a *LimitError when limited.
+func (l Limits) Admit(ctx context.Context, rdb *redis.Client, owner, client string) error {
+	if l.MaxQueueLength > 0 {
+		length, err := QueueLength(ctx, rdb)
+		if err != nil {
+			return err
+		}
+		if length >= int64(l.MaxQueueLength) {
+			return &LimitError{Reason: fmt.Sprintf("the crawl queue is full (%d jobs)", length), RetryAfter: busyRetryAfter}
+		}
+	}
+
+	if l.MaxPendingPerUser > 0 && owner != "" {
+		pending, err := CountUnfinishedJobs(ctx, rdb, owner)
+		if err != nil {
+			return err
+		}
+		if pending >= l.MaxPendingPerUser {
+			return &LimitError{Reason: fmt.Sprintf("%d of your jobs are still pending", pending), RetryAfter: busyRetryAfter}
+		}
+	}
+
+	if l.Rate > 0 {
+		key := "ratelimit:crawl:"
+		if owner != "" {
+			key += "user:" + owner
+		} else {
+			key += "ip:" + client
+		}
+		result, err := rateLimitScript.Run(ctx, rdb, []string{key}, l.RateWindow.Milliseconds()).Int64Slice()
+		if err != nil {
+			return fmt.Errorf("count crawl submission: %w", err)
+		}
+		if result[0] > int64(l.Rate) {
+			retryAfter := time.Duration(result[1]) * time.Millisecond
+			if retryAfter <= 0 {
+				retryAfter = l.RateWindow
+			}
+			return &LimitError{Reason: fmt.Sprintf("at most %d crawls per %s", l.Rate, l.RateWindow), RetryAfter: retryAfter}
+		}
+	}
+	return nil
+}
+
+// QueueLength returns the number of crawl jobs of every priority waiting
+// for a worker, held by one and not yet acknowledged, or deferred for a
+// busy host. Workers delete the jobs they acknowledge, so the streams only
+// hold those.
+func QueueLength(ctx context.Context, rdb *redis.Client) (int64, error) {
+	pipe := rdb.Pipeline()
+	cmds := make([]*redis.IntCmd, 0, len(models.Priorities)+1)
+	for _, stream := range crawlStreams() {
+		cmds = append(cmds, pipe.XLen(ctx, stream))
+	}
+	cmds = append(cmds, pipe.ZCard(ctx, deferredJobsKey))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("inspect crawl queue: %w", err)
+	}
+
+	var total int64
+	for _, cmd := range cmds {
+		total += cmd.Val()
+	}
+	return total, nil
+}
+
+// unfinishedJobsKey is the set of the jobs of owner that are pending or
+// running. Jobs are added when queued and removed by finishJob.
+func unfinishedJobsKey(owner string) string {
+	return "jobs:unfinished:" + owner
+}
+
+// CountUnfinishedJobs returns the number of jobs of owner that are pending
+// or running.
+func CountUnfinishedJobs(ctx context.Context, rdb *redis.Client, owner string) (int, error) {
+	count, err := rdb.SCard(ctx, unfinishedJobsKey(owner)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("count unfinished jobs: %w", err)
+	}
+	return int(count), nil
+}
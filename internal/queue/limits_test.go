@@ -0,0 +1,158 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		value   string
+		count   int
+		window  time.Duration
+		wantErr bool
+	}{
+		{value: "20/h", count: 20, window: time.Hour},
+		{value: " 5 / m ", count: 5, window: time.Minute},
+		{value: "100/30m", count: 100, window: 30 * time.Minute},
+		{value: "1/d", count: 1, window: 24 * time.Hour},
+		{value: "20", wantErr: true},
+		{value: "many/h", wantErr: true},
+		{value: "5/fortnight", wantErr: true},
+		{value: "5/10ms", wantErr: true},
+	}
+	for _, tt := range tests {
+		count, window, err := ParseRate(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("ParseRate(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+		}
+		if count != tt.count || window != tt.window {
+			t.Fatalf("ParseRate(%q) = %d, %s, want %d, %s", tt.value, count, window, tt.count, tt.window)
+		}
+	}
+}
+
+func TestLimitsFromEnv(t *testing.T) {
+	t.Setenv("CRAWL_RATE_LIMIT", "20/h")
+	t.Setenv("CRAWL_MAX_PENDING_PER_USER", "3")
+	t.Setenv("CRAWL_MAX_QUEUE_LENGTH", "")
+
+	limits, err := LimitsFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, Limits{Rate: 20, RateWindow: time.Hour, MaxPendingPerUser: 3}, limits)
+
+	t.Setenv("CRAWL_MAX_QUEUE_LENGTH", "-1")
+	_, err = LimitsFromEnv()
+	assert.Error(t, err)
+}
+
+func TestLimitsAdmit(t *testing.T) {
+	t.Run("rate limit is kept per user or client", func(t *testing.T) {
+		mr, rdb, ctx := newTestRedis(t)
+		limits := Limits{Rate: 2, RateWindow: time.Hour}
+
+		require.NoError(t, limits.Admit(ctx, rdb, "alice", "192.0.2.1"))
+		require.NoError(t, limits.Admit(ctx, rdb, "alice", "192.0.2.1"))
+		err := limits.Admit(ctx, rdb, "alice", "192.0.2.2")
+		var limitErr *LimitError
+		require.ErrorAs(t, err, &limitErr)
+		assert.True(t, errors.Is(err, ErrLimited))
+		assert.InDelta(t, time.Hour.Seconds(), limitErr.RetryAfter.Seconds(), 1)
+
+		assert.NoError(t, limits.Admit(ctx, rdb, "bob", "192.0.2.1"))
+		assert.NoError(t, limits.Admit(ctx, rdb, "", "192.0.2.1"))
+
+		mr.FastForward(time.Hour)
+		assert.NoError(t, limits.Admit(ctx, rdb, "alice", "192.0.2.1"))
+	})
+
+	t.Run("caps unfinished jobs per user", func(t *testing.T) {
+		_, rdb, ctx := newTestRedis(t)
+		limits := Limits{MaxPendingPerUser: 2}
+		alice := &models.User{Username: "alice"}
+
+		first, err := EnqueueCrawl(ctx, rdb, models.CrawlRequest{URL: "https://example.com", Owner: alice})
+		require.NoError(t, err)
+		_, err = EnqueueCrawl(ctx, rdb, models.CrawlRequest{URL: "https://example.com", Owner: alice})
+		require.NoError(t, err)
+		_, err = EnqueueCrawl(ctx, rdb, models.CrawlRequest{URL: "https://example.com"})
+		require.NoError(t, err)
+
+		assert.ErrorIs(t, limits.Admit(ctx, rdb, "alice", ""), ErrLimited)
+		assert.NoError(t, limits.Admit(ctx, rdb, "bob", ""))
+
+		require.NoError(t, finishJob(ctx, rdb, first.String(), "failed", "error", "crawler exited"))
+		assert.NoError(t, limits.Admit(ctx, rdb, "alice", ""))
+	})
+
+	t.Run("caps the queue length", func(t *testing.T) {
+		_, rdb, ctx := newTestRedis(t)
+		limits := Limits{MaxQueueLength: 2}
+
+		assert.NoError(t, limits.Admit(ctx, rdb, "", ""))
+		for range 2 {
+			_, err := EnqueueCrawl(ctx, rdb, models.CrawlRequest{URL: "https://example.com"})
+			require.NoError(t, err)
+		}
+		assert.ErrorIs(t, limits.Admit(ctx, rdb, "", ""), ErrLimited)
+
+		// Jobs held by a worker stay in the queue until acknowledged.
+		require.NoError(t, ensureStreamAndGroup(ctx, rdb))
+		streams, err := rdb.XReadGroup(ctx, &redis.XReadGroupArgs{Group: groupName, Consumer: "worker", Streams: []string{streamName, ">"}, Count: 1}).Result()
+		require.NoError(t, err)
+		length, err := QueueLength(ctx, rdb)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), length)
+
+		require.NoError(t, ackJob(ctx, rdb, streamName, streams[0].Messages[0].ID))
+		length, err = QueueLength(ctx, rdb)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), length)
+		assert.NoError(t, limits.Admit(ctx, rdb, "", ""))
+
+		// Jobs deferred for a busy host are still queued.
+		streams, err = rdb.XReadGroup(ctx, &redis.XReadGroupArgs{Group: groupName, Consumer: "worker", Streams: []string{streamName, ">"}, Count: 1}).Result()
+		require.NoError(t, err)
+		deferJob(ctx, rdb, streamName, streams[0].Messages[0])
+		length, err = QueueLength(ctx, rdb)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), length)
+	})
+
+	t.Run("workers release the jobs of an owner", func(t *testing.T) {
+		_, rdb, ctx := newTestRedis(t)
+		alice := &models.User{Username: "alice"}
+
+		_, err := EnqueueCrawl(ctx, rdb, models.CrawlRequest{URL: "https://example.com", Owner: alice})
+		require.NoError(t, err)
+		pending, err := CountUnfinishedJobs(ctx, rdb, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, 1, pending)
+
+		workerCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		_ = startWorker(t, workerCtx, rdb, func(context.Context, string, models.Archive, models.CrawlOptions) error {
+			return nil
+		})
+		waitForNoPending(t, ctx, rdb, 2*time.Second)
+
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if pending, err = CountUnfinishedJobs(ctx, rdb, "alice"); err == nil && pending == 0 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Zero(t, pending)
+		length, err := QueueLength(ctx, rdb)
+		require.NoError(t, err)
+		assert.Zero(t, length, "acknowledged jobs are deleted")
+	})
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/JuanSaenz04/archiver/internal/archiveutil"
 	"github.com/JuanSaenz04/archiver/internal/models"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
@@ -14,11 +16,21 @@ import (
 func EnqueueCrawl(ctx context.Context, rdb *redis.Client, request models.CrawlRequest) (*uuid.UUID, error) {
 	jobID := uuid.New()
 
-	err := rdb.HSet(ctx, "job:"+jobID.String(), map[string]interface{}{
+	priority := request.Priority
+	if priority == "" {
+		priority = models.PriorityNormal
+	}
+
+	job := map[string]interface{}{
 		"url":        request.URL,
 		"status":     "pending",
 		"created_at": time.Now().Format(time.RFC3339),
-	}).Err()
+		"priority":   string(priority),
+	}
+	if request.Owner != nil {
+		job["owner"] = request.Owner.Username
+	}
+	err := rdb.HSet(ctx, "job:"+jobID.String(), job).Err()
 	if err != nil {
 		return nil, err
 	}
@@ -27,13 +39,28 @@ func EnqueueCrawl(ctx context.Context, rdb *redis.Client, request models.CrawlRe
 	if err := rdb.SAdd(ctx, "jobs:index", jobID.String()).Err(); err != nil {
 		return nil, err
 	}
+	if request.Owner != nil {
+		if err := rdb.SAdd(ctx, unfinishedJobsKey(request.Owner.Username), jobID.String()).Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	subject := strings.TrimSpace(request.Subject)
+	if subject == "" {
+		subject = archiveutil.NormalizeSubject(request.URL)
+	}
 
 	archive := models.Archive{
 		ID:          jobID,
 		Name:        request.Name,
 		Description: request.Description,
 		SourceURL:   request.URL,
+		Subject:     subject,
 		Tags:        request.Tags,
+		Visibility:  request.Visibility,
+	}
+	if request.Owner != nil {
+		archive.OwnerID = &request.Owner.ID
 	}
 
 	msg := CrawlMessage{
@@ -48,7 +75,7 @@ func EnqueueCrawl(ctx context.Context, rdb *redis.Client, request models.CrawlRe
 	}
 
 	err = rdb.XAdd(ctx, &redis.XAddArgs{
-		Stream: "crawl_stream",
+		Stream: StreamName(priority),
 		Values: map[string]interface{}{
 			"job_id":  jobID.String(),
 			"payload": string(msgBytes),
@@ -83,6 +83,25 @@ func TestEnqueueCrawl_Success(t *testing.T) {
 	assert.Equal(t, request.Description, crawlMsg.Archive.Description)
 	assert.Equal(t, request.URL, crawlMsg.Archive.SourceURL)
 	assert.Equal(t, request.Tags, crawlMsg.Archive.Tags)
+	assert.Equal(t, "https://example.com/test-page", crawlMsg.Archive.Subject)
+}
+
+func TestEnqueueCrawl_UsesExplicitSubject(t *testing.T) {
+	_, rdb, ctx := newTestRedis(t)
+
+	_, err := EnqueueCrawl(ctx, rdb, models.CrawlRequest{
+		URL:     "https://example.com/news?page=2",
+		Subject: " example-news ",
+	})
+	assert.NoError(t, err)
+
+	entries, err := rdb.XRange(ctx, "crawl_stream", "-", "+").Result()
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		var crawlMsg CrawlMessage
+		assert.NoError(t, json.Unmarshal([]byte(entries[0].Values["payload"].(string)), &crawlMsg))
+		assert.Equal(t, "example-news", crawlMsg.Archive.Subject)
+	}
 }
 
 func TestEnqueueCrawl_RedisHSetError(t *testing.T) {
@@ -99,3 +118,20 @@ func TestEnqueueCrawl_RedisHSetError(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, jobID)
 }
+
+func TestEnqueueCrawl_QueuesByPriority(t *testing.T) {
+	_, rdb, ctx := newTestRedis(t)
+
+	jobID, err := EnqueueCrawl(ctx, rdb, models.CrawlRequest{URL: "https://example.com", Priority: models.PriorityLow})
+	assert.NoError(t, err)
+	assert.Equal(t, "low", rdb.HGet(ctx, "job:"+jobID.String(), "priority").Val())
+
+	_, err = EnqueueCrawl(ctx, rdb, models.CrawlRequest{URL: "https://example.com"})
+	assert.NoError(t, err)
+
+	for stream, want := range map[string]int64{"crawl_stream:low": 1, "crawl_stream": 1, "crawl_stream:high": 0} {
+		length, err := rdb.XLen(ctx, stream).Result()
+		assert.NoError(t, err)
+		assert.Equal(t, want, length, stream)
+	}
+}
@@ -0,0 +1,155 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/JuanSaenz04/archiver/internal/store"
+)
+
+var ErrExceeded = errors.New("storage quota exceeded")
+
+// Quota caps the bytes held in storage, including trashed archives that
+// have not been purged yet. Zero limits are unlimited.
+type Quota struct {
+	GlobalBytes int64            `json:"global_bytes"`
+	TagBytes    map[string]int64 `json:"tag_bytes"`
+}
+
+func (q Quota) Enabled() bool {
+	return q.GlobalBytes > 0 || len(q.TagBytes) > 0
+}
+
+// FromEnv reads STORAGE_QUOTA (for example "500GB") and TAG_STORAGE_QUOTAS
+// (for example "temp=10GB,news=100GB").
+func FromEnv() (Quota, error) {
+	q := Quota{TagBytes: make(map[string]int64)}
+
+	if value := strings.TrimSpace(os.Getenv("STORAGE_QUOTA")); value != "" {
+		size, err := ParseSize(value)
+		if err != nil {
+			return Quota{}, fmt.Errorf("invalid STORAGE_QUOTA: %w", err)
+		}
+		q.GlobalBytes = size
+	}
+
+	for _, entry := range strings.Split(os.Getenv("TAG_STORAGE_QUOTAS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		tag, value, ok := strings.Cut(entry, "=")
+		tag = strings.TrimSpace(tag)
+		if !ok || tag == "" {
+			return Quota{}, fmt.Errorf("invalid TAG_STORAGE_QUOTAS entry %q: expected tag=size", entry)
+		}
+		size, err := ParseSize(value)
+		if err != nil {
+			return Quota{}, fmt.Errorf("invalid TAG_STORAGE_QUOTAS entry %q: %w", entry, err)
+		}
+		if size > 0 {
+			q.TagBytes[tag] = size
+		}
+	}
+
+	return q, nil
+}
+
+var sizeUnits = map[string]int64{
+	"":   1,
+	"B":  1,
+	"K":  1 << 10,
+	"KB": 1 << 10,
+	"M":  1 << 20,
+	"MB": 1 << 20,
+	"G":  1 << 30,
+	"GB": 1 << 30,
+	"T":  1 << 40,
+	"TB": 1 << 40,
+}
+
+// ParseSize parses sizes such as "512MB", "1.5 TB" or "1048576". Units are
+// binary, matching how sizes are displayed in the frontend.
+func ParseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	split := strings.IndexFunc(value, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	number, unit := value, ""
+	if split >= 0 {
+		number, unit = value[:split], strings.TrimSpace(value[split:])
+	}
+	unit = strings.Replace(unit, "IB", "B", 1)
+
+	multiplier, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown size unit %q", unit)
+	}
+	parsed, err := strconv.ParseFloat(number, 64)
+	if err != nil || parsed < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	size := parsed * float64(multiplier)
+	if size > math.MaxInt64 {
+		return 0, fmt.Errorf("size %q is too large", value)
+	}
+	return int64(size), nil
+}
+
+// Check returns an error wrapping ErrExceeded if storing adding more bytes
+// for an archive with tags would exceed the global quota or the quota of
+// any of its tags. With adding set to zero it only rejects quotas that are
+// already full.
+func (q Quota) Check(ctx context.Context, archiveStore store.Store, tags []string, adding int64) error {
+	if !q.Enabled() {
+		return nil
+	}
+
+	limitedTags := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if q.TagBytes[tag] > 0 {
+			limitedTags = append(limitedTags, tag)
+		}
+	}
+
+	total, byTag, err := archiveStore.StorageUsed(ctx, limitedTags)
+	if err != nil {
+		return err
+	}
+
+	if q.GlobalBytes > 0 && exceeds(total, adding, q.GlobalBytes) {
+		return fmt.Errorf("%w: library uses %s of %s", ErrExceeded, FormatSize(total), FormatSize(q.GlobalBytes))
+	}
+	for _, tag := range limitedTags {
+		if exceeds(byTag[tag], adding, q.TagBytes[tag]) {
+			return fmt.Errorf("%w: tag %q uses %s of %s", ErrExceeded, tag, FormatSize(byTag[tag]), FormatSize(q.TagBytes[tag]))
+		}
+	}
+	return nil
+}
+
+func exceeds(used, adding, limit int64) bool {
+	if adding == 0 {
+		return used >= limit
+	}
+	return used+adding > limit
+}
+
+func FormatSize(bytes int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(bytes)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d %s", bytes, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
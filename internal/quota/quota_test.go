@@ -0,0 +1,107 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/google/uuid"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "1024", want: 1024},
+		{value: "512MB", want: 512 << 20},
+		{value: "1.5 TB", want: 3 << 39},
+		{value: "10gib", want: 10 << 30},
+		{value: "2k", want: 2048},
+		{value: "ten GB", wantErr: true},
+		{value: "5 PB", wantErr: true},
+		{value: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("ParseSize(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Fatalf("ParseSize(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("STORAGE_QUOTA", "1GB")
+	t.Setenv("TAG_STORAGE_QUOTAS", " temp=10MB , news = 1 GB,")
+
+	q, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if q.GlobalBytes != 1<<30 || q.TagBytes["temp"] != 10<<20 || q.TagBytes["news"] != 1<<30 {
+		t.Fatalf("unexpected quota: %#v", q)
+	}
+
+	t.Setenv("TAG_STORAGE_QUOTAS", "temp")
+	if _, err := FromEnv(); err == nil {
+		t.Fatal("expected error for entry without size")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	archiveStore, err := store.Open("file:" + uuid.NewString() + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = archiveStore.Close() })
+	if err := archiveStore.RunMigrations(); err != nil {
+		t.Fatalf("run migrations: %v", err)
+	}
+
+	ctx := context.Background()
+	trashed := models.Archive{ID: uuid.New(), Name: "b", Filename: "b.wacz", SizeBytes: 300}
+	for _, archive := range []models.Archive{
+		{ID: uuid.New(), Name: "a", Filename: "a.wacz", Tags: []string{"temp"}, SizeBytes: 600},
+		trashed,
+	} {
+		if err := archiveStore.Insert(ctx, archive); err != nil {
+			t.Fatalf("insert archive: %v", err)
+		}
+	}
+
+	// Trashed archives keep their files until purged, so they still count.
+	if err := archiveStore.Trash(ctx, trashed.ID, time.Now().UTC()); err != nil {
+		t.Fatalf("trash archive: %v", err)
+	}
+
+	q := Quota{GlobalBytes: 1000, TagBytes: map[string]int64{"temp": 600}}
+	tests := []struct {
+		name    string
+		tags    []string
+		adding  int64
+		wantErr bool
+	}{
+		{name: "untagged job with room", tags: nil, adding: 0},
+		{name: "untagged archive fits", tags: nil, adding: 100},
+		{name: "global quota exceeded", tags: nil, adding: 101, wantErr: true},
+		{name: "full tag rejects jobs", tags: []string{"temp"}, adding: 0, wantErr: true},
+		{name: "unlimited tag", tags: []string{"news"}, adding: 50},
+	}
+	for _, tt := range tests {
+		err := q.Check(ctx, archiveStore, tt.tags, tt.adding)
+		if tt.wantErr != errors.Is(err, ErrExceeded) {
+			t.Fatalf("%s: Check() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	if err := (Quota{}).Check(ctx, nil, []string{"temp"}, 1<<40); err != nil {
+		t.Fatalf("disabled quota should not touch the store: %v", err)
+	}
+}
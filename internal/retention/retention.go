@@ -0,0 +1,238 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/storage"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/JuanSaenz04/archiver/internal/trash"
+	"github.com/google/uuid"
+)
+
+const runInterval = time.Hour
+
+type Expiration struct {
+	Archive  models.Archive `json:"archive"`
+	RuleID   uuid.UUID      `json:"rule_id"`
+	RuleName string         `json:"rule_name"`
+	Reason   string         `json:"reason"`
+	DryRun   bool           `json:"dry_run"`
+}
+
+func ValidateRule(rule models.RetentionRule) error {
+	switch {
+	case rule.MaxAgeDays < 0 || rule.KeepLast < 0:
+		return errors.New("max_age_days and keep_last must not be negative")
+	case rule.Hold && (rule.MaxAgeDays > 0 || rule.KeepLast > 0):
+		return errors.New("hold rules cannot expire archives")
+	case !rule.Hold && rule.MaxAgeDays == 0 && rule.KeepLast == 0:
+		return errors.New("rule must set max_age_days, keep_last or hold")
+	}
+	return nil
+}
+
+// Evaluate returns the archives expired by rules at now, newest first. An
+// archive expired by several rules is reported once, preferring a rule that
+// is not in dry-run mode.
+func Evaluate(archives []models.Archive, rules []models.RetentionRule, now time.Time) []Expiration {
+	held := make(map[uuid.UUID]bool)
+	for _, rule := range rules {
+		if !rule.Hold {
+			continue
+		}
+		for _, archive := range archives {
+			if matches(rule, archive) {
+				held[archive.ID] = true
+			}
+		}
+	}
+
+	expired := make(map[uuid.UUID]Expiration)
+	for _, rule := range rules {
+		if rule.Hold {
+			continue
+		}
+
+		candidates := make([]models.Archive, 0)
+		for _, archive := range archives {
+			if matches(rule, archive) && !held[archive.ID] {
+				candidates = append(candidates, archive)
+			}
+		}
+
+		for _, candidate := range expiredBy(rule, candidates, now) {
+			if current, ok := expired[candidate.Archive.ID]; ok && (!current.DryRun || candidate.DryRun) {
+				continue
+			}
+			expired[candidate.Archive.ID] = candidate
+		}
+	}
+
+	expirations := make([]Expiration, 0, len(expired))
+	for _, expiration := range expired {
+		expirations = append(expirations, expiration)
+	}
+	sort.Slice(expirations, func(i, j int) bool {
+		a, b := expirations[i].Archive, expirations[j].Archive
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID.String() > b.ID.String()
+	})
+	return expirations
+}
+
+func matches(rule models.RetentionRule, archive models.Archive) bool {
+	return rule.Tag == "" || slices.Contains(archive.Tags, rule.Tag)
+}
+
+func expiredBy(rule models.RetentionRule, archives []models.Archive, now time.Time) []Expiration {
+	beyondKeepLast := make(map[uuid.UUID]bool)
+	if rule.KeepLast > 0 {
+		bySubject := make(map[string][]models.Archive)
+		for _, archive := range archives {
+			subject := subjectOf(archive)
+			bySubject[subject] = append(bySubject[subject], archive)
+		}
+		for _, snapshots := range bySubject {
+			sort.Slice(snapshots, func(i, j int) bool {
+				return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+			})
+			for _, archive := range snapshots[min(rule.KeepLast, len(snapshots)):] {
+				beyondKeepLast[archive.ID] = true
+			}
+		}
+	}
+	cutoff := now.AddDate(0, 0, -rule.MaxAgeDays)
+
+	expirations := make([]Expiration, 0)
+	for _, archive := range archives {
+		tooOld := rule.MaxAgeDays > 0 && archive.CreatedAt.Before(cutoff)
+
+		var reason string
+		switch {
+		case rule.MaxAgeDays > 0 && rule.KeepLast > 0:
+			if !tooOld || !beyondKeepLast[archive.ID] {
+				continue
+			}
+			reason = fmt.Sprintf("older than %d days and not among the last %d snapshots", rule.MaxAgeDays, rule.KeepLast)
+		case rule.MaxAgeDays > 0:
+			if !tooOld {
+				continue
+			}
+			reason = fmt.Sprintf("older than %d days", rule.MaxAgeDays)
+		default:
+			if !beyondKeepLast[archive.ID] {
+				continue
+			}
+			reason = fmt.Sprintf("not among the last %d snapshots", rule.KeepLast)
+		}
+
+		expirations = append(expirations, Expiration{
+			Archive:  archive,
+			RuleID:   rule.ID,
+			RuleName: rule.Name,
+			Reason:   reason,
+			DryRun:   rule.DryRun,
+		})
+	}
+	return expirations
+}
+
+// subjectOf groups snapshots for keep_last. Archives without a subject or
+// source URL (for example ones synced from disk) each form their own group.
+func subjectOf(archive models.Archive) string {
+	switch {
+	case archive.Subject != "":
+		return archive.Subject
+	case archive.SourceURL != "":
+		return archive.SourceURL
+	default:
+		return "id:" + archive.ID.String()
+	}
+}
+
+type Enforcer struct {
+	archiveStore store.Store
+	storage      storage.Backend
+}
+
+func NewEnforcer(archiveStore store.Store, backend storage.Backend) *Enforcer {
+	return &Enforcer{
+		archiveStore: archiveStore,
+		storage:      backend,
+	}
+}
+
+// Preview evaluates the stored rules against the live archives without
+// acting on them.
+func (e *Enforcer) Preview(ctx context.Context, now time.Time) ([]Expiration, error) {
+	rules, err := e.archiveStore.ListRetentionRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return make([]Expiration, 0), nil
+	}
+
+	archives, err := e.archiveStore.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Evaluate(archives, rules, now), nil
+}
+
+// Start enforces retention rules immediately and then every runInterval
+// until ctx is cancelled.
+func (e *Enforcer) Start(ctx context.Context) {
+	ticker := time.NewTicker(runInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := e.Run(ctx, time.Now().UTC()); err != nil && ctx.Err() == nil {
+			slog.Error("failed to enforce retention rules", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run moves archives expired by active rules to the trash and logs the ones
+// that dry-run rules would expire. It returns every expiration it found.
+func (e *Enforcer) Run(ctx context.Context, now time.Time) ([]Expiration, error) {
+	expirations, err := e.Preview(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, expiration := range expirations {
+		archive := expiration.Archive
+		if expiration.DryRun {
+			slog.Info("retention rule would expire archive", "archive_id", archive.ID, "filename", archive.Filename, "rule_id", expiration.RuleID, "rule_name", expiration.RuleName, "reason", expiration.Reason)
+			continue
+		}
+
+		err := trash.Move(ctx, e.archiveStore, e.storage, archive.ID, archive.Filename, now)
+		switch {
+		case err == nil:
+			slog.Info("retention rule expired archive", "archive_id", archive.ID, "filename", archive.Filename, "rule_id", expiration.RuleID, "rule_name", expiration.RuleName, "reason", expiration.Reason)
+		case errors.Is(err, store.ErrArchiveReferenced), errors.Is(err, store.ErrArchiveNotFound), errors.Is(err, storage.ErrNotExist):
+			slog.Warn("skipping expired archive", "archive_id", archive.ID, "filename", archive.Filename, "rule_id", expiration.RuleID, "error", err)
+		default:
+			return expirations, err
+		}
+	}
+
+	return expirations, nil
+}
@@ -0,0 +1,125 @@
+package retention
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/storage"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/JuanSaenz04/archiver/internal/trash"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+
+func snapshot(name, subject string, age time.Duration, tags ...string) models.Archive {
+	if tags == nil {
+		tags = []string{}
+	}
+	return models.Archive{ID: uuid.New(), Name: name, Filename: name + ".wacz", Subject: subject, Tags: tags, CreatedAt: now.Add(-age)}
+}
+
+func expiredNames(expirations []Expiration) []string {
+	names := make([]string, 0, len(expirations))
+	for _, expiration := range expirations {
+		names = append(names, expiration.Archive.Name)
+	}
+	return names
+}
+
+func TestEvaluate(t *testing.T) {
+	day := 24 * time.Hour
+	archives := []models.Archive{
+		snapshot("news-1", "https://news.example", 1*day),
+		snapshot("news-2", "https://news.example", 2*day),
+		snapshot("news-3", "https://news.example", 3*day, "legal-hold"),
+		snapshot("news-4", "https://news.example", 40*day),
+		snapshot("blog-1", "https://blog.example", 50*day),
+		snapshot("scratch-new", "https://scratch.example", 5*day, "temp"),
+		snapshot("scratch-old", "https://scratch.example", 31*day, "temp"),
+	}
+	keepTwo := models.RetentionRule{ID: uuid.New(), Name: "keep two", KeepLast: 2}
+	temp := models.RetentionRule{ID: uuid.New(), Name: "temp", Tag: "temp", MaxAgeDays: 30}
+	hold := models.RetentionRule{ID: uuid.New(), Name: "legal hold", Tag: "legal-hold", Hold: true}
+
+	tests := []struct {
+		name  string
+		rules []models.RetentionRule
+		want  []string
+	}{
+		{name: "no rules", want: []string{}},
+		{name: "keep last per subject", rules: []models.RetentionRule{keepTwo}, want: []string{"news-3", "news-4"}},
+		{name: "hold protects matching archives", rules: []models.RetentionRule{keepTwo, hold}, want: []string{"news-4"}},
+		{name: "max age by tag", rules: []models.RetentionRule{temp}, want: []string{"scratch-old"}},
+		{
+			name:  "age and count combine",
+			rules: []models.RetentionRule{{ID: uuid.New(), Name: "old extras", KeepLast: 1, MaxAgeDays: 2}},
+			want:  []string{"news-3", "scratch-old", "news-4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, expiredNames(Evaluate(archives, tt.rules, now)))
+		})
+	}
+}
+
+func TestEvaluatePrefersActiveRules(t *testing.T) {
+	archive := snapshot("old", "https://example.com", 90*24*time.Hour)
+	dryRun := models.RetentionRule{ID: uuid.New(), Name: "trial", MaxAgeDays: 30, DryRun: true}
+	active := models.RetentionRule{ID: uuid.New(), Name: "enforced", MaxAgeDays: 60}
+
+	expirations := Evaluate([]models.Archive{archive}, []models.RetentionRule{dryRun, active}, now)
+	if assert.Len(t, expirations, 1) {
+		assert.Equal(t, active.ID, expirations[0].RuleID)
+		assert.False(t, expirations[0].DryRun)
+	}
+}
+
+func TestValidateRule(t *testing.T) {
+	assert.NoError(t, ValidateRule(models.RetentionRule{KeepLast: 3}))
+	assert.NoError(t, ValidateRule(models.RetentionRule{Hold: true, Tag: "legal-hold"}))
+	assert.Error(t, ValidateRule(models.RetentionRule{}))
+	assert.Error(t, ValidateRule(models.RetentionRule{Hold: true, MaxAgeDays: 1}))
+	assert.Error(t, ValidateRule(models.RetentionRule{KeepLast: -1}))
+}
+
+func TestEnforcerRun(t *testing.T) {
+	archiveStore, err := store.Open("file:" + uuid.NewString() + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = archiveStore.Close() })
+	if err := archiveStore.RunMigrations(); err != nil {
+		t.Fatalf("run migrations: %v", err)
+	}
+
+	ctx := context.Background()
+	archivesDir := t.TempDir()
+	scratch := snapshot("scratch", "https://scratch.example", 40*24*time.Hour, "temp")
+	old := snapshot("old", "https://news.example", 400*24*time.Hour)
+	for _, archive := range []models.Archive{scratch, old} {
+		assert.NoError(t, archiveStore.Insert(ctx, archive))
+		assert.NoError(t, os.WriteFile(filepath.Join(archivesDir, archive.Filename), []byte("content"), 0644))
+	}
+	assert.NoError(t, archiveStore.InsertRetentionRule(ctx, models.RetentionRule{ID: uuid.New(), Name: "temp", Tag: "temp", MaxAgeDays: 30, CreatedAt: now}))
+	assert.NoError(t, archiveStore.InsertRetentionRule(ctx, models.RetentionRule{ID: uuid.New(), Name: "yearly", MaxAgeDays: 365, DryRun: true, CreatedAt: now}))
+
+	expirations, err := NewEnforcer(archiveStore, storage.NewLocal(archivesDir)).Run(ctx, now)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"scratch", "old"}, expiredNames(expirations))
+
+	assert.FileExists(t, filepath.Join(archivesDir, filepath.FromSlash(trash.Key(scratch.ID))))
+	assert.FileExists(t, filepath.Join(archivesDir, old.Filename), "dry-run rules must not act")
+
+	live, err := archiveStore.List(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, live, 1) {
+		assert.Equal(t, old.ID, live[0].ID)
+	}
+}
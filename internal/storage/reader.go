@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// ReadSeeker reads an object through ranged gets, which lets
+// http.ServeContent answer Range requests without downloading the whole
+// object.
+type ReadSeeker struct {
+	ctx     context.Context
+	backend Backend
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+func NewReadSeeker(ctx context.Context, backend Backend, key string, size int64) *ReadSeeker {
+	return &ReadSeeker{ctx: ctx, backend: backend, key: key, size: size}
+}
+
+func (r *ReadSeeker) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.backend.Get(r.ctx, r.key, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *ReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("storage: negative position")
+	}
+
+	if offset != r.offset {
+		r.closeBody()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+func (r *ReadSeeker) Close() error {
+	r.closeBody()
+	return nil
+}
+
+func (r *ReadSeeker) closeBody() {
+	if r.body != nil {
+		_ = r.body.Close()
+		r.body = nil
+	}
+}
+
+type ReaderAtCloser interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// readAtChunkSize is how much is fetched per request when reading a remote
+// object at random offsets, so sequential zip entries need few round trips.
+const readAtChunkSize = 1 << 20
+
+// OpenReaderAt gives random access to an object, as needed to read a WACZ
+// without copying it locally first. Local objects are read from their file.
+func OpenReaderAt(ctx context.Context, backend Backend, key string) (ReaderAtCloser, int64, error) {
+	if local, ok := backend.(*Local); ok {
+		file, err := os.Open(local.path(key))
+		if err != nil {
+			return nil, 0, localError(err)
+		}
+		info, err := file.Stat()
+		if err != nil {
+			_ = file.Close()
+			return nil, 0, err
+		}
+		return file, info.Size(), nil
+	}
+
+	info, err := backend.Stat(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &chunkReaderAt{ctx: ctx, backend: backend, key: key, size: info.Size, chunkStart: -1}, info.Size, nil
+}
+
+type chunkReaderAt struct {
+	mu         sync.Mutex
+	ctx        context.Context
+	backend    Backend
+	key        string
+	size       int64
+	chunk      []byte
+	chunkStart int64
+}
+
+func (r *chunkReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, errors.New("storage: negative offset")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	read := 0
+	for read < len(p) {
+		position := offset + int64(read)
+		if position >= r.size {
+			return read, io.EOF
+		}
+
+		if r.chunkStart < 0 || position < r.chunkStart || position >= r.chunkStart+int64(len(r.chunk)) {
+			if err := r.fetch(position - position%readAtChunkSize); err != nil {
+				return read, err
+			}
+		}
+		read += copy(p[read:], r.chunk[position-r.chunkStart:])
+	}
+	return read, nil
+}
+
+func (r *chunkReaderAt) fetch(start int64) error {
+	length := min(int64(readAtChunkSize), r.size-start)
+	body, err := r.backend.Get(r.ctx, r.key, start, length)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	chunk := make([]byte, length)
+	if _, err := io.ReadFull(body, chunk); err != nil {
+		return err
+	}
+	r.chunk = chunk
+	r.chunkStart = start
+	return nil
+}
+
+func (r *chunkReaderAt) Close() error {
+	r.chunk = nil
+	return nil
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const maxCopySize = 5 << 30
+
+type S3Config struct {
+	Endpoint string
+	Bucket   string
+	// Prefix is prepended to every key, so several deployments can share a
+	// bucket.
+	Prefix          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	UseSSL          bool
+}
+
+// S3 keeps objects in an S3-compatible bucket such as AWS S3 or MinIO.
+type S3 struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func NewS3(config S3Config) (*S3, error) {
+	if config.Endpoint == "" {
+		return nil, errors.New("environment variable S3_ENDPOINT not set")
+	}
+	if config.Bucket == "" {
+		return nil, errors.New("environment variable S3_BUCKET not set")
+	}
+
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKeyID, config.SecretAccessKey, ""),
+		Secure: config.UseSSL,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create s3 client: %w", err)
+	}
+
+	prefix := strings.Trim(config.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3{client: client, bucket: config.Bucket, prefix: prefix}, nil
+}
+
+func (s *S3) object(key string) string {
+	return s.prefix + strings.TrimPrefix(path.Clean("/"+key), "/")
+}
+
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	opts := minio.PutObjectOptions{ContentType: "application/wacz"}
+	opts.SetMatchETagExcept("*")
+
+	if _, err := s.client.PutObject(ctx, s.bucket, s.object(key), r, size, opts); err != nil {
+		return s3Error(err)
+	}
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	var opts minio.GetObjectOptions
+	switch {
+	case length == 0:
+		return io.NopCloser(strings.NewReader("")), nil
+	case length > 0:
+		if err := opts.SetRange(offset, offset+length-1); err != nil {
+			return nil, err
+		}
+	case offset > 0:
+		if err := opts.SetRange(offset, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	body, _, _, err := minio.Core{Client: s.client}.GetObject(ctx, s.bucket, s.object(key), opts)
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	return body, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	err := s.client.RemoveObject(ctx, s.bucket, s.object(key), minio.RemoveObjectOptions{})
+	if err != nil && !errors.Is(s3Error(err), ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, s.object(key), minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, s3Error(err)
+	}
+	return ObjectInfo{Key: key, Size: info.Size, ModTime: info.LastModified}, nil
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	listPrefix := s.prefix
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		listPrefix += prefix + "/"
+	}
+
+	objects := make([]ObjectInfo, 0)
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: listPrefix}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		// Without Recursive, deeper paths come back as common prefixes.
+		if strings.HasSuffix(object.Key, "/") {
+			continue
+		}
+		objects = append(objects, ObjectInfo{
+			Key:     strings.TrimPrefix(object.Key, s.prefix),
+			Size:    object.Size,
+			ModTime: object.LastModified,
+		})
+	}
+	return objects, nil
+}
+
+// Rename copies the object server side and then removes the original, as S3
+// has no move operation.
+func (s *S3) Rename(ctx context.Context, from, to string) error {
+	if _, err := s.Stat(ctx, to); err == nil {
+		return ErrExist
+	} else if !errors.Is(err, ErrNotExist) {
+		return err
+	}
+
+	info, err := s.Stat(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	dst := minio.CopyDestOptions{Bucket: s.bucket, Object: s.object(to)}
+	src := minio.CopySrcOptions{Bucket: s.bucket, Object: s.object(from)}
+	// A single copy request is limited to 5 GiB, larger objects are copied
+	// in parts.
+	if info.Size <= maxCopySize {
+		_, err = s.client.CopyObject(ctx, dst, src)
+	} else {
+		_, err = s.client.ComposeObject(ctx, dst, src)
+	}
+	if err != nil {
+		return s3Error(err)
+	}
+
+	if err := s.client.RemoveObject(ctx, s.bucket, s.object(from), minio.RemoveObjectOptions{}); err != nil {
+		_ = s.client.RemoveObject(ctx, s.bucket, s.object(to), minio.RemoveObjectOptions{})
+		return err
+	}
+	return nil
+}
+
+func s3Error(err error) error {
+	response := minio.ToErrorResponse(err)
+	switch {
+	case response.Code == "NoSuchKey", response.StatusCode == http.StatusNotFound && response.Code != "NoSuchBucket":
+		return fmt.Errorf("%w: %s", ErrNotExist, response.Key)
+	case response.StatusCode == http.StatusPreconditionFailed:
+		return fmt.Errorf("%w: %s", ErrExist, response.Key)
+	}
+	return err
+}
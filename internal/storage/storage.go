@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotExist = errors.New("object does not exist")
+	ErrExist    = errors.New("object already exists")
+)
+
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Backend stores archive files. Keys are slash separated paths relative to
+// the archive root, such as "example.wacz" or ".trash/<id>.wacz".
+type Backend interface {
+	// Put stores a new object and fails with ErrExist if the key is taken.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get reads length bytes starting at offset. A negative length reads to
+	// the end of the object.
+	Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// Delete removes an object. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// List returns the objects directly under prefix, without descending
+	// into deeper paths.
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// Rename moves an object to a new key and fails with ErrExist if the
+	// destination is taken.
+	Rename(ctx context.Context, from, to string) error
+}
+
+// FromEnv builds the backend selected by STORAGE_BACKEND, defaulting to the
+// local ARCHIVES_DIR.
+func FromEnv() (Backend, error) {
+	switch backend := strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_BACKEND"))); backend {
+	case "", "local":
+		dir := os.Getenv("ARCHIVES_DIR")
+		if dir == "" {
+			return nil, errors.New("environment variable ARCHIVES_DIR not set")
+		}
+		return NewLocal(dir), nil
+	case "s3":
+		config := S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			Prefix:          os.Getenv("S3_PREFIX"),
+			Region:          os.Getenv("S3_REGION"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			UseSSL:          true,
+		}
+		if value := os.Getenv("S3_USE_SSL"); value != "" {
+			useSSL, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid S3_USE_SSL: %w", err)
+			}
+			config.UseSSL = useSSL
+		}
+		return NewS3(config)
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", backend)
+	}
+}
@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+func TestLocal(t *testing.T) {
+	testBackend(t, NewLocal(t.TempDir()))
+}
+
+// TestS3 runs against a real S3-compatible server, for example a local MinIO:
+//
+//	S3_TEST_ENDPOINT=localhost:9000 S3_TEST_ACCESS_KEY_ID=minioadmin \
+//	S3_TEST_SECRET_ACCESS_KEY=minioadmin go test ./internal/storage
+func TestS3(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT not set")
+	}
+
+	config := S3Config{
+		Endpoint:        endpoint,
+		Bucket:          "archiver-test-" + uuid.NewString()[:8],
+		Prefix:          "archives",
+		AccessKeyID:     os.Getenv("S3_TEST_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("S3_TEST_SECRET_ACCESS_KEY"),
+	}
+	ctx := context.Background()
+	client, err := minio.New(endpoint, &minio.Options{Creds: credentials.NewStaticV4(config.AccessKeyID, config.SecretAccessKey, "")})
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	if err := client.MakeBucket(ctx, config.Bucket, minio.MakeBucketOptions{}); err != nil {
+		t.Fatalf("create bucket: %v", err)
+	}
+	t.Cleanup(func() {
+		for object := range client.ListObjects(ctx, config.Bucket, minio.ListObjectsOptions{Recursive: true}) {
+			_ = client.RemoveObject(ctx, config.Bucket, object.Key, minio.RemoveObjectOptions{})
+		}
+		_ = client.RemoveBucket(ctx, config.Bucket)
+	})
+
+	backend, err := NewS3(config)
+	if err != nil {
+		t.Fatalf("NewS3: %v", err)
+	}
+	testBackend(t, backend)
+}
+
+func testBackend(t *testing.T, backend Backend) {
+	ctx := context.Background()
+
+	put := func(key, content string) error {
+		return backend.Put(ctx, key, strings.NewReader(content), int64(len(content)))
+	}
+	read := func(key string, offset, length int64) string {
+		t.Helper()
+		body, err := backend.Get(ctx, key, offset, length)
+		if err != nil {
+			t.Fatalf("Get(%q, %d, %d): %v", key, offset, length, err)
+		}
+		defer body.Close()
+		data, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatalf("read %q: %v", key, err)
+		}
+		return string(data)
+	}
+
+	if err := put("first.wacz", "0123456789"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := put("first.wacz", "other"); !errors.Is(err, ErrExist) {
+		t.Fatalf("Put over existing key error = %v, want ErrExist", err)
+	}
+	if err := put("second.wacz", "abc"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	if got := read("first.wacz", 0, -1); got != "0123456789" {
+		t.Fatalf("full read = %q", got)
+	}
+	if got := read("first.wacz", 3, 4); got != "3456" {
+		t.Fatalf("ranged read = %q", got)
+	}
+	if got := read("first.wacz", 7, -1); got != "789" {
+		t.Fatalf("read to end = %q", got)
+	}
+	if _, err := backend.Get(ctx, "missing.wacz", 0, -1); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("Get missing error = %v, want ErrNotExist", err)
+	}
+
+	info, err := backend.Stat(ctx, "first.wacz")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Key != "first.wacz" || info.Size != 10 || info.ModTime.IsZero() {
+		t.Fatalf("unexpected info: %#v", info)
+	}
+	if _, err := backend.Stat(ctx, "missing.wacz"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("Stat missing error = %v, want ErrNotExist", err)
+	}
+
+	if err := backend.Rename(ctx, "second.wacz", ".trash/second.wacz"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if err := backend.Rename(ctx, ".trash/second.wacz", "first.wacz"); !errors.Is(err, ErrExist) {
+		t.Fatalf("Rename onto existing key error = %v, want ErrExist", err)
+	}
+	if got := read(".trash/second.wacz", 0, -1); got != "abc" {
+		t.Fatalf("renamed content = %q", got)
+	}
+
+	objects, err := backend.List(ctx, "")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if keys := objectKeys(objects); strings.Join(keys, ",") != "first.wacz" {
+		t.Fatalf("List root = %v", keys)
+	}
+	objects, err = backend.List(ctx, ".trash")
+	if err != nil {
+		t.Fatalf("List trash: %v", err)
+	}
+	if keys := objectKeys(objects); strings.Join(keys, ",") != ".trash/second.wacz" {
+		t.Fatalf("List trash = %v", keys)
+	}
+
+	if err := backend.Delete(ctx, "first.wacz"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := backend.Delete(ctx, "first.wacz"); err != nil {
+		t.Fatalf("Delete missing: %v", err)
+	}
+	if _, err := backend.Stat(ctx, "first.wacz"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("Stat deleted error = %v, want ErrNotExist", err)
+	}
+}
+
+func objectKeys(objects []ObjectInfo) []string {
+	keys := make([]string, 0, len(objects))
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// remote hides the Local type so helpers take their generic code paths.
+type remote struct {
+	Backend
+}
+
+func TestReadSeekerServesRanges(t *testing.T) {
+	backend := remote{NewLocal(t.TempDir())}
+	ctx := context.Background()
+	content := "0123456789abcdef"
+	if err := backend.Put(ctx, "archive.wacz", strings.NewReader(content), int64(len(content))); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/archive.wacz", nil)
+	request.Header.Set("Range", "bytes=4-9")
+	recorder := httptest.NewRecorder()
+	rs := NewReadSeeker(ctx, backend, "archive.wacz", int64(len(content)))
+	defer rs.Close()
+	http.ServeContent(recorder, request, "archive.wacz", time.Now(), rs)
+
+	if recorder.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusPartialContent)
+	}
+	if got := recorder.Body.String(); got != "456789" {
+		t.Fatalf("body = %q", got)
+	}
+}
+
+func TestOpenReaderAtFetchesRemoteChunks(t *testing.T) {
+	backend := remote{NewLocal(t.TempDir())}
+	ctx := context.Background()
+	content := strings.Repeat("x", readAtChunkSize) + "tail"
+	if err := backend.Put(ctx, "archive.wacz", strings.NewReader(content), int64(len(content))); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	r, size, err := OpenReaderAt(ctx, backend, "archive.wacz")
+	if err != nil {
+		t.Fatalf("OpenReaderAt: %v", err)
+	}
+	defer r.Close()
+	if size != int64(len(content)) {
+		t.Fatalf("size = %d", size)
+	}
+
+	p := make([]byte, 6)
+	if _, err := r.ReadAt(p, int64(readAtChunkSize)-2); err != nil {
+		t.Fatalf("ReadAt across chunks: %v", err)
+	}
+	if string(p) != "xxtail" {
+		t.Fatalf("ReadAt = %q", p)
+	}
+	if n, err := r.ReadAt(p, size-2); n != 2 || err != io.EOF {
+		t.Fatalf("ReadAt past end = %d, %v", n, err)
+	}
+}
@@ -3,20 +3,19 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/JuanSaenz04/archiver/internal/models"
 	"github.com/google/uuid"
-	"modernc.org/sqlite"
-	sqlite3 "modernc.org/sqlite/lib"
 )
 
 var ErrArchiveNotFound = errors.New("archive not found")
 var ErrArchiveFilenameConflict = errors.New("archive filename conflict")
+var ErrArchiveReferenced = errors.New("archive is referenced by deduplicated archives")
+var ErrReferencedArchiveTrashed = errors.New("archive replays payloads of trashed archives")
 
 type ArchiveCursor struct {
 	CreatedAt time.Time
@@ -26,10 +25,21 @@ type ArchiveCursor struct {
 type ListArchivesOptions struct {
 	Limit         int
 	Cursor        *ArchiveCursor
+	IDs           []uuid.UUID
 	Tags          []string
 	Search        string
+	Subject       string
+	ContentHash   string
 	CreatedFrom   *time.Time
 	CreatedBefore *time.Time
+	// Viewer, when set, limits results to the archives that user may see:
+	// their own, shared and public ones.
+	Viewer *uuid.UUID
+	// Owner, when set, limits results to the archives owned by that user.
+	Owner *uuid.UUID
+	// Trashed lists archives in the trash instead of live ones.
+	Trashed       bool
+	DeletedBefore *time.Time
 }
 
 type ArchivePage struct {
@@ -37,59 +47,7 @@ type ArchivePage struct {
 	NextCursor *ArchiveCursor
 }
 
-func (s *ArchiveStore) SyncFromDisk(ctx context.Context, archivesDir string) error {
-	files, err := os.ReadDir(archivesDir)
-	if err != nil {
-		return err
-	}
-
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
-	const insertArchiveQuery = `
-INSERT OR IGNORE INTO archives (id, name, filename, description, source_url, created_at, size_bytes)
-VALUES (?, ?, ?, '', '', ?, ?);
-`
-
-	stmt, err := tx.PrepareContext(ctx, insertArchiveQuery)
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
-
-	for _, file := range files {
-		if err := ctx.Err(); err != nil {
-			return err
-		}
-
-		if file.IsDir() || !strings.EqualFold(filepath.Ext(file.Name()), ".wacz") {
-			continue
-		}
-
-		fileInfo, err := file.Info()
-		if err != nil {
-			return err
-		}
-
-		if _, err := stmt.ExecContext(
-			ctx,
-			uuid.New(),
-			strings.TrimSuffix(file.Name(), filepath.Ext(file.Name())),
-			file.Name(),
-			fileInfo.ModTime(),
-			fileInfo.Size(),
-		); err != nil {
-			return err
-		}
-	}
-
-	return tx.Commit()
-}
-
-func (s *ArchiveStore) List(ctx context.Context) ([]models.Archive, error) {
+func (s *sqlStore) List(ctx context.Context) ([]models.Archive, error) {
 	page, err := s.ListArchives(ctx, ListArchivesOptions{})
 	if err != nil {
 		return nil, err
@@ -97,10 +55,42 @@ func (s *ArchiveStore) List(ctx context.Context) ([]models.Archive, error) {
 	return page.Archives, nil
 }
 
-func (s *ArchiveStore) ListArchives(ctx context.Context, options ListArchivesOptions) (ArchivePage, error) {
+func (s *sqlStore) ListArchives(ctx context.Context, options ListArchivesOptions) (ArchivePage, error) {
 	var where []string
 	var args []any
 
+	if len(options.IDs) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(options.IDs)), ",")
+		where = append(where, "a.id IN ("+placeholders+")")
+		for _, id := range options.IDs {
+			args = append(args, id)
+		}
+	}
+	if options.Trashed {
+		where = append(where, "a.deleted_at IS NOT NULL")
+	} else {
+		where = append(where, "a.deleted_at IS NULL")
+	}
+	if options.DeletedBefore != nil {
+		where = append(where, "a.deleted_at < ?")
+		args = append(args, *options.DeletedBefore)
+	}
+	if options.Subject != "" {
+		where = append(where, "a.subject = ?")
+		args = append(args, options.Subject)
+	}
+	if options.ContentHash != "" {
+		where = append(where, "a.content_hash = ?")
+		args = append(args, options.ContentHash)
+	}
+	if options.Viewer != nil {
+		where = append(where, "(a.visibility <> 'private' OR a.owner_id = ?)")
+		args = append(args, *options.Viewer)
+	}
+	if options.Owner != nil {
+		where = append(where, "a.owner_id = ?")
+		args = append(args, *options.Owner)
+	}
 	if options.CreatedFrom != nil {
 		where = append(where, "a.created_at >= ?")
 		args = append(args, *options.CreatedFrom)
@@ -127,16 +117,14 @@ func (s *ArchiveStore) ListArchives(ctx context.Context, options ListArchivesOpt
 		args = append(args, len(options.Tags))
 	}
 	if options.Search != "" {
-		where = append(where, `a.rowid IN (
-			SELECT rowid FROM archive_search
-			WHERE archive_search MATCH ?
-		)`)
-		args = append(args, archiveSearchQuery(options.Search))
+		condition, searchArgs := s.dialect.searchCondition(options.Search)
+		where = append(where, condition)
+		args = append(args, searchArgs...)
 	}
 
 	query := `
 WITH filtered_archives AS (
-	SELECT a.id, a.name, a.filename, a.description, a.source_url, a.created_at, a.size_bytes
+	SELECT a.id, a.name, a.filename, a.description, a.source_url, a.subject, a.created_at, a.size_bytes, a.dedup_saved_bytes, a.content_hash, a.software, a.crawl_options, a.deleted_at, a.missing_at, a.owner_id, a.visibility
 	FROM archives a`
 	if len(where) > 0 {
 		query += "\n\tWHERE " + strings.Join(where, " AND ")
@@ -148,8 +136,9 @@ WITH filtered_archives AS (
 	}
 	query += `
 )
-SELECT a.id, a.name, a.filename, a.description, a.source_url, a.created_at, a.size_bytes, t.tag
+SELECT a.id, a.name, a.filename, a.description, a.source_url, a.subject, a.created_at, a.size_bytes, a.dedup_saved_bytes, a.content_hash, a.software, a.crawl_options, a.deleted_at, a.missing_at, a.owner_id, a.visibility, u.username, t.tag
 FROM filtered_archives a
+LEFT JOIN users u ON u.id = a.owner_id
 LEFT JOIN tags t ON t.archive_id = a.id
 ORDER BY a.created_at DESC, a.id DESC, t.tag ASC;
 `
@@ -165,14 +154,18 @@ ORDER BY a.created_at DESC, a.id DESC, t.tag ASC;
 
 	for rows.Next() {
 		var (
-			id                                     uuid.UUID
-			name, filename, description, sourceURL string
-			tag                                    sql.NullString
-			createdAt                              time.Time
-			sizeBytes                              int64
+			id                                              uuid.UUID
+			name, filename, description, sourceURL, subject string
+			contentHash, crawlOptions                       string
+			visibility                                      models.Visibility
+			software, owner, tag                            sql.NullString
+			ownerId                                         uuid.NullUUID
+			createdAt                                       time.Time
+			deletedAt, missingAt                            sql.NullTime
+			sizeBytes, dedupSavedBytes                      int64
 		)
 
-		if err := rows.Scan(&id, &name, &filename, &description, &sourceURL, &createdAt, &sizeBytes, &tag); err != nil {
+		if err := rows.Scan(&id, &name, &filename, &description, &sourceURL, &subject, &createdAt, &sizeBytes, &dedupSavedBytes, &contentHash, &software, &crawlOptions, &deletedAt, &missingAt, &ownerId, &visibility, &owner, &tag); err != nil {
 			return ArchivePage{}, err
 		}
 
@@ -181,15 +174,37 @@ ORDER BY a.created_at DESC, a.id DESC, t.tag ASC;
 				archives[index].Tags = append(archives[index].Tags, tag.String)
 			}
 		} else {
+			options, err := decodeCrawlOptions(crawlOptions)
+			if err != nil {
+				return ArchivePage{}, err
+			}
 			archive := models.Archive{
-				ID:          id,
-				Name:        name,
-				Filename:    filename,
-				Description: description,
-				SourceURL:   sourceURL,
-				Tags:        make([]string, 0),
-				CreatedAt:   createdAt,
-				SizeBytes:   sizeBytes,
+				ID:              id,
+				Name:            name,
+				Filename:        filename,
+				Description:     description,
+				SourceURL:       sourceURL,
+				Subject:         subject,
+				Tags:            make([]string, 0),
+				CreatedAt:       createdAt.UTC(),
+				SizeBytes:       sizeBytes,
+				DedupSavedBytes: dedupSavedBytes,
+				ContentHash:     contentHash,
+				Software:        software.String,
+				CrawlOptions:    options,
+				Visibility:      visibility,
+			}
+			if deletedAt.Valid {
+				deletedAt := deletedAt.Time.UTC()
+				archive.DeletedAt = &deletedAt
+			}
+			if missingAt.Valid {
+				missingAt := missingAt.Time.UTC()
+				archive.MissingAt = &missingAt
+			}
+			if ownerId.Valid {
+				archive.OwnerID = &ownerId.UUID
+				archive.Owner = owner.String
 			}
 			if tag.Valid {
 				archive.Tags = append(archive.Tags, tag.String)
@@ -214,8 +229,33 @@ ORDER BY a.created_at DESC, a.id DESC, t.tag ASC;
 	return page, nil
 }
 
-func (s *ArchiveStore) ListTags(ctx context.Context) ([]string, error) {
-	rows, err := s.db.QueryContext(ctx, "SELECT DISTINCT tag FROM tags ORDER BY tag;")
+func (s *sqlStore) Get(ctx context.Context, archiveId uuid.UUID) (models.Archive, error) {
+	page, err := s.ListArchives(ctx, ListArchivesOptions{IDs: []uuid.UUID{archiveId}})
+	if err != nil {
+		return models.Archive{}, err
+	}
+	if len(page.Archives) == 0 {
+		return models.Archive{}, ErrArchiveNotFound
+	}
+	return page.Archives[0], nil
+}
+
+// ListTags returns the tags of live archives. With viewer set, only the
+// archives that user may see count.
+func (s *sqlStore) ListTags(ctx context.Context, viewer *uuid.UUID) ([]string, error) {
+	query := `
+SELECT DISTINCT t.tag
+FROM tags t
+JOIN archives a ON a.id = t.archive_id
+WHERE a.deleted_at IS NULL`
+	var args []any
+	if viewer != nil {
+		query += " AND (a.visibility <> 'private' OR a.owner_id = ?)"
+		args = append(args, *viewer)
+	}
+	query += " ORDER BY t.tag;"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -232,26 +272,124 @@ func (s *ArchiveStore) ListTags(ctx context.Context) ([]string, error) {
 	return tags, rows.Err()
 }
 
+func encodeCrawlOptions(options *models.CrawlOptions) (string, error) {
+	if options == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(options)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func decodeCrawlOptions(value string) (*models.CrawlOptions, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var options models.CrawlOptions
+	if err := json.Unmarshal([]byte(value), &options); err != nil {
+		return nil, err
+	}
+	return &options, nil
+}
+
 func archiveSearchQuery(value string) string {
 	return `"` + strings.ReplaceAll(strings.TrimSpace(value), `"`, `""`) + `" *`
 }
 
-func (s *ArchiveStore) Insert(ctx context.Context, a models.Archive) error {
+func (s *sqlStore) Insert(ctx context.Context, a models.Archive) error {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
+	if err := insertArchive(ctx, tx, a); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReplaceSynced records a in place of the live archive a storage sync
+// registered for the same file before its completion was recorded. It
+// returns ErrArchiveFilenameConflict unless that archive has the content
+// hash of a, and ErrArchiveReferenced when other archives replay it.
+func (s *sqlStore) ReplaceSynced(ctx context.Context, a models.Archive) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const existingQuery = `
+SELECT id, content_hash
+FROM archives
+WHERE filename = ? AND deleted_at IS NULL;
+	`
+
+	var existingId uuid.UUID
+	var contentHash string
+	if err := tx.QueryRowContext(ctx, existingQuery, a.Filename).Scan(&existingId, &contentHash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrArchiveNotFound
+		}
+		return err
+	}
+	if a.ContentHash == "" || contentHash != a.ContentHash {
+		return ErrArchiveFilenameConflict
+	}
+
+	const referencedQuery = `
+SELECT EXISTS (
+	SELECT 1 FROM archive_references
+	WHERE referenced_archive_id = ?
+);
+	`
+
+	var referenced bool
+	if err := tx.QueryRowContext(ctx, referencedQuery, existingId).Scan(&referenced); err != nil {
+		return err
+	}
+	if referenced {
+		return ErrArchiveReferenced
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM archives WHERE id = ?;", existingId); err != nil {
+		return err
+	}
+	if err := insertArchive(ctx, tx, a); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertArchive(ctx context.Context, tx *sqlTx, a models.Archive) error {
+	crawlOptions, err := encodeCrawlOptions(a.CrawlOptions)
+	if err != nil {
+		return err
+	}
+
+	var ownerId uuid.NullUUID
+	if a.OwnerID != nil {
+		ownerId = uuid.NullUUID{UUID: *a.OwnerID, Valid: true}
+	}
+	visibility := a.Visibility
+	if visibility == "" {
+		visibility = models.VisibilityShared
+	}
+	// Without a known crawler the row is left for storage syncs to read.
+	software := sql.NullString{String: a.Software, Valid: a.Software != ""}
+
 	archiveQuery := `
-INSERT INTO archives (id, name, filename, description, source_url, created_at, size_bytes) VALUES (?, ?, ?, ?, ?, ?, ?);
+INSERT INTO archives (id, name, filename, description, source_url, subject, created_at, size_bytes, dedup_saved_bytes, content_hash, software, crawl_options, owner_id, visibility) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
 	`
-	archiveArgs := []any{a.ID, a.Name, a.Filename, a.Description, a.SourceURL, a.CreatedAt, a.SizeBytes}
+	archiveArgs := []any{a.ID, a.Name, a.Filename, a.Description, a.SourceURL, a.Subject, a.CreatedAt, a.SizeBytes, a.DedupSavedBytes, a.ContentHash, software, crawlOptions, ownerId, visibility}
 	if a.CreatedAt.IsZero() {
 		archiveQuery = `
-INSERT INTO archives (id, name, filename, description, source_url, size_bytes) VALUES (?, ?, ?, ?, ?, ?);
+INSERT INTO archives (id, name, filename, description, source_url, subject, size_bytes, dedup_saved_bytes, content_hash, software, crawl_options, owner_id, visibility) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
 		`
-		archiveArgs = []any{a.ID, a.Name, a.Filename, a.Description, a.SourceURL, a.SizeBytes}
+		archiveArgs = []any{a.ID, a.Name, a.Filename, a.Description, a.SourceURL, a.Subject, a.SizeBytes, a.DedupSavedBytes, a.ContentHash, software, crawlOptions, ownerId, visibility}
 	}
 
 	if _, err := tx.ExecContext(ctx, archiveQuery, archiveArgs...); err != nil {
@@ -271,11 +409,21 @@ INSERT INTO tags (archive_id, tag) VALUES (?, ?)
 			return err
 		}
 	}
+	return nil
+}
 
-	return tx.Commit()
+func (s *sqlStore) UpdateVisibility(ctx context.Context, archiveId uuid.UUID, visibility models.Visibility) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE archives SET visibility = ? WHERE id = ? AND deleted_at IS NULL;", visibility, archiveId)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrArchiveNotFound
+	}
+	return nil
 }
 
-func (s *ArchiveStore) UpdateMetadata(ctx context.Context, archiveId uuid.UUID, newName, description string, tags []string) error {
+func (s *sqlStore) UpdateMetadata(ctx context.Context, archiveId uuid.UUID, newName, description string, tags []string) error {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
@@ -284,7 +432,7 @@ func (s *ArchiveStore) UpdateMetadata(ctx context.Context, archiveId uuid.UUID,
 
 	const renameQuery = `
 UPDATE archives SET name = ?
-WHERE id = ?;
+WHERE id = ? AND deleted_at IS NULL;
 		`
 
 	if res, err := tx.ExecContext(ctx, renameQuery, newName, archiveId); err != nil {
@@ -337,13 +485,34 @@ INSERT INTO tags (archive_id, tag) VALUES (?, ?);
 	return tx.Commit()
 }
 
-func (s *ArchiveStore) Delete(ctx context.Context, archiveId uuid.UUID) error {
+func (s *sqlStore) Delete(ctx context.Context, archiveId uuid.UUID) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const referencedQuery = `
+SELECT EXISTS (
+	SELECT 1 FROM archive_references
+	WHERE referenced_archive_id = ?
+);
+	`
+
+	var referenced bool
+	if err := tx.QueryRowContext(ctx, referencedQuery, archiveId).Scan(&referenced); err != nil {
+		return err
+	}
+	if referenced {
+		return ErrArchiveReferenced
+	}
+
 	const deleteQuery = `
 DELETE FROM archives
 WHERE id = ?;
 	`
 
-	if res, err := s.db.ExecContext(ctx, deleteQuery, archiveId); err != nil {
+	if res, err := tx.ExecContext(ctx, deleteQuery, archiveId); err != nil {
 		return err
 	} else {
 		n, _ := res.RowsAffected()
@@ -352,14 +521,112 @@ WHERE id = ?;
 		}
 	}
 
-	return nil
+	return tx.Commit()
+}
+
+// Trash flags a live archive as deleted. Archives whose payloads are
+// replayed by other live archives cannot be trashed.
+func (s *sqlStore) Trash(ctx context.Context, archiveId uuid.UUID, deletedAt time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const referencedQuery = `
+SELECT EXISTS (
+	SELECT 1 FROM archive_references r
+	JOIN archives a ON a.id = r.archive_id
+	WHERE r.referenced_archive_id = ? AND a.deleted_at IS NULL
+);
+	`
+
+	var referenced bool
+	if err := tx.QueryRowContext(ctx, referencedQuery, archiveId).Scan(&referenced); err != nil {
+		return err
+	}
+	if referenced {
+		return ErrArchiveReferenced
+	}
+
+	const trashQuery = `
+UPDATE archives SET deleted_at = ?
+WHERE id = ? AND deleted_at IS NULL;
+	`
+
+	if res, err := tx.ExecContext(ctx, trashQuery, deletedAt, archiveId); err != nil {
+		return err
+	} else {
+		n, _ := res.RowsAffected()
+		if n == 0 {
+			return ErrArchiveNotFound
+		}
+	}
+
+	return tx.Commit()
 }
 
-func (s *ArchiveStore) GetFilename(ctx context.Context, archiveId uuid.UUID) (string, error) {
+// Restore brings a trashed archive back. Deduplicated archives can only be
+// restored once the archives whose payloads they replay are live.
+func (s *sqlStore) Restore(ctx context.Context, archiveId uuid.UUID) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const trashedReferenceQuery = `
+SELECT EXISTS (
+	SELECT 1 FROM archive_references r
+	JOIN archives a ON a.id = r.referenced_archive_id
+	WHERE r.archive_id = ? AND a.deleted_at IS NOT NULL
+);
+	`
+
+	var trashed bool
+	if err := tx.QueryRowContext(ctx, trashedReferenceQuery, archiveId).Scan(&trashed); err != nil {
+		return err
+	}
+	if trashed {
+		return ErrReferencedArchiveTrashed
+	}
+
+	const restoreQuery = `
+UPDATE archives SET deleted_at = NULL
+WHERE id = ? AND deleted_at IS NOT NULL;
+	`
+
+	if res, err := tx.ExecContext(ctx, restoreQuery, archiveId); err != nil {
+		if isUniqueConstraint(err) {
+			return ErrArchiveFilenameConflict
+		}
+		return err
+	} else {
+		n, _ := res.RowsAffected()
+		if n == 0 {
+			return ErrArchiveNotFound
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) GetTrashed(ctx context.Context, archiveId uuid.UUID) (models.Archive, error) {
+	page, err := s.ListArchives(ctx, ListArchivesOptions{IDs: []uuid.UUID{archiveId}, Trashed: true})
+	if err != nil {
+		return models.Archive{}, err
+	}
+	if len(page.Archives) == 0 {
+		return models.Archive{}, ErrArchiveNotFound
+	}
+	return page.Archives[0], nil
+}
+
+func (s *sqlStore) GetFilename(ctx context.Context, archiveId uuid.UUID) (string, error) {
 	const getFilenameQuery = `
 SELECT filename
 FROM archives
-WHERE id = ?;
+WHERE id = ? AND deleted_at IS NULL;
 	`
 
 	row := s.db.QueryRowContext(ctx, getFilenameQuery, archiveId)
@@ -375,20 +642,3 @@ WHERE id = ?;
 
 	return filename, nil
 }
-
-func isUniqueConstraint(err error) bool {
-	var sqlErr *sqlite.Error
-	if !errors.As(err, &sqlErr) {
-		return false
-	}
-
-	if sqlErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
-		return true
-	}
-
-	if sqlErr.Code() == sqlite3.SQLITE_CONSTRAINT {
-		return true
-	}
-
-	return false
-}
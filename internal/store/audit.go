@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/google/uuid"
+)
+
+// AuditQuery filters the audit log. Entries come newest first, starting
+// below BeforeID when it is set.
+type AuditQuery struct {
+	Actor    string
+	Action   string
+	TargetID string
+	Since    *time.Time
+	BeforeID int64
+	Limit    int
+}
+
+func (s *sqlStore) InsertAuditEntry(ctx context.Context, entry models.AuditEntry) error {
+	const query = `
+INSERT INTO audit_log (created_at, actor_id, actor, token_id, client_ip, action, target_id, before_state, after_state)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);
+	`
+
+	var actorId, tokenId uuid.NullUUID
+	if entry.ActorID != nil {
+		actorId = uuid.NullUUID{UUID: *entry.ActorID, Valid: true}
+	}
+	if entry.TokenID != nil {
+		tokenId = uuid.NullUUID{UUID: *entry.TokenID, Valid: true}
+	}
+	_, err := s.db.ExecContext(ctx, query, entry.CreatedAt.UTC(), actorId, entry.Actor, tokenId, entry.ClientIP, entry.Action, entry.TargetID, nullJSON(entry.Before), nullJSON(entry.After))
+	return err
+}
+
+func (s *sqlStore) ListAuditEntries(ctx context.Context, q AuditQuery) ([]models.AuditEntry, error) {
+	var (
+		conditions []string
+		args       []any
+	)
+	if q.Actor != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, q.Actor)
+	}
+	if q.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, q.Action)
+	}
+	if q.TargetID != "" {
+		conditions = append(conditions, "target_id = ?")
+		args = append(args, q.TargetID)
+	}
+	if q.Since != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, q.Since.UTC())
+	}
+	if q.BeforeID > 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, q.BeforeID)
+	}
+
+	query := `
+SELECT id, created_at, actor_id, actor, token_id, client_ip, action, target_id, before_state, after_state
+FROM audit_log
+	`
+	if len(conditions) > 0 {
+		query += "WHERE " + strings.Join(conditions, " AND ") + "\n"
+	}
+	query += "ORDER BY id DESC"
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query+";", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]models.AuditEntry, 0)
+	for rows.Next() {
+		var (
+			entry         models.AuditEntry
+			actorId       uuid.NullUUID
+			tokenId       uuid.NullUUID
+			before, after sql.NullString
+		)
+		if err := rows.Scan(&entry.ID, &entry.CreatedAt, &actorId, &entry.Actor, &tokenId, &entry.ClientIP, &entry.Action, &entry.TargetID, &before, &after); err != nil {
+			return nil, err
+		}
+		entry.CreatedAt = entry.CreatedAt.UTC()
+		if actorId.Valid {
+			entry.ActorID = &actorId.UUID
+		}
+		if tokenId.Valid {
+			entry.TokenID = &tokenId.UUID
+		}
+		if before.Valid {
+			entry.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			entry.After = json.RawMessage(after.String)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func nullJSON(value json.RawMessage) sql.NullString {
+	if len(value) == 0 {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(value), Valid: true}
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestAuditLog(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		now := time.Now().UTC().Truncate(time.Second)
+		actorId := uuid.New()
+
+		entries := []models.AuditEntry{
+			{CreatedAt: now.Add(-time.Hour), Actor: "alice", ActorID: &actorId, ClientIP: "192.0.2.1", Action: "job.create", TargetID: "job", After: json.RawMessage(`{"url":"https://example.com"}`)},
+			{CreatedAt: now, Actor: "alice", ActorID: &actorId, ClientIP: "192.0.2.1", Action: "archive.update", TargetID: "archive", Before: json.RawMessage(`{"name":"old"}`), After: json.RawMessage(`{"name":"new"}`)},
+			{CreatedAt: now, Actor: "bob", ClientIP: "192.0.2.2", Action: "archive.delete", TargetID: "archive", Before: json.RawMessage(`{"name":"new"}`)},
+		}
+		for _, entry := range entries {
+			if err := s.InsertAuditEntry(ctx, entry); err != nil {
+				t.Fatalf("insert audit entry: %v", err)
+			}
+		}
+
+		all, err := s.ListAuditEntries(ctx, AuditQuery{})
+		if err != nil {
+			t.Fatalf("list audit entries: %v", err)
+		}
+		if len(all) != 3 || all[0].Action != "archive.delete" || all[2].Action != "job.create" {
+			t.Fatalf("expected entries newest first, got %+v", all)
+		}
+		if all[0].ActorID != nil || all[0].After != nil || string(all[0].Before) != `{"name":"new"}` {
+			t.Fatalf("unexpected entry: %+v", all[0])
+		}
+		if all[1].ActorID == nil || *all[1].ActorID != actorId || all[1].ClientIP != "192.0.2.1" {
+			t.Fatalf("unexpected entry: %+v", all[1])
+		}
+
+		filtered, err := s.ListAuditEntries(ctx, AuditQuery{Actor: "alice", TargetID: "archive"})
+		if err != nil {
+			t.Fatalf("list audit entries: %v", err)
+		}
+		if len(filtered) != 1 || filtered[0].Action != "archive.update" {
+			t.Fatalf("expected the update by alice, got %+v", filtered)
+		}
+
+		page, err := s.ListAuditEntries(ctx, AuditQuery{BeforeID: all[0].ID, Limit: 1})
+		if err != nil {
+			t.Fatalf("list audit entries: %v", err)
+		}
+		if len(page) != 1 || page[0].ID != all[1].ID {
+			t.Fatalf("expected the entry after the cursor, got %+v", page)
+		}
+
+		since := now.Add(-time.Minute)
+		recent, err := s.ListAuditEntries(ctx, AuditQuery{Since: &since})
+		if err != nil {
+			t.Fatalf("list audit entries: %v", err)
+		}
+		if len(recent) != 2 {
+			t.Fatalf("expected 2 recent entries, got %d", len(recent))
+		}
+
+		if _, err := s.db.ExecContext(ctx, "UPDATE audit_log SET actor = 'mallory';"); err == nil {
+			t.Fatal("expected audit entries not to be updatable")
+		}
+		if _, err := s.db.ExecContext(ctx, "DELETE FROM audit_log;"); err == nil {
+			t.Fatal("expected audit entries not to be deletable")
+		}
+	})
+}
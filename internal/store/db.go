@@ -0,0 +1,209 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqlStore holds the queries shared by the SQLite and PostgreSQL stores.
+// They are written for SQLite, with "?" placeholders, and only the few
+// statements the databases disagree on go through the dialect.
+type sqlStore struct {
+	db      *sqlDB
+	dialect dialect
+	// syncMu serializes storage syncs of this process.
+	syncMu *sync.Mutex
+}
+
+func newSQLStore(db *sql.DB, d dialect) sqlStore {
+	return sqlStore{
+		db:      &sqlDB{DB: db, dialect: d},
+		dialect: d,
+		syncMu:  &sync.Mutex{},
+	}
+}
+
+type dialect interface {
+	// bind rewrites "?" placeholders into the driver's syntax.
+	bind(query string) string
+	// searchCondition restricts archives, aliased as "a", to those matching
+	// a free text search.
+	searchCondition(search string) (string, []any)
+	// month formats a timestamp column as YYYY-MM.
+	month(column string) string
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) bind(query string) string {
+	return query
+}
+
+func (sqliteDialect) searchCondition(search string) (string, []any) {
+	return `a.rowid IN (
+			SELECT rowid FROM archive_search
+			WHERE archive_search MATCH ?
+		)`, []any{archiveSearchQuery(search)}
+}
+
+// month relies on created_at being stored both by SQLite defaults and by
+// the driver, which use different layouts that share the leading YYYY-MM.
+func (sqliteDialect) month(column string) string {
+	return "substr(" + column + ", 1, 7)"
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) bind(query string) string {
+	var b strings.Builder
+	b.Grow(len(query) + 16)
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// searchCondition matches the search as a phrase whose last word may be a
+// prefix, like the FTS5 query used on SQLite.
+func (postgresDialect) searchCondition(search string) (string, []any) {
+	words := strings.FieldsFunc(strings.ToLower(search), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		return "FALSE", nil
+	}
+	for i, word := range words {
+		words[i] = "'" + word + "'"
+	}
+	words[len(words)-1] += ":*"
+	return "a.search_vector @@ to_tsquery('simple', unaccent(?))", []any{strings.Join(words, " <-> ")}
+}
+
+func (postgresDialect) month(column string) string {
+	return "to_char(" + column + " AT TIME ZONE 'UTC', 'YYYY-MM')"
+}
+
+// sqlDB and sqlTx bind the placeholders of every query they run.
+type sqlDB struct {
+	*sql.DB
+	dialect dialect
+}
+
+func (db *sqlDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return db.DB.ExecContext(ctx, db.dialect.bind(query), args...)
+}
+
+func (db *sqlDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return db.DB.QueryContext(ctx, db.dialect.bind(query), args...)
+}
+
+func (db *sqlDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return db.DB.QueryRowContext(ctx, db.dialect.bind(query), args...)
+}
+
+func (db *sqlDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sqlTx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{Tx: tx, dialect: db.dialect}, nil
+}
+
+type sqlTx struct {
+	*sql.Tx
+	dialect dialect
+}
+
+func (tx *sqlTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return tx.Tx.ExecContext(ctx, tx.dialect.bind(query), args...)
+}
+
+func (tx *sqlTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return tx.Tx.QueryContext(ctx, tx.dialect.bind(query), args...)
+}
+
+func (tx *sqlTx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return tx.Tx.QueryRowContext(ctx, tx.dialect.bind(query), args...)
+}
+
+func (tx *sqlTx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return tx.Tx.PrepareContext(ctx, tx.dialect.bind(query))
+}
+
+func isUniqueConstraint(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+
+	var sqlErr *sqlite.Error
+	if !errors.As(err, &sqlErr) {
+		return false
+	}
+
+	if sqlErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return true
+	}
+
+	if sqlErr.Code() == sqlite3.SQLITE_CONSTRAINT {
+		return true
+	}
+
+	return false
+}
+
+// IsTransient reports whether err may go away when the statement is retried
+// later, as when the database is locked, restarting or unreachable.
+func IsTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Connection exceptions, insufficient resources and operator
+		// intervention such as a shutdown.
+		for _, class := range []string{"08", "53", "57"} {
+			if strings.HasPrefix(pgErr.Code, class) {
+				return true
+			}
+		}
+		return pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) || pgconn.SafeToRetry(err) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var sqlErr *sqlite.Error
+	if errors.As(err, &sqlErr) {
+		switch sqlErr.Code() & 0xff {
+		case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED, sqlite3.SQLITE_IOERR, sqlite3.SQLITE_FULL:
+			return true
+		}
+	}
+	return false
+}
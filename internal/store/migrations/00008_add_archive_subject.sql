@@ -0,0 +1,7 @@
+ALTER TABLE archives ADD COLUMN subject TEXT NOT NULL DEFAULT '';
+ALTER TABLE archives ADD COLUMN crawl_options TEXT NOT NULL DEFAULT '';
+
+UPDATE archives SET subject = rtrim(source_url, '/') WHERE source_url != '';
+
+CREATE INDEX idx_archives_subject_created_at_id
+ON archives(subject, created_at DESC, id DESC);
@@ -0,0 +1,18 @@
+ALTER TABLE archives ADD COLUMN dedup_saved_bytes INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS payload_digests (
+    digest      TEXT PRIMARY KEY,
+    archive_id  TEXT NOT NULL REFERENCES archives(id) ON DELETE CASCADE,
+    url         TEXT NOT NULL,
+    captured_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_payload_digests_archive_id ON payload_digests(archive_id);
+
+CREATE TABLE IF NOT EXISTS archive_references (
+    archive_id            TEXT NOT NULL REFERENCES archives(id) ON DELETE CASCADE,
+    referenced_archive_id TEXT NOT NULL REFERENCES archives(id) ON DELETE RESTRICT,
+    PRIMARY KEY (archive_id, referenced_archive_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_archive_references_referenced_archive_id ON archive_references(referenced_archive_id);
@@ -0,0 +1,7 @@
+ALTER TABLE archives ADD COLUMN deleted_at DATETIME;
+
+-- Trashed archives release their filename so new captures can reuse it.
+DROP INDEX IF EXISTS idx_archives_filename_unique;
+CREATE UNIQUE INDEX idx_archives_filename_unique ON archives(filename) WHERE deleted_at IS NULL;
+
+CREATE INDEX idx_archives_deleted_at ON archives(deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS retention_rules (
+    id           TEXT     PRIMARY KEY,
+    name         TEXT     NOT NULL,
+    tag          TEXT     NOT NULL DEFAULT '',
+    max_age_days INTEGER  NOT NULL DEFAULT 0,
+    keep_last    INTEGER  NOT NULL DEFAULT 0,
+    hold         INTEGER  NOT NULL DEFAULT 0,
+    dry_run      INTEGER  NOT NULL DEFAULT 1,
+    created_at   DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now'))
+);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS users (
+    id            TEXT     PRIMARY KEY,
+    username      TEXT     NOT NULL UNIQUE,
+    password_hash TEXT     NOT NULL,
+    is_admin      INTEGER  NOT NULL DEFAULT 0,
+    created_at    DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now'))
+);
+
+-- Sessions are looked up by the SHA-256 of their cookie, so a leaked
+-- database does not hand out live sessions.
+CREATE TABLE IF NOT EXISTS sessions (
+    token_hash TEXT     PRIMARY KEY,
+    user_id    TEXT     NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now')),
+    expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX idx_sessions_expires_at ON sessions(expires_at);
@@ -0,0 +1,14 @@
+-- API tokens let scripts call the API without a browser session. Like
+-- sessions, they are stored as the SHA-256 of the token.
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id           TEXT     PRIMARY KEY,
+    name         TEXT     NOT NULL,
+    token_hash   TEXT     NOT NULL UNIQUE,
+    scope        TEXT     NOT NULL CHECK (scope IN ('read', 'crawl', 'admin')),
+    user_id      TEXT     REFERENCES users(id) ON DELETE CASCADE,
+    created_at   DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now')),
+    expires_at   DATETIME,
+    last_used_at DATETIME
+);
+
+CREATE INDEX idx_api_tokens_user_id ON api_tokens(user_id);
@@ -0,0 +1,5 @@
+-- Archives remember who started their crawl. Deleting the user keeps the
+-- archive without an owner.
+ALTER TABLE archives ADD COLUMN owner_id TEXT REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_archives_owner_id ON archives(owner_id);
@@ -0,0 +1,3 @@
+-- Private archives are seen only by their owner, shared ones by every
+-- signed in user, and public ones by anyone who can reach the replay origin.
+ALTER TABLE archives ADD COLUMN visibility TEXT NOT NULL DEFAULT 'shared' CHECK (visibility IN ('private', 'shared', 'public'));
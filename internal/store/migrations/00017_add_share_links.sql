@@ -0,0 +1,13 @@
+-- Share links open one archive on the replay origin without signing in.
+-- The link itself is an HMAC over the row, so only its expiry is stored and
+-- deleting the row revokes it.
+CREATE TABLE IF NOT EXISTS share_links (
+    id         TEXT     PRIMARY KEY,
+    archive_id TEXT     NOT NULL REFERENCES archives(id) ON DELETE CASCADE,
+    name       TEXT     NOT NULL DEFAULT '',
+    created_by TEXT     REFERENCES users(id) ON DELETE SET NULL,
+    created_at DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now')),
+    expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_share_links_archive_id ON share_links(archive_id);
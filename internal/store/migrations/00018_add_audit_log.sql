@@ -0,0 +1,28 @@
+-- The audit log records who changed what. It is append-only, and keeps the
+-- name of the actor once their user is gone.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id           INTEGER  PRIMARY KEY AUTOINCREMENT,
+    created_at   DATETIME NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%SZ','now')),
+    actor_id     TEXT,
+    actor        TEXT     NOT NULL DEFAULT '',
+    token_id     TEXT,
+    client_ip    TEXT     NOT NULL DEFAULT '',
+    action       TEXT     NOT NULL,
+    target_id    TEXT     NOT NULL DEFAULT '',
+    before_state TEXT,
+    after_state  TEXT
+);
+
+CREATE INDEX idx_audit_log_actor ON audit_log(actor);
+CREATE INDEX idx_audit_log_action ON audit_log(action);
+CREATE INDEX idx_audit_log_target_id ON audit_log(target_id);
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
@@ -0,0 +1,4 @@
+-- The crawler that wrote an archive file, read from its datapackage.json.
+-- It stays NULL until a storage sync has read the file, which is how syncs
+-- find the archives whose details still have to be filled in.
+ALTER TABLE archives ADD COLUMN software TEXT;
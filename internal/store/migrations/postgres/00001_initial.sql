@@ -0,0 +1,113 @@
+-- unaccent lets searches ignore diacritics, like SQLite's remove_diacritics.
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+CREATE TABLE archives (
+    id                UUID        PRIMARY KEY,
+    name              TEXT        NOT NULL,
+    filename          TEXT,
+    description       TEXT        NOT NULL DEFAULT '',
+    source_url        TEXT        NOT NULL DEFAULT '',
+    subject           TEXT        NOT NULL DEFAULT '',
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+    size_bytes        BIGINT      NOT NULL DEFAULT 0,
+    dedup_saved_bytes BIGINT      NOT NULL DEFAULT 0,
+    crawl_options     TEXT        NOT NULL DEFAULT '',
+    deleted_at        TIMESTAMPTZ,
+    search_vector     TSVECTOR    NOT NULL DEFAULT ''::tsvector
+);
+
+-- Trashed archives release their filename so new captures can reuse it.
+CREATE UNIQUE INDEX idx_archives_filename_unique ON archives(filename) WHERE deleted_at IS NULL;
+CREATE INDEX idx_archives_created_at_id ON archives(created_at DESC, id DESC);
+CREATE INDEX idx_archives_subject_created_at_id ON archives(subject, created_at DESC, id DESC);
+CREATE INDEX idx_archives_deleted_at ON archives(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_archives_search_vector ON archives USING GIN (search_vector);
+
+CREATE TABLE tags (
+    archive_id UUID NOT NULL REFERENCES archives(id) ON DELETE CASCADE,
+    tag        TEXT NOT NULL,
+    PRIMARY KEY (archive_id, tag)
+);
+
+CREATE INDEX idx_tags_tag ON tags(tag);
+
+CREATE TABLE payload_digests (
+    digest      TEXT PRIMARY KEY,
+    archive_id  UUID NOT NULL REFERENCES archives(id) ON DELETE CASCADE,
+    url         TEXT NOT NULL,
+    captured_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_payload_digests_archive_id ON payload_digests(archive_id);
+
+CREATE TABLE archive_references (
+    archive_id            UUID NOT NULL REFERENCES archives(id) ON DELETE CASCADE,
+    referenced_archive_id UUID NOT NULL REFERENCES archives(id) ON DELETE RESTRICT,
+    PRIMARY KEY (archive_id, referenced_archive_id)
+);
+
+CREATE INDEX idx_archive_references_referenced_archive_id ON archive_references(referenced_archive_id);
+
+CREATE TABLE retention_rules (
+    id           UUID        PRIMARY KEY,
+    name         TEXT        NOT NULL,
+    tag          TEXT        NOT NULL DEFAULT '',
+    max_age_days INTEGER     NOT NULL DEFAULT 0,
+    keep_last    INTEGER     NOT NULL DEFAULT 0,
+    hold         BOOLEAN     NOT NULL DEFAULT FALSE,
+    dry_run      BOOLEAN     NOT NULL DEFAULT TRUE,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- search_vector replaces SQLite's archive_search table: it indexes the
+-- name, description, source URL and tags, split on punctuation so that
+-- URLs are searchable word by word.
+CREATE FUNCTION archive_search_document(target_id UUID, archive_name TEXT, archive_description TEXT, archive_source_url TEXT)
+RETURNS tsvector
+LANGUAGE SQL STABLE
+AS $$
+    SELECT to_tsvector('simple', regexp_replace(
+        unaccent(
+            archive_name || ' ' ||
+            archive_description || ' ' ||
+            archive_source_url || ' ' ||
+            COALESCE((SELECT string_agg(t.tag, ' ') FROM tags t WHERE t.archive_id = target_id), '')
+        ),
+        '[^[:alnum:]]+', ' ', 'g'
+    ))
+$$;
+
+CREATE FUNCTION archives_search_refresh() RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    NEW.search_vector := archive_search_document(NEW.id, NEW.name, NEW.description, NEW.source_url);
+    RETURN NEW;
+END;
+$$;
+
+CREATE TRIGGER archives_search_refresh
+BEFORE INSERT OR UPDATE OF name, description, source_url ON archives
+FOR EACH ROW EXECUTE FUNCTION archives_search_refresh();
+
+CREATE FUNCTION tags_search_refresh() RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE archives
+        SET search_vector = archive_search_document(id, name, description, source_url)
+        WHERE id = OLD.archive_id;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        UPDATE archives
+        SET search_vector = archive_search_document(id, name, description, source_url)
+        WHERE id = NEW.archive_id;
+    END IF;
+    RETURN NULL;
+END;
+$$;
+
+CREATE TRIGGER tags_search_refresh
+AFTER INSERT OR UPDATE OR DELETE ON tags
+FOR EACH ROW EXECUTE FUNCTION tags_search_refresh();
@@ -0,0 +1,2 @@
+ALTER TABLE archives ADD COLUMN content_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE archives ADD COLUMN missing_at TIMESTAMPTZ;
@@ -0,0 +1,12 @@
+CREATE TABLE api_tokens (
+    id           UUID        PRIMARY KEY,
+    name         TEXT        NOT NULL,
+    token_hash   TEXT        NOT NULL UNIQUE,
+    scope        TEXT        NOT NULL CHECK (scope IN ('read', 'crawl', 'admin')),
+    user_id      UUID        REFERENCES users(id) ON DELETE CASCADE,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_api_tokens_user_id ON api_tokens(user_id);
@@ -0,0 +1,3 @@
+ALTER TABLE archives ADD COLUMN owner_id UUID REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_archives_owner_id ON archives(owner_id);
@@ -0,0 +1 @@
+ALTER TABLE archives ADD COLUMN visibility TEXT NOT NULL DEFAULT 'shared' CHECK (visibility IN ('private', 'shared', 'public'));
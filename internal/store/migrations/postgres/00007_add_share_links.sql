@@ -0,0 +1,10 @@
+CREATE TABLE share_links (
+    id         UUID        PRIMARY KEY,
+    archive_id UUID        NOT NULL REFERENCES archives(id) ON DELETE CASCADE,
+    name       TEXT        NOT NULL DEFAULT '',
+    created_by UUID        REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_share_links_archive_id ON share_links(archive_id);
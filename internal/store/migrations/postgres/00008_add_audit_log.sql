@@ -0,0 +1,26 @@
+CREATE TABLE audit_log (
+    id           BIGINT      GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    actor_id     UUID,
+    actor        TEXT        NOT NULL DEFAULT '',
+    token_id     UUID,
+    client_ip    TEXT        NOT NULL DEFAULT '',
+    action       TEXT        NOT NULL,
+    target_id    TEXT        NOT NULL DEFAULT '',
+    before_state TEXT,
+    after_state  TEXT
+);
+
+CREATE INDEX idx_audit_log_actor ON audit_log(actor);
+CREATE INDEX idx_audit_log_action ON audit_log(action);
+CREATE INDEX idx_audit_log_target_id ON audit_log(target_id);
+
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+BEFORE UPDATE OR DELETE ON audit_log
+FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
@@ -0,0 +1,26 @@
+-- Gives archives the subject new captures of their source URL get, like
+-- archiveutil.NormalizeSubject: scheme and host are lowercased, user info,
+-- default ports, fragments and trailing slashes of the path are dropped.
+-- Only subjects left empty or backfilled by trimming trailing slashes are
+-- rewritten. SQLite runs the same migration in Go.
+WITH parsed AS (
+    SELECT
+        id,
+        btrim(source_url) AS source_url,
+        regexp_match(btrim(source_url), '^([A-Za-z][A-Za-z0-9+.-]*)://(?:[^/?#@]*@)?([^/?#]+)([^?#]*)(\?[^#]*)?') AS parts
+    FROM archives
+    WHERE source_url <> '' AND (subject = '' OR subject = rtrim(source_url, '/'))
+)
+UPDATE archives a
+SET subject = CASE
+    WHEN p.parts IS NULL THEN rtrim(p.source_url, '/')
+    ELSE lower(p.parts[1]) || '://'
+        || regexp_replace(
+            lower(p.parts[2]),
+            CASE lower(p.parts[1]) WHEN 'http' THEN ':(80)?$' WHEN 'https' THEN ':(443)?$' ELSE ':$' END,
+            '')
+        || rtrim(p.parts[3], '/')
+        || CASE WHEN length(coalesce(p.parts[4], '')) > 1 THEN p.parts[4] ELSE '' END
+END
+FROM parsed p
+WHERE a.id = p.id;
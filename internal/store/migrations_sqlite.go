@@ -0,0 +1,47 @@
+package store
+
+import (
+	"database/sql"
+
+	"github.com/JuanSaenz04/archiver/internal/archiveutil"
+)
+
+// sqliteCodeMigrations are the SQLite migrations written in Go, numbered
+// along with those of migrations/*.sql. PostgreSQL runs an SQL migration of
+// the same name instead.
+var sqliteCodeMigrations = []migration{
+	{version: 19, name: "00019_normalize_archive_subjects", code: normalizeArchiveSubjects},
+}
+
+// normalizeArchiveSubjects gives archives the subject new captures of their
+// source URL get. Subjects were first backfilled by trimming trailing
+// slashes, which left the scheme, host and default ports of older archives
+// as they were.
+func normalizeArchiveSubjects(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, source_url FROM archives WHERE source_url != '' AND (subject = '' OR subject = rtrim(source_url, '/'));")
+	if err != nil {
+		return err
+	}
+	subjects := make(map[string]string)
+	for rows.Next() {
+		var id, sourceURL string
+		if err := rows.Scan(&id, &sourceURL); err != nil {
+			rows.Close()
+			return err
+		}
+		subjects[id] = archiveutil.NormalizeSubject(sourceURL)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, subject := range subjects {
+		if _, err := tx.Exec("UPDATE archives SET subject = ? WHERE id = ?;", subject, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
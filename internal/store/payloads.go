@@ -0,0 +1,145 @@
+package store
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// maxLookupBatch keeps payload lookups below SQLite's bound parameter limit.
+const maxLookupBatch = 500
+
+type PayloadRecord struct {
+	Digest     string
+	ArchiveID  uuid.UUID
+	URL        string
+	CapturedAt string
+}
+
+type DedupStats struct {
+	SavedBytes           int64 `json:"saved_bytes"`
+	DeduplicatedArchives int   `json:"deduplicated_archives"`
+}
+
+func (s *sqlStore) LookupPayloads(ctx context.Context, digests []string) (map[string]PayloadRecord, error) {
+	records := make(map[string]PayloadRecord)
+	for start := 0; start < len(digests); start += maxLookupBatch {
+		batch := digests[start:min(start+maxLookupBatch, len(digests))]
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(batch)), ",")
+		args := make([]any, 0, len(batch))
+		for _, digest := range batch {
+			args = append(args, digest)
+		}
+
+		rows, err := s.db.QueryContext(ctx, `
+SELECT p.digest, p.archive_id, p.url, p.captured_at
+FROM payload_digests p
+JOIN archives a ON a.id = p.archive_id
+WHERE p.digest IN (`+placeholders+`) AND a.deleted_at IS NULL;
+`, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var record PayloadRecord
+			if err := rows.Scan(&record.Digest, &record.ArchiveID, &record.URL, &record.CapturedAt); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			records[record.Digest] = record
+		}
+		if err := rows.Close(); err != nil {
+			return nil, err
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// RegisterPayloads records the payloads stored by an archive and the
+// archives its revisit records point at. Digests that are already known
+// keep pointing at the archive that stored them first, unless that archive
+// is in the trash.
+func (s *sqlStore) RegisterPayloads(ctx context.Context, archiveId uuid.UUID, records []PayloadRecord, referencedIDs []uuid.UUID) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const insertPayloadQuery = `
+INSERT INTO payload_digests (digest, archive_id, url, captured_at) VALUES (?, ?, ?, ?)
+ON CONFLICT (digest) DO UPDATE SET
+	archive_id = excluded.archive_id,
+	url = excluded.url,
+	captured_at = excluded.captured_at
+WHERE (SELECT deleted_at FROM archives WHERE id = payload_digests.archive_id) IS NOT NULL;
+	`
+
+	payloadStmt, err := tx.PrepareContext(ctx, insertPayloadQuery)
+	if err != nil {
+		return err
+	}
+	defer payloadStmt.Close()
+
+	for _, record := range records {
+		if _, err := payloadStmt.ExecContext(ctx, record.Digest, archiveId, record.URL, record.CapturedAt); err != nil {
+			return err
+		}
+	}
+
+	const insertReferenceQuery = `
+INSERT INTO archive_references (archive_id, referenced_archive_id) VALUES (?, ?)
+ON CONFLICT DO NOTHING;
+	`
+
+	for _, referencedId := range referencedIDs {
+		if _, err := tx.ExecContext(ctx, insertReferenceQuery, archiveId, referencedId); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) ListReferencedArchiveIDs(ctx context.Context, archiveId uuid.UUID) ([]uuid.UUID, error) {
+	const query = `
+SELECT referenced_archive_id
+FROM archive_references
+WHERE archive_id = ?
+ORDER BY referenced_archive_id;
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, archiveId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]uuid.UUID, 0)
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *sqlStore) DedupStats(ctx context.Context) (DedupStats, error) {
+	const query = `
+SELECT CAST(COALESCE(SUM(dedup_saved_bytes), 0) AS BIGINT), COUNT(*) FILTER (WHERE dedup_saved_bytes > 0)
+FROM archives;
+	`
+
+	var stats DedupStats
+	if err := s.db.QueryRowContext(ctx, query).Scan(&stats.SavedBytes, &stats.DeduplicatedArchives); err != nil {
+		return DedupStats{}, err
+	}
+	return stats, nil
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrationFS embed.FS
+
+// postgresMigrationLock is the advisory lock key held while migrating, so
+// that API replicas starting together apply each migration once.
+const postgresMigrationLock = 7261394
+
+// PostgresStore is the PostgreSQL Store, for deployments that outgrow a
+// single SQLite file.
+type PostgresStore struct {
+	sqlStore
+}
+
+func OpenPostgres(databaseURL string) (*PostgresStore, error) {
+	db, err := sql.Open("pgx", databaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PostgresStore{
+		sqlStore: newSQLStore(db, postgresDialect{}),
+	}, nil
+}
+
+func (s *PostgresStore) RunMigrations() error {
+	migrations, err := loadMigrations(postgresMigrationFS, "migrations/postgres")
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1);", postgresMigrationLock); err != nil {
+		return err
+	}
+	const createQuery = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    INTEGER     PRIMARY KEY,
+    name       TEXT        NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+	`
+	if _, err := tx.Exec(createQuery); err != nil {
+		return fmt.Errorf("create schema_migrations table: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	return runMigrations(s, migrations)
+}
+
+func (s *PostgresStore) WaitForMigrations(ctx context.Context, interval time.Duration) error {
+	migrations, err := loadMigrations(postgresMigrationFS, "migrations/postgres")
+	if err != nil {
+		return err
+	}
+	return waitForMigrations(ctx, s, migrations, interval)
+}
+
+func (s *PostgresStore) applyMigration(migration migration) error {
+	startedAt := time.Now()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1);", postgresMigrationLock); err != nil {
+		return err
+	}
+
+	// Another process may have applied it while we waited for the lock.
+	var applied bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1);", migration.version).Scan(&applied); err != nil {
+		return err
+	}
+	if applied {
+		return tx.Commit()
+	}
+
+	slog.Info("applying database migration", "version", migration.version, "filename", migration.name)
+
+	if _, err := tx.Exec(migration.sql); err != nil {
+		return fmt.Errorf("apply migration %s: %w", migration.name, err)
+	}
+
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES ($1, $2);", migration.version, migration.name); err != nil {
+		return fmt.Errorf("set schema version after migration %s: %w", migration.name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit migration %s: %w", migration.name, err)
+	}
+
+	slog.Info("database migration applied", "version", migration.version, "filename", migration.name, "duration", time.Since(startedAt))
+	return nil
+}
+
+func (s *PostgresStore) schemaVersion() (int, error) {
+	var version int
+	err := s.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations;").Scan(&version)
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "42P01" {
+		// undefined_table: nothing has been migrated yet.
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/google/uuid"
+)
+
+var ErrRetentionRuleNotFound = errors.New("retention rule not found")
+
+func (s *sqlStore) ListRetentionRules(ctx context.Context) ([]models.RetentionRule, error) {
+	const query = `
+SELECT id, name, tag, max_age_days, keep_last, hold, dry_run, created_at
+FROM retention_rules
+ORDER BY created_at ASC, id ASC;
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := make([]models.RetentionRule, 0)
+	for rows.Next() {
+		var rule models.RetentionRule
+		if err := rows.Scan(&rule.ID, &rule.Name, &rule.Tag, &rule.MaxAgeDays, &rule.KeepLast, &rule.Hold, &rule.DryRun, &rule.CreatedAt); err != nil {
+			return nil, err
+		}
+		rule.CreatedAt = rule.CreatedAt.UTC()
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func (s *sqlStore) InsertRetentionRule(ctx context.Context, rule models.RetentionRule) error {
+	const query = `
+INSERT INTO retention_rules (id, name, tag, max_age_days, keep_last, hold, dry_run, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+	`
+
+	_, err := s.db.ExecContext(ctx, query, rule.ID, rule.Name, rule.Tag, rule.MaxAgeDays, rule.KeepLast, rule.Hold, rule.DryRun, rule.CreatedAt)
+	return err
+}
+
+func (s *sqlStore) UpdateRetentionRule(ctx context.Context, rule models.RetentionRule) error {
+	const query = `
+UPDATE retention_rules
+SET name = ?, tag = ?, max_age_days = ?, keep_last = ?, hold = ?, dry_run = ?
+WHERE id = ?;
+	`
+
+	res, err := s.db.ExecContext(ctx, query, rule.Name, rule.Tag, rule.MaxAgeDays, rule.KeepLast, rule.Hold, rule.DryRun, rule.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRetentionRuleNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) DeleteRetentionRule(ctx context.Context, ruleId uuid.UUID) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM retention_rules WHERE id = ?;", ruleId)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRetentionRuleNotFound
+	}
+	return nil
+}
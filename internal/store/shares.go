@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/google/uuid"
+)
+
+var ErrShareLinkNotFound = errors.New("share link not found")
+
+const shareLinkColumns = `id, archive_id, name, created_by, created_at, expires_at`
+
+func scanShareLink(scanner interface{ Scan(...any) error }) (models.ShareLink, error) {
+	var (
+		link      models.ShareLink
+		createdBy uuid.NullUUID
+	)
+	if err := scanner.Scan(&link.ID, &link.ArchiveID, &link.Name, &createdBy, &link.CreatedAt, &link.ExpiresAt); err != nil {
+		return models.ShareLink{}, err
+	}
+	link.CreatedAt = link.CreatedAt.UTC()
+	link.ExpiresAt = link.ExpiresAt.UTC()
+	if createdBy.Valid {
+		link.CreatedBy = &createdBy.UUID
+	}
+	return link, nil
+}
+
+// ListShareLinks returns the links to archiveId that have not expired by
+// now, newest first.
+func (s *sqlStore) ListShareLinks(ctx context.Context, archiveId uuid.UUID, now time.Time) ([]models.ShareLink, error) {
+	const query = `
+FROM share_links
+WHERE archive_id = ? AND expires_at > ?
+ORDER BY created_at DESC, id ASC;
+	`
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+shareLinkColumns+query, archiveId, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := make([]models.ShareLink, 0)
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// GetShareLink returns the link linkId, unless it expired before now.
+func (s *sqlStore) GetShareLink(ctx context.Context, linkId uuid.UUID, now time.Time) (models.ShareLink, error) {
+	const query = `
+FROM share_links
+WHERE id = ? AND expires_at > ?;
+	`
+
+	link, err := scanShareLink(s.db.QueryRowContext(ctx, "SELECT "+shareLinkColumns+query, linkId, now.UTC()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.ShareLink{}, ErrShareLinkNotFound
+	}
+	return link, err
+}
+
+func (s *sqlStore) InsertShareLink(ctx context.Context, link models.ShareLink) error {
+	const query = `
+INSERT INTO share_links (id, archive_id, name, created_by, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?);
+	`
+
+	var createdBy uuid.NullUUID
+	if link.CreatedBy != nil {
+		createdBy = uuid.NullUUID{UUID: *link.CreatedBy, Valid: true}
+	}
+	_, err := s.db.ExecContext(ctx, query, link.ID, link.ArchiveID, link.Name, createdBy, link.CreatedAt.UTC(), link.ExpiresAt.UTC())
+	return err
+}
+
+// DeleteShareLink revokes the link linkId to archiveId.
+func (s *sqlStore) DeleteShareLink(ctx context.Context, archiveId, linkId uuid.UUID) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM share_links WHERE id = ? AND archive_id = ?;", linkId, archiveId)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrShareLinkNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) DeleteExpiredShareLinks(ctx context.Context, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM share_links WHERE expires_at <= ?;", now.UTC())
+	return err
+}
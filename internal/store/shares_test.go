@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestShareLinks(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		now := time.Now().UTC().Truncate(time.Second)
+
+		archive := models.Archive{ID: uuid.New(), Name: "shared", Filename: "shared.wacz"}
+		if err := s.Insert(ctx, archive); err != nil {
+			t.Fatalf("insert archive: %v", err)
+		}
+
+		link := models.ShareLink{ID: uuid.New(), ArchiveID: archive.ID, Name: "counsel", CreatedAt: now, ExpiresAt: now.Add(time.Hour)}
+		expired := models.ShareLink{ID: uuid.New(), ArchiveID: archive.ID, CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)}
+		for _, l := range []models.ShareLink{link, expired} {
+			if err := s.InsertShareLink(ctx, l); err != nil {
+				t.Fatalf("insert share link: %v", err)
+			}
+		}
+
+		got, err := s.GetShareLink(ctx, link.ID, now)
+		if err != nil {
+			t.Fatalf("get share link: %v", err)
+		}
+		if got.ArchiveID != archive.ID || got.Name != "counsel" || got.CreatedBy != nil || !got.ExpiresAt.Equal(link.ExpiresAt) {
+			t.Fatalf("unexpected share link: %+v", got)
+		}
+		if _, err := s.GetShareLink(ctx, expired.ID, now); !errors.Is(err, ErrShareLinkNotFound) {
+			t.Fatalf("expected expired link to be rejected, got %v", err)
+		}
+
+		links, err := s.ListShareLinks(ctx, archive.ID, now)
+		if err != nil {
+			t.Fatalf("list share links: %v", err)
+		}
+		if len(links) != 1 || links[0].ID != link.ID {
+			t.Fatalf("expected only the outstanding link, got %+v", links)
+		}
+
+		if err := s.DeleteExpiredShareLinks(ctx, now); err != nil {
+			t.Fatalf("delete expired share links: %v", err)
+		}
+		if err := s.DeleteShareLink(ctx, archive.ID, expired.ID); !errors.Is(err, ErrShareLinkNotFound) {
+			t.Fatalf("expected expired link to be deleted, got %v", err)
+		}
+		if err := s.DeleteShareLink(ctx, uuid.New(), link.ID); !errors.Is(err, ErrShareLinkNotFound) {
+			t.Fatalf("expected link of another archive to be kept, got %v", err)
+		}
+		if err := s.DeleteShareLink(ctx, archive.ID, link.ID); err != nil {
+			t.Fatalf("delete share link: %v", err)
+		}
+		if _, err := s.GetShareLink(ctx, link.ID, now); !errors.Is(err, ErrShareLinkNotFound) {
+			t.Fatalf("expected revoked link to be rejected, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+type StorageUsage struct {
+	Key      string `json:"key"`
+	Archives int    `json:"archives"`
+	Bytes    int64  `json:"bytes"`
+}
+
+type StorageStats struct {
+	TotalBytes   int64          `json:"total_bytes"`
+	TrashedBytes int64          `json:"trashed_bytes"`
+	Archives     int            `json:"archives"`
+	ByTag        []StorageUsage `json:"by_tag"`
+	ByHost       []StorageUsage `json:"by_host"`
+	ByMonth      []StorageUsage `json:"by_month"`
+}
+
+// StorageUsed returns the bytes held in storage, in total and for each of
+// tags. Trashed archives are counted until they are purged, since their
+// files stay under .trash/ until then.
+func (s *sqlStore) StorageUsed(ctx context.Context, tags []string) (int64, map[string]int64, error) {
+	var total int64
+	if err := s.db.QueryRowContext(ctx, "SELECT CAST(COALESCE(SUM(size_bytes), 0) AS BIGINT) FROM archives;").Scan(&total); err != nil {
+		return 0, nil, err
+	}
+
+	byTag := make(map[string]int64, len(tags))
+	for _, tag := range tags {
+		byTag[tag] = 0
+	}
+	if len(tags) == 0 {
+		return total, byTag, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(tags)), ",")
+	args := make([]any, 0, len(tags))
+	for _, tag := range tags {
+		args = append(args, tag)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+SELECT t.tag, CAST(COALESCE(SUM(a.size_bytes), 0) AS BIGINT)
+FROM tags t
+JOIN archives a ON a.id = t.archive_id
+WHERE t.tag IN (`+placeholders+`)
+GROUP BY t.tag;
+`, args...)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			tag   string
+			bytes int64
+		)
+		if err := rows.Scan(&tag, &bytes); err != nil {
+			return 0, nil, err
+		}
+		byTag[tag] = bytes
+	}
+	return total, byTag, rows.Err()
+}
+
+// StorageStats breaks down the bytes held by live archives by tag, source
+// host and creation month, largest first. TrashedBytes reports the bytes
+// still held by trashed archives awaiting purge.
+func (s *sqlStore) StorageStats(ctx context.Context) (StorageStats, error) {
+	var stats StorageStats
+	if err := s.db.QueryRowContext(ctx, "SELECT CAST(COALESCE(SUM(size_bytes), 0) AS BIGINT), COUNT(*) FROM archives WHERE deleted_at IS NULL;").Scan(&stats.TotalBytes, &stats.Archives); err != nil {
+		return StorageStats{}, err
+	}
+	if err := s.db.QueryRowContext(ctx, "SELECT CAST(COALESCE(SUM(size_bytes), 0) AS BIGINT) FROM archives WHERE deleted_at IS NOT NULL;").Scan(&stats.TrashedBytes); err != nil {
+		return StorageStats{}, err
+	}
+
+	const byTagQuery = `
+SELECT t.tag, COUNT(*), CAST(COALESCE(SUM(a.size_bytes), 0) AS BIGINT)
+FROM tags t
+JOIN archives a ON a.id = t.archive_id
+WHERE a.deleted_at IS NULL
+GROUP BY t.tag;
+	`
+	byTag, err := s.storageUsage(ctx, byTagQuery)
+	if err != nil {
+		return StorageStats{}, err
+	}
+
+	month := s.dialect.month("created_at")
+	byMonthQuery := `
+SELECT ` + month + `, COUNT(*), CAST(COALESCE(SUM(size_bytes), 0) AS BIGINT)
+FROM archives
+WHERE deleted_at IS NULL
+GROUP BY ` + month + `;
+	`
+	byMonth, err := s.storageUsage(ctx, byMonthQuery)
+	if err != nil {
+		return StorageStats{}, err
+	}
+
+	const bySourceQuery = `
+SELECT source_url, COUNT(*), CAST(COALESCE(SUM(size_bytes), 0) AS BIGINT)
+FROM archives
+WHERE deleted_at IS NULL
+GROUP BY source_url;
+	`
+	bySource, err := s.storageUsage(ctx, bySourceQuery)
+	if err != nil {
+		return StorageStats{}, err
+	}
+	hosts := make(map[string]*StorageUsage)
+	for _, usage := range bySource {
+		host := sourceHost(usage.Key)
+		if hosts[host] == nil {
+			hosts[host] = &StorageUsage{Key: host}
+		}
+		hosts[host].Archives += usage.Archives
+		hosts[host].Bytes += usage.Bytes
+	}
+	byHost := make([]StorageUsage, 0, len(hosts))
+	for _, usage := range hosts {
+		byHost = append(byHost, *usage)
+	}
+
+	stats.ByTag = sortStorageUsage(byTag)
+	stats.ByHost = sortStorageUsage(byHost)
+	stats.ByMonth = byMonth
+	sort.Slice(stats.ByMonth, func(i, j int) bool { return stats.ByMonth[i].Key > stats.ByMonth[j].Key })
+	return stats, nil
+}
+
+func (s *sqlStore) storageUsage(ctx context.Context, query string) ([]StorageUsage, error) {
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := make([]StorageUsage, 0)
+	for rows.Next() {
+		var row StorageUsage
+		if err := rows.Scan(&row.Key, &row.Archives, &row.Bytes); err != nil {
+			return nil, err
+		}
+		usage = append(usage, row)
+	}
+	return usage, rows.Err()
+}
+
+func sortStorageUsage(usage []StorageUsage) []StorageUsage {
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Bytes != usage[j].Bytes {
+			return usage[i].Bytes > usage[j].Bytes
+		}
+		return usage[i].Key < usage[j].Key
+	})
+	return usage
+}
+
+func sourceHost(sourceURL string) string {
+	parsed, err := url.Parse(strings.TrimSpace(sourceURL))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
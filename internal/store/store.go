@@ -1,17 +1,24 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"embed"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/storage"
+	"github.com/google/uuid"
 	_ "modernc.org/sqlite"
 )
 
@@ -24,10 +31,96 @@ type migration struct {
 	version int
 	name    string
 	sql     string
+	// code runs the migrations written in Go instead of sql, for changes
+	// SQL cannot express.
+	code func(tx *sql.Tx) error
 }
 
+// Store keeps the metadata of archives, their payloads and retention rules,
+// along with users, their sessions, API tokens and share links, and the
+// audit log.
+// ArchiveStore implements it on SQLite and PostgresStore on PostgreSQL.
+type Store interface {
+	RunMigrations() error
+	WaitForMigrations(ctx context.Context, interval time.Duration) error
+	Close() error
+
+	SyncFromDisk(ctx context.Context, backend storage.Backend, options SyncOptions) (SyncReport, error)
+	List(ctx context.Context) ([]models.Archive, error)
+	ListArchives(ctx context.Context, options ListArchivesOptions) (ArchivePage, error)
+	Get(ctx context.Context, archiveId uuid.UUID) (models.Archive, error)
+	GetFilename(ctx context.Context, archiveId uuid.UUID) (string, error)
+	GetTrashed(ctx context.Context, archiveId uuid.UUID) (models.Archive, error)
+	ListTags(ctx context.Context, viewer *uuid.UUID) ([]string, error)
+	Insert(ctx context.Context, a models.Archive) error
+	ReplaceSynced(ctx context.Context, a models.Archive) error
+	UpdateMetadata(ctx context.Context, archiveId uuid.UUID, newName, description string, tags []string) error
+	UpdateVisibility(ctx context.Context, archiveId uuid.UUID, visibility models.Visibility) error
+	Delete(ctx context.Context, archiveId uuid.UUID) error
+	Trash(ctx context.Context, archiveId uuid.UUID, deletedAt time.Time) error
+	Restore(ctx context.Context, archiveId uuid.UUID) error
+
+	LookupPayloads(ctx context.Context, digests []string) (map[string]PayloadRecord, error)
+	RegisterPayloads(ctx context.Context, archiveId uuid.UUID, records []PayloadRecord, referencedIDs []uuid.UUID) error
+	ListReferencedArchiveIDs(ctx context.Context, archiveId uuid.UUID) ([]uuid.UUID, error)
+	DedupStats(ctx context.Context) (DedupStats, error)
+
+	StorageUsed(ctx context.Context, tags []string) (int64, map[string]int64, error)
+	StorageStats(ctx context.Context) (StorageStats, error)
+
+	ListRetentionRules(ctx context.Context) ([]models.RetentionRule, error)
+	InsertRetentionRule(ctx context.Context, rule models.RetentionRule) error
+	UpdateRetentionRule(ctx context.Context, rule models.RetentionRule) error
+	DeleteRetentionRule(ctx context.Context, ruleId uuid.UUID) error
+
+	ListUsers(ctx context.Context) ([]models.User, error)
+	GetUser(ctx context.Context, userId uuid.UUID) (models.User, error)
+	GetUserByUsername(ctx context.Context, username string) (models.User, error)
+	InsertUser(ctx context.Context, user models.User) error
+	SetUserAdmin(ctx context.Context, userId uuid.UUID, isAdmin bool) error
+	DeleteUser(ctx context.Context, userId uuid.UUID) error
+	InsertSession(ctx context.Context, tokenHash string, userId uuid.UUID, expiresAt time.Time) error
+	GetSessionUser(ctx context.Context, tokenHash string, now time.Time) (models.User, error)
+	DeleteSession(ctx context.Context, tokenHash string) error
+	DeleteExpiredSessions(ctx context.Context, now time.Time) error
+
+	ListAPITokens(ctx context.Context) ([]models.APIToken, error)
+	GetAPIToken(ctx context.Context, tokenId uuid.UUID) (models.APIToken, error)
+	GetAPITokenByHash(ctx context.Context, tokenHash string, now time.Time) (models.APIToken, error)
+	InsertAPIToken(ctx context.Context, token models.APIToken, tokenHash string) error
+	TouchAPIToken(ctx context.Context, tokenId uuid.UUID, usedAt time.Time) error
+	DeleteAPIToken(ctx context.Context, tokenId uuid.UUID) error
+
+	ListShareLinks(ctx context.Context, archiveId uuid.UUID, now time.Time) ([]models.ShareLink, error)
+	GetShareLink(ctx context.Context, linkId uuid.UUID, now time.Time) (models.ShareLink, error)
+	InsertShareLink(ctx context.Context, link models.ShareLink) error
+	DeleteShareLink(ctx context.Context, archiveId, linkId uuid.UUID) error
+	DeleteExpiredShareLinks(ctx context.Context, now time.Time) error
+
+	InsertAuditEntry(ctx context.Context, entry models.AuditEntry) error
+	ListAuditEntries(ctx context.Context, query AuditQuery) ([]models.AuditEntry, error)
+}
+
+// FromEnv opens the PostgreSQL database at DATABASE_URL when it is set, and
+// archive.db in SQLITE_DIR (or ARCHIVES_DIR) otherwise.
+func FromEnv() (Store, error) {
+	if databaseURL := os.Getenv("DATABASE_URL"); databaseURL != "" {
+		return OpenPostgres(databaseURL)
+	}
+
+	sqliteDir := os.Getenv("SQLITE_DIR")
+	if sqliteDir == "" {
+		sqliteDir = os.Getenv("ARCHIVES_DIR")
+	}
+	if sqliteDir == "" {
+		return nil, errors.New("environment variable SQLITE_DIR not set")
+	}
+	return Open(filepath.Join(sqliteDir, "archive.db"))
+}
+
+// ArchiveStore is the SQLite Store.
 type ArchiveStore struct {
-	db *sql.DB
+	sqlStore
 }
 
 func Open(path string) (*ArchiveStore, error) {
@@ -43,17 +136,32 @@ func Open(path string) (*ArchiveStore, error) {
 	}
 
 	return &ArchiveStore{
-		db: db,
+		sqlStore: newSQLStore(db, sqliteDialect{}),
 	}, nil
 }
 
 func (s *ArchiveStore) RunMigrations() error {
-	migrations, err := loadMigrations()
+	migrations, err := loadSQLiteMigrations()
 	if err != nil {
 		return err
 	}
+	return runMigrations(s, migrations)
+}
 
-	version, err := s.userVersion()
+// loadSQLiteMigrations returns the SQL migrations of migrations/ along with
+// those written in Go (see sqliteCodeMigrations).
+func loadSQLiteMigrations() ([]migration, error) {
+	return loadMigrations(migrationFS, "migrations", sqliteCodeMigrations...)
+}
+
+// migrator is the backend-specific half of running migrations.
+type migrator interface {
+	schemaVersion() (int, error)
+	applyMigration(migration migration) error
+}
+
+func runMigrations(m migrator, migrations []migration) error {
+	version, err := m.schemaVersion()
 	if err != nil {
 		return err
 	}
@@ -85,7 +193,7 @@ func (s *ArchiveStore) RunMigrations() error {
 			continue
 		}
 
-		if err := s.applyMigration(migration); err != nil {
+		if err := m.applyMigration(migration); err != nil {
 			return err
 		}
 	}
@@ -94,14 +202,66 @@ func (s *ArchiveStore) RunMigrations() error {
 	return nil
 }
 
-func loadMigrations() ([]migration, error) {
-	entries, err := fs.ReadDir(migrationFS, "migrations")
+// WaitForMigrations blocks until another process has brought the schema up
+// to the latest migration, checking every interval. Processes that share the
+// database with the API call it instead of RunMigrations so that only one of
+// them ever writes the schema.
+func (s *ArchiveStore) WaitForMigrations(ctx context.Context, interval time.Duration) error {
+	migrations, err := loadSQLiteMigrations()
+	if err != nil {
+		return err
+	}
+	return waitForMigrations(ctx, s, migrations, interval)
+}
+
+func waitForMigrations(ctx context.Context, m migrator, migrations []migration, interval time.Duration) error {
+	latestVersion := 0
+	if len(migrations) > 0 {
+		latestVersion = migrations[len(migrations)-1].version
+	}
+
+	logged := false
+	for {
+		version, err := m.schemaVersion()
+		if err != nil {
+			return err
+		}
+		if version > latestVersion {
+			return fmt.Errorf("unsupported schema version: %d", version)
+		}
+		if version == latestVersion {
+			return nil
+		}
+
+		if !logged {
+			slog.Info("waiting for database migrations", "current_version", version, "latest_version", latestVersion)
+			logged = true
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// loadMigrations reads the SQL migrations of dir and numbers the coded
+// ones along with them.
+func loadMigrations(fsys fs.FS, dir string, coded ...migration) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
 	if err != nil {
 		return nil, err
 	}
 
-	migrations := make([]migration, 0, len(entries))
-	versions := make(map[int]string, len(entries))
+	migrations := make([]migration, 0, len(entries)+len(coded))
+	versions := make(map[int]string, len(entries)+len(coded))
+	for _, migration := range coded {
+		if existingName, ok := versions[migration.version]; ok {
+			return nil, fmt.Errorf("duplicate migration version %05d: %s and %s", migration.version, existingName, migration.name)
+		}
+		versions[migration.version] = migration.name
+		migrations = append(migrations, migration)
+	}
 
 	for _, entry := range entries {
 		if entry.IsDir() {
@@ -129,7 +289,7 @@ func loadMigrations() ([]migration, error) {
 		}
 		versions[version] = name
 
-		contents, err := migrationFS.ReadFile("migrations/" + name)
+		contents, err := fs.ReadFile(fsys, dir+"/"+name)
 		if err != nil {
 			return nil, err
 		}
@@ -164,7 +324,12 @@ func (s *ArchiveStore) applyMigration(migration migration) error {
 		return err
 	}
 
-	if _, err := tx.Exec(migration.sql); err != nil {
+	if migration.code != nil {
+		err = migration.code(tx)
+	} else {
+		_, err = tx.Exec(migration.sql)
+	}
+	if err != nil {
 		_ = tx.Rollback()
 		return fmt.Errorf("apply migration %s: %w", migration.name, err)
 	}
@@ -182,7 +347,7 @@ func (s *ArchiveStore) applyMigration(migration migration) error {
 	return nil
 }
 
-func (s *ArchiveStore) userVersion() (int, error) {
+func (s *ArchiveStore) schemaVersion() (int, error) {
 	var version int
 	if err := s.db.QueryRow("PRAGMA user_version;").Scan(&version); err != nil {
 		return 0, err
@@ -191,6 +356,6 @@ func (s *ArchiveStore) userVersion() (int, error) {
 	return version, nil
 }
 
-func (s *ArchiveStore) Close() error {
+func (s *sqlStore) Close() error {
 	return s.db.Close()
 }
@@ -0,0 +1,386 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/storage"
+	"github.com/google/uuid"
+)
+
+// SyncSettleTime is how long a file must go unmodified before a sync
+// registers it, so that copies in progress and archives whose completion
+// is still waiting to be recorded are left alone.
+const SyncSettleTime = time.Minute
+
+var ErrSyncInProgress = errors.New("storage sync already in progress")
+
+type SyncOptions struct {
+	// DryRun reports the changes a sync would make without applying them.
+	DryRun bool
+	// RemoveMissing deletes the rows of archives whose file is gone instead
+	// of flagging them as missing.
+	RemoveMissing bool
+	// ModifiedBefore, when set, leaves unknown files modified at or after it
+	// for a later run, as they may still be being written or recorded.
+	ModifiedBefore time.Time
+	// Pending, when set, lists the files whose completion has not been
+	// recorded yet. They are left for a later run like recent files.
+	Pending func(ctx context.Context) (map[string]bool, error)
+	// NoWait returns ErrSyncInProgress instead of waiting for a sync
+	// already running.
+	NoWait bool
+	// Describe, when set, reads the details of newly found files. Files it
+	// fails on are still registered, named after the file and dated by its
+	// modification time. Archives whose file has not been read yet, such as
+	// those registered before details were read, are filled in the same
+	// way, keeping whatever they were given elsewhere.
+	Describe func(ctx context.Context, filename string) (FileDetails, error)
+}
+
+// FileDetails describes an archive file from its contents.
+type FileDetails struct {
+	Name      string
+	SourceURL string
+	Subject   string
+	CreatedAt time.Time
+	Software  string
+}
+
+type SyncChange struct {
+	ArchiveID         uuid.UUID `json:"archive_id"`
+	Filename          string    `json:"filename"`
+	PreviousFilename  string    `json:"previous_filename,omitempty"`
+	SizeBytes         int64     `json:"size_bytes"`
+	PreviousSizeBytes int64     `json:"previous_size_bytes,omitempty"`
+}
+
+// SyncReport lists what a storage sync changed. Missing holds every live
+// archive whose file could not be found, including those flagged by earlier
+// runs, and Deferred the unknown files left for a later run by
+// ModifiedBefore or Pending.
+type SyncReport struct {
+	DryRun    bool         `json:"dry_run"`
+	Added     []SyncChange `json:"added"`
+	Renamed   []SyncChange `json:"renamed"`
+	Resized   []SyncChange `json:"resized"`
+	Recovered []SyncChange `json:"recovered"`
+	Missing   []SyncChange `json:"missing"`
+	Removed   []SyncChange `json:"removed"`
+	Deferred  []SyncChange `json:"deferred"`
+}
+
+type syncRow struct {
+	id          uuid.UUID
+	filename    string
+	name        string
+	sourceURL   string
+	subject     string
+	createdAt   time.Time
+	sizeBytes   int64
+	contentHash string
+	missing     bool
+	described   bool
+}
+
+// SyncFromDisk reconciles live archives with the files at the root of the
+// storage backend: unknown files are registered, files renamed on disk are
+// matched to their row by content hash, size changes are recorded, and rows
+// whose file is gone are flagged as missing (or removed). Syncs run one at
+// a time.
+func (s *sqlStore) SyncFromDisk(ctx context.Context, backend storage.Backend, options SyncOptions) (SyncReport, error) {
+	if options.NoWait {
+		if !s.syncMu.TryLock() {
+			return SyncReport{}, ErrSyncInProgress
+		}
+	} else {
+		s.syncMu.Lock()
+	}
+	defer s.syncMu.Unlock()
+
+	report := SyncReport{
+		DryRun:    options.DryRun,
+		Added:     make([]SyncChange, 0),
+		Renamed:   make([]SyncChange, 0),
+		Resized:   make([]SyncChange, 0),
+		Recovered: make([]SyncChange, 0),
+		Missing:   make([]SyncChange, 0),
+		Removed:   make([]SyncChange, 0),
+		Deferred:  make([]SyncChange, 0),
+	}
+
+	// Pending completions are read before rows, so that a completion
+	// recorded in between is known either way.
+	var pending map[string]bool
+	if options.Pending != nil {
+		var err error
+		if pending, err = options.Pending(ctx); err != nil {
+			return SyncReport{}, err
+		}
+	}
+
+	// Rows are read before listing files, so that an archive recorded in
+	// between is never mistaken for a missing one.
+	rows, err := s.listSyncRows(ctx)
+	if err != nil {
+		return SyncReport{}, err
+	}
+	objects, err := backend.List(ctx, "")
+	if err != nil {
+		return SyncReport{}, err
+	}
+
+	files := make(map[string]storage.ObjectInfo, len(objects))
+	for _, object := range objects {
+		if strings.EqualFold(path.Ext(object.Key), ".wacz") {
+			files[object.Key] = object
+		}
+	}
+
+	known := make(map[string]bool, len(rows))
+	var gone, undescribed []*syncRow
+	for _, row := range rows {
+		known[row.filename] = true
+		object, ok := files[row.filename]
+		if !ok {
+			gone = append(gone, row)
+			continue
+		}
+		if !row.described {
+			undescribed = append(undescribed, row)
+		}
+
+		change := SyncChange{ArchiveID: row.id, Filename: row.filename, SizeBytes: object.Size}
+		if row.missing {
+			report.Recovered = append(report.Recovered, change)
+		}
+		if object.Size != row.sizeBytes {
+			change.PreviousSizeBytes = row.sizeBytes
+			report.Resized = append(report.Resized, change)
+			row.contentHash = ""
+		}
+		// Hashes are backfilled so that the file can be recognized if it
+		// is renamed later.
+		hash := row.contentHash
+		if hash == "" {
+			if hash, err = hashObject(ctx, backend, object.Key); err != nil {
+				return SyncReport{}, err
+			}
+		}
+		if options.DryRun || (!row.missing && object.Size == row.sizeBytes && hash == row.contentHash) {
+			continue
+		}
+
+		const updateQuery = `
+UPDATE archives SET size_bytes = ?, content_hash = ?, missing_at = NULL
+WHERE id = ?;
+		`
+		if _, err := s.db.ExecContext(ctx, updateQuery, object.Size, hash, row.id); err != nil {
+			return SyncReport{}, err
+		}
+	}
+
+	if options.Describe != nil && !options.DryRun {
+		for _, row := range undescribed {
+			if err := s.describeRow(ctx, row, options.Describe); err != nil {
+				return SyncReport{}, err
+			}
+		}
+	}
+
+	for _, object := range objects {
+		if err := ctx.Err(); err != nil {
+			return SyncReport{}, err
+		}
+		if _, ok := files[object.Key]; !ok || known[object.Key] {
+			continue
+		}
+		if pending[object.Key] || (!options.ModifiedBefore.IsZero() && !object.ModTime.Before(options.ModifiedBefore)) {
+			report.Deferred = append(report.Deferred, SyncChange{Filename: object.Key, SizeBytes: object.Size})
+			continue
+		}
+
+		hash, err := hashObject(ctx, backend, object.Key)
+		if err != nil {
+			return SyncReport{}, err
+		}
+
+		if index := matchRenamed(gone, object, hash); index >= 0 {
+			row := gone[index]
+			gone = append(gone[:index], gone[index+1:]...)
+			report.Renamed = append(report.Renamed, SyncChange{ArchiveID: row.id, Filename: object.Key, PreviousFilename: row.filename, SizeBytes: object.Size})
+			if options.DryRun {
+				continue
+			}
+
+			const renameQuery = `
+UPDATE archives SET filename = ?, missing_at = NULL
+WHERE id = ?;
+			`
+			if _, err := s.db.ExecContext(ctx, renameQuery, object.Key, row.id); err != nil {
+				return SyncReport{}, err
+			}
+			continue
+		}
+
+		id := uuid.New()
+		if !options.DryRun {
+			details := FileDetails{Name: strings.TrimSuffix(object.Key, path.Ext(object.Key)), CreatedAt: object.ModTime}
+			// Without Describe the file is left unread for a later sync.
+			var software sql.NullString
+			if options.Describe != nil {
+				described, err := options.Describe(ctx, object.Key)
+				if err != nil {
+					slog.Warn("failed to read archive file details", "filename", object.Key, "error", err)
+				} else {
+					if described.Name != "" {
+						details.Name = described.Name
+					}
+					if !described.CreatedAt.IsZero() {
+						details.CreatedAt = described.CreatedAt
+					}
+					details.SourceURL = described.SourceURL
+					details.Subject = described.Subject
+				}
+				software = sql.NullString{String: described.Software, Valid: true}
+			}
+
+			const insertArchiveQuery = `
+INSERT INTO archives (id, name, filename, description, source_url, subject, created_at, size_bytes, content_hash, software)
+VALUES (?, ?, ?, '', ?, ?, ?, ?, ?, ?)
+ON CONFLICT DO NOTHING;
+			`
+			res, err := s.db.ExecContext(ctx, insertArchiveQuery, id, details.Name, object.Key, details.SourceURL, details.Subject, details.CreatedAt, object.Size, hash, software)
+			if err != nil {
+				return SyncReport{}, err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				continue
+			}
+		}
+		report.Added = append(report.Added, SyncChange{ArchiveID: id, Filename: object.Key, SizeBytes: object.Size})
+	}
+
+	now := time.Now().UTC()
+	for _, row := range gone {
+		change := SyncChange{ArchiveID: row.id, Filename: row.filename, SizeBytes: row.sizeBytes}
+		if options.RemoveMissing {
+			if options.DryRun {
+				report.Removed = append(report.Removed, change)
+				continue
+			}
+			err := s.Delete(ctx, row.id)
+			if err == nil {
+				report.Removed = append(report.Removed, change)
+				continue
+			}
+			if !errors.Is(err, ErrArchiveReferenced) {
+				return SyncReport{}, err
+			}
+			slog.Warn("keeping missing archive referenced by deduplicated archives", "archive_id", row.id, "filename", row.filename)
+		}
+
+		report.Missing = append(report.Missing, change)
+		if row.missing || options.DryRun {
+			continue
+		}
+		if _, err := s.db.ExecContext(ctx, "UPDATE archives SET missing_at = ? WHERE id = ?;", now, row.id); err != nil {
+			return SyncReport{}, err
+		}
+	}
+
+	return report, nil
+}
+
+func (s *sqlStore) listSyncRows(ctx context.Context) ([]*syncRow, error) {
+	const query = `
+SELECT id, filename, name, source_url, subject, created_at, size_bytes, content_hash, missing_at, software IS NOT NULL
+FROM archives
+WHERE deleted_at IS NULL AND filename IS NOT NULL
+ORDER BY filename;
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	syncRows := make([]*syncRow, 0)
+	for rows.Next() {
+		var (
+			row       syncRow
+			missingAt sql.NullTime
+		)
+		if err := rows.Scan(&row.id, &row.filename, &row.name, &row.sourceURL, &row.subject, &row.createdAt, &row.sizeBytes, &row.contentHash, &missingAt, &row.described); err != nil {
+			return nil, err
+		}
+		row.missing = missingAt.Valid
+		syncRows = append(syncRows, &row)
+	}
+	return syncRows, rows.Err()
+}
+
+// describeRow reads the details of an archive whose file has not been read
+// yet. Only archives registered from storage without a source URL take the
+// file's source URL and capture date, and its title too unless they were
+// renamed; every other archive only gains the crawler. Files that cannot
+// be read are not tried again.
+func (s *sqlStore) describeRow(ctx context.Context, row *syncRow, describe func(ctx context.Context, filename string) (FileDetails, error)) error {
+	described, err := describe(ctx, row.filename)
+	if err != nil {
+		slog.Warn("failed to read archive file details", "filename", row.filename, "error", err)
+	}
+
+	name, sourceURL, subject, createdAt := row.name, row.sourceURL, row.subject, row.createdAt
+	if err == nil && row.sourceURL == "" && described.SourceURL != "" {
+		if described.Name != "" && row.name == strings.TrimSuffix(row.filename, path.Ext(row.filename)) {
+			name = described.Name
+		}
+		sourceURL, subject = described.SourceURL, described.Subject
+		if !described.CreatedAt.IsZero() {
+			createdAt = described.CreatedAt
+		}
+	}
+
+	const describeQuery = `
+UPDATE archives SET name = ?, source_url = ?, subject = ?, created_at = ?, software = ?
+WHERE id = ?;
+	`
+	_, err = s.db.ExecContext(ctx, describeQuery, name, sourceURL, subject, createdAt, described.Software, row.id)
+	return err
+}
+
+// matchRenamed returns the index of the vanished row holding the same
+// content as object, or -1. Rows synced before hashes were recorded cannot
+// be matched.
+func matchRenamed(gone []*syncRow, object storage.ObjectInfo, hash string) int {
+	for i, row := range gone {
+		if row.contentHash != "" && row.sizeBytes == object.Size && row.contentHash == hash {
+			return i
+		}
+	}
+	return -1
+}
+
+func hashObject(ctx context.Context, backend storage.Backend, key string) (string, error) {
+	reader, err := backend.Get(ctx, key, 0, -1)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,398 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/storage"
+	"github.com/google/uuid"
+)
+
+func writeSyncFile(t *testing.T, dir, filename, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, filename), []byte(content), 0644); err != nil {
+		t.Fatalf("write %s: %v", filename, err)
+	}
+}
+
+func insertSyncArchive(t *testing.T, s *sqlStore, filename string, sizeBytes int64) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	if err := s.Insert(context.Background(), models.Archive{
+		ID:        id,
+		Name:      filename,
+		Filename:  filename,
+		CreatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		SizeBytes: sizeBytes,
+	}); err != nil {
+		t.Fatalf("insert %s: %v", filename, err)
+	}
+	return id
+}
+
+func syncArchive(t *testing.T, s *sqlStore, dir string, options SyncOptions) SyncReport {
+	t.Helper()
+	report, err := s.SyncFromDisk(context.Background(), storage.NewLocal(dir), options)
+	if err != nil {
+		t.Fatalf("sync from disk: %v", err)
+	}
+	return report
+}
+
+func TestSyncFromDiskFlagsMissingFilesAndRecoversThem(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		dir := t.TempDir()
+		id := insertSyncArchive(t, s, "gone.wacz", 4)
+
+		report := syncArchive(t, s, dir, SyncOptions{})
+		if len(report.Missing) != 1 || report.Missing[0].ArchiveID != id {
+			t.Fatalf("expected gone.wacz to be reported missing, got %+v", report.Missing)
+		}
+
+		archive, err := s.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("get archive: %v", err)
+		}
+		if archive.MissingAt == nil {
+			t.Fatal("expected missing archive to be flagged")
+		}
+		flaggedAt := *archive.MissingAt
+
+		// A second run keeps the original flag.
+		syncArchive(t, s, dir, SyncOptions{})
+		archive, _ = s.Get(ctx, id)
+		if archive.MissingAt == nil || !archive.MissingAt.Equal(flaggedAt) {
+			t.Fatalf("expected missing_at to stay %s, got %v", flaggedAt, archive.MissingAt)
+		}
+
+		writeSyncFile(t, dir, "gone.wacz", "back")
+		report = syncArchive(t, s, dir, SyncOptions{})
+		if len(report.Recovered) != 1 || len(report.Missing) != 0 {
+			t.Fatalf("expected archive to be recovered, got %+v", report)
+		}
+		archive, _ = s.Get(ctx, id)
+		if archive.MissingAt != nil {
+			t.Fatalf("expected missing flag to be cleared, got %v", archive.MissingAt)
+		}
+	})
+}
+
+func TestSyncFromDiskRemovesMissingArchives(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		dir := t.TempDir()
+		id := insertSyncArchive(t, s, "gone.wacz", 4)
+
+		report := syncArchive(t, s, dir, SyncOptions{RemoveMissing: true})
+		if len(report.Removed) != 1 || len(report.Missing) != 0 {
+			t.Fatalf("expected gone.wacz to be removed, got %+v", report)
+		}
+		if _, err := s.Get(ctx, id); err == nil {
+			t.Fatal("expected removed archive to be deleted")
+		}
+	})
+}
+
+func TestSyncFromDiskKeepsReferencedMissingArchives(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		dir := t.TempDir()
+		original := insertSyncArchive(t, s, "original.wacz", 4)
+		revisit := insertSyncArchive(t, s, "revisit.wacz", 4)
+		writeSyncFile(t, dir, "revisit.wacz", "next")
+		if err := s.RegisterPayloads(ctx, revisit, nil, []uuid.UUID{original}); err != nil {
+			t.Fatalf("register references: %v", err)
+		}
+
+		report := syncArchive(t, s, dir, SyncOptions{RemoveMissing: true})
+		if len(report.Removed) != 0 || len(report.Missing) != 1 {
+			t.Fatalf("expected referenced archive to be flagged instead of removed, got %+v", report)
+		}
+		archive, err := s.Get(ctx, original)
+		if err != nil {
+			t.Fatalf("get referenced archive: %v", err)
+		}
+		if archive.MissingAt == nil {
+			t.Fatal("expected referenced archive to be flagged missing")
+		}
+	})
+}
+
+func TestSyncFromDiskMatchesRenamedFilesByHash(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		dir := t.TempDir()
+		writeSyncFile(t, dir, "before.wacz", "same bytes")
+		id := insertSyncArchive(t, s, "before.wacz", int64(len("same bytes")))
+
+		// The first run records the hash of the existing file.
+		syncArchive(t, s, dir, SyncOptions{})
+
+		if err := os.Rename(filepath.Join(dir, "before.wacz"), filepath.Join(dir, "after.wacz")); err != nil {
+			t.Fatalf("rename archive: %v", err)
+		}
+		report := syncArchive(t, s, dir, SyncOptions{})
+		if len(report.Renamed) != 1 || len(report.Added) != 0 || len(report.Missing) != 0 {
+			t.Fatalf("expected a single rename, got %+v", report)
+		}
+		if report.Renamed[0].PreviousFilename != "before.wacz" || report.Renamed[0].Filename != "after.wacz" {
+			t.Fatalf("unexpected rename %+v", report.Renamed[0])
+		}
+
+		filename, err := s.GetFilename(ctx, id)
+		if err != nil {
+			t.Fatalf("get filename: %v", err)
+		}
+		if filename != "after.wacz" {
+			t.Fatalf("expected filename to follow the rename, got %q", filename)
+		}
+	})
+}
+
+func TestSyncFromDiskUpdatesChangedSizes(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		dir := t.TempDir()
+		writeSyncFile(t, dir, "grown.wacz", "longer content")
+		id := insertSyncArchive(t, s, "grown.wacz", 3)
+
+		report := syncArchive(t, s, dir, SyncOptions{})
+		if len(report.Resized) != 1 {
+			t.Fatalf("expected a resize, got %+v", report)
+		}
+		if report.Resized[0].PreviousSizeBytes != 3 || report.Resized[0].SizeBytes != int64(len("longer content")) {
+			t.Fatalf("unexpected resize %+v", report.Resized[0])
+		}
+
+		archive, err := s.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("get archive: %v", err)
+		}
+		if archive.SizeBytes != int64(len("longer content")) {
+			t.Fatalf("expected size_bytes to be updated, got %d", archive.SizeBytes)
+		}
+	})
+}
+
+func TestSyncFromDiskDryRunChangesNothing(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		dir := t.TempDir()
+		writeSyncFile(t, dir, "new.wacz", "new")
+		id := insertSyncArchive(t, s, "gone.wacz", 4)
+
+		report := syncArchive(t, s, dir, SyncOptions{DryRun: true, RemoveMissing: true})
+		if !report.DryRun || len(report.Added) != 1 || len(report.Removed) != 1 {
+			t.Fatalf("expected dry run to report an addition and a removal, got %+v", report)
+		}
+
+		archives, err := s.List(ctx)
+		if err != nil {
+			t.Fatalf("list archives: %v", err)
+		}
+		if len(archives) != 1 || archives[0].ID != id || archives[0].MissingAt != nil {
+			t.Fatalf("expected dry run to leave archives untouched, got %+v", archives)
+		}
+	})
+}
+
+func TestSyncFromDiskSkipsRecentlyModifiedFiles(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *sqlStore) {
+		dir := t.TempDir()
+		writeSyncFile(t, dir, "fresh.wacz", "fresh")
+
+		report := syncArchive(t, s, dir, SyncOptions{ModifiedBefore: time.Now().Add(-time.Minute)})
+		if len(report.Added) != 0 || len(report.Deferred) != 1 {
+			t.Fatalf("expected recently modified file to be deferred, got %+v", report)
+		}
+
+		report = syncArchive(t, s, dir, SyncOptions{})
+		if len(report.Added) != 1 {
+			t.Fatalf("expected file to be added without a cutoff, got %+v", report.Added)
+		}
+	})
+}
+
+func TestSyncFromDiskSkipsFilesWithPendingCompletions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *sqlStore) {
+		dir := t.TempDir()
+		writeSyncFile(t, dir, "pending.wacz", "pending")
+		writeSyncFile(t, dir, "copied.wacz", "copied")
+
+		report := syncArchive(t, s, dir, SyncOptions{
+			Pending: func(context.Context) (map[string]bool, error) {
+				return map[string]bool{"pending.wacz": true}, nil
+			},
+		})
+		if len(report.Added) != 1 || report.Added[0].Filename != "copied.wacz" {
+			t.Fatalf("expected only the copied file to be added, got %+v", report.Added)
+		}
+		if len(report.Deferred) != 1 || report.Deferred[0].Filename != "pending.wacz" {
+			t.Fatalf("expected file with a pending completion to be deferred, got %+v", report.Deferred)
+		}
+	})
+}
+
+func TestSyncFromDiskRunsOneSyncAtATime(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *sqlStore) {
+		dir := t.TempDir()
+		writeSyncFile(t, dir, "slow.wacz", "slow")
+
+		started := make(chan struct{})
+		unblock := make(chan struct{})
+		done := make(chan error, 1)
+		go func() {
+			_, err := s.SyncFromDisk(context.Background(), storage.NewLocal(dir), SyncOptions{
+				Describe: func(context.Context, string) (FileDetails, error) {
+					close(started)
+					<-unblock
+					return FileDetails{}, nil
+				},
+			})
+			done <- err
+		}()
+		<-started
+
+		if _, err := s.SyncFromDisk(context.Background(), storage.NewLocal(dir), SyncOptions{NoWait: true}); !errors.Is(err, ErrSyncInProgress) {
+			t.Fatalf("expected ErrSyncInProgress, got %v", err)
+		}
+
+		close(unblock)
+		if err := <-done; err != nil {
+			t.Fatalf("sync from disk: %v", err)
+		}
+		report := syncArchive(t, s, dir, SyncOptions{NoWait: true})
+		if len(report.Added) != 0 {
+			t.Fatalf("expected the file to be registered once, got %+v", report.Added)
+		}
+	})
+}
+
+func TestSyncFromDiskUsesDescribedDetails(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		dir := t.TempDir()
+		writeSyncFile(t, dir, "described.wacz", "described")
+		writeSyncFile(t, dir, "broken.wacz", "broken")
+
+		syncArchive(t, s, dir, SyncOptions{
+			Describe: func(ctx context.Context, filename string) (FileDetails, error) {
+				if filename == "broken.wacz" {
+					return FileDetails{}, errors.New("not a zip file")
+				}
+				return FileDetails{
+					Name:      "Described",
+					SourceURL: "https://example.com/",
+					Subject:   "https://example.com",
+					CreatedAt: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC),
+					Software:  "Browsertrix-Crawler 1.5.0",
+				}, nil
+			},
+		})
+
+		archives, err := s.List(ctx)
+		if err != nil {
+			t.Fatalf("list archives: %v", err)
+		}
+		byFilename := make(map[string]models.Archive)
+		for _, archive := range archives {
+			byFilename[archive.Filename] = archive
+		}
+		described := byFilename["described.wacz"]
+		if described.Name != "Described" || described.Description != "" || described.SourceURL != "https://example.com/" || described.Subject != "https://example.com" || described.Software != "Browsertrix-Crawler 1.5.0" {
+			t.Fatalf("expected described details to be stored, got %+v", described)
+		}
+		if !described.CreatedAt.Equal(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)) {
+			t.Fatalf("expected capture date to be used as created_at, got %s", described.CreatedAt)
+		}
+
+		page, err := s.ListArchives(ctx, ListArchivesOptions{Search: "described"})
+		if err != nil {
+			t.Fatalf("search archives: %v", err)
+		}
+		if len(page.Archives) != 1 || page.Archives[0].ID != described.ID {
+			t.Fatalf("expected described archive to be searchable, got %+v", page.Archives)
+		}
+		if got := byFilename["broken.wacz"]; got.Name != "broken" || got.SourceURL != "" {
+			t.Fatalf("expected undescribed file to be named after the file, got %+v", got)
+		}
+	})
+}
+
+func TestSyncFromDiskBackfillsUndescribedArchives(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		dir := t.TempDir()
+		writeSyncFile(t, dir, "imported.wacz", "imported")
+		writeSyncFile(t, dir, "renamed.wacz", "renamed")
+		syncArchive(t, s, dir, SyncOptions{})
+
+		writeSyncFile(t, dir, "crawl.wacz", "crawl")
+		crawl := models.Archive{ID: uuid.New(), Name: "Weekly", Filename: "crawl.wacz", SourceURL: "https://crawl.example/", Subject: "https://crawl.example", CreatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+		if err := s.Insert(ctx, crawl); err != nil {
+			t.Fatalf("insert crawl archive: %v", err)
+		}
+
+		archives, err := s.List(ctx)
+		if err != nil {
+			t.Fatalf("list archives: %v", err)
+		}
+		for _, archive := range archives {
+			if archive.Filename == "renamed.wacz" {
+				if err := s.UpdateMetadata(ctx, archive.ID, "Kept", "", nil); err != nil {
+					t.Fatalf("rename archive: %v", err)
+				}
+			}
+		}
+
+		capturedAt := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+		described := 0
+		options := SyncOptions{
+			Describe: func(ctx context.Context, filename string) (FileDetails, error) {
+				described++
+				return FileDetails{
+					Name:      "Title of " + filename,
+					SourceURL: "https://example.com/" + filename,
+					Subject:   "https://example.com/" + filename,
+					CreatedAt: capturedAt,
+					Software:  "Browsertrix-Crawler 1.5.0",
+				}, nil
+			},
+		}
+		syncArchive(t, s, dir, options)
+		if described != 3 {
+			t.Fatalf("expected every undescribed archive to be read once, got %d reads", described)
+		}
+
+		archives, err = s.List(ctx)
+		if err != nil {
+			t.Fatalf("list archives: %v", err)
+		}
+		byFilename := make(map[string]models.Archive)
+		for _, archive := range archives {
+			byFilename[archive.Filename] = archive
+		}
+		imported := byFilename["imported.wacz"]
+		if imported.Name != "Title of imported.wacz" || imported.SourceURL != "https://example.com/imported.wacz" || !imported.CreatedAt.Equal(capturedAt) || imported.Software != "Browsertrix-Crawler 1.5.0" {
+			t.Fatalf("expected imported archive to be backfilled, got %+v", imported)
+		}
+		if renamed := byFilename["renamed.wacz"]; renamed.Name != "Kept" || renamed.SourceURL != "https://example.com/renamed.wacz" {
+			t.Fatalf("expected renamed archive to keep its name, got %+v", renamed)
+		}
+		got := byFilename["crawl.wacz"]
+		if got.Name != crawl.Name || got.SourceURL != crawl.SourceURL || !got.CreatedAt.Equal(crawl.CreatedAt) || got.Software != "Browsertrix-Crawler 1.5.0" {
+			t.Fatalf("expected crawl archive to only gain its crawler, got %+v", got)
+		}
+
+		syncArchive(t, s, dir, options)
+		if described != 3 {
+			t.Fatalf("expected described archives not to be read again, got %d reads", described)
+		}
+	})
+}
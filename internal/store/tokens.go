@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/google/uuid"
+)
+
+var ErrAPITokenNotFound = errors.New("api token not found")
+
+const apiTokenColumns = `id, name, scope, user_id, created_at, expires_at, last_used_at`
+
+func scanAPIToken(scanner interface{ Scan(...any) error }) (models.APIToken, error) {
+	var (
+		token                 models.APIToken
+		userId                uuid.NullUUID
+		expiresAt, lastUsedAt sql.NullTime
+	)
+	if err := scanner.Scan(&token.ID, &token.Name, &token.Scope, &userId, &token.CreatedAt, &expiresAt, &lastUsedAt); err != nil {
+		return models.APIToken{}, err
+	}
+	token.CreatedAt = token.CreatedAt.UTC()
+	if userId.Valid {
+		token.UserID = &userId.UUID
+	}
+	if expiresAt.Valid {
+		expiresAt := expiresAt.Time.UTC()
+		token.ExpiresAt = &expiresAt
+	}
+	if lastUsedAt.Valid {
+		lastUsedAt := lastUsedAt.Time.UTC()
+		token.LastUsedAt = &lastUsedAt
+	}
+	return token, nil
+}
+
+func (s *sqlStore) ListAPITokens(ctx context.Context) ([]models.APIToken, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+apiTokenColumns+" FROM api_tokens ORDER BY created_at DESC, id ASC;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := make([]models.APIToken, 0)
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *sqlStore) GetAPIToken(ctx context.Context, tokenId uuid.UUID) (models.APIToken, error) {
+	token, err := scanAPIToken(s.db.QueryRowContext(ctx, "SELECT "+apiTokenColumns+" FROM api_tokens WHERE id = ?;", tokenId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.APIToken{}, ErrAPITokenNotFound
+	}
+	return token, err
+}
+
+// GetAPITokenByHash returns the token whose hash is tokenHash, unless it
+// expired before now.
+func (s *sqlStore) GetAPITokenByHash(ctx context.Context, tokenHash string, now time.Time) (models.APIToken, error) {
+	const query = `
+FROM api_tokens
+WHERE token_hash = ? AND (expires_at IS NULL OR expires_at > ?);
+	`
+
+	token, err := scanAPIToken(s.db.QueryRowContext(ctx, "SELECT "+apiTokenColumns+query, tokenHash, now.UTC()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.APIToken{}, ErrAPITokenNotFound
+	}
+	return token, err
+}
+
+func (s *sqlStore) InsertAPIToken(ctx context.Context, token models.APIToken, tokenHash string) error {
+	const query = `
+INSERT INTO api_tokens (id, name, token_hash, scope, user_id, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?);
+	`
+
+	var expiresAt sql.NullTime
+	if token.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: token.ExpiresAt.UTC(), Valid: true}
+	}
+	var userId uuid.NullUUID
+	if token.UserID != nil {
+		userId = uuid.NullUUID{UUID: *token.UserID, Valid: true}
+	}
+	_, err := s.db.ExecContext(ctx, query, token.ID, token.Name, tokenHash, token.Scope, userId, token.CreatedAt.UTC(), expiresAt)
+	return err
+}
+
+func (s *sqlStore) TouchAPIToken(ctx context.Context, tokenId uuid.UUID, usedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE api_tokens SET last_used_at = ? WHERE id = ?;", usedAt.UTC(), tokenId)
+	return err
+}
+
+func (s *sqlStore) DeleteAPIToken(ctx context.Context, tokenId uuid.UUID) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM api_tokens WHERE id = ?;", tokenId)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
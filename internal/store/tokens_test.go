@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestAPITokens(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		now := time.Now().UTC().Truncate(time.Second)
+
+		user := models.User{ID: uuid.New(), Username: "script", PasswordHash: "hash", CreatedAt: now}
+		if err := s.InsertUser(ctx, user); err != nil {
+			t.Fatalf("insert user: %v", err)
+		}
+
+		expiresAt := now.Add(time.Hour)
+		owned := models.APIToken{ID: uuid.New(), Name: "ci", Scope: models.ScopeCrawl, UserID: &user.ID, CreatedAt: now, ExpiresAt: &expiresAt}
+		if err := s.InsertAPIToken(ctx, owned, "owned-hash"); err != nil {
+			t.Fatalf("insert token: %v", err)
+		}
+		ownerless := models.APIToken{ID: uuid.New(), Name: "backup", Scope: models.ScopeRead, CreatedAt: now.Add(-time.Minute)}
+		if err := s.InsertAPIToken(ctx, ownerless, "ownerless-hash"); err != nil {
+			t.Fatalf("insert token: %v", err)
+		}
+
+		got, err := s.GetAPITokenByHash(ctx, "owned-hash", now)
+		if err != nil {
+			t.Fatalf("get token by hash: %v", err)
+		}
+		if got.ID != owned.ID || got.Scope != models.ScopeCrawl || got.UserID == nil || *got.UserID != user.ID {
+			t.Fatalf("unexpected token: %+v", got)
+		}
+		if got.ExpiresAt == nil || !got.ExpiresAt.Equal(expiresAt) {
+			t.Fatalf("expected expiry %v, got %v", expiresAt, got.ExpiresAt)
+		}
+		if _, err := s.GetAPITokenByHash(ctx, "owned-hash", expiresAt); !errors.Is(err, ErrAPITokenNotFound) {
+			t.Fatalf("expected expired token to be rejected, got %v", err)
+		}
+		if _, err := s.GetAPITokenByHash(ctx, "unknown", now); !errors.Is(err, ErrAPITokenNotFound) {
+			t.Fatalf("expected ErrAPITokenNotFound, got %v", err)
+		}
+
+		if err := s.TouchAPIToken(ctx, ownerless.ID, now); err != nil {
+			t.Fatalf("touch token: %v", err)
+		}
+		got, err = s.GetAPIToken(ctx, ownerless.ID)
+		if err != nil {
+			t.Fatalf("get token: %v", err)
+		}
+		if got.UserID != nil || got.ExpiresAt != nil {
+			t.Fatalf("expected an ownerless token without expiry, got %+v", got)
+		}
+		if got.LastUsedAt == nil || !got.LastUsedAt.Equal(now) {
+			t.Fatalf("expected last use at %v, got %v", now, got.LastUsedAt)
+		}
+
+		tokens, err := s.ListAPITokens(ctx)
+		if err != nil {
+			t.Fatalf("list tokens: %v", err)
+		}
+		if len(tokens) != 2 || tokens[0].ID != owned.ID {
+			t.Fatalf("expected the newest token first, got %+v", tokens)
+		}
+
+		if err := s.DeleteAPIToken(ctx, ownerless.ID); err != nil {
+			t.Fatalf("delete token: %v", err)
+		}
+		if err := s.DeleteAPIToken(ctx, ownerless.ID); !errors.Is(err, ErrAPITokenNotFound) {
+			t.Fatalf("expected ErrAPITokenNotFound, got %v", err)
+		}
+
+		if err := s.DeleteUser(ctx, user.ID); err != nil {
+			t.Fatalf("delete user: %v", err)
+		}
+		if _, err := s.GetAPIToken(ctx, owned.ID); !errors.Is(err, ErrAPITokenNotFound) {
+			t.Fatalf("expected tokens of a deleted user to be removed, got %v", err)
+		}
+	})
+}
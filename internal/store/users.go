@@ -0,0 +1,156 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	ErrUsernameTaken   = errors.New("username already taken")
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+func (s *sqlStore) ListUsers(ctx context.Context) ([]models.User, error) {
+	const query = `
+SELECT id, username, password_hash, is_admin, created_at
+FROM users
+ORDER BY username ASC;
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]models.User, 0)
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		user.CreatedAt = user.CreatedAt.UTC()
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *sqlStore) GetUser(ctx context.Context, userId uuid.UUID) (models.User, error) {
+	const query = `
+SELECT id, username, password_hash, is_admin, created_at
+FROM users
+WHERE id = ?;
+	`
+
+	var user models.User
+	err := s.db.QueryRowContext(ctx, query, userId).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+	user.CreatedAt = user.CreatedAt.UTC()
+	return user, nil
+}
+
+func (s *sqlStore) GetUserByUsername(ctx context.Context, username string) (models.User, error) {
+	const query = `
+SELECT id, username, password_hash, is_admin, created_at
+FROM users
+WHERE username = ?;
+	`
+
+	var user models.User
+	err := s.db.QueryRowContext(ctx, query, username).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, ErrUserNotFound
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+	user.CreatedAt = user.CreatedAt.UTC()
+	return user, nil
+}
+
+func (s *sqlStore) InsertUser(ctx context.Context, user models.User) error {
+	const query = `
+INSERT INTO users (id, username, password_hash, is_admin, created_at) VALUES (?, ?, ?, ?, ?);
+	`
+
+	_, err := s.db.ExecContext(ctx, query, user.ID, user.Username, user.PasswordHash, user.IsAdmin, user.CreatedAt)
+	if isUniqueConstraint(err) {
+		return ErrUsernameTaken
+	}
+	return err
+}
+
+func (s *sqlStore) SetUserAdmin(ctx context.Context, userId uuid.UUID, isAdmin bool) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET is_admin = ? WHERE id = ?;", isAdmin, userId)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// DeleteUser removes a user along with their sessions.
+func (s *sqlStore) DeleteUser(ctx context.Context, userId uuid.UUID) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM users WHERE id = ?;", userId)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) InsertSession(ctx context.Context, tokenHash string, userId uuid.UUID, expiresAt time.Time) error {
+	const query = `
+INSERT INTO sessions (token_hash, user_id, created_at, expires_at) VALUES (?, ?, ?, ?);
+	`
+
+	_, err := s.db.ExecContext(ctx, query, tokenHash, userId, time.Now().UTC(), expiresAt.UTC())
+	return err
+}
+
+// GetSessionUser returns the user holding the session, unless it expired
+// before now.
+func (s *sqlStore) GetSessionUser(ctx context.Context, tokenHash string, now time.Time) (models.User, error) {
+	const query = `
+SELECT u.id, u.username, u.password_hash, u.is_admin, u.created_at
+FROM sessions s
+JOIN users u ON u.id = s.user_id
+WHERE s.token_hash = ? AND s.expires_at > ?;
+	`
+
+	var user models.User
+	err := s.db.QueryRowContext(ctx, query, tokenHash, now.UTC()).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return models.User{}, err
+	}
+	user.CreatedAt = user.CreatedAt.UTC()
+	return user, nil
+}
+
+func (s *sqlStore) DeleteSession(ctx context.Context, tokenHash string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE token_hash = ?;", tokenHash)
+	return err
+}
+
+func (s *sqlStore) DeleteExpiredSessions(ctx context.Context, now time.Time) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE expires_at <= ?;", now.UTC())
+	return err
+}
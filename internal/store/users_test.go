@@ -0,0 +1,201 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/google/uuid"
+)
+
+func TestUsersAndSessions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+		now := time.Now().UTC()
+
+		admin := models.User{ID: uuid.New(), Username: "admin", PasswordHash: "hash", IsAdmin: true, CreatedAt: now}
+		if err := s.InsertUser(ctx, admin); err != nil {
+			t.Fatalf("insert user: %v", err)
+		}
+		if err := s.InsertUser(ctx, models.User{ID: uuid.New(), Username: "admin", PasswordHash: "other", CreatedAt: now}); !errors.Is(err, ErrUsernameTaken) {
+			t.Fatalf("expected ErrUsernameTaken, got %v", err)
+		}
+
+		got, err := s.GetUserByUsername(ctx, "admin")
+		if err != nil {
+			t.Fatalf("get user: %v", err)
+		}
+		if got.ID != admin.ID || !got.IsAdmin || got.PasswordHash != "hash" {
+			t.Fatalf("unexpected user: %+v", got)
+		}
+		if _, err := s.GetUserByUsername(ctx, "nobody"); !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("expected ErrUserNotFound, got %v", err)
+		}
+
+		if err := s.InsertSession(ctx, "live", admin.ID, now.Add(time.Hour)); err != nil {
+			t.Fatalf("insert session: %v", err)
+		}
+		if err := s.InsertSession(ctx, "expired", admin.ID, now.Add(-time.Hour)); err != nil {
+			t.Fatalf("insert session: %v", err)
+		}
+
+		sessionUser, err := s.GetSessionUser(ctx, "live", now)
+		if err != nil {
+			t.Fatalf("get session user: %v", err)
+		}
+		if sessionUser.ID != admin.ID {
+			t.Fatalf("expected session of %s, got %s", admin.ID, sessionUser.ID)
+		}
+		if _, err := s.GetSessionUser(ctx, "expired", now); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("expected expired session to be rejected, got %v", err)
+		}
+
+		if err := s.DeleteExpiredSessions(ctx, now); err != nil {
+			t.Fatalf("delete expired sessions: %v", err)
+		}
+		var sessions int
+		if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sessions;").Scan(&sessions); err != nil {
+			t.Fatalf("count sessions: %v", err)
+		}
+		if sessions != 1 {
+			t.Fatalf("expected 1 session left, got %d", sessions)
+		}
+
+		if err := s.DeleteSession(ctx, "live"); err != nil {
+			t.Fatalf("delete session: %v", err)
+		}
+		if _, err := s.GetSessionUser(ctx, "live", now); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("expected deleted session to be rejected, got %v", err)
+		}
+
+		if err := s.InsertSession(ctx, "again", admin.ID, now.Add(time.Hour)); err != nil {
+			t.Fatalf("insert session: %v", err)
+		}
+		if err := s.DeleteUser(ctx, admin.ID); err != nil {
+			t.Fatalf("delete user: %v", err)
+		}
+		if _, err := s.GetSessionUser(ctx, "again", now); !errors.Is(err, ErrSessionNotFound) {
+			t.Fatalf("expected sessions of a deleted user to be removed, got %v", err)
+		}
+		if err := s.DeleteUser(ctx, admin.ID); !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("expected ErrUserNotFound, got %v", err)
+		}
+
+		users, err := s.ListUsers(ctx)
+		if err != nil {
+			t.Fatalf("list users: %v", err)
+		}
+		if len(users) != 0 {
+			t.Fatalf("expected no users, got %d", len(users))
+		}
+	})
+}
+
+func TestArchiveOwner(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+
+		owner := models.User{ID: uuid.New(), Username: "alice", PasswordHash: "", CreatedAt: time.Now().UTC()}
+		if err := s.InsertUser(ctx, owner); err != nil {
+			t.Fatalf("insert user: %v", err)
+		}
+		archive := models.Archive{ID: uuid.New(), Name: "owned", Filename: "owned.wacz", OwnerID: &owner.ID}
+		if err := s.Insert(ctx, archive); err != nil {
+			t.Fatalf("insert archive: %v", err)
+		}
+
+		got, err := s.Get(ctx, archive.ID)
+		if err != nil {
+			t.Fatalf("get archive: %v", err)
+		}
+		if got.OwnerID == nil || *got.OwnerID != owner.ID || got.Owner != "alice" {
+			t.Fatalf("expected archive owned by alice, got %v %q", got.OwnerID, got.Owner)
+		}
+
+		if err := s.DeleteUser(ctx, owner.ID); err != nil {
+			t.Fatalf("delete user: %v", err)
+		}
+		got, err = s.Get(ctx, archive.ID)
+		if err != nil {
+			t.Fatalf("get archive: %v", err)
+		}
+		if got.OwnerID != nil || got.Owner != "" {
+			t.Fatalf("expected archive of a deleted user to keep no owner, got %v %q", got.OwnerID, got.Owner)
+		}
+	})
+}
+
+func TestArchiveVisibility(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, s *sqlStore) {
+		ctx := context.Background()
+
+		alice := models.User{ID: uuid.New(), Username: "alice", CreatedAt: time.Now().UTC()}
+		if err := s.InsertUser(ctx, alice); err != nil {
+			t.Fatalf("insert user: %v", err)
+		}
+		if err := s.SetUserAdmin(ctx, alice.ID, true); err != nil {
+			t.Fatalf("set admin: %v", err)
+		}
+		if got, err := s.GetUser(ctx, alice.ID); err != nil || !got.IsAdmin {
+			t.Fatalf("expected alice to be an admin, got %+v %v", got, err)
+		}
+		if err := s.SetUserAdmin(ctx, uuid.New(), true); !errors.Is(err, ErrUserNotFound) {
+			t.Fatalf("expected ErrUserNotFound, got %v", err)
+		}
+
+		private := models.Archive{ID: uuid.New(), Name: "private", Filename: "private.wacz", OwnerID: &alice.ID, Visibility: models.VisibilityPrivate, Tags: []string{"secret"}}
+		shared := models.Archive{ID: uuid.New(), Name: "shared", Filename: "shared.wacz", Tags: []string{"news"}}
+		for _, archive := range []models.Archive{private, shared} {
+			if err := s.Insert(ctx, archive); err != nil {
+				t.Fatalf("insert archive: %v", err)
+			}
+		}
+
+		got, err := s.Get(ctx, shared.ID)
+		if err != nil {
+			t.Fatalf("get archive: %v", err)
+		}
+		if got.Visibility != models.VisibilityShared {
+			t.Fatalf("expected archives to be shared by default, got %q", got.Visibility)
+		}
+
+		countVisible := func(viewer *uuid.UUID) int {
+			t.Helper()
+			page, err := s.ListArchives(ctx, ListArchivesOptions{Viewer: viewer})
+			if err != nil {
+				t.Fatalf("list archives: %v", err)
+			}
+			return len(page.Archives)
+		}
+		other := uuid.New()
+		if n := countVisible(nil); n != 2 {
+			t.Fatalf("expected 2 archives without a viewer, got %d", n)
+		}
+		if n := countVisible(&alice.ID); n != 2 {
+			t.Fatalf("expected the owner to see 2 archives, got %d", n)
+		}
+		if n := countVisible(&other); n != 1 {
+			t.Fatalf("expected another user to see 1 archive, got %d", n)
+		}
+
+		tags, err := s.ListTags(ctx, &other)
+		if err != nil {
+			t.Fatalf("list tags: %v", err)
+		}
+		if !equalStrings(tags, []string{"news"}) {
+			t.Fatalf("expected tags of private archives to be hidden, got %v", tags)
+		}
+
+		if err := s.UpdateVisibility(ctx, private.ID, models.VisibilityPublic); err != nil {
+			t.Fatalf("update visibility: %v", err)
+		}
+		if n := countVisible(&other); n != 2 {
+			t.Fatalf("expected a public archive to be visible, got %d", n)
+		}
+		if err := s.UpdateVisibility(ctx, uuid.New(), models.VisibilityPublic); !errors.Is(err, ErrArchiveNotFound) {
+			t.Fatalf("expected ErrArchiveNotFound, got %v", err)
+		}
+	})
+}
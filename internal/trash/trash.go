@@ -0,0 +1,115 @@
+package trash
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/storage"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/google/uuid"
+)
+
+// DirName is the storage prefix that holds trashed archives.
+const DirName = ".trash"
+
+const purgeInterval = time.Hour
+
+// Key returns where a trashed archive's file is kept. Files are keyed by
+// archive ID so trashed archives never collide with each other.
+func Key(archiveId uuid.UUID) string {
+	return DirName + "/" + archiveId.String() + ".wacz"
+}
+
+// Move moves a live archive's file into the trash and flags its row as
+// deleted, putting the file back if the row cannot be updated.
+func Move(ctx context.Context, archiveStore store.Store, backend storage.Backend, archiveId uuid.UUID, filename string, deletedAt time.Time) error {
+	trashKey := Key(archiveId)
+
+	if err := backend.Rename(ctx, filename, trashKey); err != nil {
+		return err
+	}
+
+	if err := archiveStore.Trash(ctx, archiveId, deletedAt); err != nil {
+		if rollbackErr := backend.Rename(ctx, trashKey, filename); rollbackErr != nil {
+			slog.Error("failed to rollback archive file after trash error", "filename", filename, "trash_key", trashKey, "error", rollbackErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+type Purger struct {
+	archiveStore store.Store
+	storage      storage.Backend
+	retention    time.Duration
+}
+
+func NewPurger(archiveStore store.Store, backend storage.Backend, retention time.Duration) *Purger {
+	return &Purger{
+		archiveStore: archiveStore,
+		storage:      backend,
+		retention:    retention,
+	}
+}
+
+// Start purges expired archives immediately and then every purgeInterval
+// until ctx is cancelled.
+func (p *Purger) Start(ctx context.Context) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := p.Purge(ctx, time.Now().UTC()); err != nil && ctx.Err() == nil {
+			slog.Error("failed to purge trash", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge permanently deletes archives that have been in the trash for longer
+// than the retention period and returns how many were removed.
+func (p *Purger) Purge(ctx context.Context, now time.Time) (int, error) {
+	deletedBefore := now.Add(-p.retention)
+	page, err := p.archiveStore.ListArchives(ctx, store.ListArchivesOptions{Trashed: true, DeletedBefore: &deletedBefore})
+	if err != nil {
+		return 0, err
+	}
+
+	// Oldest first, so deduplicated archives go before the archives holding
+	// their payloads.
+	archives := page.Archives
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].DeletedAt.Before(*archives[j].DeletedAt)
+	})
+
+	purged := 0
+	for _, archive := range archives {
+		if err := p.archiveStore.Delete(ctx, archive.ID); err != nil {
+			if errors.Is(err, store.ErrArchiveReferenced) {
+				slog.Info("keeping trashed archive referenced by other archives", "archive_id", archive.ID)
+				continue
+			}
+			if errors.Is(err, store.ErrArchiveNotFound) {
+				continue
+			}
+			return purged, err
+		}
+
+		if err := p.storage.Delete(ctx, Key(archive.ID)); err != nil {
+			slog.Warn("failed to remove purged archive file", "archive_id", archive.ID, "error", err)
+		}
+		purged++
+		slog.Info("purged archive from trash", "archive_id", archive.ID, "filename", archive.Filename, "deleted_at", archive.DeletedAt)
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,87 @@
+package trash
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/models"
+	"github.com/JuanSaenz04/archiver/internal/storage"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStore(t *testing.T) *store.ArchiveStore {
+	t.Helper()
+
+	s, err := store.Open("file:" + uuid.NewString() + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := s.Close(); err != nil {
+			t.Fatalf("close store: %v", err)
+		}
+	})
+	if err := s.RunMigrations(); err != nil {
+		t.Fatalf("run migrations: %v", err)
+	}
+	return s
+}
+
+func trashArchive(t *testing.T, s *store.ArchiveStore, archivesDir string, archive models.Archive, deletedAt time.Time) {
+	t.Helper()
+
+	if err := s.Insert(context.Background(), archive); err != nil {
+		t.Fatalf("insert archive: %v", err)
+	}
+	if err := s.Trash(context.Background(), archive.ID, deletedAt); err != nil {
+		t.Fatalf("trash archive: %v", err)
+	}
+	path := filepath.Join(archivesDir, filepath.FromSlash(Key(archive.ID)))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("create trash directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatalf("write trashed file: %v", err)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	archiveStore := newTestStore(t)
+	archivesDir := t.TempDir()
+	ctx := context.Background()
+	now := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	expired := models.Archive{ID: uuid.New(), Name: "expired", Filename: "expired.wacz"}
+	recent := models.Archive{ID: uuid.New(), Name: "recent", Filename: "recent.wacz"}
+	original := models.Archive{ID: uuid.New(), Name: "original", Filename: "original.wacz"}
+	dependent := models.Archive{ID: uuid.New(), Name: "dependent", Filename: "dependent.wacz"}
+
+	trashArchive(t, archiveStore, archivesDir, expired, now.Add(-31*24*time.Hour))
+	trashArchive(t, archiveStore, archivesDir, recent, now.Add(-time.Hour))
+
+	for _, archive := range []models.Archive{original, dependent} {
+		assert.NoError(t, archiveStore.Insert(ctx, archive))
+	}
+	assert.NoError(t, archiveStore.RegisterPayloads(ctx, dependent.ID, nil, []uuid.UUID{original.ID}))
+	assert.NoError(t, archiveStore.Trash(ctx, dependent.ID, now.Add(-40*24*time.Hour)))
+	assert.NoError(t, archiveStore.Trash(ctx, original.ID, now.Add(-35*24*time.Hour)))
+
+	purger := NewPurger(archiveStore, storage.NewLocal(archivesDir), 30*24*time.Hour)
+	purged, err := purger.Purge(ctx, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, purged)
+
+	assert.NoFileExists(t, filepath.Join(archivesDir, DirName, expired.ID.String()+".wacz"))
+	assert.FileExists(t, filepath.Join(archivesDir, DirName, recent.ID.String()+".wacz"))
+
+	page, err := archiveStore.ListArchives(ctx, store.ListArchivesOptions{Trashed: true})
+	assert.NoError(t, err)
+	if assert.Len(t, page.Archives, 1) {
+		assert.Equal(t, recent.ID, page.Archives[0].ID)
+	}
+}
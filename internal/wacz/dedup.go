@@ -0,0 +1,546 @@
+package wacz
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	indexPath               = "indexes/index.cdxj"
+	datapackagePath         = "datapackage.json"
+	datapackageDigestPath   = "datapackage-digest.json"
+	revisitProfileWARC10    = "http://netpreserve.org/warc/1.0/revisit/identical-payload-digest"
+	revisitProfileWARC11    = "http://netpreserve.org/warc/1.1/revisit/identical-payload-digest"
+	revisitMime             = "warc/revisit"
+	cdxjTimestampLayout     = "20060102150405"
+	warcDateLayout          = "2006-01-02T15:04:05Z"
+	maxWARCHeaderLineLength = 1024 * 1024
+)
+
+// PayloadRef points at the record that already stores a payload.
+type PayloadRef struct {
+	ArchiveID string
+	URL       string
+	Timestamp string
+}
+
+type DedupResult struct {
+	Revisits   int
+	SavedBytes int64
+	ArchiveIDs []string
+}
+
+type memberMove struct {
+	offset  int64
+	length  int64
+	revisit bool
+}
+
+// Deduplicate copies the WACZ at srcPath to dst, replacing every response
+// record whose payload digest is present in known with a revisit record
+// pointing at the stored payload. Indexes and datapackage hashes are
+// rewritten to match the new WARC offsets.
+func Deduplicate(srcPath string, dst io.Writer, known map[string]PayloadRef) (DedupResult, error) {
+	reader, err := Open(srcPath)
+	if err != nil {
+		return DedupResult{}, err
+	}
+	defer reader.Close()
+
+	zw := zip.NewWriter(dst)
+	moves := make(map[string]map[int64]memberMove)
+	hashes := make(map[string]fileHash)
+	referenced := make(map[string]struct{})
+	result := DedupResult{}
+
+	for _, file := range reader.zip.File {
+		switch {
+		case isIndexFile(file.Name), file.Name == datapackagePath, file.Name == datapackageDigestPath:
+			continue
+		case path.Dir(file.Name) == "archive" && strings.HasSuffix(strings.ToLower(file.Name), ".warc.gz"):
+			fileMoves, warcHash, stats, err := rewriteWARC(zw, file, known, referenced)
+			if err != nil {
+				return DedupResult{}, fmt.Errorf("rewrite %s: %w", file.Name, err)
+			}
+			moves[path.Base(file.Name)] = fileMoves
+			hashes[file.Name] = warcHash
+			result.Revisits += stats.Revisits
+			result.SavedBytes += stats.SavedBytes
+		default:
+			if err := zw.Copy(file); err != nil {
+				return DedupResult{}, err
+			}
+		}
+	}
+
+	lines, err := reader.rewriteIndexLines(moves)
+	if err != nil {
+		return DedupResult{}, err
+	}
+	indexHash, err := writeEntry(zw, indexPath, zip.Store, []byte(strings.Join(lines, "\n")+"\n"))
+	if err != nil {
+		return DedupResult{}, err
+	}
+	hashes[indexPath] = indexHash
+
+	if err := reader.rewriteDatapackage(zw, hashes); err != nil {
+		return DedupResult{}, err
+	}
+	if err := zw.Close(); err != nil {
+		return DedupResult{}, err
+	}
+
+	for id := range referenced {
+		result.ArchiveIDs = append(result.ArchiveIDs, id)
+	}
+	sort.Strings(result.ArchiveIDs)
+	return result, nil
+}
+
+type fileHash struct {
+	hash  string
+	bytes int64
+}
+
+type hashingWriter struct {
+	w     io.Writer
+	hash  hash.Hash
+	count int64
+}
+
+func newHashingWriter(w io.Writer) *hashingWriter {
+	return &hashingWriter{w: w, hash: sha256.New()}
+}
+
+func (hw *hashingWriter) Write(p []byte) (int, error) {
+	n, err := hw.w.Write(p)
+	hw.hash.Write(p[:n])
+	hw.count += int64(n)
+	return n, err
+}
+
+func (hw *hashingWriter) result() fileHash {
+	return fileHash{hash: "sha256:" + hex.EncodeToString(hw.hash.Sum(nil)), bytes: hw.count}
+}
+
+func writeEntry(zw *zip.Writer, name string, method uint16, data []byte) (fileHash, error) {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: time.Now().UTC()})
+	if err != nil {
+		return fileHash{}, err
+	}
+	hw := newHashingWriter(w)
+	if _, err := hw.Write(data); err != nil {
+		return fileHash{}, err
+	}
+	return hw.result(), nil
+}
+
+func isIndexFile(name string) bool {
+	if path.Dir(name) != "indexes" {
+		return false
+	}
+	name = strings.ToLower(name)
+	for _, suffix := range []string{".cdx", ".cdxj", ".cdx.gz", ".cdxj.gz", ".idx"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+func (cr *countingReader) ReadByte() (byte, error) {
+	b, err := cr.r.ReadByte()
+	if err == nil {
+		cr.n++
+	}
+	return b, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+func rewriteWARC(zw *zip.Writer, file *zip.File, known map[string]PayloadRef, referenced map[string]struct{}) (map[int64]memberMove, fileHash, DedupResult, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, fileHash{}, DedupResult{}, err
+	}
+	defer rc.Close()
+
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: file.Name, Method: zip.Store, Modified: file.Modified})
+	if err != nil {
+		return nil, fileHash{}, DedupResult{}, err
+	}
+	hw := newHashingWriter(w)
+	out := &countingWriter{w: hw}
+
+	// gzip reads exactly one member at a time from an io.ByteReader, so the
+	// counter yields the compressed offset of every record.
+	in := &countingReader{r: bufio.NewReader(rc)}
+	moves := make(map[int64]memberMove)
+	stats := DedupResult{}
+
+	gz := new(gzip.Reader)
+	for {
+		memberStart := in.n
+		if err := gz.Reset(in); err != nil {
+			if errors.Is(err, io.EOF) {
+				return moves, hw.result(), stats, nil
+			}
+			return nil, fileHash{}, DedupResult{}, err
+		}
+		gz.Multistream(false)
+
+		newStart := out.n
+		revisit, err := rewriteMember(out, bufio.NewReader(gz), known, referenced)
+		if err != nil {
+			return nil, fileHash{}, DedupResult{}, err
+		}
+		newLength := out.n - newStart
+		moves[memberStart] = memberMove{offset: newStart, length: newLength, revisit: revisit}
+		if revisit {
+			stats.Revisits++
+			stats.SavedBytes += (in.n - memberStart) - newLength
+		}
+	}
+}
+
+type warcHeader struct {
+	name  string
+	value string
+}
+
+func rewriteMember(out io.Writer, member *bufio.Reader, known map[string]PayloadRef, referenced map[string]struct{}) (bool, error) {
+	version, headers, raw, err := readWARCHeaders(member)
+	if err != nil {
+		return false, err
+	}
+
+	gw := gzip.NewWriter(out)
+	ref, duplicate := known[headerValue(headers, "WARC-Payload-Digest")]
+	if duplicate && strings.EqualFold(headerValue(headers, "WARC-Type"), "response") {
+		block, err := readHTTPHeaders(member)
+		if err != nil {
+			return false, err
+		}
+		if _, err := io.Copy(io.Discard, member); err != nil {
+			return false, err
+		}
+		if err := writeRevisit(gw, version, headers, block, ref); err != nil {
+			return false, err
+		}
+		referenced[ref.ArchiveID] = struct{}{}
+	} else {
+		duplicate = false
+		if _, err := gw.Write(raw); err != nil {
+			return false, err
+		}
+		if _, err := io.Copy(gw, member); err != nil {
+			return false, err
+		}
+	}
+
+	return duplicate, gw.Close()
+}
+
+func readWARCHeaders(r *bufio.Reader) (string, []warcHeader, []byte, error) {
+	var raw bytes.Buffer
+	version := ""
+	headers := make([]warcHeader, 0)
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("read warc header: %w", err)
+		}
+		if raw.Len()+len(line) > maxWARCHeaderLineLength {
+			return "", nil, nil, errors.New("warc header too large")
+		}
+		raw.Write(line)
+
+		trimmed := strings.TrimRight(string(line), "\r\n")
+		if trimmed == "" {
+			if version == "" {
+				continue
+			}
+			return version, headers, raw.Bytes(), nil
+		}
+		if version == "" {
+			if !strings.HasPrefix(trimmed, "WARC/") {
+				return "", nil, nil, fmt.Errorf("invalid warc version line %q", trimmed)
+			}
+			version = trimmed
+			continue
+		}
+
+		name, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return "", nil, nil, fmt.Errorf("invalid warc header line %q", trimmed)
+		}
+		headers = append(headers, warcHeader{name: strings.TrimSpace(name), value: strings.TrimSpace(value)})
+	}
+}
+
+func readHTTPHeaders(r *bufio.Reader) ([]byte, error) {
+	var block bytes.Buffer
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return nil, fmt.Errorf("read http headers: %w", err)
+		}
+		if block.Len()+len(line) > maxWARCHeaderLineLength {
+			return nil, errors.New("http headers too large")
+		}
+		block.Write(line)
+		if len(bytes.TrimRight(line, "\r\n")) == 0 {
+			return block.Bytes(), nil
+		}
+	}
+}
+
+func headerValue(headers []warcHeader, name string) string {
+	for _, header := range headers {
+		if strings.EqualFold(header.name, name) {
+			return header.value
+		}
+	}
+	return ""
+}
+
+func writeRevisit(w io.Writer, version string, headers []warcHeader, block []byte, ref PayloadRef) error {
+	profile := revisitProfileWARC11
+	if version == "WARC/1.0" {
+		profile = revisitProfileWARC10
+	}
+	blockDigest := sha256.Sum256(block)
+
+	var b bytes.Buffer
+	b.WriteString(version + "\r\n")
+	for _, header := range headers {
+		switch strings.ToLower(header.name) {
+		case "content-length", "warc-block-digest", "warc-truncated", "warc-profile", "warc-refers-to-target-uri", "warc-refers-to-date":
+			continue
+		case "warc-type":
+			header.value = "revisit"
+		}
+		b.WriteString(header.name + ": " + header.value + "\r\n")
+	}
+	b.WriteString("WARC-Profile: " + profile + "\r\n")
+	b.WriteString("WARC-Refers-To-Target-URI: " + ref.URL + "\r\n")
+	if date := warcDate(ref.Timestamp); date != "" {
+		b.WriteString("WARC-Refers-To-Date: " + date + "\r\n")
+	}
+	b.WriteString("WARC-Block-Digest: sha256:" + hex.EncodeToString(blockDigest[:]) + "\r\n")
+	b.WriteString("Content-Length: " + strconv.Itoa(len(block)) + "\r\n\r\n")
+	b.Write(block)
+	b.WriteString("\r\n\r\n")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func warcDate(timestamp string) string {
+	if len(timestamp) < len(cdxjTimestampLayout) {
+		return ""
+	}
+	parsed, err := time.Parse(cdxjTimestampLayout, timestamp[:len(cdxjTimestampLayout)])
+	if err != nil {
+		return ""
+	}
+	return parsed.Format(warcDateLayout)
+}
+
+func (r *Reader) rewriteIndexLines(moves map[string]map[int64]memberMove) ([]string, error) {
+	lines := make([]string, 0)
+	for _, file := range r.zip.File {
+		if !isIndexFile(file.Name) || strings.HasSuffix(strings.ToLower(file.Name), ".idx") {
+			continue
+		}
+		compressed := strings.HasSuffix(strings.ToLower(file.Name), ".gz")
+		err := r.eachLine(file, compressed, func(line []byte) error {
+			rewritten, err := rewriteIndexLine(line, moves)
+			if err != nil {
+				return fmt.Errorf("rewrite %s: %w", file.Name, err)
+			}
+			lines = append(lines, rewritten)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(lines)
+	return lines, nil
+}
+
+func rewriteIndexLine(line []byte, moves map[string]map[int64]memberMove) (string, error) {
+	fields := bytes.SplitN(line, []byte(" "), 3)
+	if len(fields) < 3 || !bytes.HasPrefix(fields[2], []byte("{")) {
+		return string(line), nil
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(fields[2], &values); err != nil {
+		return "", err
+	}
+
+	var filename string
+	if err := json.Unmarshal(values["filename"], &filename); err != nil {
+		return string(line), nil
+	}
+	offset, quoted, err := jsonInt(values["offset"])
+	if err != nil {
+		return string(line), nil
+	}
+	move, ok := moves[path.Base(filename)][offset]
+	if !ok {
+		return string(line), nil
+	}
+
+	values["offset"] = encodeJSONInt(move.offset, quoted)
+	values["length"] = encodeJSONInt(move.length, quoted)
+	if move.revisit {
+		values["mime"] = json.RawMessage(strconv.Quote(revisitMime))
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return string(fields[0]) + " " + string(fields[1]) + " " + string(data), nil
+}
+
+func jsonInt(value json.RawMessage) (int64, bool, error) {
+	var text string
+	if err := json.Unmarshal(value, &text); err == nil {
+		parsed, err := strconv.ParseInt(text, 10, 64)
+		return parsed, true, err
+	}
+	var number int64
+	err := json.Unmarshal(value, &number)
+	return number, false, err
+}
+
+func encodeJSONInt(value int64, quoted bool) json.RawMessage {
+	text := strconv.FormatInt(value, 10)
+	if quoted {
+		return json.RawMessage(strconv.Quote(text))
+	}
+	return json.RawMessage(text)
+}
+
+func (r *Reader) rewriteDatapackage(zw *zip.Writer, hashes map[string]fileHash) error {
+	file := r.file(datapackagePath)
+	if file == nil {
+		return nil
+	}
+
+	data, err := readZipFile(file)
+	if err != nil {
+		return err
+	}
+	var pkg map[string]any
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return fmt.Errorf("parse %s: %w", datapackagePath, err)
+	}
+
+	resources, _ := pkg["resources"].([]any)
+	updated := make([]any, 0, len(resources)+1)
+	for _, item := range resources {
+		resource, ok := item.(map[string]any)
+		if !ok {
+			updated = append(updated, item)
+			continue
+		}
+		resourcePath, _ := resource["path"].(string)
+		if isIndexFile(resourcePath) {
+			continue
+		}
+		if hash, ok := hashes[resourcePath]; ok {
+			resource["hash"] = hash.hash
+			resource["bytes"] = hash.bytes
+		}
+		updated = append(updated, resource)
+	}
+	index := hashes[indexPath]
+	updated = append(updated, map[string]any{
+		"name":  path.Base(indexPath),
+		"path":  indexPath,
+		"hash":  index.hash,
+		"bytes": index.bytes,
+	})
+	pkg["resources"] = updated
+
+	data, err = json.MarshalIndent(pkg, "", "  ")
+	if err != nil {
+		return err
+	}
+	pkgHash, err := writeEntry(zw, datapackagePath, file.Method, data)
+	if err != nil {
+		return err
+	}
+
+	digestFile := r.file(datapackageDigestPath)
+	if digestFile == nil {
+		return nil
+	}
+	digestData, err := readZipFile(digestFile)
+	if err != nil {
+		return err
+	}
+	var digest map[string]any
+	if err := json.Unmarshal(digestData, &digest); err != nil {
+		return fmt.Errorf("parse %s: %w", datapackageDigestPath, err)
+	}
+	// The original signature covers the old datapackage and can no longer
+	// be verified, so it is dropped instead of left dangling.
+	delete(digest, "signedData")
+	digest["hash"] = pkgHash.hash
+	digestData, err = json.MarshalIndent(digest, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = writeEntry(zw, datapackageDigestPath, digestFile.Method, digestData)
+	return err
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
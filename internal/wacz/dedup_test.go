@@ -0,0 +1,230 @@
+package wacz
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testWARCRecord struct {
+	url     string
+	digest  string
+	payload string
+}
+
+func buildTestWARC(t *testing.T, records []testWARCRecord) ([]byte, []string) {
+	t.Helper()
+
+	var warc bytes.Buffer
+	lines := make([]string, 0, len(records))
+	for i, record := range records {
+		block := "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\n" + record.payload
+		header := fmt.Sprintf("WARC/1.1\r\nWARC-Type: response\r\nWARC-Record-ID: <urn:uuid:%d>\r\nWARC-Target-URI: %s\r\nWARC-Date: 2026-04-01T00:00:0%dZ\r\nWARC-Payload-Digest: %s\r\nContent-Type: application/http; msgtype=response\r\nContent-Length: %d\r\n\r\n",
+			i, record.url, i, record.digest, len(block))
+
+		offset := warc.Len()
+		gz := gzip.NewWriter(&warc)
+		if _, err := gz.Write([]byte(header + block + "\r\n\r\n")); err != nil {
+			t.Fatalf("write warc record: %v", err)
+		}
+		if err := gz.Close(); err != nil {
+			t.Fatalf("close warc record: %v", err)
+		}
+		lines = append(lines, fmt.Sprintf(`com,example)/%d 2026040100000%d {"url":%q,"mime":"text/plain","status":"200","digest":%q,"length":"%d","offset":"%d","filename":"data.warc.gz"}`,
+			i, i, record.url, record.digest, warc.Len()-offset, offset))
+	}
+	return warc.Bytes(), lines
+}
+
+func readZipEntry(t *testing.T, reader *Reader, name string) []byte {
+	t.Helper()
+
+	file := reader.file(name)
+	if file == nil {
+		t.Fatalf("missing %s", name)
+	}
+	data, err := readZipFile(file)
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return data
+}
+
+func readMember(t *testing.T, warc []byte, offset, length int64) string {
+	t.Helper()
+
+	gz, err := gzip.NewReader(bytes.NewReader(warc[offset : offset+length]))
+	if err != nil {
+		t.Fatalf("open warc member: %v", err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("read warc member: %v", err)
+	}
+	return string(data)
+}
+
+func TestDeduplicate(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "src.wacz")
+	largePayload := strings.Repeat("shared stylesheet ", 4096)
+	warc, lines := buildTestWARC(t, []testWARCRecord{
+		{url: "https://example.com/style.css", digest: "sha256:shared", payload: largePayload},
+		{url: "https://example.com/", digest: "sha256:fresh", payload: "new home page"},
+	})
+	writeTestWACZ(t, srcPath, map[string][]byte{
+		"archive/data.warc.gz":    warc,
+		"indexes/index.cdx.gz":    gzipBytes(t, strings.Join(lines, "\n")+"\n"),
+		"indexes/index.idx":       []byte("!meta 0 {}\n"),
+		"pages/pages.jsonl":       []byte(`{"url":"https://example.com/","text":"new home page"}` + "\n"),
+		"datapackage.json":        []byte(`{"profile":"data-package","resources":[{"name":"data.warc.gz","path":"archive/data.warc.gz","hash":"sha256:old","bytes":1},{"name":"index.cdx.gz","path":"indexes/index.cdx.gz","hash":"sha256:old","bytes":1}]}`),
+		"datapackage-digest.json": []byte(`{"path":"datapackage.json","hash":"sha256:old","signedData":{"signature":"stale"}}`),
+	})
+
+	var out bytes.Buffer
+	result, err := Deduplicate(srcPath, &out, map[string]PayloadRef{
+		"sha256:shared": {ArchiveID: "previous-archive", URL: "https://example.com/style.css", Timestamp: "20260325120000"},
+	})
+	if err != nil {
+		t.Fatalf("deduplicate: %v", err)
+	}
+	if result.Revisits != 1 || result.SavedBytes <= 0 {
+		t.Fatalf("unexpected dedup result: %#v", result)
+	}
+	if len(result.ArchiveIDs) != 1 || result.ArchiveIDs[0] != "previous-archive" {
+		t.Fatalf("unexpected referenced archives: %v", result.ArchiveIDs)
+	}
+
+	dstPath := filepath.Join(dir, "dst.wacz")
+	if err := os.WriteFile(dstPath, out.Bytes(), 0644); err != nil {
+		t.Fatalf("write deduplicated wacz: %v", err)
+	}
+	reader, err := Open(dstPath)
+	if err != nil {
+		t.Fatalf("open deduplicated wacz: %v", err)
+	}
+	defer reader.Close()
+
+	if reader.file("indexes/index.cdx.gz") != nil || reader.file("indexes/index.idx") != nil {
+		t.Fatal("expected compressed indexes to be replaced")
+	}
+	newWARC := readZipEntry(t, reader, "archive/data.warc.gz")
+	if int64(len(newWARC)) >= int64(len(warc)) {
+		t.Fatalf("expected smaller warc, got %d >= %d", len(newWARC), len(warc))
+	}
+
+	records, err := reader.IndexRecords()
+	if err != nil {
+		t.Fatalf("read index records: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 index records, got %#v", records)
+	}
+	for _, record := range records {
+		var offset, length int64
+		fmt.Sscan(record.Offset, &offset)
+		fmt.Sscan(record.Length, &length)
+		member := readMember(t, newWARC, offset, length)
+
+		switch record.URL {
+		case "https://example.com/style.css":
+			if record.Mime != "warc/revisit" {
+				t.Fatalf("expected revisit mime, got %q", record.Mime)
+			}
+			for _, want := range []string{
+				"WARC-Type: revisit",
+				"WARC-Profile: http://netpreserve.org/warc/1.1/revisit/identical-payload-digest",
+				"WARC-Refers-To-Target-URI: https://example.com/style.css",
+				"WARC-Refers-To-Date: 2026-03-25T12:00:00Z",
+				"WARC-Payload-Digest: sha256:shared",
+			} {
+				if !strings.Contains(member, want) {
+					t.Fatalf("revisit record missing %q:\n%s", want, member)
+				}
+			}
+			if strings.Contains(member, "shared stylesheet") {
+				t.Fatal("revisit record should not contain the payload")
+			}
+		case "https://example.com/":
+			if !strings.Contains(member, "WARC-Type: response") || !strings.Contains(member, "new home page") {
+				t.Fatalf("unexpected response record:\n%s", member)
+			}
+		}
+	}
+
+	var pkg struct {
+		Resources []struct {
+			Path  string `json:"path"`
+			Hash  string `json:"hash"`
+			Bytes int64  `json:"bytes"`
+		} `json:"resources"`
+	}
+	pkgData := readZipEntry(t, reader, "datapackage.json")
+	if err := json.Unmarshal(pkgData, &pkg); err != nil {
+		t.Fatalf("parse datapackage: %v", err)
+	}
+	paths := make([]string, 0, len(pkg.Resources))
+	for _, resource := range pkg.Resources {
+		paths = append(paths, resource.Path)
+		data := readZipEntry(t, reader, resource.Path)
+		sum := sha256.Sum256(data)
+		if resource.Hash != "sha256:"+hex.EncodeToString(sum[:]) || resource.Bytes != int64(len(data)) {
+			t.Fatalf("stale datapackage entry for %s: %#v", resource.Path, resource)
+		}
+	}
+	if !equal(paths, []string{"archive/data.warc.gz", "indexes/index.cdxj"}) {
+		t.Fatalf("unexpected datapackage resources: %v", paths)
+	}
+
+	var digest map[string]any
+	if err := json.Unmarshal(readZipEntry(t, reader, "datapackage-digest.json"), &digest); err != nil {
+		t.Fatalf("parse datapackage digest: %v", err)
+	}
+	pkgSum := sha256.Sum256(pkgData)
+	if digest["hash"] != "sha256:"+hex.EncodeToString(pkgSum[:]) {
+		t.Fatalf("stale datapackage digest: %v", digest["hash"])
+	}
+	if _, ok := digest["signedData"]; ok {
+		t.Fatal("expected stale signature to be dropped")
+	}
+
+	if _, err := reader.Pages(); err != nil {
+		t.Fatalf("pages should be copied unchanged: %v", err)
+	}
+}
+
+func TestDeduplicateKeepsWACZWithoutKnownPayloads(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "src.wacz")
+	warc, lines := buildTestWARC(t, []testWARCRecord{{url: "https://example.com/", digest: "sha256:fresh", payload: "hello"}})
+	writeTestWACZ(t, srcPath, map[string][]byte{
+		"archive/data.warc.gz": warc,
+		"indexes/index.cdxj":   []byte(strings.Join(lines, "\n") + "\n"),
+	})
+
+	var out bytes.Buffer
+	result, err := Deduplicate(srcPath, &out, nil)
+	if err != nil {
+		t.Fatalf("deduplicate: %v", err)
+	}
+	if result.Revisits != 0 || result.SavedBytes != 0 || len(result.ArchiveIDs) != 0 {
+		t.Fatalf("unexpected dedup result: %#v", result)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("open output: %v", err)
+	}
+	if len(zr.File) != 2 {
+		t.Fatalf("expected warc and index entries, got %d", len(zr.File))
+	}
+}
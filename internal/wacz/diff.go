@@ -0,0 +1,335 @@
+package wacz
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	diffContextLines = 3
+	maxDiffLines     = 2000
+)
+
+type URLChanges struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+func (changes URLChanges) Empty() bool {
+	return len(changes.Added) == 0 && len(changes.Removed) == 0 && len(changes.Changed) == 0
+}
+
+type TextChange struct {
+	URL  string `json:"url"`
+	Diff string `json:"diff"`
+}
+
+// DiffIndexes compares the latest capture of every URL in two indexes by
+// payload digest.
+func DiffIndexes(from, to []IndexRecord) URLChanges {
+	fromDigests := latestDigests(from)
+	toDigests := latestDigests(to)
+
+	changes := URLChanges{
+		Added:   make([]string, 0),
+		Removed: make([]string, 0),
+		Changed: make([]string, 0),
+	}
+	for url, digest := range toDigests {
+		previous, ok := fromDigests[url]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, url)
+		case previous != digest:
+			changes.Changed = append(changes.Changed, url)
+		}
+	}
+	for url := range fromDigests {
+		if _, ok := toDigests[url]; !ok {
+			changes.Removed = append(changes.Removed, url)
+		}
+	}
+
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Removed)
+	sort.Strings(changes.Changed)
+	return changes
+}
+
+func latestDigests(records []IndexRecord) map[string]string {
+	latest := make(map[string]IndexRecord, len(records))
+	for _, record := range records {
+		if current, ok := latest[record.URL]; ok && current.Timestamp > record.Timestamp {
+			continue
+		}
+		latest[record.URL] = record
+	}
+
+	digests := make(map[string]string, len(latest))
+	for url, record := range latest {
+		digests[url] = record.Digest
+	}
+	return digests
+}
+
+// DiffPages returns a unified diff of the extracted text of every page
+// whose text differs between the two captures. Pages that exist in only
+// one capture are diffed against empty text.
+func DiffPages(from, to []Page) []TextChange {
+	fromText := pageTexts(from)
+	toText := pageTexts(to)
+
+	urls := make([]string, 0, len(fromText)+len(toText))
+	for url := range fromText {
+		urls = append(urls, url)
+	}
+	for url := range toText {
+		if _, ok := fromText[url]; !ok {
+			urls = append(urls, url)
+		}
+	}
+	sort.Strings(urls)
+
+	changes := make([]TextChange, 0)
+	for _, url := range urls {
+		if fromText[url] == toText[url] {
+			continue
+		}
+		changes = append(changes, TextChange{URL: url, Diff: DiffText(fromText[url], toText[url])})
+	}
+	return changes
+}
+
+func pageTexts(pages []Page) map[string]string {
+	texts := make(map[string]string, len(pages))
+	for _, page := range pages {
+		texts[page.URL] = page.Text
+	}
+	return texts
+}
+
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// DiffText returns a line-based unified diff between two texts, or an
+// empty string if they are equal.
+func DiffText(from, to string) string {
+	if from == to {
+		return ""
+	}
+
+	ops := diffLines(splitLines(from), splitLines(to))
+
+	var b strings.Builder
+	for start := 0; start < len(ops); {
+		if ops[start].kind == ' ' {
+			start++
+			continue
+		}
+
+		hunkStart := max(start-diffContextLines, 0)
+		hunkEnd := start
+		for lastChange := start; hunkEnd < len(ops); hunkEnd++ {
+			if ops[hunkEnd].kind != ' ' {
+				lastChange = hunkEnd
+			} else if hunkEnd-lastChange > 2*diffContextLines {
+				break
+			}
+		}
+		hunkEnd = min(trimTrailingContext(ops, hunkEnd), len(ops))
+
+		fromLine, toLine := lineNumbers(ops[:hunkStart])
+		fromCount, toCount := lineNumbers(ops[hunkStart:hunkEnd])
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n", hunkLine(fromLine, fromCount), fromCount, hunkLine(toLine, toCount), toCount)
+		for _, op := range ops[hunkStart:hunkEnd] {
+			b.WriteByte(op.kind)
+			b.WriteString(op.line)
+			b.WriteByte('\n')
+		}
+		start = hunkEnd
+	}
+	return b.String()
+}
+
+func trimTrailingContext(ops []diffOp, end int) int {
+	lastChange := end - 1
+	for lastChange >= 0 && ops[lastChange].kind == ' ' {
+		lastChange--
+	}
+	return lastChange + 1 + diffContextLines
+}
+
+func lineNumbers(ops []diffOp) (int, int) {
+	from, to := 0, 0
+	for _, op := range ops {
+		if op.kind != '+' {
+			from++
+		}
+		if op.kind != '-' {
+			to++
+		}
+	}
+	return from, to
+}
+
+func hunkLine(offset, count int) int {
+	if count == 0 {
+		return offset
+	}
+	return offset + 1
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines computes a shortest edit script with Myers' algorithm, using
+// its linear space variant. Inputs that still differ in more than
+// maxDiffLines lines once their common prefix and suffix are removed are
+// reported as a full replacement to keep the running time bounded.
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{kind: ' ', line: line})
+	}
+	middleA, middleB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(middleA)+len(middleB) > maxDiffLines {
+		for _, line := range middleA {
+			ops = append(ops, diffOp{kind: '-', line: line})
+		}
+		for _, line := range middleB {
+			ops = append(ops, diffOp{kind: '+', line: line})
+		}
+	} else {
+		ops = append(ops, myers(middleA, middleB)...)
+	}
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{kind: ' ', line: line})
+	}
+	return ops
+}
+
+func myers(a, b []string) []diffOp {
+	size := 2*((len(a)+len(b)+1)/2) + 3
+	diff := myersDiff{a: a, b: b, forward: make([]int, size), backward: make([]int, size)}
+	diff.ops = make([]diffOp, 0, len(a)+len(b))
+	diff.compare(0, len(a), 0, len(b))
+	return diff.ops
+}
+
+// myersDiff splits the edit graph at the middle snake of a shortest path
+// and recurses into both halves, so only two diagonal arrays are kept
+// instead of one per edit distance.
+type myersDiff struct {
+	a, b              []string
+	forward, backward []int
+	ops               []diffOp
+}
+
+func (diff *myersDiff) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && diff.a[aLo] == diff.b[bLo] {
+		diff.ops = append(diff.ops, diffOp{kind: ' ', line: diff.a[aLo]})
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && diff.a[aHi-1-suffix] == diff.b[bHi-1-suffix] {
+		suffix++
+	}
+	aHi -= suffix
+	bHi -= suffix
+
+	switch {
+	case aLo == aHi:
+		for _, line := range diff.b[bLo:bHi] {
+			diff.ops = append(diff.ops, diffOp{kind: '+', line: line})
+		}
+	case bLo == bHi:
+		for _, line := range diff.a[aLo:aHi] {
+			diff.ops = append(diff.ops, diffOp{kind: '-', line: line})
+		}
+	default:
+		// Both sides are non-empty and differ at either end, so the edit
+		// distance is at least two and both halves are strictly smaller.
+		x, y, u, v := diff.middleSnake(aLo, aHi, bLo, bHi)
+		diff.compare(aLo, x, bLo, y)
+		for _, line := range diff.a[x:u] {
+			diff.ops = append(diff.ops, diffOp{kind: ' ', line: line})
+		}
+		diff.compare(u, aHi, v, bHi)
+	}
+
+	for _, line := range diff.a[aHi : aHi+suffix] {
+		diff.ops = append(diff.ops, diffOp{kind: ' ', line: line})
+	}
+}
+
+// middleSnake runs the search from both corners of the edit graph until the
+// paths overlap and returns the start and end of the snake where they met.
+func (diff *myersDiff) middleSnake(aLo, aHi, bLo, bHi int) (int, int, int, int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	maxEdits := (n + m + 1) / 2
+	offset := maxEdits + 1
+	forward, backward := diff.forward, diff.backward
+	forward[offset+1] = 0
+	backward[offset+1] = 0
+
+	for d := 0; d <= maxEdits; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && diff.a[aLo+x] == diff.b[bLo+y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			if reverseK := delta - k; odd && reverseK >= -(d-1) && reverseK <= d-1 && x+backward[offset+reverseK] >= n {
+				return aLo + startX, bLo + startY, aLo + x, bLo + y
+			}
+		}
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && diff.a[aHi-1-x] == diff.b[bHi-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			if forwardK := delta - k; !odd && forwardK >= -d && forwardK <= d && x+forward[offset+forwardK] >= n {
+				return aHi - x, bHi - y, aHi - startX, bHi - startY
+			}
+		}
+	}
+	return aLo, bLo, aLo, bLo
+}
@@ -0,0 +1,125 @@
+package wacz
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDiffIndexes(t *testing.T) {
+	from := []IndexRecord{
+		{URL: "https://example.com/", Timestamp: "20260401000000", Digest: "sha256:old-home"},
+		{URL: "https://example.com/style.css", Timestamp: "20260401000000", Digest: "sha256:css"},
+		{URL: "https://example.com/gone", Timestamp: "20260401000000", Digest: "sha256:gone"},
+	}
+	to := []IndexRecord{
+		{URL: "https://example.com/", Timestamp: "20260408000000", Digest: "sha256:stale"},
+		{URL: "https://example.com/", Timestamp: "20260408000001", Digest: "sha256:new-home"},
+		{URL: "https://example.com/style.css", Timestamp: "20260408000000", Digest: "sha256:css"},
+		{URL: "https://example.com/new", Timestamp: "20260408000000", Digest: "sha256:new"},
+	}
+
+	changes := DiffIndexes(from, to)
+	if !equal(changes.Added, []string{"https://example.com/new"}) {
+		t.Fatalf("unexpected added urls: %v", changes.Added)
+	}
+	if !equal(changes.Removed, []string{"https://example.com/gone"}) {
+		t.Fatalf("unexpected removed urls: %v", changes.Removed)
+	}
+	if !equal(changes.Changed, []string{"https://example.com/"}) {
+		t.Fatalf("unexpected changed urls: %v", changes.Changed)
+	}
+}
+
+func TestDiffText(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want string
+	}{
+		{name: "equal", from: "a\nb", to: "a\nb", want: ""},
+		{
+			name: "changed line with context",
+			from: "1\n2\n3\n4\n5\n6\n7\n8",
+			to:   "1\n2\n3\n4\nfive\n6\n7\n8",
+			want: "@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{name: "from empty", from: "", to: "a\nb", want: "@@ -0,0 +1,2 @@\n+a\n+b\n"},
+		{name: "to empty", from: "a", to: "", want: "@@ -1,1 +0,0 @@\n-a\n"},
+		{
+			name: "separate hunks",
+			from: "a\n1\n2\n3\n4\n5\n6\n7\n8\nb",
+			to:   "A\n1\n2\n3\n4\n5\n6\n7\n8\nB",
+			want: "@@ -1,4 +1,4 @@\n-a\n+A\n 1\n 2\n 3\n@@ -7,4 +7,4 @@\n 6\n 7\n 8\n-b\n+B\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DiffText(tt.from, tt.to); got != tt.want {
+				t.Fatalf("DiffText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffTextLargeInput(t *testing.T) {
+	var from, to strings.Builder
+	for i := range 900 {
+		fmt.Fprintf(&from, "line %d\n", i)
+		if i%10 == 5 {
+			fmt.Fprintf(&to, "changed %d\n", i)
+		} else {
+			fmt.Fprintf(&to, "line %d\n", i)
+		}
+	}
+
+	removed, added := 0, 0
+	for _, line := range strings.Split(DiffText(from.String(), to.String()), "\n") {
+		switch {
+		case strings.HasPrefix(line, "-"):
+			removed++
+		case strings.HasPrefix(line, "+"):
+			added++
+		}
+	}
+	if removed != 90 || added != 90 {
+		t.Fatalf("expected 90 removed and 90 added lines, got %d and %d", removed, added)
+	}
+}
+
+func TestDiffPages(t *testing.T) {
+	from := []Page{
+		{URL: "https://example.com/", Text: "welcome"},
+		{URL: "https://example.com/same", Text: "unchanged"},
+	}
+	to := []Page{
+		{URL: "https://example.com/", Text: "welcome back"},
+		{URL: "https://example.com/same", Text: "unchanged"},
+		{URL: "https://example.com/new", Text: "fresh"},
+	}
+
+	changes := DiffPages(from, to)
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 text changes, got %#v", changes)
+	}
+	if changes[0].URL != "https://example.com/" || changes[0].Diff != "@@ -1,1 +1,1 @@\n-welcome\n+welcome back\n" {
+		t.Fatalf("unexpected home diff: %#v", changes[0])
+	}
+	if changes[1].URL != "https://example.com/new" || changes[1].Diff != "@@ -0,0 +1,1 @@\n+fresh\n" {
+		t.Fatalf("unexpected new page diff: %#v", changes[1])
+	}
+}
+
+func equal(left, right []string) bool {
+	if len(left) != len(right) {
+		return false
+	}
+	for i := range left {
+		if left[i] != right[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package wacz
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Metadata describes a WACZ from its own contents, for archives that were
+// not recorded by a crawl.
+type Metadata struct {
+	Title     string
+	SourceURL string
+	CreatedAt time.Time
+	Software  string
+}
+
+var errStopLines = errors.New("stop reading lines")
+
+// Metadata reads the title, creation date and software from
+// datapackage.json, and the source URL from its main page. The first seed of
+// pages/pages.jsonl, or its first page when none is marked as a seed, fills
+// in whatever the datapackage leaves out.
+func (r *Reader) Metadata() (Metadata, error) {
+	var metadata Metadata
+
+	if file := r.file(datapackagePath); file != nil {
+		data, err := readZipFile(file)
+		if err != nil {
+			return Metadata{}, err
+		}
+		var pkg struct {
+			Title       string `json:"title"`
+			MainPageURL string `json:"mainPageURL"`
+			Created     string `json:"created"`
+			Software    string `json:"software"`
+		}
+		if err := json.Unmarshal(data, &pkg); err != nil {
+			return Metadata{}, fmt.Errorf("parse %s: %w", datapackagePath, err)
+		}
+		metadata.Title = strings.TrimSpace(pkg.Title)
+		metadata.SourceURL = strings.TrimSpace(pkg.MainPageURL)
+		metadata.CreatedAt = parseTime(pkg.Created)
+		metadata.Software = strings.TrimSpace(pkg.Software)
+	}
+
+	if metadata.Title != "" && metadata.SourceURL != "" && !metadata.CreatedAt.IsZero() {
+		return metadata, nil
+	}
+
+	seed, err := r.firstSeed()
+	if err != nil {
+		return Metadata{}, err
+	}
+	if metadata.Title == "" {
+		metadata.Title = strings.TrimSpace(seed.Title)
+	}
+	if metadata.SourceURL == "" {
+		metadata.SourceURL = seed.URL
+	}
+	if metadata.CreatedAt.IsZero() {
+		metadata.CreatedAt = parseTime(seed.TS)
+	}
+	return metadata, nil
+}
+
+func (r *Reader) firstSeed() (Page, error) {
+	file := r.file("pages/pages.jsonl")
+	if file == nil {
+		return Page{}, nil
+	}
+
+	var first Page
+	err := r.eachLine(file, false, func(line []byte) error {
+		var page Page
+		if err := json.Unmarshal(line, &page); err != nil {
+			return fmt.Errorf("parse %s: %w", file.Name, err)
+		}
+		if page.URL == "" {
+			return nil
+		}
+		if page.Seed {
+			first = page
+			return errStopLines
+		}
+		if first.URL == "" {
+			first = page
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopLines) {
+		return Page{}, err
+	}
+	return first, nil
+}
+
+func parseTime(value string) time.Time {
+	parsed, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(value))
+	if err != nil {
+		return time.Time{}
+	}
+	return parsed.UTC()
+}
@@ -0,0 +1,244 @@
+package wacz
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/JuanSaenz04/archiver/internal/storage"
+)
+
+const maxLineSize = 64 * 1024 * 1024
+
+type Reader struct {
+	zip    *zip.Reader
+	closer io.Closer
+}
+
+type IndexRecord struct {
+	URL       string `json:"url"`
+	Timestamp string `json:"-"`
+	Digest    string `json:"digest"`
+	Mime      string `json:"mime"`
+	Status    string `json:"status"`
+	Filename  string `json:"filename"`
+	Offset    string `json:"offset"`
+	Length    string `json:"length"`
+}
+
+// IsResponse reports whether the record indexes an HTTP response, or a
+// revisit of one, rather than a request, page info or other resource record.
+func (record IndexRecord) IsResponse() bool {
+	if !strings.HasPrefix(record.URL, "http://") && !strings.HasPrefix(record.URL, "https://") {
+		return false
+	}
+	return record.Digest != "" && record.Status != ""
+}
+
+type Page struct {
+	ID    string `json:"id"`
+	URL   string `json:"url"`
+	Title string `json:"title"`
+	TS    string `json:"ts"`
+	Text  string `json:"text"`
+	Seed  bool   `json:"seed"`
+}
+
+func Open(path string) (*Reader, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{zip: &r.Reader, closer: r}, nil
+}
+
+// NewReader reads a WACZ from r, such as an archive held by a remote storage
+// backend. Closing the Reader closes r when it implements io.Closer.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	closer, _ := r.(io.Closer)
+	return &Reader{zip: zr, closer: closer}, nil
+}
+
+// OpenObject reads the WACZ stored under key in backend.
+func OpenObject(ctx context.Context, backend storage.Backend, key string) (*Reader, error) {
+	r, size, err := storage.OpenReaderAt(ctx, backend, key)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := NewReader(r, size)
+	if err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+func (r *Reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// IndexRecords returns every CDXJ record stored under indexes/, reading
+// plain and gzip-compressed indexes alike.
+func (r *Reader) IndexRecords() ([]IndexRecord, error) {
+	records := make([]IndexRecord, 0)
+	for _, file := range r.zip.File {
+		if path.Dir(file.Name) != "indexes" {
+			continue
+		}
+
+		name := strings.ToLower(file.Name)
+		compressed := strings.HasSuffix(name, ".cdx.gz") || strings.HasSuffix(name, ".cdxj.gz")
+		if !compressed && !strings.HasSuffix(name, ".cdx") && !strings.HasSuffix(name, ".cdxj") {
+			continue
+		}
+
+		err := r.eachLine(file, compressed, func(line []byte) error {
+			record, ok, err := parseIndexLine(line)
+			if err != nil {
+				return fmt.Errorf("parse %s: %w", file.Name, err)
+			}
+			if ok {
+				records = append(records, record)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// Pages returns the entries of pages/pages.jsonl followed by
+// pages/extraPages.jsonl, skipping their format header lines.
+func (r *Reader) Pages() ([]Page, error) {
+	pages := make([]Page, 0)
+	for _, name := range []string{"pages/pages.jsonl", "pages/extraPages.jsonl"} {
+		file := r.file(name)
+		if file == nil {
+			continue
+		}
+
+		err := r.eachLine(file, false, func(line []byte) error {
+			var page Page
+			if err := json.Unmarshal(line, &page); err != nil {
+				return fmt.Errorf("parse %s: %w", name, err)
+			}
+			if page.URL != "" {
+				pages = append(pages, page)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pages, nil
+}
+
+func (r *Reader) file(name string) *zip.File {
+	for _, file := range r.zip.File {
+		if file.Name == name {
+			return file
+		}
+	}
+	return nil
+}
+
+func (r *Reader) eachLine(file *zip.File, compressed bool, fn func(line []byte) error) error {
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	var src io.Reader = rc
+	if compressed {
+		gz, err := gzip.NewReader(rc)
+		if err != nil {
+			return fmt.Errorf("open %s: %w", file.Name, err)
+		}
+		defer gz.Close()
+		src = gz
+	}
+
+	scanner := bufio.NewScanner(src)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func parseIndexLine(line []byte) (IndexRecord, bool, error) {
+	fields := bytes.SplitN(line, []byte(" "), 3)
+	if len(fields) < 3 || !bytes.HasPrefix(fields[2], []byte("{")) {
+		// Legacy space-delimited CDX lines and headers carry no JSON block.
+		return IndexRecord{}, false, nil
+	}
+
+	var block struct {
+		URL      string     `json:"url"`
+		Digest   string     `json:"digest"`
+		Mime     string     `json:"mime"`
+		Status   flexString `json:"status"`
+		Filename string     `json:"filename"`
+		Offset   flexString `json:"offset"`
+		Length   flexString `json:"length"`
+	}
+	if err := json.Unmarshal(fields[2], &block); err != nil {
+		return IndexRecord{}, false, err
+	}
+	record := IndexRecord{
+		URL:       block.URL,
+		Timestamp: string(fields[1]),
+		Digest:    block.Digest,
+		Mime:      block.Mime,
+		Status:    string(block.Status),
+		Filename:  block.Filename,
+		Offset:    string(block.Offset),
+		Length:    string(block.Length),
+	}
+	return record, record.URL != "", nil
+}
+
+// flexString accepts both quoted and bare numbers, since indexers disagree
+// on how CDXJ offsets, lengths and statuses are encoded.
+type flexString string
+
+func (value *flexString) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*value = flexString(s)
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return err
+	}
+	*value = flexString(number)
+	return nil
+}
@@ -0,0 +1,183 @@
+package wacz
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestWACZ(t *testing.T, path string, files map[string][]byte) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("write wacz: %v", err)
+	}
+}
+
+func gzipBytes(t *testing.T, data string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write([]byte(data)); err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("close gzip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestReaderIndexRecordsAndPages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wacz")
+	writeTestWACZ(t, path, map[string][]byte{
+		"indexes/index.cdxj": []byte(
+			`com,example)/ 20260401000000 {"url":"https://example.com/","digest":"sha256:aaa","mime":"text/html","status":"200"}` + "\n" +
+				"!meta 0 header\n",
+		),
+		"indexes/extra.cdx.gz": gzipBytes(t, `com,example)/app.js 20260401000001 {"url":"https://example.com/app.js","digest":"sha256:bbb","mime":"application/javascript","status":"200"}`+"\n"),
+		"indexes/index.idx":    []byte("ignored"),
+		"pages/pages.jsonl": []byte(
+			`{"format":"json-pages-1.0","id":"pages","title":"All Pages"}` + "\n" +
+				`{"id":"1","url":"https://example.com/","title":"Example","ts":"2026-04-01T00:00:00Z","text":"hello"}` + "\n",
+		),
+		"pages/extraPages.jsonl": []byte(
+			`{"format":"json-pages-1.0","id":"extra-pages","title":"Extra Pages"}` + "\n" +
+				`{"id":"2","url":"https://example.com/about","title":"About","text":"about us"}` + "\n",
+		),
+	})
+
+	reader, err := Open(path)
+	if err != nil {
+		t.Fatalf("open wacz: %v", err)
+	}
+	defer reader.Close()
+
+	records, err := reader.IndexRecords()
+	if err != nil {
+		t.Fatalf("read index records: %v", err)
+	}
+	digests := latestDigests(records)
+	if len(digests) != 2 || digests["https://example.com/"] != "sha256:aaa" || digests["https://example.com/app.js"] != "sha256:bbb" {
+		t.Fatalf("unexpected index records: %#v", records)
+	}
+
+	pages, err := reader.Pages()
+	if err != nil {
+		t.Fatalf("read pages: %v", err)
+	}
+	if len(pages) != 2 || pages[0].Text != "hello" || pages[1].URL != "https://example.com/about" {
+		t.Fatalf("unexpected pages: %#v", pages)
+	}
+}
+
+func TestIndexRecordIsResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		record IndexRecord
+		want   bool
+	}{
+		{name: "response", record: IndexRecord{URL: "https://example.com/", Digest: "sha256:aaa", Status: "200"}, want: true},
+		{name: "revisit", record: IndexRecord{URL: "https://example.com/", Digest: "sha256:aaa", Mime: "warc/revisit", Status: "200"}, want: true},
+		{name: "page info", record: IndexRecord{URL: "urn:pageinfo:https://example.com/", Digest: "sha256:bbb", Mime: "application/json"}, want: false},
+		{name: "request", record: IndexRecord{URL: "https://example.com/", Digest: "sha256:ccc"}, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.record.IsResponse(); got != tt.want {
+			t.Errorf("%s: IsResponse() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOpenRejectsNonZipFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.wacz")
+	if err := os.WriteFile(path, []byte("not a zip"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Fatal("expected error opening non-zip file")
+	}
+}
+
+func TestReaderMetadata(t *testing.T) {
+	dir := t.TempDir()
+	pages := []byte(
+		`{"format":"json-pages-1.0","id":"pages","title":"All Pages"}` + "\n" +
+			`{"id":"1","url":"https://example.com/start","title":"Start Page","ts":"2026-04-01T10:00:00Z"}` + "\n" +
+			`{"id":"2","url":"https://example.com/seed","title":"Seed Page","ts":"2026-04-02T10:00:00.5+02:00","seed":true}` + "\n",
+	)
+
+	tests := []struct {
+		name  string
+		files map[string][]byte
+		want  Metadata
+	}{
+		{
+			name: "datapackage",
+			files: map[string][]byte{
+				"datapackage.json":  []byte(`{"title":" My Collection ","mainPageURL":"https://example.com/main","created":"2026-03-01T12:30:00Z","software":"Browsertrix-Crawler 1.5.0"}`),
+				"pages/pages.jsonl": pages,
+			},
+			want: Metadata{Title: "My Collection", SourceURL: "https://example.com/main", CreatedAt: time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC), Software: "Browsertrix-Crawler 1.5.0"},
+		},
+		{
+			name: "seed page",
+			files: map[string][]byte{
+				"datapackage.json":  []byte(`{"profile":"data-package","software":"py-wacz"}`),
+				"pages/pages.jsonl": pages,
+			},
+			want: Metadata{Title: "Seed Page", SourceURL: "https://example.com/seed", CreatedAt: time.Date(2026, 4, 2, 8, 0, 0, 500000000, time.UTC), Software: "py-wacz"},
+		},
+		{
+			name: "first page",
+			files: map[string][]byte{
+				"pages/pages.jsonl": []byte(`{"id":"1","url":"https://example.com/start","title":"Start Page","ts":"2026-04-01T10:00:00Z"}` + "\n"),
+			},
+			want: Metadata{Title: "Start Page", SourceURL: "https://example.com/start", CreatedAt: time.Date(2026, 4, 1, 10, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:  "empty",
+			files: map[string][]byte{"archive/data.warc.gz": []byte("warc")},
+			want:  Metadata{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".wacz")
+			writeTestWACZ(t, path, tt.files)
+
+			reader, err := Open(path)
+			if err != nil {
+				t.Fatalf("open wacz: %v", err)
+			}
+			defer reader.Close()
+
+			got, err := reader.Metadata()
+			if err != nil {
+				t.Fatalf("read metadata: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("metadata = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
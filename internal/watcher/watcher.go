@@ -0,0 +1,142 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/storage"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/fsnotify/fsnotify"
+)
+
+const pollInterval = 30 * time.Second
+
+// Watcher keeps the database in step with archive files added to or removed
+// from a local archives directory while the API runs.
+type Watcher struct {
+	archiveStore store.Store
+	storage      *storage.Local
+	describe     func(ctx context.Context, filename string) (store.FileDetails, error)
+	pending      func(ctx context.Context) (map[string]bool, error)
+	settle       time.Duration
+	poll         time.Duration
+}
+
+func NewWatcher(archiveStore store.Store, backend *storage.Local, describe func(ctx context.Context, filename string) (store.FileDetails, error)) *Watcher {
+	return &Watcher{
+		archiveStore: archiveStore,
+		storage:      backend,
+		describe:     describe,
+		settle:       store.SyncSettleTime,
+		poll:         pollInterval,
+	}
+}
+
+// SetPending sets the lookup of files whose completion is not recorded
+// yet, which are left alone until it is.
+func (w *Watcher) SetPending(pending func(ctx context.Context) (map[string]bool, error)) {
+	w.pending = pending
+}
+
+// Start syncs the database whenever archive files change, until ctx is
+// cancelled. It polls the directory instead when it cannot be watched, as
+// on some network file systems.
+func (w *Watcher) Start(ctx context.Context) {
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		err = fsWatcher.Add(w.storage.Dir())
+		if err != nil {
+			_ = fsWatcher.Close()
+		}
+	}
+	if err != nil {
+		slog.Warn("cannot watch archives directory, polling it instead", "dir", w.storage.Dir(), "interval", w.poll, "error", err)
+		w.startPolling(ctx)
+		return
+	}
+	defer fsWatcher.Close()
+
+	slog.Info("watching archives directory", "dir", w.storage.Dir())
+
+	timer := time.NewTimer(w.settle)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-fsWatcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Chmod) || !strings.EqualFold(filepath.Ext(event.Name), ".wacz") {
+				continue
+			}
+			timer.Reset(w.settle)
+		case err, ok := <-fsWatcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("archives directory watcher error", "error", err)
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				timer.Reset(w.settle)
+			}
+		case <-timer.C:
+			if w.sync(ctx) {
+				// Files still settling raise no further events once
+				// written, so they are checked again.
+				timer.Reset(w.settle / 4)
+			}
+		}
+	}
+}
+
+func (w *Watcher) startPolling(ctx context.Context) {
+	ticker := time.NewTicker(w.poll)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.sync(ctx)
+		}
+	}
+}
+
+// sync reconciles the database with the directory and reports whether some
+// files were too recent to register.
+func (w *Watcher) sync(ctx context.Context) bool {
+	report, err := w.archiveStore.SyncFromDisk(ctx, w.storage, store.SyncOptions{
+		ModifiedBefore: time.Now().Add(-w.settle),
+		Pending:        w.pending,
+		Describe:       w.describe,
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Error("failed to sync archives directory", "error", err)
+		}
+		return false
+	}
+
+	for _, change := range report.Added {
+		slog.Info("registered archive file", "archive_id", change.ArchiveID, "filename", change.Filename)
+	}
+	for _, change := range report.Renamed {
+		slog.Info("archive file renamed", "archive_id", change.ArchiveID, "filename", change.Filename, "previous_filename", change.PreviousFilename)
+	}
+	for _, change := range report.Resized {
+		slog.Info("archive file size changed", "archive_id", change.ArchiveID, "filename", change.Filename, "size_bytes", change.SizeBytes)
+	}
+	if len(report.Missing) > 0 {
+		slog.Warn("archive files missing from archives directory", "count", len(report.Missing))
+	}
+
+	return len(report.Deferred) > 0
+}
@@ -0,0 +1,90 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/JuanSaenz04/archiver/internal/storage"
+	"github.com/JuanSaenz04/archiver/internal/store"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStore(t *testing.T) *store.ArchiveStore {
+	t.Helper()
+
+	s, err := store.Open("file:" + uuid.NewString() + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := s.Close(); err != nil {
+			t.Fatalf("close store: %v", err)
+		}
+	})
+	if err := s.RunMigrations(); err != nil {
+		t.Fatalf("run migrations: %v", err)
+	}
+	return s
+}
+
+func describeExample(ctx context.Context, filename string) (store.FileDetails, error) {
+	return store.FileDetails{Name: "Example", SourceURL: "https://example.com/", Subject: "https://example.com"}, nil
+}
+
+func TestWatcherRegistersAndFlagsArchiveFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		start func(w *Watcher, ctx context.Context)
+	}{
+		{name: "events", start: (*Watcher).Start},
+		{name: "polling", start: (*Watcher).startPolling},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			dir := t.TempDir()
+			w := NewWatcher(s, storage.NewLocal(dir), describeExample)
+			w.settle = 50 * time.Millisecond
+			w.poll = 20 * time.Millisecond
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				tt.start(w, ctx)
+			}()
+			t.Cleanup(func() {
+				cancel()
+				<-done
+			})
+
+			// Give the watcher time to start watching the directory.
+			time.Sleep(50 * time.Millisecond)
+			archivePath := filepath.Join(dir, "copied.wacz")
+			assert.NoError(t, os.WriteFile(archivePath, []byte("archive"), 0644))
+			assert.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0644))
+
+			assert.Eventually(t, func() bool {
+				archives, err := s.List(ctx)
+				return err == nil && len(archives) == 1
+			}, 2*time.Second, 10*time.Millisecond)
+
+			archives, err := s.List(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, "Example", archives[0].Name)
+			assert.Equal(t, "copied.wacz", archives[0].Filename)
+			assert.Equal(t, "https://example.com/", archives[0].SourceURL)
+
+			assert.NoError(t, os.Remove(archivePath))
+			assert.Eventually(t, func() bool {
+				archive, err := s.Get(ctx, archives[0].ID)
+				return err == nil && archive.MissingAt != nil
+			}, 2*time.Second, 10*time.Millisecond)
+		})
+	}
+}